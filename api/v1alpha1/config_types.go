@@ -13,8 +13,40 @@ const (
 	StoreTypeDirectory           = "directory"
 	StoreTypeCRD                 = "crd"
 	StoreTypeVerifiedPermissions = "verifiedPermissions"
+
+	// Entity stores load Cedar entities that are added to requests, rather than policies
+	StoreTypeEntityDirectory = "entityDirectory"
+	StoreTypeEntityCRD       = "entityCRD"
+)
+
+// Combining algorithms set how a policy store tier's decision is combined with later tiers
+const (
+	// CombiningFirstApplicable returns the decision of the first tier where any
+	// policy applies. This is the default.
+	CombiningFirstApplicable = "firstApplicable"
+	// CombiningDenyOverrides allows requests permitted by the tier unless a
+	// forbid policy in a later tier applies
+	CombiningDenyOverrides = "denyOverrides"
+	// CombiningForbidOnly ignores permit policies in the tier, so it can only deny requests
+	CombiningForbidOnly = "forbidOnly"
+)
+
+// Error modes set how evaluation errors in a policy store tier are handled
+const (
+	// OnErrorSkip ignores policies with errors, and continues evaluating the tier and later tiers
+	OnErrorSkip = "skip"
+	// OnErrorDeny denies the request if any policy in the tier has an error
+	OnErrorDeny = "deny"
+	// OnErrorNoOpinion stops evaluating at the tier. If any policy in the tier
+	// applied its decision is returned, otherwise no decision is made. This is the default.
+	OnErrorNoOpinion = "noOpinion"
 )
 
+// IsEntityStore returns true if the store type loads entities instead of policies
+func IsEntityStore(storeType string) bool {
+	return storeType == StoreTypeEntityDirectory || storeType == StoreTypeEntityCRD
+}
+
 type Duration time.Duration
 
 func (d Duration) MarshalJSON() ([]byte, error) {
@@ -53,31 +85,82 @@ type CedarConfig struct {
 }
 
 func (c *CedarConfig) Validate() error {
-	for i, storeDef := range c.Spec.Stores {
+	for i := range c.Spec.Stores {
 		storeId := fmt.Sprintf(".spec.stores[%d]: ", i)
-		err := storeDef.Validate()
+		err := c.Spec.Stores[i].Validate()
 		if err != nil {
 			return errors.New(storeId + err.Error())
 		}
 	}
+	if c.Spec.Authorizer != nil {
+		for i, rule := range c.Spec.Authorizer.PrincipalRules {
+			ruleId := fmt.Sprintf(".spec.authorizer.principalRules[%d]: ", i)
+			err := rule.Validate()
+			if err != nil {
+				return errors.New(ruleId + err.Error())
+			}
+		}
+	}
+	if c.Spec.ClusterMetadata != nil {
+		err := c.Spec.ClusterMetadata.Validate()
+		if err != nil {
+			return errors.New(".spec.clusterMetadata: " + err.Error())
+		}
+	}
+	if c.Spec.Admission != nil {
+		err := c.Spec.Admission.Validate()
+		if err != nil {
+			return errors.New(".spec.admission: " + err.Error())
+		}
+	}
 	return nil
 }
 
 type ConfigSpec struct {
 	//+required
 	Stores []StoreConfig `json:"stores"`
+	//+optional
+	Authorizer *AuthorizerConfig `json:"authorizer,omitempty"`
+	//+optional
+	ClusterMetadata *ClusterMetadataConfig `json:"clusterMetadata,omitempty"`
+	//+optional
+	Admission *AdmissionConfig `json:"admission,omitempty"`
+	// DisableNamespaceEntities disables watching Namespaces to add k8s::Namespace
+	// entities to requests. Namespace entities are still added as resource parents,
+	// but without labels or annotations.
+	//+optional
+	DisableNamespaceEntities bool `json:"disableNamespaceEntities,omitempty"`
+	// EnablePrincipalEnrichment enables watching ServiceAccounts and Nodes to add
+	// their labels and annotations to k8s::ServiceAccount and k8s::Node principals
+	//+optional
+	EnablePrincipalEnrichment bool `json:"enablePrincipalEnrichment,omitempty"`
 }
 
+// StoreConfig configures a policy store, or an entity store. Policy stores are
+// evaluated in order as tiers. Entity stores add their entities to every request,
+// with earlier entity stores taking precedence.
 type StoreConfig struct {
-	//+kubebuilder:validation:Enum=directory;crd;verifiedPermissions
+	//+kubebuilder:validation:Enum=directory;crd;verifiedPermissions;entityDirectory;entityCRD
 	//+required
 	Type string `json:"type"`
+	// DirectoryStore configures directory and entityDirectory stores
 	//+optional
 	DirectoryStore DirectoryStoreConfig `json:"directoryStore,omitempty"`
+	// CRDStore configures crd and entityCRD stores
 	//+optional
 	CRDStore CRDStoreConfig `json:"crdStore,omitempty"`
 	//+optional
 	VerifiedPermissionsStore VerifiedPermissionsStoreConfig `json:"verifiedPermissionsStore,omitempty"`
+	// Combining sets how the decision of a policy store is combined with later
+	// policy stores. Defaults to firstApplicable.
+	//+kubebuilder:validation:Enum=firstApplicable;denyOverrides;forbidOnly
+	//+optional
+	Combining string `json:"combining,omitempty"`
+	// OnError sets how evaluation errors in a policy store are handled.
+	// Defaults to noOpinion.
+	//+kubebuilder:validation:Enum=skip;deny;noOpinion
+	//+optional
+	OnError string `json:"onError,omitempty"`
 }
 
 type DirectoryStoreConfig struct {
@@ -104,8 +187,21 @@ type VerifiedPermissionsStoreConfig struct {
 }
 
 func (c *StoreConfig) Validate() error {
+	if IsEntityStore(c.Type) && (c.Combining != "" || c.OnError != "") {
+		return errors.New("combining and onError are not supported for entity stores")
+	}
+	switch c.Combining {
+	case "", CombiningFirstApplicable, CombiningDenyOverrides, CombiningForbidOnly:
+	default:
+		return fmt.Errorf("invalid store combining %q", c.Combining)
+	}
+	switch c.OnError {
+	case "", OnErrorSkip, OnErrorDeny, OnErrorNoOpinion:
+	default:
+		return fmt.Errorf("invalid store onError %q", c.OnError)
+	}
 	switch c.Type {
-	case StoreTypeDirectory:
+	case StoreTypeDirectory, StoreTypeEntityDirectory:
 		if c.DirectoryStore.Path == "" {
 			return errors.New("directory store path is required")
 		}
@@ -120,7 +216,7 @@ func (c *StoreConfig) Validate() error {
 			defaultDur := Duration(time.Minute * 1)
 			c.DirectoryStore.RefreshInterval = &defaultDur
 		}
-	case StoreTypeCRD:
+	case StoreTypeCRD, StoreTypeEntityCRD:
 		// no-op
 	case StoreTypeVerifiedPermissions:
 		if c.VerifiedPermissionsStore.PolicyStoreID == "" {
@@ -143,3 +239,202 @@ func (c *StoreConfig) Validate() error {
 	}
 	return nil
 }
+
+const (
+	PrincipalRuleActionNoOpinion = "noOpinion"
+	PrincipalRuleActionAllow     = "allow"
+	PrincipalRuleActionEvaluate  = "evaluate"
+)
+
+// AuthorizerConfig configures the authorization webhook
+type AuthorizerConfig struct {
+	// PrincipalRules are matched in order against each authorization request
+	// before any policies are evaluated, and the first matching rule's action is used.
+	// Requests that match no rule are evaluated.
+	// When no rules are specified, DefaultPrincipalRules() are used.
+	//+optional
+	PrincipalRules []PrincipalRule `json:"principalRules,omitempty"`
+}
+
+// PrincipalRule matches authorization requests by principal, and optionally by resource.
+// All specified matchers must match for a rule to apply. Within a matcher any value may match.
+type PrincipalRule struct {
+	// Users matches requests from any of the exact usernames
+	//+optional
+	Users []string `json:"users,omitempty"`
+	// Groups matches requests from principals in any of the groups
+	//+optional
+	Groups []string `json:"groups,omitempty"`
+	// UserPrefixes matches requests from any username with one of the prefixes
+	//+optional
+	UserPrefixes []string `json:"userPrefixes,omitempty"`
+
+	// ReadOnly only matches read-only requests (get, list, watch) when true
+	//+optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// APIGroups matches resource requests for any of the API groups
+	//+optional
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// Resources matches resource requests for any of the resources
+	//+optional
+	Resources []string `json:"resources,omitempty"`
+
+	//+kubebuilder:validation:Enum=noOpinion;allow;evaluate
+	//+required
+	Action string `json:"action"`
+	// Reason is returned with allow decisions
+	//+optional
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r *PrincipalRule) Validate() error {
+	switch r.Action {
+	case PrincipalRuleActionNoOpinion, PrincipalRuleActionAllow, PrincipalRuleActionEvaluate:
+	default:
+		return errors.New("invalid principal rule action")
+	}
+	if len(r.Users) == 0 && len(r.Groups) == 0 && len(r.UserPrefixes) == 0 {
+		return errors.New("principal rule must specify at least one of users, groups, or userPrefixes")
+	}
+	return nil
+}
+
+// DefaultPrincipalRules returns the principal rules used when none are configured.
+//
+// The cedar authorizer's own identity is always allowed to read policies,
+// entity sets, RBAC objects, namespaces, service accounts, and nodes, and
+// system users other than service accounts and nodes are not evaluated, to
+// help from accidentally halting normal cluster operations.
+func DefaultPrincipalRules(authorizerIdentity string) []PrincipalRule {
+	return []PrincipalRule{
+		{
+			Users:     []string{authorizerIdentity},
+			ReadOnly:  true,
+			APIGroups: []string{GroupVersion.Group},
+			Resources: []string{"policies", "entitysets"},
+			Action:    PrincipalRuleActionAllow,
+			Reason:    "cedar authorizer is always allowed to access policies and entity sets",
+		},
+		{
+			Users:     []string{authorizerIdentity},
+			ReadOnly:  true,
+			APIGroups: []string{"rbac.authorization.k8s.io"},
+			Action:    PrincipalRuleActionAllow,
+			Reason:    "cedar authorizer is always allowed to read RBAC policies",
+		},
+		{
+			Users:     []string{authorizerIdentity},
+			ReadOnly:  true,
+			APIGroups: []string{""},
+			Resources: []string{"namespaces", "serviceaccounts", "nodes"},
+			Action:    PrincipalRuleActionAllow,
+			Reason:    "cedar authorizer is always allowed to read namespaces and principals",
+		},
+		{
+			UserPrefixes: []string{"system:serviceaccount:", "system:node:"},
+			Action:       PrincipalRuleActionEvaluate,
+		},
+		{
+			UserPrefixes: []string{"system:"},
+			Action:       PrincipalRuleActionNoOpinion,
+		},
+	}
+}
+
+// ClusterMetadataConfig is metadata about the cluster added to the context of
+// every evaluated authorization and admission request as `context.cluster`
+type ClusterMetadataConfig struct {
+	//+optional
+	Name string `json:"name,omitempty"`
+	//+optional
+	ARN string `json:"arn,omitempty"`
+	//+optional
+	Region string `json:"region,omitempty"`
+	//+optional
+	AccountID string `json:"accountId,omitempty"`
+	//+optional
+	PlatformVersion string `json:"platformVersion,omitempty"`
+	//+optional
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// DisableVersionDiscovery disables discovering the Kubernetes version from the API server
+	//+optional
+	DisableVersionDiscovery bool `json:"disableVersionDiscovery,omitempty"`
+	// VersionRefreshInterval is how often the Kubernetes version is refreshed from the API server
+	//+optional
+	VersionRefreshInterval *Duration `json:"versionRefreshInterval,omitempty"`
+}
+
+func (c *ClusterMetadataConfig) Validate() error {
+	if c.VersionRefreshInterval != nil {
+		if *c.VersionRefreshInterval < Duration(time.Second*30) {
+			return errors.New("version refresh interval must be at least 30s")
+		}
+		if *c.VersionRefreshInterval > Duration(time.Hour*24*7) {
+			return errors.New("version refresh interval must be under 1 week (168h)")
+		}
+	} else {
+		defaultDur := Duration(time.Minute * 10)
+		c.VersionRefreshInterval = &defaultDur
+	}
+	return nil
+}
+
+// DefaultExcludedNamespaces are the namespaces excluded from admission
+// policies when excludedNamespaces isn't set
+var DefaultExcludedNamespaces = []string{"kube-system", "cedar-k8s-authz-system"}
+
+// AdmissionConfig configures the admission webhook.
+//
+// Requests that match any exclusion are allowed without evaluating admission policies.
+type AdmissionConfig struct {
+	// ExcludedNamespaces are namespaces whose requests are excluded.
+	// When unset, DefaultExcludedNamespaces are excluded. Set to an empty
+	// list to evaluate requests in every namespace.
+	//+optional
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// ExcludedNamespaceSelectors exclude requests in namespaces with labels
+	// matching any of the selectors. Requests for cluster-scoped resources never match.
+	//+optional
+	ExcludedNamespaceSelectors []metav1.LabelSelector `json:"excludedNamespaceSelectors,omitempty"`
+	// ExcludedResources exclude requests for objects of any of the kinds
+	//+optional
+	ExcludedResources []AdmissionResourceExclusion `json:"excludedResources,omitempty"`
+	// ExcludedUsers exclude requests from any of the exact usernames
+	//+optional
+	ExcludedUsers []string `json:"excludedUsers,omitempty"`
+	// ExcludedGroups exclude requests from users in any of the groups
+	//+optional
+	ExcludedGroups []string `json:"excludedGroups,omitempty"`
+}
+
+// AdmissionResourceExclusion matches the kind of an admission request's object
+type AdmissionResourceExclusion struct {
+	// Group is the API group of the kind. The core API group is "".
+	//+optional
+	Group string `json:"group,omitempty"`
+	// Version is the API version of the kind. All versions match when unset.
+	//+optional
+	Version string `json:"version,omitempty"`
+	//+required
+	Kind string `json:"kind"`
+}
+
+// Matches returns true if the exclusion matches the group, version, and kind
+func (e AdmissionResourceExclusion) Matches(gvk metav1.GroupVersionKind) bool {
+	return e.Group == gvk.Group && (e.Version == "" || e.Version == gvk.Version) && e.Kind == gvk.Kind
+}
+
+func (c *AdmissionConfig) Validate() error {
+	for i := range c.ExcludedNamespaceSelectors {
+		if _, err := metav1.LabelSelectorAsSelector(&c.ExcludedNamespaceSelectors[i]); err != nil {
+			return fmt.Errorf("excludedNamespaceSelectors[%d]: %w", i, err)
+		}
+	}
+	for i, resource := range c.ExcludedResources {
+		if resource.Kind == "" {
+			return fmt.Errorf("excludedResources[%d]: kind is required", i)
+		}
+	}
+	return nil
+}
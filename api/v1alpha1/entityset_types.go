@@ -0,0 +1,51 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EntitySetSpec defines the desired state of EntitySet
+type EntitySetSpec struct {
+	// Content is a Cedar entities JSON array, such as groups with parent groups
+	// or user attributes
+	//+required
+	Content string `json:"content"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// EntitySet is the Schema for the entitysets API. Entities in an EntitySet are
+// added to authorization and admission requests by an entity store.
+type EntitySet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	//+required
+	Spec EntitySetSpec `json:"spec"`
+}
+
+//+kubebuilder:object:root=true
+
+// EntitySetList contains a list of EntitySet
+type EntitySetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EntitySet `json:"items"`
+}
@@ -37,5 +37,6 @@ var (
 
 func init() {
 	SchemeBuilder.Register(&PolicyList{}, &Policy{})
+	SchemeBuilder.Register(&EntitySetList{}, &EntitySet{})
 	SchemeBuilder.Register(&CedarConfig{})
 }
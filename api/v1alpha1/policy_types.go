@@ -24,6 +24,16 @@ const (
 	StrictValidationMode     = "strict"
 	PermissiveValidationMode = "permissive"
 	PartialValidationMode    = "partial"
+
+	// EnforcementModeEnforce policies participate in decisions. This is the default.
+	EnforcementModeEnforce = "enforce"
+	// EnforcementModeAudit policies are evaluated, but never change a decision.
+	// The "would have" decision is logged and counted instead.
+	EnforcementModeAudit = "audit"
+	// EnforcementModeWarn policies never change a decision. When a warn forbid
+	// policy applies to an admission request, its message is returned as a
+	// warning. Warn policies aren't evaluated for authorization requests.
+	EnforcementModeWarn = "warn"
 )
 
 // PolicyValidation defines the
@@ -55,6 +65,18 @@ type PolicySpec struct {
 	// Validation
 	//+required
 	Validation PolicyValidation `json:"validation"`
+
+	// Enforcement indicates if the policies are enforced, audit-only, or warn.
+	// Audit policies are evaluated but never change a decision, the decision they
+	// would have made is logged and counted instead.
+	// Warn policies never change a decision, forbid policies that apply to an
+	// admission request add their message to the response's warnings instead.
+	// Individual policies can also be marked audit-only with the `@enforcement("audit")`
+	// annotation, or warn with the `@effect("warn")` annotation.
+	//+kubebuilder:validation:Enum=enforce;audit;warn
+	//+kubebuilder:default:value=enforce
+	//+optional
+	Enforcement string `json:"enforcement,omitempty"`
 }
 
 // PolicyStatus defines the observed state of Policy
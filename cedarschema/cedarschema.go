@@ -0,0 +1,12 @@
+// Package cedarschema contains the Cedar schemas generated for Kubernetes
+package cedarschema
+
+import (
+	_ "embed"
+)
+
+// K8sFullJSON is the combined authorization and admission schema of built-in
+// Kubernetes types, in the Cedar JSON schema format
+//
+//go:embed k8s-full.cedarschema.json
+var K8sFullJSON []byte
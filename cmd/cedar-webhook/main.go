@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"sync/atomic"
+	"time"
 
-	"github.com/cedar-policy/cedar-go"
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/component-base/cli"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/cli/globalflag"
@@ -22,14 +27,16 @@ import (
 	"k8s.io/component-base/version/verflag"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
-	cradmission "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server"
-	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
-	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/clientconfig"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
 	serveroptions "github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 )
 
 var (
@@ -82,6 +89,9 @@ func NewAuthorizerCommand() *cobra.Command {
 	cols, _, _ := term.TerminalSize(cmd.OutOrStdout())
 	cliflag.SetUsageAndHelpFunc(cmd, *namedFlagSets, cols)
 
+	cmd.AddCommand(NewRulesCommand())
+	cmd.AddCommand(NewReplayCommand())
+
 	return cmd
 }
 
@@ -91,6 +101,26 @@ func Run(config *config.AuthorizationWebhookConfig) error {
 	defer func() { cancel() }()
 	klog.InfoS("Starting cedar-webhook", "version", version.Get())
 
+	tracerProvider, err := tracing.NewProvider(ctx, config.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to create tracer provider: %w", err)
+	}
+	defer func() {
+		if err := tracerProvider.Shutdown(context.Background()); err != nil {
+			klog.ErrorS(err, "Failed to flush traces")
+		}
+	}()
+
+	decisionLog, err := decisionlog.New(config.DecisionLog)
+	if err != nil {
+		return fmt.Errorf("failed to create decision log: %w", err)
+	}
+	defer func() {
+		if err := decisionLog.Close(); err != nil {
+			klog.ErrorS(err, "Failed to close decision log")
+		}
+	}()
+
 	storeContent, err := os.ReadFile(config.StoreConfig)
 	if err != nil {
 		return fmt.Errorf("failed to read store config: %w", err)
@@ -105,24 +135,53 @@ func Run(config *config.AuthorizationWebhookConfig) error {
 		return err
 	}
 	klog.InfoS("Successfully loaded policy store config", "count", len(stores), "file", config.StoreConfig)
+	entityStores, err := store.CedarConfigEntityStores(cfg)
+	if err != nil {
+		return err
+	}
 
-	authorizer := authorizer.NewAuthorizer(stores...)
-
-	pset := cedar.NewPolicySet()
-	pset.Add("allow-all-admission", admission.AllowAllAdmissionPolicy())
-	stores = append(stores, store.StaticStore(*pset))
+	clusterMetadata := entities.NewClusterMetadata(cfg.Spec.ClusterMetadata)
+	if clusterMetadata != nil && !cfg.Spec.ClusterMetadata.DisableVersionDiscovery {
+		go func() {
+			restConfig, err := clientconfig.Load("")
+			if err != nil {
+				klog.ErrorS(err, "Failed to load client config for Kubernetes version discovery")
+				return
+			}
+			client, err := discovery.NewDiscoveryClientForConfig(restConfig)
+			if err != nil {
+				klog.ErrorS(err, "Failed to create discovery client for Kubernetes version discovery")
+				return
+			}
+			clusterMetadata.DiscoverKubernetesVersion(ctx, client, time.Duration(*cfg.Spec.ClusterMetadata.VersionRefreshInterval))
+		}()
+	}
 
-	// We add a default allow-all admission policy as a static store at the end
-	vWebhook := &cradmission.Webhook{Handler: admission.NewHandler(store.TieredPolicyStores(stores), true)}
+	webhooks := newWebhooks(config, decisionLog, clusterMetadata, storeContent, cfg, stores, entityStores)
+	informersSynced := &atomic.Bool{}
+	go func() {
+		// Loading the client config blocks until the kubeconfig exists, so the
+		// webhooks serve requests without informers until their caches sync
+		informers, err := startInformers(ctx, cfg.Spec)
+		if err != nil {
+			klog.ErrorS(err, "Failed to watch namespaces and principals, entities will not have labels or annotations")
+		} else {
+			webhooks.setInformers(informers)
+		}
+		informersSynced.Store(true)
+	}()
+	if config.StoreConfigReload != nil {
+		go webhooks.watch(ctx, config.StoreConfigReload)
+	}
 	ctrl.SetLogger(logr.FromSlogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})))
 
-	srv := server.NewServer(authorizer, vWebhook, config)
+	srv := server.NewServer(webhooks.authorizer, webhooks.admission, config)
 	serverShutdownCh, listenerStoppedCh, err := config.SecureServing.Serve(srv.GetHandler(), 0, server.DeriveStopChannel(ctx))
 	if err != nil {
 		return err
 	}
 	go func() {
-		s := server.NewMetricsServer()
+		s := server.NewMetricsServer(webhooks.Stores, informersSynced.Load)
 		if err := s.ListenAndServe(); err != nil {
 			klog.ErrorS(err, "Failed to start metrics server")
 			// If we fail to set up metrics then shutdown the server
@@ -138,3 +197,60 @@ func Run(config *config.AuthorizationWebhookConfig) error {
 
 	return nil
 }
+
+// webhookInformers are the informer caches used to evaluate requests
+type webhookInformers struct {
+	// namespaceLister is nil unless namespace entities or admission namespace
+	// selectors are enabled
+	namespaceLister corev1listers.NamespaceLister
+	// namespaces is nil if namespace entities are disabled
+	namespaces *entities.Namespaces
+	// principals is nil if principal enrichment is disabled
+	principals *entities.Principals
+}
+
+// watchesNamespaces returns true if namespaces are watched for namespace
+// entities or admission namespace selectors
+func watchesNamespaces(spec v1alpha1.ConfigSpec) bool {
+	return !spec.DisableNamespaceEntities || (spec.Admission != nil && len(spec.Admission.ExcludedNamespaceSelectors) > 0)
+}
+
+// startInformers starts the informers used to add namespace entities and
+// principal attributes to requests, and to match admission namespace
+// selectors. It blocks until the kubeconfig exists and the informer caches
+// have synced.
+func startInformers(ctx context.Context, spec v1alpha1.ConfigSpec) (webhookInformers, error) {
+	resp := webhookInformers{}
+	watchNamespaces := watchesNamespaces(spec)
+	if !watchNamespaces && !spec.EnablePrincipalEnrichment {
+		return resp, nil
+	}
+	restConfig, err := clientconfig.Load("")
+	if err != nil {
+		return resp, fmt.Errorf("failed to load client config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return resp, fmt.Errorf("failed to create client: %w", err)
+	}
+	factory := informers.NewSharedInformerFactory(client, 0)
+	if watchNamespaces {
+		resp.namespaceLister = factory.Core().V1().Namespaces().Lister()
+	}
+	if !spec.DisableNamespaceEntities {
+		resp.namespaces = entities.NewNamespaces(resp.namespaceLister)
+	}
+	if spec.EnablePrincipalEnrichment {
+		resp.principals = entities.NewPrincipals(
+			factory.Core().V1().ServiceAccounts().Lister(),
+			factory.Core().V1().Nodes().Lister(),
+		)
+	}
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return webhookInformers{}, fmt.Errorf("failed to sync %v informer cache", informerType)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/cedar-policy/cedar-go"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// webhooks creates the authorizer and admission handler for the stores of a
+// store config, and swaps them in when the store config file changes
+type webhooks struct {
+	config          *config.AuthorizationWebhookConfig
+	decisionLog     *decisionlog.Logger
+	clusterMetadata *entities.ClusterMetadata
+
+	authorizer *authorizer.ReloadableAuthorizer
+	admission  *admission.ReloadableHandler
+
+	// spec is the store config the webhook started with
+	spec v1alpha1.ConfigSpec
+
+	mu sync.RWMutex
+	// content is the store config file the stores were created from, and
+	// rejected is the last content that failed to parse or validate
+	content      []byte
+	rejected     []byte
+	storeConfig  *v1alpha1.CedarConfig
+	stores       store.TieredPolicyStores
+	entityStores store.TieredEntityStores
+	// informers are empty until their caches have synced
+	informers webhookInformers
+}
+
+// newWebhooks creates the webhooks for the stores of the store config in
+// content. The webhooks don't use informers until setInformers is called.
+func newWebhooks(
+	cfg *config.AuthorizationWebhookConfig,
+	decisionLog *decisionlog.Logger,
+	clusterMetadata *entities.ClusterMetadata,
+	content []byte,
+	storeConfig *v1alpha1.CedarConfig,
+	stores store.TieredPolicyStores,
+	entityStores store.TieredEntityStores,
+) *webhooks {
+	resp := &webhooks{
+		config:          cfg,
+		decisionLog:     decisionLog,
+		clusterMetadata: clusterMetadata,
+		content:         content,
+		storeConfig:     storeConfig,
+		spec:            storeConfig.Spec,
+		stores:          stores,
+		entityStores:    entityStores,
+	}
+	authz, handler := resp.build(storeConfig, stores, entityStores)
+	resp.authorizer = authorizer.NewReloadableAuthorizer(authz)
+	resp.admission = admission.NewReloadableHandler(handler)
+	return resp
+}
+
+// setInformers rebuilds the webhooks with informers whose caches have synced
+func (w *webhooks) setInformers(informers webhookInformers) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.informers = informers
+	authz, handler := w.build(w.storeConfig, w.stores, w.entityStores)
+	w.authorizer.Set(authz)
+	w.admission.Set(handler)
+}
+
+// build creates an authorizer and admission handler for stores. Each
+// authorizer has its own decision cache, so decisions cached with the previous
+// stores are never returned. Callers other than newWebhooks must hold w.mu.
+func (w *webhooks) build(storeConfig *v1alpha1.CedarConfig, stores store.TieredPolicyStores, entityStores store.TieredEntityStores) (authorizer.Authorizer, admission.Handler) {
+	authz := authorizer.NewAuthorizer(storeConfig.Spec.Authorizer, authorizer.Options{
+		DecisionCache:   w.config.DecisionCache,
+		Evaluation:      w.config.AuthorizationEvaluation,
+		DecisionLog:     w.decisionLog,
+		ClusterMetadata: w.clusterMetadata,
+		Namespaces:      w.informers.namespaces,
+		Principals:      w.informers.principals,
+		EntityStores:    entityStores,
+	}, stores...)
+
+	// We add a default allow-all admission policy as a static store at the end
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", admission.AllowAllAdmissionPolicy())
+	admissionStores := append(append(store.TieredPolicyStores{}, stores...), store.StaticStore(*pset))
+	handler := admission.NewHandler(admissionStores, admission.Options{
+		Exclusions:      admission.NewExclusions(storeConfig.Spec.Admission, w.informers.namespaceLister),
+		ResourceSchema:  w.config.AdmissionSchema,
+		Evaluation:      w.config.AdmissionEvaluation,
+		DecisionLog:     w.decisionLog,
+		ClusterMetadata: w.clusterMetadata,
+		Namespaces:      w.informers.namespaces,
+		Principals:      w.informers.principals,
+		EntityStores:    entityStores,
+	})
+	return authz, handler
+}
+
+// Stores returns the configured stores in use, without the admission store.
+// Health and status endpoints report these stores.
+func (w *webhooks) Stores() (store.TieredPolicyStores, store.TieredEntityStores) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.stores, w.entityStores
+}
+
+// watch reloads the store config file every interval until ctx is done
+func (w *webhooks) watch(ctx context.Context, reloadConfig *config.StoreConfigReloadConfig) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		reloaded, err := w.reload(ctx, reloadConfig)
+		if err != nil {
+			klog.ErrorS(err, "Failed to reload store config, keeping the previous config", "file", w.config.StoreConfig)
+			metrics.RecordConfigReload(true)
+			return
+		}
+		if reloaded {
+			metrics.RecordConfigReload(false)
+		}
+	}, reloadConfig.Interval)
+}
+
+// reload replaces the webhooks' stores if the store config file changed.
+// The new stores must load within the reload timeout, otherwise they are
+// stopped and the previous stores are kept. The previous stores are stopped
+// once the webhooks use the new stores.
+func (w *webhooks) reload(ctx context.Context, reloadConfig *config.StoreConfigReloadConfig) (bool, error) {
+	content, err := os.ReadFile(w.config.StoreConfig)
+	if err != nil {
+		return false, fmt.Errorf("failed to read store config: %w", err)
+	}
+	w.mu.RLock()
+	unchanged := bytes.Equal(content, w.content) || bytes.Equal(content, w.rejected)
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if _, err := store.ParseConfig(content); err != nil {
+		// don't retry an invalid config until it changes
+		w.mu.Lock()
+		w.rejected = content
+		w.mu.Unlock()
+		return false, fmt.Errorf("failed to parse store config: %w", err)
+	}
+	// stores that fail to be created or loaded are retried on the next interval
+	storeConfig, stores, entityStores, err := storeConfigStores(ctx, content, reloadConfig.Timeout)
+	if err != nil {
+		return false, err
+	}
+	w.warnRestartRequired(storeConfig.Spec)
+
+	w.mu.Lock()
+	authz, handler := w.build(storeConfig, stores, entityStores)
+	oldStores, oldEntityStores := w.stores, w.entityStores
+	w.content, w.rejected = content, nil
+	w.storeConfig, w.stores, w.entityStores = storeConfig, stores, entityStores
+	w.authorizer.Set(authz)
+	w.admission.Set(handler)
+	w.mu.Unlock()
+
+	oldStores.Stop()
+	oldEntityStores.Stop()
+	klog.InfoS("Reloaded policy store config", "count", len(stores), "file", w.config.StoreConfig)
+	return true, nil
+}
+
+// warnRestartRequired logs settings in spec that differ from the store config
+// the webhook started with, but only take effect when the webhook restarts
+func (w *webhooks) warnRestartRequired(spec v1alpha1.ConfigSpec) {
+	if !reflect.DeepEqual(spec.ClusterMetadata, w.spec.ClusterMetadata) {
+		klog.InfoS("Changes to clusterMetadata require a restart", "file", w.config.StoreConfig)
+	}
+	if spec.DisableNamespaceEntities != w.spec.DisableNamespaceEntities {
+		klog.InfoS("Changes to disableNamespaceEntities require a restart", "file", w.config.StoreConfig)
+	}
+	if spec.EnablePrincipalEnrichment != w.spec.EnablePrincipalEnrichment {
+		klog.InfoS("Changes to enablePrincipalEnrichment require a restart", "file", w.config.StoreConfig)
+	}
+	if !watchesNamespaces(w.spec) && spec.Admission != nil && len(spec.Admission.ExcludedNamespaceSelectors) > 0 {
+		klog.InfoS("Adding admission excludedNamespaceSelectors when namespaces aren't watched requires a restart", "file", w.config.StoreConfig)
+	}
+}
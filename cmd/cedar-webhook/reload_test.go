@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+func TestReloadFailedStore(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	policyDir := filepath.Join(dir, "policies")
+	if err := os.Mkdir(policyDir, 0o700); err != nil {
+		t.Fatalf("Failed to create policy directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(policyDir, "policy.cedar"), []byte(`permit (principal, action, resource);`), 0o600); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	storeConfig := filepath.Join(dir, "store-config.yaml")
+	content := []byte(`apiVersion: cedar.k8s.aws/v1alpha1
+kind: StoreConfig
+spec:
+  stores:
+    - type: "directory"
+      directoryStore:
+        path: "` + policyDir + `"
+`)
+	if err := os.WriteFile(storeConfig, content, 0o600); err != nil {
+		t.Fatalf("Failed to write store config: %v", err)
+	}
+
+	ctx := context.Background()
+	reloadConfig := &config.StoreConfigReloadConfig{Interval: time.Minute, Timeout: time.Second}
+	cfg, stores, entityStores, err := storeConfigStores(ctx, content, reloadConfig.Timeout)
+	if err != nil {
+		t.Fatalf("Failed to create stores: %v", err)
+	}
+	w := newWebhooks(&config.AuthorizationWebhookConfig{StoreConfig: storeConfig}, nil, nil, content, cfg, stores, entityStores)
+	defer func() {
+		stores, entityStores := w.Stores()
+		stores.Stop()
+		entityStores.Stop()
+	}()
+
+	// a CRD store with a kubeconfigContext that doesn't exist fails to start
+	if err := os.WriteFile(storeConfig, []byte(`apiVersion: cedar.k8s.aws/v1alpha1
+kind: StoreConfig
+spec:
+  stores:
+    - type: "crd"
+      crdStore:
+        kubeconfigContext: "missing"
+`), 0o600); err != nil {
+		t.Fatalf("Failed to write store config: %v", err)
+	}
+	reloaded, err := w.reload(ctx, reloadConfig)
+	if err == nil || reloaded {
+		t.Fatalf("Expected reload to fail, got reloaded %v, error %v", reloaded, err)
+	}
+	if !strings.Contains(err.Error(), `context "missing" does not exist`) {
+		t.Errorf("Expected the CRD store's error, got %v", err)
+	}
+
+	got, _ := w.Stores()
+	if len(got) != 1 || got[0] != stores[0] {
+		t.Errorf("Expected the previous stores to be kept, got %v", got)
+	}
+	if got := len(got[0].PolicySet().Map()); got != 1 {
+		t.Errorf("Expected the previous store to keep its policies, got %d policies", got)
+	}
+}
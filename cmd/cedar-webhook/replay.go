@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/spf13/cobra"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/replay"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+type replayOptions struct {
+	recordingDir string
+	base         []string
+	proposed     []string
+	output       string
+	timeout      time.Duration
+	schema       string
+}
+
+// NewReplayCommand creates a command that compares the decisions two policy
+// configurations make for recorded requests
+func NewReplayCommand() *cobra.Command {
+	o := &replayOptions{
+		output:  "summary",
+		timeout: 30 * time.Second,
+	}
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Compare the decisions of two policy configurations on recorded requests",
+		Long: `Replay the requests recorded with --enable-request-recording against a
+		base and a proposed policy configuration, and report every request whose
+		decision or determining policies changed.
+
+		Each configuration is a store config file, or one or more .cedar files or
+		directories of .cedar files. Each file or directory is a policy store tier,
+		in the order given.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReplay(cmd.Context(), cmd.OutOrStdout(), o)
+		},
+	}
+
+	fs := cmd.Flags()
+	fs.StringVar(&o.recordingDir, "recording-dir", o.recordingDir, "The directory of recorded requests, written with --request-recording-dir")
+	fs.StringSliceVar(&o.base, "base", o.base, "The base policy configuration: a store config file, or .cedar files and directories. May be repeated")
+	fs.StringSliceVar(&o.proposed, "proposed", o.proposed, "The proposed policy configuration: a store config file, or .cedar files and directories. May be repeated")
+	fs.StringVarP(&o.output, "output", "o", o.output, "The output format, one of: summary, json")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "How long to wait for policy stores to load")
+	fs.StringVar(&o.schema, "admission-schema", o.schema, "A Cedar schema in JSON format that admission objects are converted into entities with. Defaults to the built-in schema of Kubernetes types.")
+	return cmd
+}
+
+func runReplay(ctx context.Context, out io.Writer, o *replayOptions) error {
+	if o.output != "summary" && o.output != "json" {
+		return fmt.Errorf("unsupported output format %q", o.output)
+	}
+	if len(o.base) == 0 || len(o.proposed) == 0 {
+		return fmt.Errorf("--base and --proposed are required")
+	}
+	recordings, err := replay.LoadRecordings(o.recordingDir)
+	if err != nil {
+		return err
+	}
+	admissionSchema, err := schema.LoadCedarSchema(o.schema)
+	if err != nil {
+		return fmt.Errorf("failed to load admission schema: %w", err)
+	}
+	base, err := replayEvaluator(ctx, o.base, o.timeout, admissionSchema)
+	if err != nil {
+		return fmt.Errorf("failed to load base configuration: %w", err)
+	}
+	proposed, err := replayEvaluator(ctx, o.proposed, o.timeout, admissionSchema)
+	if err != nil {
+		return fmt.Errorf("failed to load proposed configuration: %w", err)
+	}
+
+	report := replay.Diff(ctx, recordings, base, proposed)
+	if o.output == "json" {
+		return report.WriteJSON(out)
+	}
+	return report.WriteSummary(out)
+}
+
+// replayEvaluator creates an evaluator from a store config file, or from
+// .cedar files and directories that are each a policy store tier
+func replayEvaluator(ctx context.Context, paths []string, timeout time.Duration, admissionSchema schema.CedarSchema) (replay.Evaluator, error) {
+	var (
+		stores       store.TieredPolicyStores
+		entityStores store.TieredEntityStores
+		authzConfig  *v1alpha1.AuthorizerConfig
+		admissionCfg *v1alpha1.AdmissionConfig
+	)
+	if len(paths) == 1 && isStoreConfig(paths[0]) {
+		cfg, configStores, configEntityStores, err := loadStoreConfig(ctx, paths[0], timeout)
+		if err != nil {
+			return replay.Evaluator{}, err
+		}
+		stores, entityStores, authzConfig, admissionCfg = configStores, configEntityStores, cfg.Spec.Authorizer, cfg.Spec.Admission
+	} else {
+		for _, path := range paths {
+			policyStore, err := policyFileStore(path)
+			if err != nil {
+				return replay.Evaluator{}, err
+			}
+			stores = append(stores, policyStore)
+		}
+	}
+
+	authz := authorizer.NewAuthorizer(authzConfig, authorizer.Options{EntityStores: entityStores}, stores...)
+	// admission requests are evaluated with the same default allow-all policy as the webhook
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", admission.AllowAllAdmissionPolicy())
+	admissionStores := append(stores[:len(stores):len(stores)], store.StaticStore(*pset))
+	// namespaces aren't watched, so admission namespace selectors don't match
+	exclusions := admission.NewExclusions(admissionCfg, nil)
+	handler := admission.NewHandler(admissionStores, admission.Options{
+		Exclusions:     exclusions,
+		ResourceSchema: admissionSchema,
+		EntityStores:   entityStores,
+	})
+	return replay.Evaluator{Authorizer: authz, Admission: handler}, nil
+}
+
+// isStoreConfig returns true if path is a file that isn't a .cedar policy file
+func isStoreConfig(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir() && filepath.Ext(path) != ".cedar"
+}
+
+// policyFileStore creates a policy store tier from a directory of .cedar files, or a .cedar file
+func policyFileStore(path string) (store.PolicyStore, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		directoryStore := store.NewDirectoryPolicyStore(path, time.Hour)
+		if err := directoryStore.Status().LastError; err != nil {
+			return nil, fmt.Errorf("failed to load policies from %s: %w", path, err)
+		}
+		return directoryStore, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewMemoryStore(path, content, true)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+type rulesOptions struct {
+	storeConfig string
+	user        string
+	uid         string
+	groups      []string
+	namespace   string
+	output      string
+	timeout     time.Duration
+}
+
+// NewRulesCommand creates a command that prints the rules Cedar policies grant a user
+func NewRulesCommand() *cobra.Command {
+	o := &rulesOptions{
+		namespace: "default",
+		output:    "table",
+		timeout:   30 * time.Second,
+	}
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "List the rules Cedar policies grant a user",
+		Long: `List the resource and non-resource rules the configured Cedar policy
+		stores grant a user in a namespace, similar to 'kubectl auth can-i --list'.
+		Rules are incomplete when policies can't be represented as rules.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRules(cmd.Context(), cmd.OutOrStdout(), o)
+		},
+	}
+
+	fs := cmd.Flags()
+	fs.StringVar(&o.storeConfig, "config", o.storeConfig, "The config for the Cedar policy stores")
+	fs.StringVar(&o.user, "user", o.user, "The name of the user to list rules for")
+	fs.StringVar(&o.uid, "uid", o.uid, "The UID of the user to list rules for")
+	fs.StringSliceVar(&o.groups, "group", o.groups, "The groups of the user to list rules for. May be repeated")
+	fs.StringVarP(&o.namespace, "namespace", "n", o.namespace, "The namespace to list rules in")
+	fs.StringVarP(&o.output, "output", "o", o.output, "The output format, one of: table, json")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "How long to wait for policy stores to load")
+	return cmd
+}
+
+func runRules(ctx context.Context, out io.Writer, o *rulesOptions) error {
+	if o.output != "table" && o.output != "json" {
+		return fmt.Errorf("unsupported output format %q", o.output)
+	}
+	cfg, stores, entityStores, err := loadStoreConfig(ctx, o.storeConfig, o.timeout)
+	if err != nil {
+		return err
+	}
+
+	authz := authorizer.NewAuthorizer(cfg.Spec.Authorizer, authorizer.Options{EntityStores: entityStores}, stores...)
+	u := &user.DefaultInfo{Name: o.user, UID: o.uid, Groups: o.groups}
+	review := server.SubjectRulesReview{
+		Spec: server.SubjectRulesReviewSpec{
+			User:      o.user,
+			UID:       o.uid,
+			Groups:    o.groups,
+			Namespace: o.namespace,
+		},
+		Status: server.GetSubjectRulesReviewStatus(ctx, authz, u, o.namespace),
+	}
+	review.Kind = "SubjectRulesReview"
+
+	if o.output == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(review)
+	}
+	return printRules(out, review.Status)
+}
+
+// loadStoreConfig creates the policy and entity stores in a store config file,
+// and waits until they are loaded
+func loadStoreConfig(ctx context.Context, path string, timeout time.Duration) (*v1alpha1.CedarConfig, store.TieredPolicyStores, store.TieredEntityStores, error) {
+	storeContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read store config: %w", err)
+	}
+	return storeConfigStores(ctx, storeContent, timeout)
+}
+
+// storeConfigStores creates the policy and entity stores in store config
+// content, and waits until they are loaded. The stores are stopped if they
+// don't load in time.
+func storeConfigStores(ctx context.Context, storeContent []byte, timeout time.Duration) (*v1alpha1.CedarConfig, store.TieredPolicyStores, store.TieredEntityStores, error) {
+	cfg, err := store.ParseConfig(storeContent)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse store config: %w", err)
+	}
+	stores, err := store.CedarConfigStores(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	entityStores, err := store.CedarConfigEntityStores(cfg)
+	if err != nil {
+		stores.Stop()
+		return nil, nil, nil, err
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, timeout, true, func(context.Context) (bool, error) {
+		for _, s := range stores {
+			if !s.InitalPolicyLoadComplete() {
+				return false, nil
+			}
+		}
+		return entityStores.InitalEntityLoadComplete(), nil
+	})
+	if err != nil {
+		stores.Stop()
+		entityStores.Stop()
+		// include the errors of stores that failed to start, such as a CRD
+		// store with an invalid kubeconfigContext
+		errs := []error{err}
+		for _, s := range stores {
+			if status := s.Status(); !s.InitalPolicyLoadComplete() && status.LastError != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Name(), status.LastError))
+			}
+		}
+		return nil, nil, nil, fmt.Errorf("failed waiting for policy stores to load: %w", errors.Join(errs...))
+	}
+	return cfg, stores, entityStores, nil
+}
+
+// printRules prints rules in the same format as 'kubectl auth can-i --list'
+func printRules(out io.Writer, status authzv1.SubjectRulesReviewStatus) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Resources\tNon-Resource URLs\tResource Names\tVerbs")
+	for _, rule := range status.ResourceRules {
+		resources := []string{}
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if group == "" {
+					resources = append(resources, resource)
+				} else {
+					resources = append(resources, resource+"."+group)
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t[]\t[%s]\t[%s]\n", strings.Join(resources, ", "), strings.Join(rule.ResourceNames, " "), strings.Join(rule.Verbs, " "))
+	}
+	for _, rule := range status.NonResourceRules {
+		fmt.Fprintf(w, "\t[%s]\t[]\t[%s]\n", strings.Join(rule.NonResourceURLs, " "), strings.Join(rule.Verbs, " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if status.EvaluationError != "" {
+		fmt.Fprintf(out, "Evaluation error: %s\n", status.EvaluationError)
+	}
+	if status.Incomplete {
+		fmt.Fprintln(out, "Rules are incomplete: some policies could not be represented as rules.")
+	}
+	return nil
+}
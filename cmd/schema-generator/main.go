@@ -129,7 +129,7 @@ func main() {
 				continue
 			}
 
-			err = convert.ModifySchemaForAPIVersion(resources, openAPISpec, cedarschema, v.Name, v.Version, *actionNs)
+			err = convert.ModifySchemaForAPIVersion(resources, openAPISpec, cedarschema, v.Name, v.Version, *actionNs, *authorizationNs)
 			if err != nil {
 				klog.ErrorS(err, "Failed to get convert to cedar schema for API, skipping", "api", v.Name, "version", v.Version)
 				continue
@@ -12,6 +12,15 @@ const (
 	AllAction              = "all"
 
 	AdmissionActionEntityType = cedartypes.EntityType("k8s::admission::Action")
+
+	AdmissionDryRunContextKey      = "dryRun"
+	AdmissionSubResourceContextKey = "subResource"
+	AdmissionOptionsContextKey     = "options"
+	AdmissionKindContextKey        = "kind"
+	AdmissionRequestKindContextKey = "requestKind"
+
+	GroupVersionKindName = "GroupVersionKind"
+	AdmissionOptionsName = "AdmissionOptions"
 )
 
 // AllAdmissionActions returns all the admission actions
@@ -19,18 +28,24 @@ func AllAdmissionActions() []string {
 	return []string{AdmissionCreateAction, AdmissionUpdateAction, AdmissionDeleteAction, AdmissionConnectAction, AllAction}
 }
 
-// AddAdmissionActions adds all admission actions to a schema in the specified namespace
+// AddAdmissionActions adds all admission actions to a schema in the specified
+// namespace, and the common types of their context to the principal namespace
 func AddAdmissionActions(schema CedarSchema, actionNamespace, principalNamespace string) {
 	if actionNamespace == principalNamespace {
 		principalNamespace = ""
 	}
 	namespacedPrincipalTypes := AdmissionPrincipalTypes(principalNamespace)
+	principalPrefix := ""
+	if principalNamespace != "" {
+		principalPrefix = principalNamespace + "::"
+	}
 
 	for _, action := range AllAdmissionActions() {
 		localActionShape := ActionShape{
 			AppliesTo: ActionAppliesTo{
 				PrincipalTypes: namespacedPrincipalTypes,
 				ResourceTypes:  []string{},
+				Context:        AdmissionContextShape(principalPrefix),
 			},
 		}
 		if action != AllAction {
@@ -46,6 +61,84 @@ func AddAdmissionActions(schema CedarSchema, actionNamespace, principalNamespace
 			}
 		}
 	}
+	addAdmissionCommonTypes(schema, principalNamespace, actionNamespace)
+}
+
+// addAdmissionCommonTypes adds the common types of the admission context to
+// the principal namespace, or the action namespace if principalNamespace is empty
+func addAdmissionCommonTypes(schema CedarSchema, principalNamespace, actionNamespace string) {
+	typeNamespace := principalNamespace
+	if typeNamespace == "" {
+		typeNamespace = actionNamespace
+	}
+	ns := schema[typeNamespace]
+	if ns.CommonTypes == nil {
+		ns.CommonTypes = map[string]EntityShape{}
+	}
+	ns.CommonTypes[NamespaceObjectName] = NamespaceObjectShape()
+	ns.CommonTypes[GroupVersionKindName] = GroupVersionKindShape()
+	ns.CommonTypes[AdmissionOptionsName] = AdmissionOptionsShape()
+	schema[typeNamespace] = ns
+}
+
+// AdmissionContextShape returns the context shape for admission actions.
+// The principalPrefix is prepended to common types in the authorization namespace.
+func AdmissionContextShape(principalPrefix string) *EntityShape {
+	return &EntityShape{
+		Type: RecordType,
+		Attributes: map[string]EntityAttribute{
+			ClusterMetadataContextKey:      ClusterMetadataContextAttribute(principalPrefix),
+			NamespaceContextKey:            NamespaceContextAttribute(principalPrefix),
+			NamespaceObjectContextKey:      NamespaceObjectContextAttribute(principalPrefix),
+			AdmissionDryRunContextKey:      {Type: BoolType, Required: true},
+			AdmissionSubResourceContextKey: {Type: StringType, Required: true},
+			AdmissionOptionsContextKey:     {Type: principalPrefix + AdmissionOptionsName},
+			AdmissionKindContextKey:        {Type: principalPrefix + GroupVersionKindName, Required: true},
+			AdmissionRequestKindContextKey: {Type: principalPrefix + GroupVersionKindName},
+		},
+	}
+}
+
+// GroupVersionKindShape returns a Cedar EntityShape for the kind of an admission request
+func GroupVersionKindShape() EntityShape {
+	return EntityShape{
+		Annotations: docAnnotation("GroupVersionKind represents the kind of an admission request. The group of core resources is empty."),
+		Type:        RecordType,
+		Attributes: map[string]EntityAttribute{
+			"group":   {Type: StringType, Required: true},
+			"version": {Type: StringType, Required: true},
+			"kind":    {Type: StringType, Required: true},
+		},
+	}
+}
+
+// AdmissionOptionsShape returns a Cedar EntityShape for the CreateOptions,
+// UpdateOptions, or DeleteOptions of an admission request
+func AdmissionOptionsShape() EntityShape {
+	return EntityShape{
+		Annotations: docAnnotation("AdmissionOptions represents the CreateOptions, UpdateOptions, or DeleteOptions of an admission request"),
+		Type:        RecordType,
+		Attributes: map[string]EntityAttribute{
+			"apiVersion": {Type: StringType},
+			"kind":       {Type: StringType},
+			"dryRun": {
+				Type:    SetType,
+				Element: &EntityAttributeElement{Type: StringType},
+			},
+			"fieldManager":       {Type: StringType},
+			"fieldValidation":    {Type: StringType},
+			"gracePeriodSeconds": {Type: LongType},
+			"orphanDependents":   {Type: BoolType},
+			"propagationPolicy":  {Type: StringType},
+			"preconditions": {
+				Type: RecordType,
+				Attributes: map[string]EntityAttribute{
+					"resourceVersion": {Type: StringType},
+					"uid":             {Type: StringType},
+				},
+			},
+		},
+	}
 }
 
 // Adds the namespaced action to the schema
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"testing"
+)
+
+func TestAddAdmissionActions(t *testing.T) {
+	cases := []struct {
+		name               string
+		actionNamespace    string
+		principalNamespace string
+		typeNamespace      string
+		typePrefix         string
+	}{
+		{
+			name:               "separate namespaces",
+			actionNamespace:    "k8s::admission",
+			principalNamespace: "k8s",
+			typeNamespace:      "k8s",
+			typePrefix:         "k8s::",
+		},
+		{
+			name:               "same namespace",
+			actionNamespace:    "k8s",
+			principalNamespace: "k8s",
+			typeNamespace:      "k8s",
+			typePrefix:         "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema := NewCedarSchema()
+			AddAdmissionActions(schema, tc.actionNamespace, tc.principalNamespace)
+
+			for _, name := range []string{NamespaceObjectName, GroupVersionKindName, AdmissionOptionsName} {
+				if _, ok := schema.GetEntityShape(tc.typeNamespace + "::" + name); !ok {
+					t.Errorf("Expected common type %s in namespace %s", name, tc.typeNamespace)
+				}
+			}
+			for _, action := range AllAdmissionActions() {
+				actionShape, ok := schema[tc.actionNamespace].Actions[action]
+				if !ok {
+					t.Fatalf("Expected action %s in namespace %s", action, tc.actionNamespace)
+				}
+				context := actionShape.AppliesTo.Context.Attributes
+				if got := context[NamespaceObjectContextKey].Type; got != tc.typePrefix+NamespaceObjectName {
+					t.Errorf("Expected %s context type %s, got %s", NamespaceObjectContextKey, tc.typePrefix+NamespaceObjectName, got)
+				}
+				if got := context[AdmissionKindContextKey]; got.Type != tc.typePrefix+GroupVersionKindName || !got.Required {
+					t.Errorf("Expected required %s context type %s, got %+v", AdmissionKindContextKey, tc.typePrefix+GroupVersionKindName, got)
+				}
+				if got := context[AdmissionDryRunContextKey]; got.Type != BoolType || !got.Required {
+					t.Errorf("Expected required boolean %s context, got %+v", AdmissionDryRunContextKey, got)
+				}
+			}
+		})
+	}
+}
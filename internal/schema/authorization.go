@@ -18,12 +18,15 @@ const (
 	NonResourceURLEntityType      = cedartypes.EntityType("k8s::" + NonResourceURLEntityName)
 	ResourceEntityType            = cedartypes.EntityType("k8s::" + ResourceEntityName)
 
-	StringType = "String"
-	LongType   = "Long"
-	BoolType   = "Boolean"
-	SetType    = "Set"
-	RecordType = "Record"
-	EntityType = "Entity"
+	StringType    = "String"
+	LongType      = "Long"
+	BoolType      = "Boolean"
+	SetType       = "Set"
+	RecordType    = "Record"
+	EntityType    = "Entity"
+	ExtensionType = "Extension"
+
+	DatetimeExtensionName = "datetime"
 )
 
 // PrincipalUIDEntity returns a Cedar Entity for a PrincipalUID
@@ -81,7 +84,8 @@ func LabelRequirementEntityShape() EntityShape {
 // ResourceEntity returns a Cedar Entity for a Kubernetes Authorization Resource
 func ResourceEntity() Entity {
 	return Entity{
-		Annotations: docAnnotation("Resource represents an authorizable Kubernetes resource"),
+		Annotations:   docAnnotation("Resource represents an authorizable Kubernetes resource"),
+		MemberOfTypes: []string{NamespaceEntityName},
 		Shape: EntityShape{
 			Type: RecordType,
 			Attributes: map[string]EntityAttribute{
@@ -152,17 +156,19 @@ func AllAuthorizationActionNames() []string {
 	}
 }
 
-// GetAuthorizationActions returns a map of all Cedar Authorization Actions
-func GetAuthorizationActions(principalNs, entityNs, actionNs string) map[string]ActionShape {
-
-	nonResourceOnlyActions := []string{
+// NonResourceOnlyAuthorizationActionNames returns the Cedar Authorization Actions that only apply to non-resource URLs
+func NonResourceOnlyAuthorizationActionNames() []string {
+	return []string{
 		AuthorizationActionPut,
 		AuthorizationActionPost,
 		AuthorizationActionHead,
 		AuthorizationActionOptions,
 	}
+}
 
-	resourceOnlyActions := []string{
+// ResourceOnlyAuthorizationActionNames returns the Cedar Authorization Actions that only apply to resources
+func ResourceOnlyAuthorizationActionNames() []string {
+	return []string{
 		AuthorizationActionList,
 		AuthorizationActionWatch,
 		AuthorizationActionCreate,
@@ -175,6 +181,12 @@ func GetAuthorizationActions(principalNs, entityNs, actionNs string) map[string]
 		AuthorizationActionEscalate,
 		AuthorizationActionAttest,
 	}
+}
+
+// GetAuthorizationActions returns a map of all Cedar Authorization Actions
+func GetAuthorizationActions(principalNs, entityNs, actionNs string) map[string]ActionShape {
+	nonResourceOnlyActions := NonResourceOnlyAuthorizationActionNames()
+	resourceOnlyActions := ResourceOnlyAuthorizationActionNames()
 
 	principalPrefix := ""
 	if principalNs != actionNs {
@@ -204,6 +216,7 @@ func GetAuthorizationActions(principalNs, entityNs, actionNs string) map[string]
 					entityPrefix + ResourceEntityName,
 					entityPrefix + NonResourceURLEntityName,
 				},
+				Context: AuthorizationContextShape(entityPrefix),
 			},
 		}
 		if slices.Contains(nonResourceOnlyActions, action) {
@@ -226,11 +239,29 @@ func GetAuthorizationActions(principalNs, entityNs, actionNs string) map[string]
 				principalPrefix + NodePrincipalType,
 				principalPrefix + ExtraValueType,
 			},
+			Context: AuthorizationContextShape(entityPrefix),
 		},
 	}
 	return response
 }
 
+// AuthorizationContextShape returns the context shape for authorization actions.
+// The entityPrefix is prepended to common types in the entity namespace.
+func AuthorizationContextShape(entityPrefix string) *EntityShape {
+	return &EntityShape{
+		Type: RecordType,
+		Attributes: map[string]EntityAttribute{
+			"now":                     {Type: ExtensionType, Name: DatetimeExtensionName, Required: true},
+			"apiVersion":              {Type: StringType},
+			"isReadOnly":              {Type: BoolType, Required: true},
+			"hasLabelSelector":        {Type: BoolType, Required: true},
+			"hasFieldSelector":        {Type: BoolType, Required: true},
+			ClusterMetadataContextKey: ClusterMetadataContextAttribute(entityPrefix),
+			NamespaceContextKey:       NamespaceContextAttribute(entityPrefix),
+		},
+	}
+}
+
 func GetAuthorizationActionsNamespace(principalNs, entityNs, actionNs string) CedarSchemaNamespace {
 	return CedarSchemaNamespace{
 		Actions: GetAuthorizationActions(principalNs, entityNs, actionNs),
@@ -249,11 +280,15 @@ func GetAuthorizationNamespace(principalNs, entityNs, actionNs string) CedarSche
 			NonResourceURLEntityName:    NonResourceURLEntity(),
 			ResourceEntityName:          ResourceEntity(),
 			ExtraValueType:              ExtraEntity(),
+			NamespaceEntityName:         NamespaceEntity(),
 		},
 		CommonTypes: map[string]EntityShape{
 			FieldRequirementName:     FieldRequirementEntityShape(),
 			LabelRequirementName:     LabelRequirementEntityShape(),
 			ExtraValuesAttributeType: ExtraEntityShape(),
+			ClusterMetadataName:      ClusterMetadataShape(),
+			ClusterTagName:           ClusterTagShape(),
+			KeyValueName:             KeyValueShape(),
 		},
 	}
 }
@@ -0,0 +1,53 @@
+package schema
+
+const (
+	ClusterMetadataContextKey = "cluster"
+	ClusterMetadataName       = "ClusterMetadata"
+	ClusterTagName            = "ClusterTag"
+)
+
+// ClusterMetadataShape returns a Cedar EntityShape for cluster metadata in a request context
+func ClusterMetadataShape() EntityShape {
+	return EntityShape{
+		Annotations: docAnnotation("ClusterMetadata represents the cluster a request was made to"),
+		Type:        RecordType,
+		Attributes: map[string]EntityAttribute{
+			"name":            {Type: StringType},
+			"arn":             {Type: StringType},
+			"region":          {Type: StringType},
+			"accountId":       {Type: StringType},
+			"platformVersion": {Type: StringType},
+			"tags": {
+				Type:     SetType,
+				Required: true,
+				Element:  &EntityAttributeElement{Type: ClusterTagName},
+			},
+			"kubernetesVersion": {
+				Type: RecordType,
+				Attributes: map[string]EntityAttribute{
+					"major":      {Type: LongType, Required: true},
+					"minor":      {Type: LongType, Required: true},
+					"gitVersion": {Type: StringType, Required: true},
+				},
+			},
+		},
+	}
+}
+
+// ClusterTagShape returns a Cedar EntityShape for a cluster tag
+func ClusterTagShape() EntityShape {
+	return EntityShape{
+		Annotations: docAnnotation("ClusterTag represents a key/value tag on a cluster"),
+		Type:        RecordType,
+		Attributes: map[string]EntityAttribute{
+			"key":   {Type: StringType, Required: true},
+			"value": {Type: StringType, Required: true},
+		},
+	}
+}
+
+// ClusterMetadataContextAttribute returns the context attribute for cluster
+// metadata, referencing the ClusterMetadata common type with the given prefix
+func ClusterMetadataContextAttribute(prefix string) EntityAttribute {
+	return EntityAttribute{Type: prefix + ClusterMetadataName}
+}
@@ -11,6 +11,9 @@ func proxyOptionEntityShape() EntityShape {
 	}
 }
 
+// namespacedConnectMemberOfTypes are the parent types of connect options for namespaced resources
+var namespacedConnectMemberOfTypes = []string{"k8s::" + NamespaceEntityName}
+
 func NodeProxyOptions() Entity {
 	return Entity{
 		Annotations: docAnnotation("NodeProxyOptions represents options for proxying to a Kubernetes node"),
@@ -20,21 +23,24 @@ func NodeProxyOptions() Entity {
 
 func ServiceProxyOptions() Entity {
 	return Entity{
-		Annotations: docAnnotation("ServiceProxyOptions represents options for proxying to a Kubernetes service"),
-		Shape:       proxyOptionEntityShape(),
+		Annotations:   docAnnotation("ServiceProxyOptions represents options for proxying to a Kubernetes service"),
+		MemberOfTypes: namespacedConnectMemberOfTypes,
+		Shape:         proxyOptionEntityShape(),
 	}
 }
 
 func PodProxyOptions() Entity {
 	return Entity{
-		Annotations: docAnnotation("PodProxyOptions represents options for proxying to a Kubernetes pod"),
-		Shape:       proxyOptionEntityShape(),
+		Annotations:   docAnnotation("PodProxyOptions represents options for proxying to a Kubernetes pod"),
+		MemberOfTypes: namespacedConnectMemberOfTypes,
+		Shape:         proxyOptionEntityShape(),
 	}
 }
 
 func PodPortForwardOptions() Entity {
 	return Entity{
-		Annotations: docAnnotation("PodPortForwardOptions represents options for port forwarding to a Kubernetes pod"),
+		Annotations:   docAnnotation("PodPortForwardOptions represents options for port forwarding to a Kubernetes pod"),
+		MemberOfTypes: namespacedConnectMemberOfTypes,
 		Shape: EntityShape{
 			Type: RecordType,
 			Attributes: map[string]EntityAttribute{
@@ -72,15 +78,17 @@ func podExecAttachEntityShape() EntityShape {
 
 func PodExecOptions() Entity {
 	return Entity{
-		Annotations: docAnnotation("PodExecOptions represents options for executing a command in a Kubernetes pod"),
-		Shape:       podExecAttachEntityShape(),
+		Annotations:   docAnnotation("PodExecOptions represents options for executing a command in a Kubernetes pod"),
+		MemberOfTypes: namespacedConnectMemberOfTypes,
+		Shape:         podExecAttachEntityShape(),
 	}
 }
 
 func PodAttachOptions() Entity {
 	return Entity{
-		Annotations: docAnnotation("PodAttachOptions represents options for attaching to a Kubernetes pod"),
-		Shape:       podExecAttachEntityShape(),
+		Annotations:   docAnnotation("PodAttachOptions represents options for attaching to a Kubernetes pod"),
+		MemberOfTypes: namespacedConnectMemberOfTypes,
+		Shape:         podExecAttachEntityShape(),
 	}
 }
 
@@ -122,6 +130,7 @@ func AddConnectEntities(schema CedarSchema) {
 				coreNSName + "::PodProxyOptions",
 				coreNSName + "::ServiceProxyOptions",
 			},
+			Context: AdmissionContextShape("k8s::"),
 		},
 		MemberOf: []ActionMember{{ID: AllAction}},
 	}
@@ -87,7 +87,9 @@ func (g *K8sSchemaGetter) APIResourceList(apiPath string) (*metav1.APIResourceLi
 	return resources, nil
 }
 
-func ModifySchemaForAPIVersion(apiResources *metav1.APIResourceList, openApiSchema *spec3.OpenAPI, cSchema schema.CedarSchema, api, version, actionNamespace string) error {
+// ModifySchemaForAPIVersion adds the entities and admission actions for an API version to the schema.
+// Entities for namespaced kinds are members of the Namespace entity type in the authorizationNamespace.
+func ModifySchemaForAPIVersion(apiResources *metav1.APIResourceList, openApiSchema *spec3.OpenAPI, cSchema schema.CedarSchema, api, version, actionNamespace, authorizationNamespace string) error {
 
 	for schemaKind, schemaDefinition := range openApiSchema.Components.Schemas {
 
@@ -196,6 +198,11 @@ func ModifySchemaForAPIVersion(apiResources *metav1.APIResourceList, openApiSche
 			schema.AddResourceTypeToAction(cSchema, actionNamespace, schema.AdmissionCreateAction, nsName+"::"+sKind)
 		}
 
+		if isNamespacedKind(sKind, apiResources) || (api == "core" && sKind == "Namespace") {
+			// Namespace objects are children of their own namespace entity
+			entity.MemberOfTypes = []string{authorizationNamespace + "::" + schema.NamespaceEntityName}
+		}
+
 		// We hard-code `CONNECT` elsewhere since there are only a few connectable Kinds that aren't in the OpenAPI schema.
 		ns.EntityTypes[sKind] = entity
 		schema.AddResourceTypeToAction(cSchema, actionNamespace, schema.AllAction, nsName+"::"+sKind)
@@ -223,6 +230,16 @@ func verbsForKind(kind string, apiResources *metav1.APIResourceList) sets.Set[st
 	return verbs
 }
 
+// isNamespacedKind returns true if any resource of the kind is namespaced
+func isNamespacedKind(kind string, apiResources *metav1.APIResourceList) bool {
+	for _, r := range apiResources.APIResources {
+		if r.Kind == kind && r.Namespaced {
+			return true
+		}
+	}
+	return false
+}
+
 // isEntity determines if the structure is an entity (true) or common type (false)
 func isEntity(shape schema.EntityShape) bool {
 	if shape.Attributes == nil {
@@ -418,6 +435,16 @@ func RefToEntityShape(api *spec3.OpenAPI, schemaKind string) (schema.EntityShape
 
 				if url := attrDef.AdditionalProperties.Schema.Ref.GetURL(); url != nil && url.String() != "" {
 					typeName := refToRelativeTypeName(schemaKind, url.String())
+					if typeName == schema.StringType {
+						// maps of Quantities or IntOrStrings
+						entityShape.Attributes[attrName] = schema.EntityAttribute{
+							Type: schema.SetType,
+							Element: &schema.EntityAttributeElement{
+								Type: refToRelativeTypeName(schemaKind, keyValueSchemaName),
+							},
+						}
+						continue
+					}
 
 					attrShape, err := RefToEntityShape(api, url.String()[21:])
 					if err != nil {
@@ -437,52 +464,11 @@ func RefToEntityShape(api *spec3.OpenAPI, schemaKind string) (schema.EntityShape
 					continue
 				}
 
-				knownKeyValueStringMapAttributes := map[string][]string{
-					"io.k8s.api.core.v1.ConfigMap":                       {"data", "binaryData"}, // format is []byte, should we exclude?
-					"io.k8s.api.core.v1.CSIPersistentVolumeSource":       {"volumeAttributes"},
-					"io.k8s.api.core.v1.CSIVolumeSource":                 {"volumeAttributes"},
-					"io.k8s.api.core.v1.FlexPersistentVolumeSource":      {"options"},
-					"io.k8s.api.core.v1.FlexVolumeSource":                {"options"},
-					"io.k8s.api.core.v1.PersistentVolumeClaimStatus":     {"allocatedResourceStatuses"},
-					"io.k8s.api.core.v1.PodSpec":                         {"nodeSelector"},
-					"io.k8s.api.core.v1.ReplicationControllerSpec":       {"selector"},
-					"io.k8s.api.core.v1.Secret":                          {"data", "stringData"},
-					"io.k8s.api.core.v1.ServiceSpec":                     {"selector"},
-					"io.k8s.api.discovery.v1.Endpoint":                   {"deprecatedTopology"},
-					"io.k8s.api.node.v1.Scheduling":                      {"nodeSelector"},
-					"io.k8s.api.storage.v1.StorageClass":                 {"parameters"},
-					"io.k8s.api.storage.v1.VolumeAttachmentStatus":       {"attachmentMetadata"},
-					"io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector": {"matchLabels"},
-					"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta":    {"annotations", "labels"},
-				}
-				if attrs, ok := knownKeyValueStringMapAttributes[schemaKind]; ok &&
-					slices.Contains(attrs, attrName) &&
-					len(attrDef.AdditionalProperties.Schema.Type) > 0 && attrDef.AdditionalProperties.Schema.Type[0] == "string" {
+				if element := mapElementSchemaName(attrDef.AdditionalProperties); element != "" {
 					entityShape.Attributes[attrName] = schema.EntityAttribute{
 						Type: schema.SetType,
 						Element: &schema.EntityAttributeElement{
-							Type: refToRelativeTypeName(schemaKind, "io.k8s.apimachinery.pkg.apis.meta.v1.KeyValue"),
-						},
-					}
-					continue
-				}
-				knownKeyValueStringStringSlice := map[string][]string{
-					"io.k8s.api.authentication.v1.UserInfo":                    {"extra"},
-					"io.k8s.api.authorization.v1.SubjectAccessReviewSpec":      {"extra"},
-					"io.k8s.api.certificates.v1.CertificateSigningRequestSpec": {"extra"},
-				}
-				if attrs, ok := knownKeyValueStringStringSlice[schemaKind]; ok &&
-					slices.Contains(attrs, attrName) &&
-					len(attrDef.AdditionalProperties.Schema.Type) > 0 &&
-					attrDef.AdditionalProperties.Schema.Type[0] == "array" &&
-					attrDef.AdditionalProperties.Schema.Items != nil &&
-					attrDef.AdditionalProperties.Schema.Items.Schema != nil &&
-					len(attrDef.AdditionalProperties.Schema.Items.Schema.Type) > 0 &&
-					attrDef.AdditionalProperties.Schema.Items.Schema.Type[0] == "string" {
-					entityShape.Attributes[attrName] = schema.EntityAttribute{
-						Type: schema.SetType,
-						Element: &schema.EntityAttributeElement{
-							Type: refToRelativeTypeName(schemaKind, "io.k8s.apimachinery.pkg.apis.meta.v1.KeyValueStringSlice"),
+							Type: refToRelativeTypeName(schemaKind, element),
 						},
 					}
 					continue
@@ -526,6 +512,31 @@ func RefToEntityShape(api *spec3.OpenAPI, schemaKind string) (schema.EntityShape
 	return entityShape, nil
 }
 
+const (
+	keyValueSchemaName            = "io.k8s.apimachinery.pkg.apis.meta.v1.KeyValue"
+	keyValueStringSliceSchemaName = "io.k8s.apimachinery.pkg.apis.meta.v1.KeyValueStringSlice"
+)
+
+// mapElementSchemaName returns the key/value type that a map with
+// additionalProperties is converted into a set of, or an empty string if the
+// map's values aren't strings or lists of strings
+func mapElementSchemaName(additionalProperties *spec.SchemaOrBool) string {
+	if additionalProperties == nil || additionalProperties.Schema == nil || len(additionalProperties.Schema.Type) == 0 {
+		return ""
+	}
+	values := additionalProperties.Schema
+	switch values.Type[0] {
+	case "string":
+		return keyValueSchemaName
+	case "array":
+		if values.Items != nil && values.Items.Schema != nil &&
+			len(values.Items.Schema.Type) > 0 && values.Items.Schema.Type[0] == "string" {
+			return keyValueStringSliceSchemaName
+		}
+	}
+	return ""
+}
+
 func parseCRDProperties(depth int, properties map[string]spec.Schema) (map[string]schema.EntityAttribute, error) {
 	if depth == 0 {
 		return nil, fmt.Errorf("max depth reached")
@@ -587,6 +598,15 @@ func parseCRDProperties(depth int, properties map[string]spec.Schema) (map[strin
 					return nil, err
 				}
 				attrMap[k] = schema.EntityAttribute{Type: schema.RecordType, Attributes: attrs}
+				continue
+			}
+			if element := mapElementSchemaName(v.AdditionalProperties); element != "" {
+				ns, typeName := SchemaNameToCedar(element)
+				attrMap[k] = schema.EntityAttribute{
+					Type:     schema.SetType,
+					Element:  &schema.EntityAttributeElement{Type: ns + "::" + typeName},
+					Required: slices.Contains(v.Required, k),
+				}
 			}
 		default:
 			klog.V(2).Infof("Skipping attr %s type %s", k, v.Type[0])
@@ -6,8 +6,10 @@ import (
 	"testing"
 
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/google/go-cmp/cmp"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/kube-openapi/pkg/spec3"
+	"k8s.io/kube-openapi/pkg/validation/spec"
 )
 
 func createSchema() schema.CedarSchema {
@@ -78,6 +80,17 @@ func TestModifySchemaForAPIVersion(t *testing.T) {
 				if _, ok := got["apps::v1"].CommonTypes["StatefulSet"]; ok {
 					t.Fatalf("StatefulSet should be an entity not a common type")
 				}
+
+				// maps are sets of key/value records
+				for _, tc := range []struct{ typeName, attrName, element string }{
+					{"PodSpec", "nodeSelector", "meta::v1::KeyValue"},
+					{"ResourceRequirements", "limits", "meta::v1::KeyValue"},
+				} {
+					attr := got["core::v1"].CommonTypes[tc.typeName].Attributes[tc.attrName]
+					if attr.Type != schema.SetType || attr.Element == nil || attr.Element.Type != tc.element {
+						t.Errorf("%s.%s should be a set of %s, got %+v", tc.typeName, tc.attrName, tc.element, attr)
+					}
+				}
 			},
 		},
 		{
@@ -126,7 +139,7 @@ func TestModifySchemaForAPIVersion(t *testing.T) {
 				if err != nil {
 					t.Fatalf("error unmarshalling file %s: %v", input.inputOpenAPIFile, err)
 				}
-				err = ModifySchemaForAPIVersion(apiResources, api, cedarschema, input.inputName, input.inputVersion, "k8s::admission")
+				err = ModifySchemaForAPIVersion(apiResources, api, cedarschema, input.inputName, input.inputVersion, "k8s::admission", "k8s")
 				if err != nil {
 					t.Fatalf("error modifying schema for %s: %v", input.inputOpenAPIFile, err)
 				}
@@ -135,3 +148,33 @@ func TestModifySchemaForAPIVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCRDProperties(t *testing.T) {
+	properties := map[string]spec.Schema{
+		"name": {SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"string"}}},
+		"settings": {SchemaProps: spec.SchemaProps{
+			Type:                 spec.StringOrArray{"object"},
+			AdditionalProperties: &spec.SchemaOrBool{Schema: spec.StringProperty()},
+		}},
+		"owners": {SchemaProps: spec.SchemaProps{
+			Type:                 spec.StringOrArray{"object"},
+			AdditionalProperties: &spec.SchemaOrBool{Schema: spec.ArrayProperty(spec.StringProperty())},
+		}},
+		"replicas": {SchemaProps: spec.SchemaProps{
+			Type:                 spec.StringOrArray{"object"},
+			AdditionalProperties: &spec.SchemaOrBool{Schema: spec.Int64Property()},
+		}},
+	}
+	got, err := parseCRDProperties(15, properties)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]schema.EntityAttribute{
+		"name":     {Type: schema.StringType},
+		"settings": {Type: schema.SetType, Element: &schema.EntityAttributeElement{Type: "meta::v1::KeyValue"}},
+		"owners":   {Type: schema.SetType, Element: &schema.EntityAttributeElement{Type: "meta::v1::KeyValueStringSlice"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected attributes (-want +got):\n%s", diff)
+	}
+}
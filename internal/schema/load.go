@@ -0,0 +1,27 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/cedarschema"
+)
+
+// LoadCedarSchema reads a schema in the Cedar JSON schema format from path.
+// If path is empty, the built-in schema of Kubernetes types is returned.
+func LoadCedarSchema(path string) (CedarSchema, error) {
+	data := cedarschema.K8sFullJSON
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+	}
+	resp := NewCedarSchema()
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,117 @@
+package schema
+
+import (
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+)
+
+const (
+	NamespaceEntityName = "Namespace"
+	NamespaceContextKey = "namespace"
+	KeyValueName        = "KeyValue"
+
+	NamespaceObjectName       = "NamespaceObject"
+	NamespaceObjectContextKey = "namespaceObject"
+
+	NamespaceEntityType = cedartypes.EntityType("k8s::" + NamespaceEntityName)
+)
+
+// NamespaceEntity returns a Cedar Entity for a Kubernetes Namespace
+func NamespaceEntity() Entity {
+	return Entity{
+		Annotations:   docAnnotation("Namespace represents a Kubernetes namespace, and is the parent of resources in the namespace"),
+		MemberOfTypes: []string{},
+		Shape: EntityShape{
+			Type: RecordType,
+			Attributes: map[string]EntityAttribute{
+				"name": {Type: StringType, Required: true},
+				"labels": {
+					Type:     SetType,
+					Required: true,
+					Element:  &EntityAttributeElement{Type: KeyValueName},
+				},
+				"annotations": {
+					Type:     SetType,
+					Required: true,
+					Element:  &EntityAttributeElement{Type: KeyValueName},
+				},
+			},
+		},
+	}
+}
+
+// KeyValueShape returns a Cedar EntityShape for a key/value pair of a string map, such as labels
+func KeyValueShape() EntityShape {
+	return EntityShape{
+		Annotations: docAnnotation("KeyValue represents a single entry in a string map, such as a label"),
+		Type:        RecordType,
+		Attributes: map[string]EntityAttribute{
+			"key":   {Type: StringType, Required: true},
+			"value": {Type: StringType, Required: true},
+		},
+	}
+}
+
+// NamespaceContextAttribute returns the context attribute for the namespace
+// of a request, referencing the Namespace entity type with the given prefix
+func NamespaceContextAttribute(prefix string) EntityAttribute {
+	return EntityAttribute{Type: EntityType, Name: prefix + NamespaceEntityName}
+}
+
+// NamespaceObjectShape returns a Cedar EntityShape for the Namespace object of
+// an admission request's namespace
+func NamespaceObjectShape() EntityShape {
+	return EntityShape{
+		Annotations: docAnnotation("NamespaceObject represents the Namespace object of the namespace an admission request is made in"),
+		Type:        RecordType,
+		Attributes: map[string]EntityAttribute{
+			"apiVersion": {Type: StringType, Required: true},
+			"kind":       {Type: StringType, Required: true},
+			"metadata": {
+				Type:     RecordType,
+				Required: true,
+				Attributes: map[string]EntityAttribute{
+					"name":              {Type: StringType, Required: true},
+					"uid":               {Type: StringType, Required: true},
+					"resourceVersion":   {Type: StringType, Required: true},
+					"creationTimestamp": {Type: StringType, Required: true},
+					"deletionTimestamp": {Type: StringType},
+					"labels": {
+						Type:     SetType,
+						Required: true,
+						Element:  &EntityAttributeElement{Type: KeyValueName},
+					},
+					"annotations": {
+						Type:     SetType,
+						Required: true,
+						Element:  &EntityAttributeElement{Type: KeyValueName},
+					},
+				},
+			},
+			"spec": {
+				Type:     RecordType,
+				Required: true,
+				Attributes: map[string]EntityAttribute{
+					"finalizers": {
+						Type:     SetType,
+						Required: true,
+						Element:  &EntityAttributeElement{Type: StringType},
+					},
+				},
+			},
+			"status": {
+				Type:     RecordType,
+				Required: true,
+				Attributes: map[string]EntityAttribute{
+					"phase": {Type: StringType, Required: true},
+				},
+			},
+		},
+	}
+}
+
+// NamespaceObjectContextAttribute returns the context attribute for the
+// Namespace object of a request, referencing the NamespaceObject common type
+// with the given prefix
+func NamespaceObjectContextAttribute(prefix string) EntityAttribute {
+	return EntityAttribute{Type: prefix + NamespaceObjectName}
+}
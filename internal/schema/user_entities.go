@@ -43,6 +43,8 @@ func UserEntity() Entity {
 func GroupEntity() Entity {
 	return Entity{
 		Annotations: docAnnotation("Group represents a Kubernetes group"),
+		// groups only have parent groups when added by an entity store
+		MemberOfTypes: []string{GroupPrincipalType},
 		Shape: EntityShape{Type: RecordType, Attributes: map[string]EntityAttribute{
 			"name": {Type: StringType, Required: true},
 		}},
@@ -65,6 +67,9 @@ func ServiceAccountEntity() Entity {
 					Element: &EntityAttributeElement{
 						Type: ExtraValuesAttributeType,
 					}},
+				// labels and annotations are only set when principal enrichment is enabled
+				"labels":      keyValueSetAttribute(),
+				"annotations": keyValueSetAttribute(),
 			},
 		},
 	}
@@ -84,11 +89,26 @@ func NodeEntity() Entity {
 					Element: &EntityAttributeElement{
 						Type: ExtraValuesAttributeType,
 					}},
+				// labels and well-known label values are only set when principal enrichment is enabled
+				"labels":       keyValueSetAttribute(),
+				"zone":         {Type: StringType, Required: false},
+				"region":       {Type: StringType, Required: false},
+				"instanceType": {Type: StringType, Required: false},
+				"nodePool":     {Type: StringType, Required: false},
 			},
 		},
 	}
 }
 
+// keyValueSetAttribute returns an optional attribute for a string map, such as labels
+func keyValueSetAttribute() EntityAttribute {
+	return EntityAttribute{
+		Type:     SetType,
+		Required: false,
+		Element:  &EntityAttributeElement{Type: KeyValueName},
+	}
+}
+
 func ExtraEntityShape() EntityShape {
 	return EntityShape{
 		Annotations: docAnnotation("ExtraAttribute represents a set of key-value pairs for an identity"),
@@ -0,0 +1,69 @@
+package admission
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// Audit annotation keys added to admission responses. The API server prefixes
+// each key with the name of the admission webhook in the audit event.
+const (
+	// AuditAnnotationDecision is Allow or Deny
+	AuditAnnotationDecision = "decision"
+	// AuditAnnotationPolicies is a comma-separated list of the IDs of the
+	// policies that determined the decision
+	AuditAnnotationPolicies = "policies"
+	// AuditAnnotationStore is the name of the policy store that contains the policies
+	AuditAnnotationStore = "store"
+	// AuditAnnotationTier is the index of the policy store in the policy store tiers
+	AuditAnnotationTier = "tier"
+	// AuditAnnotationExclusion is why a request was allowed without evaluating policies
+	AuditAnnotationExclusion = "exclusion"
+	// AuditAnnotationFallback is why a request was given the fallback decision
+	// without completing evaluation
+	AuditAnnotationFallback = "fallback"
+)
+
+// auditAnnotations records an evaluated decision, and the policies, store,
+// and tier that determined it. Only the decision is recorded if no policy
+// determined it, such as when policy errors stopped evaluation.
+func (h *cedarHandler) auditAnnotations(allowed bool, diagnostics store.TieredDiagnostic) map[string]string {
+	decision := decisionString(cedar.Deny)
+	if allowed {
+		decision = decisionString(cedar.Allow)
+	}
+	resp := map[string]string{AuditAnnotationDecision: decision}
+	tier := diagnostics.DecidingTier()
+	if tier < 0 {
+		return resp
+	}
+	resp[AuditAnnotationPolicies] = strings.Join(store.DiagnosticPolicyIDs(diagnostics.Diagnostic), ",")
+	resp[AuditAnnotationStore] = h.stores[tier].Name()
+	resp[AuditAnnotationTier] = strconv.Itoa(tier)
+	return resp
+}
+
+// exclusionAuditAnnotations records that a request was allowed by an exclusion
+func exclusionAuditAnnotations(exclusion string) map[string]string {
+	return map[string]string{
+		AuditAnnotationDecision:  decisionString(cedar.Allow),
+		AuditAnnotationExclusion: exclusion,
+	}
+}
+
+// fallbackAuditAnnotations records the fallback decision of a request whose
+// evaluation didn't complete
+func fallbackAuditAnnotations(allowed bool, reason string) map[string]string {
+	decision := decisionString(cedar.Deny)
+	if allowed {
+		decision = decisionString(cedar.Allow)
+	}
+	return map[string]string{
+		AuditAnnotationDecision: decision,
+		AuditAnnotationFallback: reason,
+	}
+}
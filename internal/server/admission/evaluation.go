@@ -0,0 +1,67 @@
+package admission
+
+import (
+	"context"
+	"fmt"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// Handler is a Cedar admission handler
+type Handler interface {
+	admission.Handler
+	// Evaluate returns the decision for a request and the policies that determined it
+	Evaluate(context.Context, admission.Request) (Evaluation, error)
+}
+
+// Evaluation is an admission decision, with the input and policies that determined it
+type Evaluation struct {
+	Allowed bool
+	// Exclusion is why the request was allowed without evaluating policies, if it was excluded
+	Exclusion string
+	// Policies are the policies that determined the decision, in the tier Store
+	Policies []store.PolicyReason
+	Store    string
+	// Diagnostic contains the reasons and errors from evaluating policies
+	Diagnostic store.TieredDiagnostic
+	// Tiers are the results of evaluating each policy store
+	Tiers []store.TierEvaluation
+	// Warnings are the warn policies that apply to the request
+	Warnings []store.PolicyReason
+
+	Entities cedartypes.EntityMap
+	Request  cedartypes.Request
+}
+
+// Evaluate makes the same decision as Handle, without audit policies, metrics,
+// or the decision log. Requests are evaluated even if the stores haven't
+// completed their initial load.
+func (h *cedarHandler) Evaluate(ctx context.Context, req admission.Request) (Evaluation, error) {
+	if exclusion := h.exclusions.Match(req); exclusion != "" {
+		return Evaluation{Allowed: true, Exclusion: exclusion}, nil
+	}
+	requestEntities, cedarReq, err := h.cedarRequest(ctx, req)
+	if err != nil {
+		return Evaluation{}, err
+	}
+	evaluation, err := h.stores.Evaluate(ctx, requestEntities, cedarReq)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("error evaluating policies: %w", err)
+	}
+	diagnostics := evaluation.Diagnostic
+	allowed, _ := h.result(req, evaluation.Decision, diagnostics)
+	warnings, _ := h.stores.Warnings(requestEntities, cedarReq)
+	return Evaluation{
+		Allowed:    allowed,
+		Policies:   h.stores.Reasons(diagnostics),
+		Store:      h.stores.DecidingStore(diagnostics),
+		Diagnostic: diagnostics,
+		Tiers:      evaluation.Tiers,
+		Warnings:   warnings,
+		Entities:   requestEntities,
+		Request:    cedarReq,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package admission
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+)
+
+// Exclusions match admission requests that are allowed without evaluating
+// policies. A nil *Exclusions matches no requests.
+type Exclusions struct {
+	namespaces sets.Set[string]
+	selectors  []labels.Selector
+	resources  []v1alpha1.AdmissionResourceExclusion
+	users      sets.Set[string]
+	groups     sets.Set[string]
+
+	namespaceLister corev1listers.NamespaceLister
+}
+
+// NewExclusions creates the exclusions in cfg. A nil cfg, or a cfg without
+// excludedNamespaces, excludes v1alpha1.DefaultExcludedNamespaces.
+//
+// Namespace labels are looked up in namespaceLister. When namespaceLister is
+// nil, namespace selectors never match.
+func NewExclusions(cfg *v1alpha1.AdmissionConfig, namespaceLister corev1listers.NamespaceLister) *Exclusions {
+	if cfg == nil {
+		cfg = &v1alpha1.AdmissionConfig{}
+	}
+	resp := &Exclusions{
+		namespaces:      sets.New(v1alpha1.DefaultExcludedNamespaces...),
+		resources:       cfg.ExcludedResources,
+		users:           sets.New(cfg.ExcludedUsers...),
+		groups:          sets.New(cfg.ExcludedGroups...),
+		namespaceLister: namespaceLister,
+	}
+	if cfg.ExcludedNamespaces != nil {
+		resp.namespaces = sets.New(cfg.ExcludedNamespaces...)
+	}
+	for i := range cfg.ExcludedNamespaceSelectors {
+		// selectors are checked when the config is parsed
+		selector, err := metav1.LabelSelectorAsSelector(&cfg.ExcludedNamespaceSelectors[i])
+		if err != nil {
+			klog.ErrorS(err, "Ignoring invalid admission namespace selector", "index", i)
+			continue
+		}
+		resp.selectors = append(resp.selectors, selector)
+	}
+	if len(resp.selectors) > 0 && namespaceLister == nil {
+		klog.InfoS("Namespaces aren't watched, admission namespace selectors will not match any requests")
+	}
+	return resp
+}
+
+// Match returns why a request is excluded, or an empty string if it isn't.
+// Only the request's metadata is used, so requests are matched before their
+// objects are converted into entities.
+func (e *Exclusions) Match(req admission.Request) string {
+	if e == nil {
+		return ""
+	}
+	if e.users.Has(req.UserInfo.Username) {
+		return fmt.Sprintf("user %s is excluded", req.UserInfo.Username)
+	}
+	if i := slices.IndexFunc(req.UserInfo.Groups, e.groups.Has); i >= 0 {
+		return fmt.Sprintf("group %s is excluded", req.UserInfo.Groups[i])
+	}
+	if i := slices.IndexFunc(e.resources, func(resource v1alpha1.AdmissionResourceExclusion) bool {
+		return resource.Matches(req.Kind)
+	}); i >= 0 {
+		return fmt.Sprintf("kind %s is excluded", kindString(req.Kind))
+	}
+	if req.Namespace == "" {
+		return ""
+	}
+	if e.namespaces.Has(req.Namespace) {
+		return fmt.Sprintf("namespace %s is excluded", req.Namespace)
+	}
+	if i := e.matchNamespaceSelector(req.Namespace); i >= 0 {
+		return fmt.Sprintf("namespace %s matches excluded namespace selector %d", req.Namespace, i)
+	}
+	return ""
+}
+
+// matchNamespaceSelector returns the index of the first selector matching a
+// namespace's labels, or -1 if none match or the namespace isn't cached
+func (e *Exclusions) matchNamespaceSelector(name string) int {
+	if len(e.selectors) == 0 || e.namespaceLister == nil {
+		return -1
+	}
+	namespace, err := e.namespaceLister.Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to get namespace from cache", "namespace", name)
+		}
+		return -1
+	}
+	namespaceLabels := labels.Set(namespace.Labels)
+	return slices.IndexFunc(e.selectors, func(selector labels.Selector) bool {
+		return selector.Matches(namespaceLabels)
+	})
+}
+
+// kindString formats a kind as group/version/kind, or version/kind for the core group
+func kindString(gvk metav1.GroupVersionKind) string {
+	if gvk.Group == "" {
+		return gvk.Version + "/" + gvk.Kind
+	}
+	return gvk.Group + "/" + gvk.Version + "/" + gvk.Kind
+}
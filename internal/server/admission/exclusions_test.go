@@ -0,0 +1,241 @@
+package admission
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+)
+
+// namespaceLister returns a lister with namespaces in its cache
+func namespaceLister(t *testing.T, namespaces ...*corev1.Namespace) corev1listers.NamespaceLister {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, namespace := range namespaces {
+		if err := indexer.Add(namespace); err != nil {
+			t.Fatalf("Failed to add namespace %s: %v", namespace.Name, err)
+		}
+	}
+	return corev1listers.NewNamespaceLister(indexer)
+}
+
+func TestExclusionsMatch(t *testing.T) {
+	synced := namespaceLister(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "platform", Labels: map[string]string{"team": "platform"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	)
+	selectorConfig := &v1alpha1.AdmissionConfig{
+		ExcludedNamespaceSelectors: []metav1.LabelSelector{
+			{MatchLabels: map[string]string{"team": "security"}},
+			{MatchLabels: map[string]string{"team": "platform"}},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		cfg       *v1alpha1.AdmissionConfig
+		lister    corev1listers.NamespaceLister
+		namespace string
+		kind      metav1.GroupVersionKind
+		username  string
+		groups    []string
+		want      string
+	}{
+		{
+			name:      "nil config excludes kube-system",
+			namespace: "kube-system",
+			want:      "namespace kube-system is excluded",
+		},
+		{
+			name:      "nil config excludes cedar-k8s-authz-system",
+			namespace: "cedar-k8s-authz-system",
+			want:      "namespace cedar-k8s-authz-system is excluded",
+		},
+		{
+			name:      "nil config doesn't exclude other namespaces",
+			namespace: "default",
+			want:      "",
+		},
+		{
+			name:      "config without excludedNamespaces excludes the defaults",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedUsers: []string{"admin"}},
+			namespace: "kube-system",
+			want:      "namespace kube-system is excluded",
+		},
+		{
+			name:      "empty excludedNamespaces excludes no namespaces",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedNamespaces: []string{}},
+			namespace: "kube-system",
+			want:      "",
+		},
+		{
+			name:      "excludedNamespaces replaces the defaults",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedNamespaces: []string{"monitoring"}},
+			namespace: "monitoring",
+			want:      "namespace monitoring is excluded",
+		},
+		{
+			name:      "excludedNamespaces doesn't exclude the defaults",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedNamespaces: []string{"monitoring"}},
+			namespace: "kube-system",
+			want:      "",
+		},
+		{
+			name: "cluster-scoped requests don't match namespaces",
+			cfg:  &v1alpha1.AdmissionConfig{ExcludedNamespaces: []string{""}},
+			kind: metav1.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+			want: "",
+		},
+		{
+			name:      "namespace selector matches namespace labels",
+			cfg:       selectorConfig,
+			lister:    synced,
+			namespace: "platform",
+			want:      "namespace platform matches excluded namespace selector 1",
+		},
+		{
+			name:      "namespace selector doesn't match other labels",
+			cfg:       selectorConfig,
+			lister:    synced,
+			namespace: "default",
+			want:      "",
+		},
+		{
+			name:      "namespace selector doesn't match uncached namespaces",
+			cfg:       selectorConfig,
+			lister:    synced,
+			namespace: "new",
+			want:      "",
+		},
+		{
+			name:      "namespace selector doesn't match before the namespace cache is synced",
+			cfg:       selectorConfig,
+			lister:    namespaceLister(t),
+			namespace: "platform",
+			want:      "",
+		},
+		{
+			name:      "namespace selector doesn't match without namespaces",
+			cfg:       selectorConfig,
+			namespace: "platform",
+			want:      "",
+		},
+		{
+			name: "kind matches any version",
+			cfg: &v1alpha1.AdmissionConfig{ExcludedResources: []v1alpha1.AdmissionResourceExclusion{
+				{Group: "coordination.k8s.io", Kind: "Lease"},
+			}},
+			namespace: "default",
+			kind:      metav1.GroupVersionKind{Group: "coordination.k8s.io", Version: "v1", Kind: "Lease"},
+			want:      "kind coordination.k8s.io/v1/Lease is excluded",
+		},
+		{
+			name: "kind matches the core group",
+			cfg: &v1alpha1.AdmissionConfig{ExcludedResources: []v1alpha1.AdmissionResourceExclusion{
+				{Version: "v1", Kind: "Event"},
+			}},
+			namespace: "default",
+			kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Event"},
+			want:      "kind v1/Event is excluded",
+		},
+		{
+			name: "kind doesn't match another version",
+			cfg: &v1alpha1.AdmissionConfig{ExcludedResources: []v1alpha1.AdmissionResourceExclusion{
+				{Group: "events.k8s.io", Version: "v1beta1", Kind: "Event"},
+			}},
+			namespace: "default",
+			kind:      metav1.GroupVersionKind{Group: "events.k8s.io", Version: "v1", Kind: "Event"},
+			want:      "",
+		},
+		{
+			name: "kind doesn't match another group",
+			cfg: &v1alpha1.AdmissionConfig{ExcludedResources: []v1alpha1.AdmissionResourceExclusion{
+				{Group: "events.k8s.io", Kind: "Event"},
+			}},
+			namespace: "default",
+			kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Event"},
+			want:      "",
+		},
+		{
+			name: "kind matches cluster-scoped requests",
+			cfg: &v1alpha1.AdmissionConfig{ExcludedResources: []v1alpha1.AdmissionResourceExclusion{
+				{Version: "v1", Kind: "Node"},
+			}},
+			kind: metav1.GroupVersionKind{Version: "v1", Kind: "Node"},
+			want: "kind v1/Node is excluded",
+		},
+		{
+			name:      "user matches exactly",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedUsers: []string{"system:serviceaccount:flux-system:kustomize-controller"}},
+			namespace: "default",
+			username:  "system:serviceaccount:flux-system:kustomize-controller",
+			want:      "user system:serviceaccount:flux-system:kustomize-controller is excluded",
+		},
+		{
+			name:      "user doesn't match a prefix",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedUsers: []string{"system:serviceaccount:flux-system"}},
+			namespace: "default",
+			username:  "system:serviceaccount:flux-system:kustomize-controller",
+			want:      "",
+		},
+		{
+			name:      "group matches any of the user's groups",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedGroups: []string{"system:masters"}},
+			namespace: "default",
+			groups:    []string{"system:authenticated", "system:masters"},
+			want:      "group system:masters is excluded",
+		},
+		{
+			name:      "group doesn't match other groups",
+			cfg:       &v1alpha1.AdmissionConfig{ExcludedGroups: []string{"system:masters"}},
+			namespace: "default",
+			groups:    []string{"system:authenticated"},
+			want:      "",
+		},
+		{
+			name: "users are matched before namespaces",
+			cfg: &v1alpha1.AdmissionConfig{
+				ExcludedNamespaces: []string{"monitoring"},
+				ExcludedUsers:      []string{"alice"},
+			},
+			namespace: "monitoring",
+			want:      "user alice is excluded",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kind := tc.kind
+			if kind.Kind == "" {
+				kind = metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+			}
+			username := tc.username
+			if username == "" {
+				username = "alice"
+			}
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:      kind,
+				Namespace: tc.namespace,
+				Operation: admissionv1.Create,
+				UserInfo:  authnv1.UserInfo{Username: username, Groups: tc.groups},
+			}}
+			if got := NewExclusions(tc.cfg, tc.lister).Match(req); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNilExclusionsMatch(t *testing.T) {
+	var exclusions *Exclusions
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Namespace: "kube-system"}}
+	if got := exclusions.Match(req); got != "" {
+		t.Errorf("Expected nil exclusions to match no requests, got %q", got)
+	}
+}
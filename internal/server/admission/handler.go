@@ -5,33 +5,85 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"slices"
+	"time"
 
 	"github.com/cedar-policy/cedar-go"
 	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"go.opentelemetry.io/otel/attribute"
 	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 )
 
 type cedarHandler struct {
-	stores         store.TieredPolicyStores
-	allStoresReady bool
-	allowOnError   bool
+	stores          store.TieredPolicyStores
+	entityStores    store.TieredEntityStores
+	allStoresReady  bool
+	clusterMetadata *entities.ClusterMetadata
+	namespaces      *entities.Namespaces
+	principals      *entities.Principals
+	exclusions      *Exclusions
+	resourceSchema  schema.CedarSchema
+
+	evaluationTimeout time.Duration
+	timeoutAllowed    bool
+
+	decisionLog *decisionlog.Logger
 }
 
-var _ admission.Handler = &cedarHandler{}
+var _ Handler = &cedarHandler{}
 
-func NewHandler(stores []store.PolicyStore, allowOnError bool) admission.Handler {
-	return &cedarHandler{
-		stores:       stores,
-		allowOnError: allowOnError,
+// Options are the optional dependencies of a Handler. The zero Options
+// evaluates every request without a timeout, decision log, or entities other
+// than the request's.
+type Options struct {
+	// Exclusions match requests that are allowed without evaluating policies
+	Exclusions *Exclusions
+	// ResourceSchema converts objects of the types in it into entities that
+	// match the schema
+	ResourceSchema schema.CedarSchema
+	// Evaluation with a Timeout returns its fallback decision for requests
+	// that aren't evaluated in time
+	Evaluation *config.EvaluationConfig
+	// DecisionLog is written each evaluated decision
+	DecisionLog *decisionlog.Logger
+	// ClusterMetadata is added to every request context
+	ClusterMetadata *entities.ClusterMetadata
+	// Namespaces are added to the entities and context of namespaced requests
+	Namespaces *entities.Namespaces
+	// Principals add attributes to service account and node principals
+	Principals *entities.Principals
+	// EntityStores entities are merged into the entities of every request
+	EntityStores store.TieredEntityStores
+}
+
+// NewHandler creates a Cedar admission handler for stores
+func NewHandler(stores []store.PolicyStore, opts Options) Handler {
+	resp := &cedarHandler{
+		stores:          stores,
+		entityStores:    opts.EntityStores,
+		clusterMetadata: opts.ClusterMetadata,
+		namespaces:      opts.Namespaces,
+		principals:      opts.Principals,
+		exclusions:      opts.Exclusions,
+		resourceSchema:  opts.ResourceSchema,
+		decisionLog:     opts.DecisionLog,
+	}
+	if opts.Evaluation != nil {
+		resp.evaluationTimeout = opts.Evaluation.Timeout
+		resp.timeoutAllowed = opts.Evaluation.FallbackDecision == config.FallbackDecisionAllow
 	}
+	return resp
 }
 
 func allowedResponse(uid types.UID) admission.Response {
@@ -40,75 +92,215 @@ func allowedResponse(uid types.UID) admission.Response {
 	return resp
 }
 
-func (h *cedarHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
-	// for now, skip some namespaces
-	if slices.Contains([]string{"kube-system", "cedar-k8s-authz-system"}, req.Namespace) {
-		return allowedResponse(req.UID)
+func (h *cedarHandler) Handle(ctx context.Context, req admission.Request) (resp admission.Response) {
+	start := time.Now()
+	timedOut := false
+	ctx, span := tracing.Start(ctx, "Admit")
+	defer func() {
+		recordRequest(ctx, resp, timedOut, time.Since(start))
+		span.SetAttributes(attribute.Bool("cedar.allowed", resp.Allowed))
+		span.End()
+	}()
+
+	if exclusion := h.exclusions.Match(req); exclusion != "" {
+		klog.V(5).InfoS("Request excluded from admission policies", "uid", req.UID, "exclusion", exclusion)
+		h.logUnevaluatedDecision(req, decisionlog.SourceExcluded, exclusion, time.Since(start))
+		resp := allowedResponse(req.UID)
+		resp.AuditAnnotations = exclusionAuditAnnotations(exclusion)
+		return resp
 	}
 
 	if !h.allStoresReady {
 		for i, store := range h.stores {
 			if !store.InitalPolicyLoadComplete() {
 				klog.V(2).Infof("policy store [%d] (%s) not ready, emitting allow response", i, store.Name())
+				h.logUnevaluatedDecision(req, decisionlog.SourceNotLoaded, "", time.Since(start))
+				return allowedResponse(req.UID)
+			}
+		}
+		for i, store := range h.entityStores {
+			if !store.InitalEntityLoadComplete() {
+				klog.V(2).Infof("entity store [%d] (%s) not ready, emitting allow response", i, store.Name())
+				h.logUnevaluatedDecision(req, decisionlog.SourceNotLoaded, "", time.Since(start))
 				return allowedResponse(req.UID)
 			}
 		}
 		h.allStoresReady = true
 	}
 
-	allowed, diagnostics, err := h.review(req)
+	if h.evaluationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.evaluationTimeout)
+		defer cancel()
+	}
+	reviewed, err := h.review(ctx, req)
+	if err != nil && ctx.Err() != nil {
+		timedOut = true
+		return h.timeoutResponse(ctx, req, reviewed.request, err, time.Since(start))
+	}
 	if err != nil {
 		klog.V(3).ErrorS(err, "error during review")
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
-	reasons := []byte{}
-	if diagnostics != nil && len(diagnostics.Reasons) > 0 {
-		reasons, _ = json.Marshal(diagnostics.Reasons)
+	message := ""
+	if reviewed.diagnostics != nil {
+		message = h.stores.ReasonString(*reviewed.diagnostics)
 	}
 
 	vResp := admission.Response{
 		AdmissionResponse: admissionv1.AdmissionResponse{
 			UID:     req.UID,
-			Allowed: allowed,
+			Allowed: reviewed.allowed,
 			Result: &metav1.Status{
 				Code:    http.StatusOK,
-				Message: string(reasons),
+				Message: message,
 			},
+			AuditAnnotations: reviewed.auditAnnotations,
+			Warnings:         reviewed.warnings,
 		},
 	}
 	return vResp
 }
 
-func (h *cedarHandler) review(req admission.Request) (bool, *cedar.Diagnostic, error) {
+// recordRequest counts an admission response and its latency by decision
+func recordRequest(ctx context.Context, resp admission.Response, timedOut bool, latency time.Duration) {
+	decision := decisionString(cedar.Deny)
+	switch {
+	case timedOut:
+		decision = "timeout"
+	case resp.Result != nil && resp.Result.Code == http.StatusInternalServerError:
+		decision = "<error>"
+	case resp.Allowed:
+		decision = decisionString(cedar.Allow)
+	}
+	metrics.RecordAdmissionRequestTotal(ctx, decision)
+	metrics.RecordAdmissionRequestLatency(ctx, decision, latency.Seconds())
+}
+
+// timeoutResponse returns the fallback decision for a request that wasn't
+// evaluated before its context was done, with fallback audit annotations, and
+// logs it to the decision log.
+// cedarReq is empty if the request timed out before it was built.
+func (h *cedarHandler) timeoutResponse(ctx context.Context, req admission.Request, cedarReq cedartypes.Request, err error, latency time.Duration) admission.Response {
+	decision := decisionString(cedar.Deny)
+	if h.timeoutAllowed {
+		decision = decisionString(cedar.Allow)
+	}
+	klog.ErrorS(err, "Admission evaluation did not complete, returning fallback decision", "uid", req.UID, "timeout", h.evaluationTimeout, "decision", decision)
+	metrics.RecordEvaluationTimeout(ctx, "admission", decision)
+	if cedarReq.Principal == (cedartypes.EntityUID{}) {
+		cedarReq = requestUIDs(req)
+	}
+	h.logDecision(req, cedarReq, h.timeoutAllowed, store.TieredDiagnostic{Tier: -1}, latency, true)
+	message := fmt.Sprintf("evaluation did not complete within %s", h.evaluationTimeout)
+	return admission.Response{
+		AdmissionResponse: admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: h.timeoutAllowed,
+			Result: &metav1.Status{
+				Code:    http.StatusOK,
+				Message: message,
+			},
+			AuditAnnotations: fallbackAuditAnnotations(h.timeoutAllowed, message),
+		},
+	}
+}
+
+// reviewResult is the outcome of evaluating an admission request
+type reviewResult struct {
+	// request is the Cedar request, which is also set if evaluating it failed
+	request cedartypes.Request
+	allowed bool
+	// diagnostics are used for the response message
+	diagnostics *store.TieredDiagnostic
+	// warnings are the messages of warn policies that apply to the request
+	warnings         []string
+	auditAnnotations map[string]string
+}
+
+func (h *cedarHandler) review(ctx context.Context, req admission.Request) (reviewResult, error) {
 	if reqJSON, err := json.Marshal(req); err != nil {
 		klog.V(8).Info("Reviewing request ", string(reqJSON))
 	} else {
 		klog.V(8).Infof("Reviewing request: %#v", req)
 	}
 
+	start := time.Now()
+	requestEntities, cedarReq, err := h.cedarRequest(ctx, req)
+	if err != nil {
+		return reviewResult{}, err
+	}
+	metrics.RecordEntityConstructionLatency(ctx, "admission", time.Since(start).Seconds())
+	klog.V(9).InfoS("Request evaluation input", "uid", req.UID, "request", cedarReq)
+	decision, diagnostics, err := h.stores.IsAuthorized(ctx, requestEntities, cedarReq)
+	if err != nil {
+		return reviewResult{request: cedarReq}, fmt.Errorf("error evaluating policies: %w", err)
+	}
+	klog.V(9).InfoS("Policy decision", "uid", req.UID, "decision", decision, "diagnostics", diagnostics)
+	h.evaluateAuditPolicies(ctx, req, requestEntities, cedarReq, decision)
+	warnings := h.warnings(req, requestEntities, cedarReq)
+	allowed, resultDiagnostics := h.result(req, decision, diagnostics)
+	h.logDecision(req, cedarReq, allowed, diagnostics, time.Since(start), false)
+	return reviewResult{
+		request:          cedarReq,
+		allowed:          allowed,
+		diagnostics:      resultDiagnostics,
+		warnings:         warningStrings(warnings),
+		auditAnnotations: h.auditAnnotations(allowed, diagnostics),
+	}, nil
+}
+
+// warnings returns the warn policies that apply to a request. They never
+// change the enforced decision.
+func (h *cedarHandler) warnings(req admission.Request, requestEntities cedartypes.EntityMap, cedarReq cedartypes.Request) []store.PolicyReason {
+	warnings, warnErrors := h.stores.Warnings(requestEntities, cedarReq)
+	if len(warnErrors) > 0 {
+		klog.ErrorS(nil, "Warn policy evaluation errors", "uid", req.UID, "errors", warnErrors)
+	}
+	if len(warnings) > 0 {
+		klog.V(5).InfoS("Warn policies applied to request", "uid", req.UID, "policies", warnings)
+	}
+	return warnings
+}
+
+// warningStrings formats warn policies as admission response warnings
+func warningStrings(warnings []store.PolicyReason) []string {
+	if len(warnings) == 0 {
+		return nil
+	}
+	resp := make([]string, 0, len(warnings))
+	for _, warning := range warnings {
+		resp = append(resp, warning.String())
+	}
+	return resp
+}
+
+// cedarRequest builds the entities and Cedar request for an admission request
+func (h *cedarHandler) cedarRequest(ctx context.Context, req admission.Request) (cedartypes.EntityMap, cedartypes.Request, error) {
 	principalEntity, requestEntities, err := entities.CedarPrincipalEntitesFromAdmissionRequest(req)
 	if err != nil {
-		return h.allowOnError, nil, fmt.Errorf("error converting request to Cedar principal entity: %w", err)
+		return nil, cedartypes.Request{}, fmt.Errorf("error converting request to Cedar principal entity: %w", err)
 	}
+	h.principals.AddAttributes(*principalEntity, requestEntities)
 	var resourceEntity *cedartypes.Entity
 
 	if req.Operation == "DELETE" {
-		resourceEntity, err = entities.CedarOldResourceEntityFromAdmissionRequest(req)
+		resourceEntity, err = entities.CedarOldResourceEntityFromAdmissionRequest(ctx, req, h.resourceSchema)
 		if err != nil {
-			return h.allowOnError, nil, fmt.Errorf("error converting oldObject to Cedar entity: %w", err)
+			return nil, cedartypes.Request{}, fmt.Errorf("error converting oldObject to Cedar entity: %w", err)
 		}
 	} else {
-		resourceEntity, err = entities.CedarResourceEntityFromAdmissionRequest(req)
+		resourceEntity, err = entities.CedarResourceEntityFromAdmissionRequest(ctx, req, h.resourceSchema)
 		if err != nil {
-			return h.allowOnError, nil, fmt.Errorf("error converting request to Cedar resource entity: %w", err)
+			return nil, cedartypes.Request{}, fmt.Errorf("error converting request to Cedar resource entity: %w", err)
 		}
 	}
 
 	var oldObject *cedartypes.Entity
 	if req.OldObject.Raw != nil && req.Operation != "DELETE" {
-		oldObject, err = entities.CedarOldResourceEntityFromAdmissionRequest(req)
+		oldObject, err = entities.CedarOldResourceEntityFromAdmissionRequest(ctx, req, h.resourceSchema)
 		if err != nil {
-			return h.allowOnError, nil, fmt.Errorf("error converting oldObject to Cedar entity: %w", err)
+			return nil, cedartypes.Request{}, fmt.Errorf("error converting oldObject to Cedar entity: %w", err)
 		}
 
 		// The old object and new object will have the same UID, and to differentiate them
@@ -127,7 +319,7 @@ func (h *cedarHandler) review(req admission.Request) (bool, *cedar.Diagnostic, e
 
 	actionEntityUID, err := entities.CedarActionEntityFromAdmissionRequest(req)
 	if err != nil {
-		return h.allowOnError, nil, fmt.Errorf("error converting request to Cedar action entity: %w", err)
+		return nil, cedartypes.Request{}, fmt.Errorf("error converting request to Cedar action entity: %w", err)
 	}
 
 	entities.MergeIntoEntities(requestEntities, entities.AdmissionActionEntities()...)
@@ -136,6 +328,13 @@ func (h *cedarHandler) review(req admission.Request) (bool, *cedar.Diagnostic, e
 	if oldObject != nil {
 		context["oldObject"] = oldObject.Attributes
 	}
+	h.clusterMetadata.AddToContext(context)
+	h.namespaces.AddToRequest(req.Namespace, requestEntities, context)
+	h.namespaces.AddObjectToContext(req.Namespace, context)
+	if err := entities.AddAdmissionRequestToContext(ctx, req, context); err != nil {
+		return nil, cedartypes.Request{}, fmt.Errorf("error converting request to Cedar context: %w", err)
+	}
+	h.entityStores.AddToRequest(*principalEntity, requestEntities)
 
 	klog.V(6).InfoS("Request evaluation input",
 		"entities", requestEntities,
@@ -151,17 +350,121 @@ func (h *cedarHandler) review(req admission.Request) (bool, *cedar.Diagnostic, e
 		Action:    actionEntityUID,
 		Context:   cedartypes.NewRecord(context),
 	}
-	klog.V(9).InfoS("Request evaluation input", "uid", req.UID, "request", cedarReq)
-	decision, diagnostics := h.stores.IsAuthorized(requestEntities, cedarReq)
-	klog.V(9).InfoS("Policy decision", "uid", req.UID, "decision", decision, "diagnostics", diagnostics)
+	return requestEntities, cedarReq, nil
+}
+
+// result converts a policy decision into if the request is allowed, and the
+// diagnostics used for the response message
+func (h *cedarHandler) result(req admission.Request, decision cedar.Decision, diagnostics store.TieredDiagnostic) (bool, *store.TieredDiagnostic) {
+	if decision == cedar.Deny && len(diagnostics.Reasons) == 0 && len(diagnostics.Errors) > 0 {
+		// a policy store with errors stopped evaluation without a decision, so
+		// the allow-all policy wasn't reached and the request is denied
+		klog.ErrorS(nil, "Policy evaluation errors, no decision made, request denied", "uid", req.UID, "errors", h.stores.ErrorString(diagnostics))
+		return false, &diagnostics
+	}
 	if decision == cedar.Deny {
-		if len(diagnostics.Reasons) == 0 && len(diagnostics.Errors) == 0 {
+		if len(diagnostics.Reasons) == 0 {
 			// should never reach this with the always allow policy
 			klog.Error("Request denied without reasons, somehow the default permit policy didn't get evaluated")
 		}
 		klog.V(5).InfoS("Request denied", "uid", req.UID, "diagnostics", diagnostics)
-		return false, &diagnostics, nil
+		return false, &diagnostics
 	}
 	klog.V(5).InfoS("No forbid policies applied, request allowed", "uid", req.UID)
-	return true, nil, nil
+	return true, nil
+}
+
+// logDecision writes an evaluated or timed out decision to the decision log
+func (h *cedarHandler) logDecision(req admission.Request, cedarReq cedartypes.Request, allowed bool, diagnostics store.TieredDiagnostic, latency time.Duration, timedOut bool) {
+	if h.decisionLog == nil {
+		return
+	}
+	record := decisionRecord(req, cedarReq, allowed, latency)
+	record.Policies = decisionlog.Policies(h.stores.Reasons(diagnostics))
+	record.Store = h.stores.DecidingStore(diagnostics)
+	record.TimedOut = timedOut
+	h.decisionLog.Log(record)
+}
+
+// logUnevaluatedDecision writes a request that was allowed without evaluating
+// policies to the decision log, such as an excluded request
+func (h *cedarHandler) logUnevaluatedDecision(req admission.Request, source, reason string, latency time.Duration) {
+	if h.decisionLog == nil {
+		return
+	}
+	record := decisionRecord(req, requestUIDs(req), true, latency)
+	record.Source = source
+	record.Reason = reason
+	h.decisionLog.Log(record)
+}
+
+// requestUIDs returns a Cedar request with the principal and action of an
+// admission request. Building them doesn't depend on the object, so the
+// resource is left empty.
+func requestUIDs(req admission.Request) cedartypes.Request {
+	var cedarReq cedartypes.Request
+	if principal, _, err := entities.CedarPrincipalEntitesFromAdmissionRequest(req); err == nil {
+		cedarReq.Principal = *principal
+	}
+	cedarReq.Action, _ = entities.CedarActionEntityFromAdmissionRequest(req)
+	return cedarReq
+}
+
+// decisionRecord returns the decision log record of an admission decision.
+// The resource is omitted if cedarReq doesn't have one.
+func decisionRecord(req admission.Request, cedarReq cedartypes.Request, allowed bool, latency time.Duration) decisionlog.Record {
+	decision := decisionString(cedar.Deny)
+	if allowed {
+		decision = decisionString(cedar.Allow)
+	}
+	resource := ""
+	if cedarReq.Resource != (cedartypes.EntityUID{}) {
+		resource = cedarReq.Resource.String()
+	}
+	return decisionlog.Record{
+		Webhook: decisionlog.WebhookAdmission,
+		Principal: decisionlog.Principal{
+			Type:   string(cedarReq.Principal.Type),
+			UID:    string(cedarReq.Principal.ID),
+			Name:   req.UserInfo.Username,
+			Groups: req.UserInfo.Groups,
+		},
+		Action:         cedarReq.Action.String(),
+		Resource:       resource,
+		Namespace:      req.Namespace,
+		Decision:       decision,
+		LatencySeconds: latency.Seconds(),
+	}
+}
+
+// evaluateAuditPolicies logs and counts the decision that audit policies would
+// have made. It never changes the enforced decision.
+func (h *cedarHandler) evaluateAuditPolicies(ctx context.Context, req admission.Request, requestEntities cedartypes.EntityMap, cedarReq cedartypes.Request, decision cedar.Decision) {
+	if !h.stores.HasAuditPolicies() {
+		return
+	}
+	auditDecision, auditDiagnostic := h.stores.AuditIsAuthorized(requestEntities, cedarReq)
+	if len(auditDiagnostic.Errors) > 0 {
+		klog.ErrorS(nil, "Audit policy evaluation errors", "uid", req.UID, "errors", auditDiagnostic.Errors)
+	}
+	if len(auditDiagnostic.Reasons) == 0 {
+		return
+	}
+	klog.InfoS("Audit policies applied to request",
+		"uid", req.UID,
+		"principal", cedarReq.Principal,
+		"action", cedarReq.Action,
+		"resource", cedarReq.Resource,
+		"decision", decisionString(decision),
+		"auditDecision", decisionString(auditDecision),
+		"policies", store.DiagnosticPolicyIDs(auditDiagnostic.Diagnostic),
+	)
+	metrics.RecordAuditDecision(ctx, "admission", decisionString(decision), decisionString(auditDecision))
+}
+
+func decisionString(decision cedar.Decision) string {
+	if decision == cedar.Allow {
+		return "Allow"
+	}
+	return "Deny"
 }
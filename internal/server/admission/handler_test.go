@@ -0,0 +1,375 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	admissionv1 "k8s.io/api/admission/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// testStores returns a policy store tier for policies with options, followed
+// by the default allow-all admission policy
+func testStores(t *testing.T, policies string, options store.TierOptions) store.TieredPolicyStores {
+	t.Helper()
+	policyStore, err := store.NewMemoryStore("policies.cedar", []byte(policies), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", AllowAllAdmissionPolicy())
+	return store.TieredPolicyStores{store.WithTierOptions(policyStore, options), store.StaticStore(*pset)}
+}
+
+// podRequest returns a request to create a pod in a namespace
+func podRequest(t *testing.T, namespace string) admission.Request {
+	t.Helper()
+	pod := corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace, Labels: map[string]string{"app": "web"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+	}
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatalf("Failed to marshal pod: %v", err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		UID:       "705ab4f5-6393-11e8-b7cc-42010a800002",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      "web",
+		Namespace: namespace,
+		Operation: admissionv1.Create,
+		UserInfo:  authnv1.UserInfo{Username: "alice", Groups: []string{"developers"}},
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func TestHandleEvaluationErrors(t *testing.T) {
+	// the policy errors on every pod, as pods have no spec.missing attribute
+	erroringForbid := `forbid (
+    principal,
+    action == k8s::admission::Action::"create",
+    resource is core::v1::Pod
+) when {
+    resource.spec.missing == true
+};`
+
+	cases := []struct {
+		name        string
+		onError     string
+		wantAllowed bool
+	}{
+		{name: "default onError denies", onError: "", wantAllowed: false},
+		{name: "noOpinion denies", onError: v1alpha1.OnErrorNoOpinion, wantAllowed: false},
+		{name: "deny denies", onError: v1alpha1.OnErrorDeny, wantAllowed: false},
+		{name: "skip reaches the allow-all policy", onError: v1alpha1.OnErrorSkip, wantAllowed: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := testStores(t, erroringForbid, store.TierOptions{OnError: tc.onError})
+			handler := NewHandler(stores, Options{})
+			resp := handler.Handle(context.Background(), podRequest(t, "default"))
+			if resp.Allowed != tc.wantAllowed {
+				t.Errorf("expected allowed %v, got %v: %v", tc.wantAllowed, resp.Allowed, resp.Result)
+			}
+
+			evaluation, err := handler.Evaluate(context.Background(), podRequest(t, "default"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if evaluation.Allowed != tc.wantAllowed {
+				t.Errorf("expected evaluation allowed %v, got %v", tc.wantAllowed, evaluation.Allowed)
+			}
+		})
+	}
+}
+
+func TestHandleTimeoutDecisionLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	decisionLog, err := decisionlog.New(&config.DecisionLogConfig{Path: path, MaxSize: 1, AllowSampleRate: 0})
+	if err != nil {
+		t.Fatalf("Failed to create decision log: %v", err)
+	}
+	stores := testStores(t, `permit(principal, action, resource);`, store.TierOptions{})
+	handler := NewHandler(stores, Options{
+		Evaluation:  &config.EvaluationConfig{Timeout: time.Minute, FallbackDecision: config.FallbackDecisionDeny},
+		DecisionLog: decisionLog,
+	})
+
+	// a request whose deadline has already passed never completes evaluation
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	if resp := handler.Handle(ctx, podRequest(t, "default")); resp.Allowed {
+		t.Fatalf("Expected the Deny fallback decision, got %v", resp.Result)
+	}
+	if err := decisionLog.Close(); err != nil {
+		t.Fatalf("Failed to close decision log: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read decision log: %v", err)
+	}
+	var got decisionlog.Record
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to parse decision log %s: %v", data, err)
+	}
+	want := decisionlog.Record{
+		Webhook: decisionlog.WebhookAdmission,
+		Principal: decisionlog.Principal{
+			Type:   "k8s::User",
+			UID:    "alice",
+			Name:   "alice",
+			Groups: []string{"developers"},
+		},
+		Action:    `k8s::admission::Action::"create"`,
+		Namespace: "default",
+		Decision:  "Deny",
+		Policies:  []decisionlog.Policy{},
+		TimedOut:  true,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(decisionlog.Record{}, "Time", "LatencySeconds")); diff != "" {
+		t.Errorf("Unexpected decision log record (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandleUnevaluatedDecisionLog(t *testing.T) {
+	cases := []struct {
+		name          string
+		namespace     string
+		storeComplete bool
+		want          decisionlog.Record
+	}{
+		{
+			name:          "excluded namespace",
+			namespace:     "kube-system",
+			storeComplete: true,
+			want: decisionlog.Record{
+				Namespace: "kube-system",
+				Source:    decisionlog.SourceExcluded,
+				Reason:    "namespace kube-system is excluded",
+			},
+		},
+		{
+			name:      "policies not loaded",
+			namespace: "default",
+			want: decisionlog.Record{
+				Namespace: "default",
+				Source:    decisionlog.SourceNotLoaded,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "decisions.log")
+			decisionLog, err := decisionlog.New(&config.DecisionLogConfig{Path: path, MaxSize: 1, AllowSampleRate: 1})
+			if err != nil {
+				t.Fatalf("Failed to create decision log: %v", err)
+			}
+			policyStore, err := store.NewMemoryStore("policies.cedar", []byte(`forbid(principal, action, resource);`), tc.storeComplete)
+			if err != nil {
+				t.Fatalf("Failed to create policy store: %v", err)
+			}
+			handler := NewHandler([]store.PolicyStore{policyStore}, Options{
+				Exclusions:  NewExclusions(nil, nil),
+				DecisionLog: decisionLog,
+			})
+			if resp := handler.Handle(context.Background(), podRequest(t, tc.namespace)); !resp.Allowed {
+				t.Fatalf("Expected the request to be allowed, got %v", resp.Result)
+			}
+			if err := decisionLog.Close(); err != nil {
+				t.Fatalf("Failed to close decision log: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read decision log: %v", err)
+			}
+			var got decisionlog.Record
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Failed to parse decision log %s: %v", data, err)
+			}
+			tc.want.Webhook = decisionlog.WebhookAdmission
+			tc.want.Principal = decisionlog.Principal{
+				Type:   "k8s::User",
+				UID:    "alice",
+				Name:   "alice",
+				Groups: []string{"developers"},
+			}
+			tc.want.Action = `k8s::admission::Action::"create"`
+			tc.want.Decision = "Allow"
+			tc.want.Policies = []decisionlog.Policy{}
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(decisionlog.Record{}, "Time", "LatencySeconds")); diff != "" {
+				t.Errorf("Unexpected decision log record (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleTimeoutAuditAnnotations(t *testing.T) {
+	cases := []struct {
+		name     string
+		fallback string
+		want     map[string]string
+	}{
+		{
+			name:     "deny fallback",
+			fallback: config.FallbackDecisionDeny,
+			want: map[string]string{
+				AuditAnnotationDecision: "Deny",
+				AuditAnnotationFallback: "evaluation did not complete within 1m0s",
+			},
+		},
+		{
+			name:     "allow fallback",
+			fallback: config.FallbackDecisionAllow,
+			want: map[string]string{
+				AuditAnnotationDecision: "Allow",
+				AuditAnnotationFallback: "evaluation did not complete within 1m0s",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := testStores(t, `permit(principal, action, resource);`, store.TierOptions{})
+			handler := NewHandler(stores, Options{
+				Evaluation: &config.EvaluationConfig{Timeout: time.Minute, FallbackDecision: tc.fallback},
+			})
+
+			// a request whose deadline has already passed never completes evaluation
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+			defer cancel()
+			resp := handler.Handle(ctx, podRequest(t, "default"))
+			if diff := cmp.Diff(tc.want, resp.AuditAnnotations); diff != "" {
+				t.Errorf("Unexpected audit annotations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleAuditAnnotations(t *testing.T) {
+	policies := `permit (
+    principal,
+    action == k8s::admission::Action::"create",
+    resource is core::v1::Pod
+) when {
+    resource.metadata.namespace == "default"
+};
+
+forbid (
+    principal,
+    action == k8s::admission::Action::"create",
+    resource is core::v1::Pod
+) when {
+    resource.metadata.namespace == "prod"
+};`
+
+	cases := []struct {
+		name        string
+		namespace   string
+		wantAllowed bool
+		want        map[string]string
+	}{
+		{
+			name:        "allowed by a policy",
+			namespace:   "default",
+			wantAllowed: true,
+			want: map[string]string{
+				AuditAnnotationDecision: "Allow",
+				AuditAnnotationPolicies: "policy0",
+				AuditAnnotationStore:    "policies.cedar",
+				AuditAnnotationTier:     "0",
+			},
+		},
+		{
+			name:        "denied by a policy",
+			namespace:   "prod",
+			wantAllowed: false,
+			want: map[string]string{
+				AuditAnnotationDecision: "Deny",
+				AuditAnnotationPolicies: "policy1",
+				AuditAnnotationStore:    "policies.cedar",
+				AuditAnnotationTier:     "0",
+			},
+		},
+		{
+			name:        "allowed by the allow-all policy",
+			namespace:   "staging",
+			wantAllowed: true,
+			want: map[string]string{
+				AuditAnnotationDecision: "Allow",
+				AuditAnnotationPolicies: "allow-all-admission",
+				AuditAnnotationStore:    "StaticStore",
+				AuditAnnotationTier:     "1",
+			},
+		},
+		{
+			name:        "excluded namespace",
+			namespace:   "kube-system",
+			wantAllowed: true,
+			want: map[string]string{
+				AuditAnnotationDecision:  "Allow",
+				AuditAnnotationExclusion: "namespace kube-system is excluded",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := testStores(t, policies, store.TierOptions{})
+			handler := NewHandler(stores, Options{Exclusions: NewExclusions(nil, nil)})
+			resp := handler.Handle(context.Background(), podRequest(t, tc.namespace))
+			if resp.Allowed != tc.wantAllowed {
+				t.Errorf("expected allowed %v, got %v: %v", tc.wantAllowed, resp.Allowed, resp.Result)
+			}
+			if diff := cmp.Diff(tc.want, resp.AuditAnnotations); diff != "" {
+				t.Errorf("Unexpected audit annotations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleAuditAnnotationsPolicyIDCollision(t *testing.T) {
+	// both stores name their first policy policy0
+	first, err := store.NewMemoryStore("first.cedar", []byte(`forbid (principal, action, resource) when { resource.metadata.namespace == "prod" };`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	second, err := store.NewMemoryStore("second.cedar", []byte(`forbid (principal, action, resource) when { resource.metadata.namespace == "staging" };`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", AllowAllAdmissionPolicy())
+	handler := NewHandler(store.TieredPolicyStores{first, second, store.StaticStore(*pset)}, Options{})
+
+	resp := handler.Handle(context.Background(), podRequest(t, "staging"))
+	if resp.Allowed {
+		t.Fatalf("Expected the request to be denied, got %v", resp.Result)
+	}
+	want := map[string]string{
+		AuditAnnotationDecision: "Deny",
+		AuditAnnotationPolicies: "policy0",
+		AuditAnnotationStore:    "second.cedar",
+		AuditAnnotationTier:     "1",
+	}
+	if diff := cmp.Diff(want, resp.AuditAnnotations); diff != "" {
+		t.Errorf("Unexpected audit annotations (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,41 @@
+package admission
+
+import (
+	"context"
+	"sync/atomic"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ReloadableHandler is a Handler that delegates to a handler that can be
+// replaced while requests are served, such as when the store config is reloaded
+type ReloadableHandler struct {
+	current atomic.Pointer[Handler]
+}
+
+// NewReloadableHandler creates a ReloadableHandler that delegates to handler
+func NewReloadableHandler(handler Handler) *ReloadableHandler {
+	resp := &ReloadableHandler{}
+	resp.Set(handler)
+	return resp
+}
+
+// Set replaces the handler. Requests already being evaluated complete with the
+// previous handler.
+func (r *ReloadableHandler) Set(handler Handler) {
+	r.current.Store(&handler)
+}
+
+func (r *ReloadableHandler) get() Handler {
+	return *r.current.Load()
+}
+
+func (r *ReloadableHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	return r.get().Handle(ctx, req)
+}
+
+func (r *ReloadableHandler) Evaluate(ctx context.Context, req admission.Request) (Evaluation, error) {
+	return r.get().Evaluate(ctx, req)
+}
+
+var _ Handler = &ReloadableHandler{}
@@ -5,120 +5,359 @@ import (
 	"encoding/json"
 	"fmt"
 	"maps"
-	"strings"
+	"time"
 
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
-	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 	"github.com/cedar-policy/cedar-go"
 	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/klog/v2"
 )
 
-// Authorizer makes authorization decisions
+// Authorizer makes authorization decisions, and resolves the rules a user is granted
 type Authorizer interface {
 	Authorize(context.Context, authorizer.Attributes) (authorizer.Decision, string, error)
+	// Evaluate returns the decision for a request and the policies that determined it
+	Evaluate(context.Context, authorizer.Attributes) (Evaluation, error)
+	RulesFor(context.Context, user.Info, string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error)
+}
+
+// Options are the optional dependencies of an Authorizer. The zero Options
+// evaluates requests without a decision cache, timeout, decision log, or
+// entities other than the request's.
+type Options struct {
+	// DecisionCache caches decisions if it is non-nil and enabled
+	DecisionCache *config.DecisionCacheConfig
+	// Evaluation with a Timeout returns its fallback decision for requests
+	// that aren't evaluated in time
+	Evaluation *config.EvaluationConfig
+	// DecisionLog is written each evaluated decision
+	DecisionLog *decisionlog.Logger
+	// ClusterMetadata is added to every request context
+	ClusterMetadata *entities.ClusterMetadata
+	// Namespaces are added to the entities and context of namespaced requests
+	Namespaces *entities.Namespaces
+	// Principals add attributes to service account and node principals
+	Principals *entities.Principals
+	// EntityStores entities, such as nested groups, are merged into the
+	// entities of every request
+	EntityStores store.TieredEntityStores
 }
 
 // NewAuthorizer creates a Cedar authorizer.
-// Each store takes priority over the susequent stores
-func NewAuthorizer(stores ...store.PolicyStore) Authorizer {
-	return &cedarWebhookAuthorizer{stores: stores}
+// Each store takes priority over the susequent stores. Principal rules from
+// authorizerConfig are matched before policies are evaluated.
+func NewAuthorizer(authorizerConfig *v1alpha1.AuthorizerConfig, opts Options, stores ...store.PolicyStore) Authorizer {
+	resp := &cedarWebhookAuthorizer{
+		stores:          stores,
+		entityStores:    opts.EntityStores,
+		rules:           principalRulesOrDefault(authorizerConfig),
+		clusterMetadata: opts.ClusterMetadata,
+		namespaces:      opts.Namespaces,
+		principals:      opts.Principals,
+		decisionLog:     opts.DecisionLog,
+	}
+	if opts.Evaluation != nil {
+		resp.evaluationTimeout = opts.Evaluation.Timeout
+		resp.fallbackDecision = fallbackDecision(opts.Evaluation.FallbackDecision)
+	}
+	if opts.DecisionCache != nil {
+		resp.cache = newDecisionCache(opts.DecisionCache.Size, opts.DecisionCache.TTL, resp.evaluationTimeout)
+	}
+	return resp
 }
 
 type cedarWebhookAuthorizer struct {
 	stores       store.TieredPolicyStores
+	entityStores store.TieredEntityStores
 	storesLoaded bool
+	cache        *decisionCache
+	rules        []v1alpha1.PrincipalRule
+
+	evaluationTimeout time.Duration
+	fallbackDecision  authorizer.Decision
+
+	decisionLog *decisionlog.Logger
+
+	clusterMetadata *entities.ClusterMetadata
+	namespaces      *entities.Namespaces
+	principals      *entities.Principals
 }
 
-func (e *cedarWebhookAuthorizer) Authorize(ctx context.Context, requestAttributes authorizer.Attributes) (authorizer.Decision, string, error) {
-	// Always allow self to read policies
-	if requestAttributes.GetUser().GetName() == options.CedarAuthorizerIdentityName &&
-		requestAttributes.IsReadOnly() &&
-		requestAttributes.GetAPIGroup() == "cedar.k8s.aws" &&
-		requestAttributes.GetResource() == "policies" {
-		return authorizer.DecisionAllow, "cedar authorizer is always allowed to access policies", nil
-	}
+func (e *cedarWebhookAuthorizer) Authorize(ctx context.Context, requestAttributes authorizer.Attributes) (decision authorizer.Decision, reason string, err error) {
+	ctx, span := tracing.Start(ctx, "Authorize")
+	defer func() {
+		span.SetAttributes(tracing.DecisionKey.String(decisionString(decision)))
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
 
-	if requestAttributes.GetUser().GetName() == options.CedarAuthorizerIdentityName &&
-		requestAttributes.IsReadOnly() &&
-		requestAttributes.GetAPIGroup() == "rbac.authorization.k8s.io" {
-		return authorizer.DecisionAllow, "cedar authorizer is always allowed to read RBAC policies", nil
+	start := time.Now()
+	rule := matchPrincipalRules(e.rules, requestAttributes)
+	switch rule.Action {
+	case v1alpha1.PrincipalRuleActionAllow:
+		e.logUnevaluatedDecision(requestAttributes, authorizer.DecisionAllow, decisionlog.SourcePrincipalRule, rule.Reason, time.Since(start))
+		return authorizer.DecisionAllow, rule.Reason, nil
+	case v1alpha1.PrincipalRuleActionNoOpinion:
+		e.logUnevaluatedDecision(requestAttributes, authorizer.DecisionNoOpinion, decisionlog.SourcePrincipalRule, rule.Reason, time.Since(start))
+		return authorizer.DecisionNoOpinion, "", nil
 	}
 
-	if strings.HasPrefix(requestAttributes.GetUser().GetName(), "system:") &&
-		!strings.HasPrefix(requestAttributes.GetUser().GetName(), "system:serviceaccount:") &&
-		!strings.HasPrefix(requestAttributes.GetUser().GetName(), "system:node:") {
-		// skip system users (nodes, anonymous, internal identities) for development, helps from accidentally halting normal operations
-		// TODO: are there any system users we should always skip? Anonymous probably?
+	if !e.policiesLoaded() {
+		e.logUnevaluatedDecision(requestAttributes, authorizer.DecisionNoOpinion, decisionlog.SourceNotLoaded, "", time.Since(start))
 		return authorizer.DecisionNoOpinion, "", nil
 	}
-	if !e.storesLoaded {
-		for _, store := range e.stores {
-			if !store.InitalPolicyLoadComplete() {
-				klog.InfoS("Policies not yet loaded, returning no opinion", "store", store.Name())
-				return authorizer.DecisionNoOpinion, "", nil
-			}
-		}
-		e.storesLoaded = true
+	if e.evaluationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.evaluationTimeout)
+		defer cancel()
 	}
-	entities, request := RecordToCedarResource(requestAttributes)
+	entities, request := e.cedarRequest(ctx, requestAttributes)
+	metrics.RecordEntityConstructionLatency(ctx, "authorization", time.Since(start).Seconds())
 	entityJson, _ := entities.MarshalJSON()
 	requestJson, _ := json.Marshal(request)
 	klog.V(3).Info("Request entities ", string(entityJson))
 	klog.V(3).Info("Cedar request ", string(requestJson))
 
-	ok, diagnostic := e.stores.IsAuthorized(entities, request)
-	klog.V(9).InfoS("Authorize", "ok", ok, "Diagnostic", diagnosticToReason(diagnostic))
-	if ok {
-		return authorizer.DecisionAllow, diagnosticToReason(diagnostic), nil
-	} else if !ok && len(diagnostic.Reasons) > 0 {
-		return authorizer.DecisionDeny, diagnosticToReason(diagnostic), nil
+	cache := e.cache
+	if cache.hasTimeBasedPolicies(e.stores) {
+		cache = nil
 	}
-	// In the case of failure, we don't want to leave an opinion
+	generations := append(e.stores.Generations(), e.entityStores.Generations()...)
+	objectVersions := []string{
+		e.namespaces.ResourceVersion(requestAttributes.GetNamespace()),
+		e.principals.ResourceVersion(request.Principal, entities),
+	}
+	ok, diagnostic, err := cache.IsAuthorized(ctx, generations, requestAttributes, objectVersions, func(ctx context.Context) (cedar.Decision, store.TieredDiagnostic, error) {
+		return e.stores.IsAuthorized(ctx, entities, request)
+	})
+	if err != nil {
+		decision, reason, err = e.timeoutDecision(ctx, err)
+		e.logDecision(requestAttributes, request, decision, store.TieredDiagnostic{Tier: -1}, time.Since(start), true)
+		return decision, reason, err
+	}
+	decision, reason = e.policyDecision(ok, diagnostic)
+	klog.V(9).InfoS("Authorize", "ok", ok, "reason", reason)
+	// Errors are returned with the decision, as the SubjectAccessReview's evaluationError
 	if len(diagnostic.Errors) > 0 {
-		klog.Error("Authorize", "errors", diagnostic.Errors)
+		err = fmt.Errorf("policy evaluation errors: %s", e.stores.ErrorString(diagnostic))
+		klog.ErrorS(err, "Authorize")
+	}
+	e.evaluateAuditPolicies(ctx, request, decision, func() (cedar.Decision, store.TieredDiagnostic) {
+		return cache.AuditIsAuthorized(generations, requestAttributes, objectVersions, func() (cedar.Decision, store.TieredDiagnostic) {
+			return e.stores.AuditIsAuthorized(entities, request)
+		})
+	})
+	e.logDecision(requestAttributes, request, decision, diagnostic, time.Since(start), false)
+	return decision, reason, err
+}
+
+// cedarRequest builds the entities and Cedar request for request attributes
+func (e *cedarWebhookAuthorizer) cedarRequest(ctx context.Context, requestAttributes authorizer.Attributes) (cedartypes.EntityMap, cedar.Request) {
+	_, span := tracing.Start(ctx, "RecordToCedarResource")
+	defer span.End()
+	entities, request := RecordToCedarResource(requestAttributes, e.clusterMetadata, e.namespaces, e.principals)
+	e.entityStores.AddToRequest(request.Principal, entities)
+	return entities, request
+}
+
+// policyDecision converts the result of evaluating policies to an authorization
+// decision and reason. When no policy applied, there is no opinion.
+func (e *cedarWebhookAuthorizer) policyDecision(ok cedar.Decision, diagnostic store.TieredDiagnostic) (authorizer.Decision, string) {
+	switch {
+	case ok == cedar.Allow:
+		return authorizer.DecisionAllow, e.stores.ReasonString(diagnostic)
+	case len(diagnostic.Reasons) > 0:
+		return authorizer.DecisionDeny, e.stores.ReasonString(diagnostic)
+	}
+	// In the case of failure, we don't want to leave an opinion
+	return authorizer.DecisionNoOpinion, ""
+}
+
+// logDecision writes an evaluated or timed out decision to the decision log
+func (e *cedarWebhookAuthorizer) logDecision(requestAttributes authorizer.Attributes, request cedar.Request, decision authorizer.Decision, diagnostic store.TieredDiagnostic, latency time.Duration, timedOut bool) {
+	if e.decisionLog == nil {
+		return
+	}
+	record := decisionRecord(requestAttributes, request, decision, latency)
+	record.Policies = decisionlog.Policies(e.stores.Reasons(diagnostic))
+	record.Store = e.stores.DecidingStore(diagnostic)
+	record.TimedOut = timedOut
+	e.decisionLog.Log(record)
+}
+
+// logUnevaluatedDecision writes a decision made without evaluating policies to
+// the decision log, such as a principal rule's decision
+func (e *cedarWebhookAuthorizer) logUnevaluatedDecision(requestAttributes authorizer.Attributes, decision authorizer.Decision, source, reason string, latency time.Duration) {
+	if e.decisionLog == nil {
+		return
+	}
+	record := decisionRecord(requestAttributes, RecordToCedarRequestUIDs(requestAttributes), decision, latency)
+	record.Source = source
+	record.Reason = reason
+	e.decisionLog.Log(record)
+}
+
+// decisionRecord returns the decision log record of a request's decision
+func decisionRecord(requestAttributes authorizer.Attributes, request cedar.Request, decision authorizer.Decision, latency time.Duration) decisionlog.Record {
+	return decisionlog.Record{
+		Webhook: decisionlog.WebhookAuthorization,
+		Principal: decisionlog.Principal{
+			Type:   string(request.Principal.Type),
+			UID:    string(request.Principal.ID),
+			Name:   requestAttributes.GetUser().GetName(),
+			Groups: requestAttributes.GetUser().GetGroups(),
+		},
+		Action:         request.Action.String(),
+		Resource:       request.Resource.String(),
+		Namespace:      requestAttributes.GetNamespace(),
+		Decision:       decisionString(decision),
+		LatencySeconds: latency.Seconds(),
+	}
+}
+
+// timeoutDecision returns the fallback decision for a request that wasn't
+// evaluated before its context was done
+func (e *cedarWebhookAuthorizer) timeoutDecision(ctx context.Context, err error) (authorizer.Decision, string, error) {
+	klog.ErrorS(err, "Authorization evaluation did not complete, returning fallback decision", "timeout", e.evaluationTimeout, "decision", decisionString(e.fallbackDecision))
+	metrics.RecordEvaluationTimeout(ctx, "authorization", decisionString(e.fallbackDecision))
+	return e.fallbackDecision, fmt.Sprintf("evaluation did not complete within %s", e.evaluationTimeout), fmt.Errorf("evaluation did not complete: %w", err)
+}
+
+// fallbackDecision converts a configured fallback decision to an authorizer.Decision
+func fallbackDecision(decision string) authorizer.Decision {
+	switch decision {
+	case config.FallbackDecisionAllow:
+		return authorizer.DecisionAllow
+	case config.FallbackDecisionDeny:
+		return authorizer.DecisionDeny
 	}
-	return authorizer.DecisionNoOpinion, "", nil
+	return authorizer.DecisionNoOpinion
+}
+
+// policiesLoaded returns true once every store has completed its initial policy
+// or entity load
+func (e *cedarWebhookAuthorizer) policiesLoaded() bool {
+	if e.storesLoaded {
+		return true
+	}
+	for _, store := range e.stores {
+		if !store.InitalPolicyLoadComplete() {
+			klog.InfoS("Policies not yet loaded, returning no opinion", "store", store.Name())
+			return false
+		}
+	}
+	for _, store := range e.entityStores {
+		if !store.InitalEntityLoadComplete() {
+			klog.InfoS("Entities not yet loaded, returning no opinion", "store", store.Name())
+			return false
+		}
+	}
+	e.storesLoaded = true
+	return true
+}
+
+// evaluateAuditPolicies logs and counts the decision that audit policies would
+// have made, which audit returns. It never changes the enforced decision.
+func (e *cedarWebhookAuthorizer) evaluateAuditPolicies(ctx context.Context, request cedar.Request, decision authorizer.Decision, audit func() (cedar.Decision, store.TieredDiagnostic)) {
+	if !e.stores.HasAuditPolicies() {
+		return
+	}
+	auditOk, auditDiagnostic := audit()
+	if len(auditDiagnostic.Errors) > 0 {
+		klog.ErrorS(nil, "Audit policy evaluation errors", "errors", auditDiagnostic.Errors)
+	}
+	if len(auditDiagnostic.Reasons) == 0 {
+		return
+	}
+	auditDecision := authorizer.DecisionAllow
+	if !auditOk {
+		auditDecision = authorizer.DecisionDeny
+	}
+	klog.InfoS("Audit policies applied to request",
+		"principal", request.Principal,
+		"action", request.Action,
+		"resource", request.Resource,
+		"decision", decisionString(decision),
+		"auditDecision", decisionString(auditDecision),
+		"policies", store.DiagnosticPolicyIDs(auditDiagnostic.Diagnostic),
+	)
+	metrics.RecordAuditDecision(ctx, "authorization", decisionString(decision), decisionString(auditDecision))
+}
+
+func decisionString(decision authorizer.Decision) string {
+	switch decision {
+	case authorizer.DecisionDeny:
+		return "Deny"
+	case authorizer.DecisionAllow:
+		return "Allow"
+	case authorizer.DecisionNoOpinion:
+		return "NoOpinion"
+	}
+	return "unknown"
 }
 
 type entityDerivationFunc = func(attributes authorizer.Attributes) cedartypes.Entity
 
-func RecordToCedarResource(attributes authorizer.Attributes) (cedartypes.EntityMap, cedar.Request) {
+// now returns the time used in request contexts, and is overridden in tests
+var now = time.Now
+
+func RecordToCedarResource(attributes authorizer.Attributes, clusterMetadata *entities.ClusterMetadata, namespaces *entities.Namespaces, principals *entities.Principals) (cedartypes.EntityMap, cedar.Request) {
 	action, reqEntities := ActionEntities(attributes.GetVerb())
 	principalUID, principalEntities := entities.UserToCedarEntity(attributes.GetUser())
+	principals.AddAttributes(principalUID, principalEntities)
+
+	requestContext := RequestContext(attributes, now())
+	clusterMetadata.AddToContext(requestContext)
+	if attributes.IsResourceRequest() {
+		namespaces.AddToRequest(attributes.GetNamespace(), reqEntities, requestContext)
+	}
 
 	req := cedar.Request{
 		Principal: principalUID,
 		Action:    action,
+		Context:   cedartypes.NewRecord(requestContext),
 	}
 	maps.Copy(reqEntities, principalEntities)
 
-	var resourceEntityFunc entityDerivationFunc = NonResourceToCedarEntity
-	if attributes.IsResourceRequest() {
-		resourceEntityFunc = ResourceToCedarEntity
-		if attributes.GetVerb() == schema.AuthorizationActionImpersonate {
-			resourceEntityFunc = ImpersonatedResourceToCedarEntity
-		}
-	}
-	entity := resourceEntityFunc(attributes)
+	entity := resourceEntityFunc(attributes)(attributes)
 	req.Resource = entity.UID
 	reqEntities[entity.UID] = entity
 
 	return reqEntities, req
 }
 
-func diagnosticToReason(diagnostic cedar.Diagnostic) string {
-	if len(diagnostic.Reasons) == 0 {
-		return ""
-	}
-	// TODO handle diagnostic.Errors?
-	data, err := json.Marshal(diagnostic)
-	if err != nil {
-		return fmt.Sprintf("error marshalling diagnostic: %v", err)
+// RecordToCedarRequestUIDs returns the principal, action, and resource of the
+// Cedar request for authorization attributes, without the entities or context
+// needed to evaluate it
+func RecordToCedarRequestUIDs(attributes authorizer.Attributes) cedar.Request {
+	action, _ := ActionEntities(attributes.GetVerb())
+	principalUID, _ := entities.UserToCedarEntity(attributes.GetUser())
+	return cedar.Request{
+		Principal: principalUID,
+		Action:    action,
+		Resource:  resourceEntityFunc(attributes)(attributes).UID,
 	}
-	return string(data)
+}
 
+// resourceEntityFunc returns the function that derives the resource entity of
+// authorization attributes
+func resourceEntityFunc(attributes authorizer.Attributes) entityDerivationFunc {
+	if !attributes.IsResourceRequest() {
+		return NonResourceToCedarEntity
+	}
+	if attributes.GetVerb() == schema.AuthorizationActionImpersonate {
+		return ImpersonatedResourceToCedarEntity
+	}
+	return ResourceToCedarEntity
 }
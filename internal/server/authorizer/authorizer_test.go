@@ -2,19 +2,40 @@ package authorizer
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 	"github.com/cedar-policy/cedar-go"
 	cedartypes "github.com/cedar-policy/cedar-go/types"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 var (
@@ -29,6 +50,10 @@ var (
 )
 
 func TestRecordToCedarResource(t *testing.T) {
+	testTime := time.Date(2024, time.October, 1, 12, 30, 0, 0, time.UTC)
+	now = func() time.Time { return testTime }
+	defer func() { now = time.Now }()
+
 	cases := []struct {
 		name         string
 		input        authorizer.Attributes
@@ -75,7 +100,8 @@ func TestRecordToCedarResource(t *testing.T) {
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{"name": cedartypes.String("test-group")}),
 				},
 				cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods/test-pod"}: {
-					UID: cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods/test-pod"},
+					UID:     cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods/test-pod"},
+					Parents: cedartypes.NewEntityUIDSet(entities.NamespaceUID("default")),
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
 						"apiGroup":  cedartypes.String(""),
 						"namespace": cedartypes.String("default"),
@@ -97,6 +123,13 @@ func TestRecordToCedarResource(t *testing.T) {
 					Type: schema.ResourceEntityType,
 					ID:   "/api/v1/namespaces/default/pods/test-pod",
 				},
+				Context: cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion":       cedartypes.String("v1"),
+					"hasFieldSelector": cedartypes.False,
+					"hasLabelSelector": cedartypes.False,
+					"isReadOnly":       cedartypes.True,
+					"now":              cedartypes.NewDatetime(testTime),
+				}),
 			},
 		},
 		{
@@ -159,6 +192,13 @@ func TestRecordToCedarResource(t *testing.T) {
 					Type: schema.ResourceEntityType,
 					ID:   "/api/v1/pods",
 				},
+				Context: cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion":       cedartypes.String("v1"),
+					"hasFieldSelector": cedartypes.False,
+					"hasLabelSelector": cedartypes.False,
+					"isReadOnly":       cedartypes.True,
+					"now":              cedartypes.NewDatetime(testTime),
+				}),
 			},
 		},
 		{
@@ -218,6 +258,12 @@ func TestRecordToCedarResource(t *testing.T) {
 					Type: schema.NonResourceURLEntityType,
 					ID:   "/metrics",
 				},
+				Context: cedartypes.NewRecord(cedartypes.RecordMap{
+					"hasFieldSelector": cedartypes.False,
+					"hasLabelSelector": cedartypes.False,
+					"isReadOnly":       cedartypes.True,
+					"now":              cedartypes.NewDatetime(testTime),
+				}),
 			},
 		},
 		{
@@ -260,7 +306,8 @@ func TestRecordToCedarResource(t *testing.T) {
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{"name": cedartypes.String("test-group")}),
 				},
 				cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/apis/apps/v1/namespaces/default/deployments/nginx/scale"}: {
-					UID: cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/apis/apps/v1/namespaces/default/deployments/nginx/scale"},
+					UID:     cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/apis/apps/v1/namespaces/default/deployments/nginx/scale"},
+					Parents: cedartypes.NewEntityUIDSet(entities.NamespaceUID("default")),
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
 						"apiGroup":    cedartypes.String("apps"),
 						"namespace":   cedartypes.String("default"),
@@ -283,6 +330,13 @@ func TestRecordToCedarResource(t *testing.T) {
 					Type: schema.ResourceEntityType,
 					ID:   "/apis/apps/v1/namespaces/default/deployments/nginx/scale",
 				},
+				Context: cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion":       cedartypes.String("v1"),
+					"hasFieldSelector": cedartypes.False,
+					"hasLabelSelector": cedartypes.False,
+					"isReadOnly":       cedartypes.False,
+					"now":              cedartypes.NewDatetime(testTime),
+				}),
 			},
 		},
 		{
@@ -338,7 +392,8 @@ func TestRecordToCedarResource(t *testing.T) {
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{"name": cedartypes.String("system:authenticated")}),
 				},
 				cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods/test-pod"}: {
-					UID: cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods/test-pod"},
+					UID:     cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods/test-pod"},
+					Parents: cedartypes.NewEntityUIDSet(entities.NamespaceUID("default")),
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
 						"apiGroup":  cedartypes.String(""),
 						"namespace": cedartypes.String("default"),
@@ -360,6 +415,13 @@ func TestRecordToCedarResource(t *testing.T) {
 					Type: schema.ResourceEntityType,
 					ID:   "/api/v1/namespaces/default/pods/test-pod",
 				},
+				Context: cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion":       cedartypes.String("v1"),
+					"hasFieldSelector": cedartypes.False,
+					"hasLabelSelector": cedartypes.False,
+					"isReadOnly":       cedartypes.True,
+					"now":              cedartypes.NewDatetime(testTime),
+				}),
 			},
 		},
 		{
@@ -411,7 +473,8 @@ func TestRecordToCedarResource(t *testing.T) {
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{"name": cedartypes.String("test-group")}),
 				},
 				cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods"}: {
-					UID: cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods"},
+					UID:     cedartypes.EntityUID{Type: schema.ResourceEntityType, ID: "/api/v1/namespaces/default/pods"},
+					Parents: cedartypes.NewEntityUIDSet(entities.NamespaceUID("default")),
 					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
 						"apiGroup":  cedartypes.String(""),
 						"namespace": cedartypes.String("default"),
@@ -442,12 +505,19 @@ func TestRecordToCedarResource(t *testing.T) {
 					Type: schema.ResourceEntityType,
 					ID:   "/api/v1/namespaces/default/pods",
 				},
+				Context: cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion":       cedartypes.String("v1"),
+					"hasFieldSelector": cedartypes.True,
+					"hasLabelSelector": cedartypes.True,
+					"isReadOnly":       cedartypes.True,
+					"now":              cedartypes.NewDatetime(testTime),
+				}),
 			},
 		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			gotEntities, gotRequest := RecordToCedarResource(tc.input)
+			gotEntities, gotRequest := RecordToCedarResource(tc.input, nil, nil, nil)
 			if diff := cmp.Diff(gotEntities, tc.wantEntities); diff != "" {
 				t.Errorf("Didn't get same entities: %s", diff)
 				return
@@ -468,6 +538,7 @@ func TestAuthorize(t *testing.T) {
 		storeComplete bool
 		wantDecision  authorizer.Decision
 		wantReason    string
+		wantErr       string
 	}{
 		{
 			name: "Allow",
@@ -501,7 +572,38 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow, policy0`,
+		},
+		{
+			name: "Allow with request context",
+			inputPolicy: `
+permit (
+	principal,
+	action,
+	resource is k8s::Resource
+) when {
+	context.isReadOnly &&
+	context has apiVersion &&
+	context.apiVersion == "v1" &&
+	!context.hasLabelSelector &&
+	context.now > datetime("2024-01-01")
+};`,
+			input: authorizer.AttributesRecord{
+				User: &user.DefaultInfo{
+					UID:    "1234567890",
+					Name:   "test-user",
+					Groups: []string{"test-group"},
+				},
+				Verb:            "list",
+				Namespace:       "default",
+				APIGroup:        "",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `Allow with request context, policy0`,
 		},
 		{
 			name: "Allow Impersonate UID",
@@ -532,7 +634,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate UID","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate UID, policy0`,
 		},
 		{
 			name: "Allow Impersonate serviceaccount",
@@ -565,7 +667,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate serviceaccount","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate serviceaccount, policy0`,
 		},
 		{
 			name: "Allow Impersonate serviceaccount id",
@@ -596,7 +698,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate serviceaccount id","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate serviceaccount id, policy0`,
 		},
 		{
 			name: "Allow Impersonate node",
@@ -630,7 +732,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate node","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate node, policy0`,
 		},
 		{
 			name: "Allow Impersonate user",
@@ -662,7 +764,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate user","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate user, policy0`,
 		},
 		{
 			name: "Allow Impersonate group",
@@ -694,7 +796,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate group","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate group, policy0`,
 		},
 		{
 			name: "Allow Impersonate extra",
@@ -728,7 +830,7 @@ permit (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Allow Impersonate extra","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Allow Impersonate extra, policy0`,
 		},
 		{
 			name: "Explicit Deny",
@@ -762,7 +864,7 @@ forbid (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionDeny,
-			wantReason:    `{"reasons":[{"policy":"policy0","position":{"filename":"Explicit Deny","offset":1,"line":2,"column":1}}]}`,
+			wantReason:    `Explicit Deny, policy0`,
 		},
 		{
 			name: "No Opinion",
@@ -892,9 +994,281 @@ forbid (
 			},
 			storeComplete: true,
 			wantDecision:  authorizer.DecisionAllow,
-			wantReason:    `cedar authorizer is always allowed to access policies`,
+			wantReason:    `cedar authorizer is always allowed to access policies and entity sets`,
+		},
+		{
+			name: "Allow in namespace",
+			inputPolicy: `
+permit (
+	principal,
+	action,
+	resource in k8s::Namespace::"team-a"
+);`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "get",
+				Namespace:       "team-a",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				Name:            "test-pod",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `Allow in namespace, policy0`,
 		},
+		{
+			name: "No opinion in other namespace",
+			inputPolicy: `
+permit (
+	principal,
+	action,
+	resource in k8s::Namespace::"team-a"
+);`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				Name:            "test-pod",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionNoOpinion,
+			wantReason:    ``,
+		},
+		{
+			name: "Allow on namespace labels",
+			inputPolicy: `
+permit (
+	principal,
+	action,
+	resource is k8s::Resource
+) when {
+	context has namespace &&
+	context.namespace.labels.contains({"key": "team", "value": "a"})
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "list",
+				Namespace:       "team-a",
+				APIVersion:      "v1",
+				Resource:        "configmaps",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `Allow on namespace labels, policy0`,
+		},
+		{
+			name: "Allow on service account labels",
+			inputPolicy: `
+permit (
+	principal is k8s::ServiceAccount,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	principal has labels &&
+	principal.labels.contains({"key": "tier", "value": "platform"}) &&
+	resource.resource == "secrets"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "system:serviceaccount:platform:controller"},
+				Verb:            "get",
+				Namespace:       "platform",
+				APIVersion:      "v1",
+				Resource:        "secrets",
+				Name:            "token",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `Allow on service account labels, policy0`,
+		},
+		{
+			name: "No opinion on unlabeled service account",
+			inputPolicy: `
+permit (
+	principal is k8s::ServiceAccount,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	principal has labels &&
+	principal.labels.contains({"key": "tier", "value": "platform"}) &&
+	resource.resource == "secrets"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "system:serviceaccount:default:default"},
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "secrets",
+				Name:            "token",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionNoOpinion,
+			wantReason:    ``,
+		},
+		{
+			name: "Deny with reason annotation",
+			inputPolicy: `
+@reason("pods can't be read in the default namespace")
+forbid (
+	principal,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	resource.resource == "pods"
+};
+@message("unused, reason takes precedence")
+@reason("secrets can't be read")
+forbid (
+	principal,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	resource.resource == "secrets"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionDeny,
+			wantReason:    `pods can't be read in the default namespace (Deny with reason annotation, policy0)`,
+		},
+		{
+			name: "Allow with message annotation",
+			inputPolicy: `
+@message("test-user can read pods")
+permit (
+	principal,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	principal.name == "test-user" &&
+	resource.resource == "pods"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `test-user can read pods (Allow with message annotation, policy0)`,
+		},
+		{
+			name: "Evaluation error",
+			inputPolicy: `
+permit (
+	principal,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	principal.team == "sre"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionNoOpinion,
+			wantReason:    ``,
+			wantErr:       `policy evaluation errors: Evaluation error, policy0: `,
+		},
+		{
+			name: "Allow in nested group",
+			inputPolicy: `
+permit (
+	principal in k8s::Group::"sre",
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	resource.resource == "pods"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user", Groups: []string{"oncall"}},
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `Allow in nested group, policy0`,
+		},
+		{
+			name: "Allow on stored user attributes by username",
+			inputPolicy: `
+permit (
+	principal is k8s::User,
+	action == k8s::Action::"get",
+	resource is k8s::Resource
+) when {
+	principal has department &&
+	principal.department == "sre" &&
+	principal.name == "test-user" &&
+	resource.resource == "nodes"
+};`,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{UID: "1234567890", Name: "test-user"},
+				Verb:            "get",
+				APIVersion:      "v1",
+				Resource:        "nodes",
+				ResourceRequest: true,
+			},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			wantReason:    `Allow on stored user attributes by username, policy0`,
+		},
+	}
+
+	entityStore, err := store.NewMemoryEntityStore("entities", []byte(`[
+		{"uid": {"type": "k8s::Group", "id": "oncall"}, "parents": [{"type": "k8s::Group", "id": "sre"}], "attrs": {}},
+		{"uid": {"type": "k8s::Group", "id": "sre"}, "parents": [], "attrs": {}},
+		{"uid": {"type": "k8s::User", "id": "test-user"}, "parents": [], "attrs": {"name": "other-user", "department": "sre"}}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to create entity store: %v", err)
+	}
+
+	namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err = namespaceIndexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "team-a",
+		Labels: map[string]string{"team": "a"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to add namespace: %v", err)
 	}
+	namespaces := entities.NewNamespaces(corev1listers.NewNamespaceLister(namespaceIndexer))
+	serviceAccountIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	err = serviceAccountIndexer.Add(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:      "controller",
+		Namespace: "platform",
+		Labels:    map[string]string{"tier": "platform"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to add service account: %v", err)
+	}
+	principals := entities.NewPrincipals(
+		corev1listers.NewServiceAccountLister(serviceAccountIndexer),
+		corev1listers.NewNodeLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})),
+	)
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -903,11 +1277,20 @@ forbid (
 				t.Errorf("Failed to create policy store: %s", err)
 				return
 			}
-			authorizer := cedarWebhookAuthorizer{stores: []store.PolicyStore{policyStore}}
+			authorizer := cedarWebhookAuthorizer{
+				stores:       []store.PolicyStore{policyStore},
+				entityStores: store.TieredEntityStores{entityStore},
+				namespaces:   namespaces,
+				principals:   principals,
+				rules:        principalRulesOrDefault(nil),
+			}
 			dec, reason, err := authorizer.Authorize(context.Background(), tc.input)
-			if err != nil {
+			if tc.wantErr == "" && err != nil {
 				t.Fatalf("Unexpected error: %v", err)
 			}
+			if tc.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tc.wantErr)) {
+				t.Errorf("Didn't get expected error: got %v: wanted prefix `%s`", err, tc.wantErr)
+			}
 			if dec != tc.wantDecision {
 				t.Errorf("Didn't get same decision: got %v: wanted %v", dec, tc.wantDecision)
 			}
@@ -918,3 +1301,366 @@ forbid (
 		})
 	}
 }
+
+func TestAuthorizeDecisionCacheObjectVersions(t *testing.T) {
+	policyStore, err := store.NewMemoryStore("namespaces", []byte(`permit(principal, action, resource) when {
+    context.namespace.labels.contains({"key": "team", "value": "a"})
+};`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	setLabels := func(resourceVersion string, labels map[string]string) {
+		err := namespaceIndexer.Update(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:            "team-a",
+			ResourceVersion: resourceVersion,
+			Labels:          labels,
+		}})
+		if err != nil {
+			t.Fatalf("Failed to update namespace: %v", err)
+		}
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		Namespace:       "team-a",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	authz := NewAuthorizer(nil, Options{
+		DecisionCache: &config.DecisionCacheConfig{Size: 10, TTL: time.Minute},
+		Namespaces:    entities.NewNamespaces(corev1listers.NewNamespaceLister(namespaceIndexer)),
+	}, policyStore)
+
+	setLabels("1", map[string]string{"team": "a"})
+	if dec, _, _ := authz.Authorize(context.Background(), input); dec != authorizer.DecisionAllow {
+		t.Fatalf("Expected Allow, got %v", dec)
+	}
+	setLabels("2", map[string]string{"team": "b"})
+	if dec, _, _ := authz.Authorize(context.Background(), input); dec != authorizer.DecisionNoOpinion {
+		t.Errorf("Expected a namespace label change to invalidate the cached decision, got %v", dec)
+	}
+}
+
+func TestAuthorizeDecisionCacheTimeBasedPolicies(t *testing.T) {
+	policyStore, err := store.NewMemoryStore("time", []byte(`permit(principal, action, resource) when {
+    context.now.toTime() < duration("12h")
+};`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	authz := NewAuthorizer(nil, Options{DecisionCache: &config.DecisionCacheConfig{Size: 10, TTL: time.Minute}}, policyStore)
+	defer func() { now = time.Now }()
+
+	now = func() time.Time { return time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC) }
+	if dec, _, _ := authz.Authorize(context.Background(), input); dec != authorizer.DecisionAllow {
+		t.Fatalf("Expected Allow, got %v", dec)
+	}
+	now = func() time.Time { return time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC) }
+	if dec, _, _ := authz.Authorize(context.Background(), input); dec != authorizer.DecisionNoOpinion {
+		t.Errorf("Expected decisions of time-based policies not to be cached, got %v", dec)
+	}
+}
+
+func TestAuthorizeTimeout(t *testing.T) {
+	policyStore, err := store.NewMemoryStore("timeout", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+
+	cases := []struct {
+		name         string
+		fallback     string
+		wantDecision authorizer.Decision
+	}{
+		{name: "NoOpinion fallback", fallback: config.FallbackDecisionNoOpinion, wantDecision: authorizer.DecisionNoOpinion},
+		{name: "Allow fallback", fallback: config.FallbackDecisionAllow, wantDecision: authorizer.DecisionAllow},
+		{name: "Deny fallback", fallback: config.FallbackDecisionDeny, wantDecision: authorizer.DecisionDeny},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			authz := NewAuthorizer(nil, Options{Evaluation: &config.EvaluationConfig{Timeout: time.Minute, FallbackDecision: tc.fallback}}, policyStore)
+			// a request whose deadline has already passed never completes evaluation
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+			defer cancel()
+			dec, reason, err := authz.Authorize(ctx, input)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected context.DeadlineExceeded error, got %v", err)
+			}
+			if dec != tc.wantDecision {
+				t.Errorf("Didn't get same decision: got %v: wanted %v", dec, tc.wantDecision)
+			}
+			if want := "evaluation did not complete within 1m0s"; reason != want {
+				t.Errorf("Didn't get same reason: got `%v`: wanted `%v`", reason, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	policyStore, err := store.NewMemoryStore("tracing", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	authz := NewAuthorizer(nil, Options{}, policyStore)
+
+	// the API server's span, as propagated in the request's trace headers
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "apiserver")
+	if _, _, err := authz.Authorize(ctx, input); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parent.End()
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+		if span.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+			t.Errorf("Expected span %s to continue the parent trace", span.Name)
+		}
+		if span.Name == "Authorize" {
+			if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("Expected Authorize span to be a child of the parent span")
+			}
+			if !slices.Contains(span.Attributes, tracing.DecisionKey.String("Allow")) {
+				t.Errorf("Expected Authorize span to have an Allow decision, got %v", span.Attributes)
+			}
+		}
+	}
+	want := []string{"RecordToCedarResource", "EvaluatePolicyStore", "IsAuthorized", "Authorize", "apiserver"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("Unexpected spans (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuthorizeDecisionLog(t *testing.T) {
+	policyStore, err := store.NewMemoryStore("decision-log", []byte(`forbid(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	decisionLog, err := decisionlog.New(&config.DecisionLogConfig{Path: path, MaxSize: 1, AllowSampleRate: 0})
+	if err != nil {
+		t.Fatalf("Failed to create decision log: %v", err)
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user", UID: "1234", Groups: []string{"test-group"}},
+		Verb:            "get",
+		Namespace:       "default",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	authz := NewAuthorizer(nil, Options{DecisionLog: decisionLog}, policyStore)
+	if dec, _, err := authz.Authorize(context.Background(), input); err != nil || dec != authorizer.DecisionDeny {
+		t.Fatalf("Expected Deny, got %v, %v", dec, err)
+	}
+	if err := decisionLog.Close(); err != nil {
+		t.Fatalf("Failed to close decision log: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read decision log: %v", err)
+	}
+	var got decisionlog.Record
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to parse decision log %s: %v", data, err)
+	}
+	want := decisionlog.Record{
+		Webhook: decisionlog.WebhookAuthorization,
+		Principal: decisionlog.Principal{
+			Type:   "k8s::User",
+			UID:    "1234",
+			Name:   "test-user",
+			Groups: []string{"test-group"},
+		},
+		Action:    `k8s::Action::"get"`,
+		Resource:  `k8s::Resource::"/api/v1/namespaces/default/pods"`,
+		Namespace: "default",
+		Decision:  "Deny",
+		Policies:  []decisionlog.Policy{{ID: "policy0", Source: "decision-log, policy0"}},
+		Store:     "decision-log",
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(decisionlog.Record{}, "Time", "LatencySeconds")); diff != "" {
+		t.Errorf("Unexpected decision log record (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuthorizeTimeoutDecisionLog(t *testing.T) {
+	policyStore, err := store.NewMemoryStore("timeout", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	decisionLog, err := decisionlog.New(&config.DecisionLogConfig{Path: path, MaxSize: 1, AllowSampleRate: 0})
+	if err != nil {
+		t.Fatalf("Failed to create decision log: %v", err)
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user", UID: "1234", Groups: []string{"test-group"}},
+		Verb:            "get",
+		Namespace:       "default",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	authz := NewAuthorizer(nil, Options{
+		Evaluation:  &config.EvaluationConfig{Timeout: time.Minute, FallbackDecision: config.FallbackDecisionDeny},
+		DecisionLog: decisionLog,
+	}, policyStore)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	if dec, _, _ := authz.Authorize(ctx, input); dec != authorizer.DecisionDeny {
+		t.Fatalf("Expected the Deny fallback decision, got %v", dec)
+	}
+	if err := decisionLog.Close(); err != nil {
+		t.Fatalf("Failed to close decision log: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read decision log: %v", err)
+	}
+	var got decisionlog.Record
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed to parse decision log %s: %v", data, err)
+	}
+	want := decisionlog.Record{
+		Webhook: decisionlog.WebhookAuthorization,
+		Principal: decisionlog.Principal{
+			Type:   "k8s::User",
+			UID:    "1234",
+			Name:   "test-user",
+			Groups: []string{"test-group"},
+		},
+		Action:    `k8s::Action::"get"`,
+		Resource:  `k8s::Resource::"/api/v1/namespaces/default/pods"`,
+		Namespace: "default",
+		Decision:  "Deny",
+		Policies:  []decisionlog.Policy{},
+		TimedOut:  true,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(decisionlog.Record{}, "Time", "LatencySeconds")); diff != "" {
+		t.Errorf("Unexpected decision log record (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuthorizeUnevaluatedDecisionLog(t *testing.T) {
+	authorizerConfig := &v1alpha1.AuthorizerConfig{PrincipalRules: []v1alpha1.PrincipalRule{
+		{Users: []string{"system:kube-scheduler"}, Action: v1alpha1.PrincipalRuleActionAllow, Reason: "scheduler is trusted"},
+		{UserPrefixes: []string{"system:node:"}, Action: v1alpha1.PrincipalRuleActionNoOpinion},
+	}}
+	cases := []struct {
+		name          string
+		user          *user.DefaultInfo
+		storeComplete bool
+		wantDecision  authorizer.Decision
+		want          decisionlog.Record
+	}{
+		{
+			name:          "principal rule allow",
+			user:          &user.DefaultInfo{Name: "system:kube-scheduler", UID: "1234"},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionAllow,
+			want: decisionlog.Record{
+				Principal: decisionlog.Principal{Type: "k8s::User", UID: "1234", Name: "system:kube-scheduler", Groups: []string{}},
+				Decision:  "Allow",
+				Source:    decisionlog.SourcePrincipalRule,
+				Reason:    "scheduler is trusted",
+			},
+		},
+		{
+			name:          "principal rule noOpinion",
+			user:          &user.DefaultInfo{Name: "system:node:node-1", UID: "5678", Groups: []string{"system:nodes"}},
+			storeComplete: true,
+			wantDecision:  authorizer.DecisionNoOpinion,
+			want: decisionlog.Record{
+				Principal: decisionlog.Principal{Type: "k8s::Node", UID: "5678", Name: "system:node:node-1", Groups: []string{"system:nodes"}},
+				Decision:  "NoOpinion",
+				Source:    decisionlog.SourcePrincipalRule,
+			},
+		},
+		{
+			name:         "policies not loaded",
+			user:         &user.DefaultInfo{Name: "test-user", UID: "1234", Groups: []string{"test-group"}},
+			wantDecision: authorizer.DecisionNoOpinion,
+			want: decisionlog.Record{
+				Principal: decisionlog.Principal{Type: "k8s::User", UID: "1234", Name: "test-user", Groups: []string{"test-group"}},
+				Decision:  "NoOpinion",
+				Source:    decisionlog.SourceNotLoaded,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policyStore, err := store.NewMemoryStore(tc.name, []byte(`forbid(principal, action, resource);`), tc.storeComplete)
+			if err != nil {
+				t.Fatalf("Failed to create policy store: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "decisions.log")
+			decisionLog, err := decisionlog.New(&config.DecisionLogConfig{Path: path, MaxSize: 1, AllowSampleRate: 1})
+			if err != nil {
+				t.Fatalf("Failed to create decision log: %v", err)
+			}
+			input := authorizer.AttributesRecord{
+				User:            tc.user,
+				Verb:            "get",
+				Namespace:       "default",
+				APIVersion:      "v1",
+				Resource:        "pods",
+				ResourceRequest: true,
+			}
+			authz := NewAuthorizer(authorizerConfig, Options{DecisionLog: decisionLog}, policyStore)
+			if dec, _, err := authz.Authorize(context.Background(), input); err != nil || dec != tc.wantDecision {
+				t.Fatalf("Expected %v, got %v, %v", tc.wantDecision, dec, err)
+			}
+			if err := decisionLog.Close(); err != nil {
+				t.Fatalf("Failed to close decision log: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read decision log: %v", err)
+			}
+			var got decisionlog.Record
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Failed to parse decision log %s: %v", data, err)
+			}
+			tc.want.Webhook = decisionlog.WebhookAuthorization
+			tc.want.Action = `k8s::Action::"get"`
+			tc.want.Resource = `k8s::Resource::"/api/v1/namespaces/default/pods"`
+			tc.want.Namespace = "default"
+			tc.want.Policies = []decisionlog.Policy{}
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(decisionlog.Record{}, "Time", "LatencySeconds")); diff != "" {
+				t.Errorf("Unexpected decision log record (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package authorizer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"golang.org/x/sync/singleflight"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// decisionCache is an LRU cache of tiered policy store decisions with a TTL.
+//
+// Entries are keyed on normalized request attributes and the resource versions
+// of the cached objects the request's entities were built from, and are only
+// valid for the policy and entity store generations they were evaluated with.
+// Concurrent identical requests are coalesced into a single evaluation.
+type decisionCache struct {
+	cache *utilcache.LRUExpireCache
+	ttl   time.Duration
+	// timeout limits a coalesced evaluation, which doesn't end with the
+	// context of the request that started it
+	timeout time.Duration
+	group   singleflight.Group
+
+	// timeBased memoizes if the enforced or audit policies of the stores
+	// generations reference context.now
+	timeBasedMu          sync.Mutex
+	timeBasedGenerations []uint64
+	timeBased            bool
+}
+
+type cachedDecision struct {
+	generations []uint64
+	decision    cedar.Decision
+	diagnostic  store.TieredDiagnostic
+}
+
+// newDecisionCache returns a decisionCache, or nil if size or ttl are not
+// positive. Coalesced evaluations are limited to a positive timeout.
+func newDecisionCache(size int, ttl, timeout time.Duration) *decisionCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &decisionCache{
+		cache:   utilcache.NewLRUExpireCache(size),
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+// hasTimeBasedPolicies returns true if an enforced or audit policy in stores
+// references context.now. Decisions of time-based policies change without any
+// change to the request, so they aren't cached. The result is memoized for the store
+// generations, and a warning is logged when a policy change adds time-based
+// policies. A nil decisionCache returns false.
+func (c *decisionCache) hasTimeBasedPolicies(stores store.TieredPolicyStores) bool {
+	if c == nil {
+		return false
+	}
+	generations := stores.Generations()
+	c.timeBasedMu.Lock()
+	defer c.timeBasedMu.Unlock()
+	if c.timeBasedGenerations != nil && slices.Equal(c.timeBasedGenerations, generations) {
+		return c.timeBased
+	}
+	timeBased := false
+	for _, tier := range stores {
+		if referencesContextAttribute(tier.PolicySet(), "now") || referencesContextAttribute(tier.AuditPolicySet(), "now") {
+			timeBased = true
+			break
+		}
+	}
+	if timeBased && !c.timeBased {
+		klog.Warning("Policies reference context.now, authorization decisions are not cached while they are loaded")
+	}
+	c.timeBasedGenerations, c.timeBased = generations, timeBased
+	return timeBased
+}
+
+// IsAuthorized returns a cached decision for the attributes and object
+// versions if one exists for the current store generations, otherwise it calls
+// evaluate and caches the result. Generations must include every store the
+// decision depends on, and objectVersions the resource version of every cached
+// object, such as the request's namespace, that its entities were built from. Decisions
+// returned with an error, such as a timeout, are never cached.
+// A nil decisionCache always calls evaluate.
+//
+// A coalesced evaluation isn't canceled with the context of any one request.
+// Each request waits for it until its own ctx is done, and then returns the
+// context's error.
+func (c *decisionCache) IsAuthorized(
+	ctx context.Context,
+	generations []uint64,
+	attributes authorizer.Attributes,
+	objectVersions []string,
+	evaluate func(context.Context) (cedar.Decision, store.TieredDiagnostic, error),
+) (cedar.Decision, store.TieredDiagnostic, error) {
+	if c == nil {
+		return evaluate(ctx)
+	}
+	key, err := decisionCacheKey(attributes, objectVersions)
+	if err != nil {
+		return evaluate(ctx)
+	}
+
+	if v, ok := c.cache.Get(key); ok {
+		entry := v.(*cachedDecision)
+		if slices.Equal(entry.generations, generations) {
+			metrics.RecordDecisionCacheHit(ctx)
+			return entry.decision, entry.diagnostic, nil
+		}
+		c.cache.Remove(key)
+	}
+	metrics.RecordDecisionCacheMiss(ctx)
+
+	// Include generations in the flight key so a request never waits on an
+	// evaluation of an older policy set
+	flight := c.group.DoChan(fmt.Sprintf("%v/%s", generations, key), func() (any, error) {
+		flightCtx := context.WithoutCancel(ctx)
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			flightCtx, cancel = context.WithTimeout(flightCtx, c.timeout)
+			defer cancel()
+		}
+		decision, diagnostic, err := evaluate(flightCtx)
+		entry := &cachedDecision{
+			generations: generations,
+			decision:    decision,
+			diagnostic:  diagnostic,
+		}
+		if err == nil {
+			c.cache.Add(key, entry, c.ttl)
+		}
+		return entry, err
+	})
+	select {
+	case result := <-flight:
+		entry := result.Val.(*cachedDecision)
+		return entry.decision, entry.diagnostic, result.Err
+	case <-ctx.Done():
+		return cedar.Deny, store.TieredDiagnostic{Tier: -1}, ctx.Err()
+	}
+}
+
+// AuditIsAuthorized returns a cached audit decision for the attributes and
+// object versions if one exists for the current store generations, otherwise
+// it calls evaluate and caches the result. Audit decisions are cached with the
+// same key and generations as enforced decisions, in separate entries that
+// aren't counted in the cache metrics.
+// A nil decisionCache always calls evaluate.
+func (c *decisionCache) AuditIsAuthorized(
+	generations []uint64,
+	attributes authorizer.Attributes,
+	objectVersions []string,
+	evaluate func() (cedar.Decision, store.TieredDiagnostic),
+) (cedar.Decision, store.TieredDiagnostic) {
+	if c == nil {
+		return evaluate()
+	}
+	key, err := decisionCacheKey(attributes, objectVersions)
+	if err != nil {
+		return evaluate()
+	}
+	key = "audit/" + key
+
+	if v, ok := c.cache.Get(key); ok {
+		entry := v.(*cachedDecision)
+		if slices.Equal(entry.generations, generations) {
+			return entry.decision, entry.diagnostic
+		}
+		c.cache.Remove(key)
+	}
+	decision, diagnostic := evaluate()
+	c.cache.Add(key, &cachedDecision{
+		generations: generations,
+		decision:    decision,
+		diagnostic:  diagnostic,
+	}, c.ttl)
+	return decision, diagnostic
+}
+
+// normalizedAttributes is the set of attributes used in a decision
+type normalizedAttributes struct {
+	User            string              `json:"user"`
+	UID             string              `json:"uid"`
+	Groups          []string            `json:"groups"`
+	Extra           map[string][]string `json:"extra"`
+	Verb            string              `json:"verb"`
+	Namespace       string              `json:"namespace"`
+	APIGroup        string              `json:"apiGroup"`
+	APIVersion      string              `json:"apiVersion"`
+	Resource        string              `json:"resource"`
+	Subresource     string              `json:"subresource"`
+	Name            string              `json:"name"`
+	ResourceRequest bool                `json:"resourceRequest"`
+	Path            string              `json:"path"`
+	LabelSelector   []string            `json:"labelSelector"`
+	FieldSelector   []string            `json:"fieldSelector"`
+	ObjectVersions  []string            `json:"objectVersions"`
+}
+
+// decisionCacheKey returns a stable key for authorizer attributes and object
+// versions. Groups, extra values, and selectors are sorted so equivalent
+// requests share a key.
+func decisionCacheKey(attributes authorizer.Attributes, objectVersions []string) (string, error) {
+	key := normalizedAttributes{
+		Verb:            attributes.GetVerb(),
+		Namespace:       attributes.GetNamespace(),
+		APIGroup:        attributes.GetAPIGroup(),
+		APIVersion:      attributes.GetAPIVersion(),
+		Resource:        attributes.GetResource(),
+		Subresource:     attributes.GetSubresource(),
+		Name:            attributes.GetName(),
+		ResourceRequest: attributes.IsResourceRequest(),
+		Path:            attributes.GetPath(),
+		ObjectVersions:  objectVersions,
+	}
+	if u := attributes.GetUser(); u != nil {
+		key.User = u.GetName()
+		key.UID = u.GetUID()
+		key.Groups = slices.Sorted(slices.Values(u.GetGroups()))
+		if extra := u.GetExtra(); len(extra) > 0 {
+			key.Extra = map[string][]string{}
+			for k, v := range extra {
+				key.Extra[k] = slices.Sorted(slices.Values(v))
+			}
+		}
+	}
+	if labelSelector, err := attributes.GetLabelSelector(); err == nil {
+		for _, requirement := range labelSelector {
+			key.LabelSelector = append(key.LabelSelector, requirement.String())
+		}
+		sort.Strings(key.LabelSelector)
+	}
+	if fieldSelector, err := attributes.GetFieldSelector(); err == nil {
+		for _, requirement := range fieldSelector {
+			key.FieldSelector = append(key.FieldSelector, requirement.Field+string(requirement.Operator)+requirement.Value)
+		}
+		sort.Strings(key.FieldSelector)
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,314 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+type generationStore struct {
+	store.PolicyStore
+	generation atomic.Uint64
+}
+
+func (s *generationStore) Generation() uint64 { return s.generation.Load() }
+
+func TestDecisionCacheKey(t *testing.T) {
+	a := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user", Groups: []string{"b", "a"}},
+		Verb:            "get",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	b := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user", Groups: []string{"a", "b"}},
+		Verb:            "get",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	c := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user", Groups: []string{"a", "b"}},
+		Verb:            "list",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+	aKey, err := decisionCacheKey(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bKey, err := decisionCacheKey(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cKey, err := decisionCacheKey(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aKey != bKey {
+		t.Errorf("expected group order to be normalized: %s != %s", aKey, bKey)
+	}
+	if aKey == cKey {
+		t.Errorf("expected different verbs to have different keys: %s", aKey)
+	}
+	dKey, err := decisionCacheKey(a, []string{"2", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aKey == dKey {
+		t.Errorf("expected different object versions to have different keys: %s", aKey)
+	}
+}
+
+func TestDecisionCacheTimeBasedPolicies(t *testing.T) {
+	memStore, err := store.NewMemoryStore("cache", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeStore, err := store.NewMemoryStore("time", []byte(`forbid(principal, action, resource) when { context.now.toTime() < duration("9h") };`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newDecisionCache(10, time.Minute, 0)
+	if cache.hasTimeBasedPolicies(store.TieredPolicyStores{memStore}) {
+		t.Errorf("expected policies without context.now not to be time-based")
+	}
+	if !cache.hasTimeBasedPolicies(store.TieredPolicyStores{memStore, timeStore}) {
+		t.Errorf("expected policies with context.now to be time-based")
+	}
+	auditTimeStore, err := store.NewMemoryStore("audit-time", []byte(`@enforcement("audit") forbid(principal, action, resource) when { context.now.toTime() < duration("9h") };`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newDecisionCache(10, time.Minute, 0).hasTimeBasedPolicies(store.TieredPolicyStores{memStore, auditTimeStore}) {
+		t.Errorf("expected audit policies with context.now to be time-based")
+	}
+	var nilCache *decisionCache
+	if nilCache.hasTimeBasedPolicies(store.TieredPolicyStores{timeStore}) {
+		t.Errorf("expected a nil cache to return false")
+	}
+}
+
+func TestDecisionCache(t *testing.T) {
+	memStore, err := store.NewMemoryStore("cache", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genStore := &generationStore{PolicyStore: memStore}
+	stores := store.TieredPolicyStores{genStore}
+	attributes := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+
+	var evaluations atomic.Int32
+	evaluate := func(context.Context) (cedar.Decision, store.TieredDiagnostic, error) {
+		evaluations.Add(1)
+		return cedar.Allow, store.TieredDiagnostic{Tier: -1}, nil
+	}
+
+	cache := newDecisionCache(10, time.Minute, 0)
+	ctx := context.Background()
+
+	cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate)
+	cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate)
+	if got := evaluations.Load(); got != 1 {
+		t.Errorf("expected 1 evaluation after a cache hit, got %d", got)
+	}
+
+	genStore.generation.Add(1)
+	cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate)
+	if got := evaluations.Load(); got != 2 {
+		t.Errorf("expected generation change to invalidate the cache, got %d evaluations", got)
+	}
+
+	var nilCache *decisionCache
+	nilCache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate)
+	if got := evaluations.Load(); got != 3 {
+		t.Errorf("expected nil cache to always evaluate, got %d evaluations", got)
+	}
+
+	timeout := func(context.Context) (cedar.Decision, store.TieredDiagnostic, error) {
+		evaluations.Add(1)
+		return cedar.Deny, store.TieredDiagnostic{Tier: -1}, context.DeadlineExceeded
+	}
+	attributes.Verb = "watch"
+	if _, _, err := cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded error, got %v", err)
+	}
+	if decision, _, _ := cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate); decision != cedar.Allow {
+		t.Errorf("expected an evaluation error not to be cached, got %v", decision)
+	}
+	if got := evaluations.Load(); got != 5 {
+		t.Errorf("expected 5 evaluations, got %d", got)
+	}
+}
+
+func TestDecisionCacheAuditIsAuthorized(t *testing.T) {
+	memStore, err := store.NewMemoryStore("cache", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genStore := &generationStore{PolicyStore: memStore}
+	stores := store.TieredPolicyStores{genStore}
+	attributes := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+
+	var evaluations, auditEvaluations atomic.Int32
+	evaluate := func(context.Context) (cedar.Decision, store.TieredDiagnostic, error) {
+		evaluations.Add(1)
+		return cedar.Allow, store.TieredDiagnostic{Tier: -1}, nil
+	}
+	audit := func() (cedar.Decision, store.TieredDiagnostic) {
+		auditEvaluations.Add(1)
+		return cedar.Deny, store.TieredDiagnostic{Tier: 0}
+	}
+
+	cache := newDecisionCache(10, time.Minute, 0)
+	ctx := context.Background()
+
+	cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate)
+	if decision, diagnostic := cache.AuditIsAuthorized(stores.Generations(), attributes, nil, audit); decision != cedar.Deny || diagnostic.Tier != 0 {
+		t.Errorf("expected the audit decision not to be the cached enforced decision, got %v, tier %d", decision, diagnostic.Tier)
+	}
+	if decision, _ := cache.AuditIsAuthorized(stores.Generations(), attributes, nil, audit); decision != cedar.Deny {
+		t.Errorf("expected the cached audit decision, got %v", decision)
+	}
+	if got := auditEvaluations.Load(); got != 1 {
+		t.Errorf("expected 1 audit evaluation after a cache hit, got %d", got)
+	}
+	if decision, _, _ := cache.IsAuthorized(ctx, stores.Generations(), attributes, nil, evaluate); decision != cedar.Allow {
+		t.Errorf("expected the cached enforced decision, got %v", decision)
+	}
+	if got := evaluations.Load(); got != 1 {
+		t.Errorf("expected 1 evaluation after a cache hit, got %d", got)
+	}
+
+	genStore.generation.Add(1)
+	cache.AuditIsAuthorized(stores.Generations(), attributes, nil, audit)
+	if got := auditEvaluations.Load(); got != 2 {
+		t.Errorf("expected generation change to invalidate the cache, got %d audit evaluations", got)
+	}
+
+	var nilCache *decisionCache
+	nilCache.AuditIsAuthorized(stores.Generations(), attributes, nil, audit)
+	if got := auditEvaluations.Load(); got != 3 {
+		t.Errorf("expected nil cache to always evaluate, got %d audit evaluations", got)
+	}
+}
+
+func TestDecisionCacheCoalesce(t *testing.T) {
+	memStore, err := store.NewMemoryStore("cache", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := store.TieredPolicyStores{memStore}
+	attributes := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "list",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+
+	var evaluations atomic.Int32
+	release := make(chan struct{})
+	evaluate := func(context.Context) (cedar.Decision, store.TieredDiagnostic, error) {
+		evaluations.Add(1)
+		<-release
+		return cedar.Allow, store.TieredDiagnostic{Tier: -1}, nil
+	}
+
+	cache := newDecisionCache(10, time.Minute, 0)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if decision, _, _ := cache.IsAuthorized(context.Background(), stores.Generations(), attributes, nil, evaluate); decision != cedar.Allow {
+				t.Errorf("got %v, want %v", decision, cedar.Allow)
+			}
+		}()
+	}
+	// give the goroutines a chance to join the in-flight evaluation
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := evaluations.Load(); got != 1 {
+		t.Errorf("expected concurrent requests to be coalesced into 1 evaluation, got %d", got)
+	}
+}
+
+func TestDecisionCacheCoalesceDeadlines(t *testing.T) {
+	memStore, err := store.NewMemoryStore("cache", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := store.TieredPolicyStores{memStore}
+	attributes := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		Resource:        "secrets",
+		ResourceRequest: true,
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	evaluate := func(ctx context.Context) (cedar.Decision, store.TieredDiagnostic, error) {
+		close(started)
+		select {
+		case <-release:
+			return cedar.Allow, store.TieredDiagnostic{Tier: -1}, nil
+		case <-ctx.Done():
+			return cedar.Deny, store.TieredDiagnostic{Tier: -1}, ctx.Err()
+		}
+	}
+
+	cache := newDecisionCache(10, time.Minute, time.Minute)
+	shortCtx, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	longCtx, cancelLong := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelLong()
+
+	shortErr := make(chan error, 1)
+	go func() {
+		_, _, err := cache.IsAuthorized(shortCtx, stores.Generations(), attributes, nil, evaluate)
+		shortErr <- err
+	}()
+	<-started
+
+	type result struct {
+		decision cedar.Decision
+		err      error
+	}
+	longResult := make(chan result, 1)
+	go func() {
+		decision, _, err := cache.IsAuthorized(longCtx, stores.Generations(), attributes, nil, evaluate)
+		longResult <- result{decision, err}
+	}()
+
+	// the request that started the evaluation times out while it's in flight
+	if err := <-shortErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the short deadline request to get context.DeadlineExceeded, got %v", err)
+	}
+	close(release)
+	got := <-longResult
+	if got.err != nil || got.decision != cedar.Allow {
+		t.Errorf("expected the long deadline request to get the evaluated decision, got %v, %v", got.decision, got.err)
+	}
+}
@@ -2,6 +2,7 @@ package authorizer
 
 import (
 	"strings"
+	"time"
 
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
@@ -138,6 +139,27 @@ func ResourceToCedarEntity(attributes authorizer.Attributes) cedartypes.Entity {
 			Type: schema.ResourceEntityType,
 			ID:   cedartypes.String(entities.ResourceRequestToPath(attributes)),
 		},
+		Parents:    entities.NamespaceParents(attributes.GetNamespace()),
 		Attributes: cedartypes.NewRecord(respAttributes),
 	}
 }
+
+// RequestContext returns the context record for an authorization request made at the given time
+func RequestContext(attributes authorizer.Attributes, now time.Time) cedartypes.RecordMap {
+	resp := cedartypes.RecordMap{
+		"now":              cedartypes.NewDatetime(now),
+		"isReadOnly":       cedartypes.Boolean(attributes.IsReadOnly()),
+		"hasLabelSelector": cedartypes.False,
+		"hasFieldSelector": cedartypes.False,
+	}
+	if attributes.IsResourceRequest() {
+		resp["apiVersion"] = cedartypes.String(attributes.GetAPIVersion())
+	}
+	if labelSelector, err := attributes.GetLabelSelector(); err == nil && len(labelSelector) > 0 {
+		resp["hasLabelSelector"] = cedartypes.True
+	}
+	if fieldSelector, err := attributes.GetFieldSelector(); err == nil && len(fieldSelector) > 0 {
+		resp["hasFieldSelector"] = cedartypes.True
+	}
+	return resp
+}
@@ -0,0 +1,63 @@
+package authorizer
+
+import (
+	"context"
+
+	"github.com/cedar-policy/cedar-go"
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// Evaluation is an authorization decision, with the input and policies that determined it
+type Evaluation struct {
+	Decision authorizer.Decision
+	Reason   string
+	// PrincipalRule is the principal rule that decided the request, if any.
+	// Policies aren't evaluated when a principal rule decides a request.
+	PrincipalRule *v1alpha1.PrincipalRule
+	// Policies are the policies that determined the decision, in the tier Store
+	Policies []store.PolicyReason
+	Store    string
+	// Diagnostic contains the reasons and errors from evaluating policies
+	Diagnostic store.TieredDiagnostic
+	// Tiers are the results of evaluating each policy store
+	Tiers []store.TierEvaluation
+
+	Entities cedartypes.EntityMap
+	Request  cedar.Request
+}
+
+// Evaluate makes the same decision as Authorize, without the decision cache,
+// audit policies, metrics, or decision log. Requests are evaluated even if the
+// stores haven't completed their initial load, and every store is evaluated,
+// including stores after the store that decided the request.
+func (e *cedarWebhookAuthorizer) Evaluate(ctx context.Context, requestAttributes authorizer.Attributes) (Evaluation, error) {
+	rule := matchPrincipalRules(e.rules, requestAttributes)
+	switch rule.Action {
+	case v1alpha1.PrincipalRuleActionAllow:
+		return Evaluation{Decision: authorizer.DecisionAllow, Reason: rule.Reason, PrincipalRule: &rule}, nil
+	case v1alpha1.PrincipalRuleActionNoOpinion:
+		return Evaluation{Decision: authorizer.DecisionNoOpinion, PrincipalRule: &rule}, nil
+	}
+
+	entities, request := e.cedarRequest(ctx, requestAttributes)
+	evaluation, err := e.stores.Evaluate(ctx, entities, request)
+	if err != nil {
+		return Evaluation{}, err
+	}
+	diagnostic := evaluation.Diagnostic
+	decision, reason := e.policyDecision(evaluation.Decision, diagnostic)
+	return Evaluation{
+		Decision:   decision,
+		Reason:     reason,
+		Policies:   e.stores.Reasons(diagnostic),
+		Store:      e.stores.DecidingStore(diagnostic),
+		Diagnostic: diagnostic,
+		Tiers:      evaluation.Tiers,
+		Entities:   entities,
+		Request:    request,
+	}, nil
+}
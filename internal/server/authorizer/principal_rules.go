@@ -0,0 +1,73 @@
+package authorizer
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
+)
+
+// principalRulesOrDefault returns the configured rules, or the default rules if none are configured
+func principalRulesOrDefault(cfg *v1alpha1.AuthorizerConfig) []v1alpha1.PrincipalRule {
+	if cfg == nil || len(cfg.PrincipalRules) == 0 {
+		return v1alpha1.DefaultPrincipalRules(options.CedarAuthorizerIdentityName)
+	}
+	return cfg.PrincipalRules
+}
+
+// matchPrincipalRules returns the first rule that matches the request attributes.
+// If no rule matches, an evaluate rule is returned.
+func matchPrincipalRules(rules []v1alpha1.PrincipalRule, attributes authorizer.Attributes) v1alpha1.PrincipalRule {
+	for _, rule := range rules {
+		if principalRuleMatches(rule, attributes) {
+			return rule
+		}
+	}
+	return v1alpha1.PrincipalRule{Action: v1alpha1.PrincipalRuleActionEvaluate}
+}
+
+func principalRuleMatches(rule v1alpha1.PrincipalRule, attributes authorizer.Attributes) bool {
+	if !principalRuleMatchesUser(rule, attributes.GetUser()) {
+		return false
+	}
+	if rule.ReadOnly && !attributes.IsReadOnly() {
+		return false
+	}
+	if len(rule.APIGroups) > 0 && (!attributes.IsResourceRequest() || !slices.Contains(rule.APIGroups, attributes.GetAPIGroup())) {
+		return false
+	}
+	if len(rule.Resources) > 0 && (!attributes.IsResourceRequest() || !slices.Contains(rule.Resources, attributes.GetResource())) {
+		return false
+	}
+	return true
+}
+
+// principalRuleMatchesUser returns true if the rule's users, groups, and user prefixes match the user
+func principalRuleMatchesUser(rule v1alpha1.PrincipalRule, u user.Info) bool {
+	if u == nil {
+		return false
+	}
+	if len(rule.Users) > 0 && !slices.Contains(rule.Users, u.GetName()) {
+		return false
+	}
+	if len(rule.Groups) > 0 && !slices.ContainsFunc(u.GetGroups(), func(group string) bool {
+		return slices.Contains(rule.Groups, group)
+	}) {
+		return false
+	}
+	if len(rule.UserPrefixes) > 0 && !slices.ContainsFunc(rule.UserPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(u.GetName(), prefix)
+	}) {
+		return false
+	}
+	return true
+}
+
+// principalRuleIsUnconditional returns true if the rule applies to every request from a matching user
+func principalRuleIsUnconditional(rule v1alpha1.PrincipalRule) bool {
+	return !rule.ReadOnly && len(rule.APIGroups) == 0 && len(rule.Resources) == 0
+}
@@ -0,0 +1,201 @@
+package authorizer
+
+import (
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
+)
+
+func TestMatchPrincipalRules(t *testing.T) {
+	customRules := []v1alpha1.PrincipalRule{
+		{
+			Users:  []string{"system:anonymous"},
+			Action: v1alpha1.PrincipalRuleActionEvaluate,
+		},
+		{
+			Groups: []string{"system:masters"},
+			Action: v1alpha1.PrincipalRuleActionAllow,
+			Reason: "cluster admins are always allowed",
+		},
+		{
+			UserPrefixes: []string{"system:"},
+			Action:       v1alpha1.PrincipalRuleActionNoOpinion,
+		},
+	}
+
+	cases := []struct {
+		name       string
+		rules      []v1alpha1.PrincipalRule
+		input      authorizer.Attributes
+		wantAction string
+		wantReason string
+	}{
+		{
+			name:  "default: authorizer reads policies",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: options.CedarAuthorizerIdentityName},
+				Verb:            "watch",
+				APIGroup:        "cedar.k8s.aws",
+				Resource:        "policies",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionAllow,
+			wantReason: "cedar authorizer is always allowed to access policies and entity sets",
+		},
+		{
+			name:  "default: authorizer reads entity sets",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: options.CedarAuthorizerIdentityName},
+				Verb:            "list",
+				APIGroup:        "cedar.k8s.aws",
+				Resource:        "entitysets",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionAllow,
+			wantReason: "cedar authorizer is always allowed to access policies and entity sets",
+		},
+		{
+			name:  "default: authorizer reads RBAC",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: options.CedarAuthorizerIdentityName},
+				Verb:            "list",
+				APIGroup:        "rbac.authorization.k8s.io",
+				Resource:        "clusterroles",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionAllow,
+			wantReason: "cedar authorizer is always allowed to read RBAC policies",
+		},
+		{
+			name:  "default: authorizer watches namespaces",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: options.CedarAuthorizerIdentityName},
+				Verb:            "watch",
+				Resource:        "namespaces",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionAllow,
+			wantReason: "cedar authorizer is always allowed to read namespaces and principals",
+		},
+		{
+			name:  "default: authorizer writes policies",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: options.CedarAuthorizerIdentityName},
+				Verb:            "delete",
+				APIGroup:        "cedar.k8s.aws",
+				Resource:        "policies",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionNoOpinion,
+		},
+		{
+			name:  "default: service account is evaluated",
+			rules: principalRulesOrDefault(&v1alpha1.AuthorizerConfig{}),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "system:serviceaccount:default:default"},
+				Verb:            "get",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionEvaluate,
+		},
+		{
+			name:  "default: node is evaluated",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "system:node:ip-10-0-0-1"},
+				Verb:            "get",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionEvaluate,
+		},
+		{
+			name:  "default: system identity has no opinion",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "system:anonymous"},
+				Verb:            "get",
+				Path:            "/healthz",
+				ResourceRequest: false,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionNoOpinion,
+		},
+		{
+			name:  "default: user is evaluated",
+			rules: principalRulesOrDefault(nil),
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "test-user"},
+				Verb:            "get",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionEvaluate,
+		},
+		{
+			name:  "custom: anonymous is evaluated",
+			rules: customRules,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "system:anonymous"},
+				Verb:            "get",
+				Path:            "/healthz",
+				ResourceRequest: false,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionEvaluate,
+		},
+		{
+			name:  "custom: group allowed",
+			rules: customRules,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "admin", Groups: []string{"system:authenticated", "system:masters"}},
+				Verb:            "delete",
+				Resource:        "nodes",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionAllow,
+			wantReason: "cluster admins are always allowed",
+		},
+		{
+			name:  "custom: service account has no opinion",
+			rules: customRules,
+			input: authorizer.AttributesRecord{
+				User:            &user.DefaultInfo{Name: "system:serviceaccount:default:default"},
+				Verb:            "get",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionNoOpinion,
+		},
+		{
+			name:  "no user",
+			rules: customRules,
+			input: authorizer.AttributesRecord{
+				Verb:            "get",
+				Resource:        "pods",
+				ResourceRequest: true,
+			},
+			wantAction: v1alpha1.PrincipalRuleActionEvaluate,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := matchPrincipalRules(tc.rules, tc.input)
+			if rule.Action != tc.wantAction {
+				t.Errorf("Didn't get same action: got %q: wanted %q", rule.Action, tc.wantAction)
+			}
+			if rule.Reason != tc.wantReason {
+				t.Errorf("Didn't get same reason: got %q: wanted %q", rule.Reason, tc.wantReason)
+			}
+		})
+	}
+}
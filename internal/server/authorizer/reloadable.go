@@ -0,0 +1,47 @@
+package authorizer
+
+import (
+	"context"
+	"sync/atomic"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// ReloadableAuthorizer is an Authorizer that delegates to an authorizer that
+// can be replaced while requests are served, such as when the store config is
+// reloaded
+type ReloadableAuthorizer struct {
+	current atomic.Pointer[Authorizer]
+}
+
+// NewReloadableAuthorizer creates a ReloadableAuthorizer that delegates to authz
+func NewReloadableAuthorizer(authz Authorizer) *ReloadableAuthorizer {
+	resp := &ReloadableAuthorizer{}
+	resp.Set(authz)
+	return resp
+}
+
+// Set replaces the authorizer. Requests already being evaluated complete with
+// the previous authorizer.
+func (r *ReloadableAuthorizer) Set(authz Authorizer) {
+	r.current.Store(&authz)
+}
+
+func (r *ReloadableAuthorizer) get() Authorizer {
+	return *r.current.Load()
+}
+
+func (r *ReloadableAuthorizer) Authorize(ctx context.Context, attrs authorizer.Attributes) (authorizer.Decision, string, error) {
+	return r.get().Authorize(ctx, attrs)
+}
+
+func (r *ReloadableAuthorizer) Evaluate(ctx context.Context, attrs authorizer.Attributes) (Evaluation, error) {
+	return r.get().Evaluate(ctx, attrs)
+}
+
+func (r *ReloadableAuthorizer) RulesFor(ctx context.Context, u user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
+	return r.get().RulesFor(ctx, u, namespace)
+}
+
+var _ Authorizer = &ReloadableAuthorizer{}
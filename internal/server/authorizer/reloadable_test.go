@@ -0,0 +1,59 @@
+package authorizer
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func TestReloadableAuthorizer(t *testing.T) {
+	newAuthorizer := func(policy string) Authorizer {
+		t.Helper()
+		policyStore, err := store.NewMemoryStore("reload", []byte(policy), true)
+		if err != nil {
+			t.Fatalf("Failed to create policy store: %v", err)
+		}
+		return NewAuthorizer(nil, Options{}, policyStore)
+	}
+	input := authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: "test-user"},
+		Verb:            "get",
+		APIVersion:      "v1",
+		Resource:        "pods",
+		ResourceRequest: true,
+	}
+
+	authz := NewReloadableAuthorizer(newAuthorizer(`permit (principal, action, resource);`))
+	if dec, _, err := authz.Authorize(context.Background(), input); err != nil || dec != authorizer.DecisionAllow {
+		t.Fatalf("Expected Allow before reload, got %v, %v", dec, err)
+	}
+
+	// requests are served while the authorizer is replaced
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, _, err := authz.Authorize(context.Background(), input); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	authz.Set(newAuthorizer(`forbid (principal, action, resource);`))
+	wg.Wait()
+
+	if dec, _, err := authz.Authorize(context.Background(), input); err != nil || dec != authorizer.DecisionDeny {
+		t.Errorf("Expected Deny after reload, got %v, %v", dec, err)
+	}
+	evaluation, err := authz.Evaluate(context.Background(), input)
+	if err != nil || evaluation.Decision != authorizer.DecisionDeny {
+		t.Errorf("Expected Evaluate to use the reloaded authorizer, got %v, %v", evaluation.Decision, err)
+	}
+}
@@ -0,0 +1,635 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+	cedarast "github.com/cedar-policy/cedar-go/ast"
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"github.com/cedar-policy/cedar-go/x/exp/ast"
+	"github.com/cedar-policy/cedar-go/x/exp/batch"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// RulesFor returns the resource and non-resource rules that the Cedar policies
+// grant a user in a namespace. Each tier is partially evaluated for the user
+// with an unknown action and resource, and the remaining resource conditions
+// of applicable permit policies are converted into rules. Permit policies in
+// forbidOnly tiers never allow a request, so they aren't converted. The result
+// is incomplete if any applicable policy can't be represented as a rule, or if
+// a forbid policy may apply, as it could override a permit in an earlier
+// denyOverrides tier or in its own tier.
+func (e *cedarWebhookAuthorizer) RulesFor(ctx context.Context, u user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
+	resolver := newRuleResolver(namespace)
+	if !resolver.addPrincipalRules(e.rules, u) {
+		resourceRules, nonResourceRules := resolver.rules()
+		return resourceRules, nonResourceRules, resolver.incomplete, nil
+	}
+	if !e.policiesLoaded() {
+		return nil, nil, true, errors.New("policies not yet loaded")
+	}
+
+	principalUID, principalEntities := entities.UserToCedarEntity(u)
+	e.principals.AddAttributes(principalUID, principalEntities)
+	e.entityStores.AddToRequest(principalUID, principalEntities)
+	for _, tier := range e.stores {
+		if err := resolver.addPolicySet(ctx, tier.PolicySet(), store.TierOptionsOf(tier), principalUID, principalEntities); err != nil {
+			return nil, nil, true, err
+		}
+	}
+	resourceRules, nonResourceRules := resolver.rules()
+	return resourceRules, nonResourceRules, resolver.incomplete, nil
+}
+
+const (
+	ruleWildcard   = "*"
+	actionVariable = "action"
+)
+
+var readOnlyVerbs = []string{
+	schema.AuthorizationActionGet,
+	schema.AuthorizationActionList,
+	schema.AuthorizationActionWatch,
+}
+
+// ruleResolver collects rules, merging rules that only differ by verb
+type ruleResolver struct {
+	namespace  string
+	incomplete bool
+
+	resourceRules    map[string]*authorizer.DefaultResourceRuleInfo
+	nonResourceRules map[string]*authorizer.DefaultNonResourceRuleInfo
+}
+
+func newRuleResolver(namespace string) *ruleResolver {
+	return &ruleResolver{
+		namespace:        namespace,
+		resourceRules:    map[string]*authorizer.DefaultResourceRuleInfo{},
+		nonResourceRules: map[string]*authorizer.DefaultNonResourceRuleInfo{},
+	}
+}
+
+func (r *ruleResolver) addResourceRule(verbs, apiGroups, resources, resourceNames []string) {
+	key := fmt.Sprintf("%q %q %q", apiGroups, resources, resourceNames)
+	rule, ok := r.resourceRules[key]
+	if !ok {
+		rule = &authorizer.DefaultResourceRuleInfo{
+			APIGroups:     apiGroups,
+			Resources:     resources,
+			ResourceNames: resourceNames,
+		}
+		r.resourceRules[key] = rule
+	}
+	rule.Verbs = appendUnique(rule.Verbs, verbs...)
+}
+
+func (r *ruleResolver) addNonResourceRule(verbs, urls []string) {
+	key := fmt.Sprintf("%q", urls)
+	rule, ok := r.nonResourceRules[key]
+	if !ok {
+		rule = &authorizer.DefaultNonResourceRuleInfo{NonResourceURLs: urls}
+		r.nonResourceRules[key] = rule
+	}
+	rule.Verbs = appendUnique(rule.Verbs, verbs...)
+}
+
+// rules returns the collected rules sorted by everything but their verbs
+func (r *ruleResolver) rules() ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo) {
+	resourceRules := []authorizer.ResourceRuleInfo{}
+	for _, key := range slices.Sorted(maps.Keys(r.resourceRules)) {
+		resourceRules = append(resourceRules, r.resourceRules[key])
+	}
+	nonResourceRules := []authorizer.NonResourceRuleInfo{}
+	for _, key := range slices.Sorted(maps.Keys(r.nonResourceRules)) {
+		nonResourceRules = append(nonResourceRules, r.nonResourceRules[key])
+	}
+	return resourceRules, nonResourceRules
+}
+
+// addPrincipalRules adds the rules granted by principal rules matching the
+// user, and returns true if policies need to be evaluated for the user.
+func (r *ruleResolver) addPrincipalRules(rules []v1alpha1.PrincipalRule, u user.Info) bool {
+	for _, rule := range rules {
+		if !principalRuleMatchesUser(rule, u) {
+			continue
+		}
+		unconditional := principalRuleIsUnconditional(rule)
+		switch rule.Action {
+		case v1alpha1.PrincipalRuleActionAllow:
+			verbs := []string{ruleWildcard}
+			if rule.ReadOnly {
+				verbs = readOnlyVerbs
+			}
+			r.addResourceRule(verbs, wildcardIfEmpty(rule.APIGroups), wildcardIfEmpty(rule.Resources), nil)
+			if len(rule.APIGroups) == 0 && len(rule.Resources) == 0 {
+				r.addNonResourceRule(verbs, []string{ruleWildcard})
+			}
+			if unconditional {
+				return false
+			}
+		case v1alpha1.PrincipalRuleActionNoOpinion:
+			// Another authorizer decides these requests
+			r.incomplete = true
+			if unconditional {
+				return false
+			}
+		default:
+			if unconditional {
+				return true
+			}
+		}
+	}
+	return true
+}
+
+// addPolicySet partially evaluates a tier of policies for the principal, and
+// adds rules for each applicable permit policy, unless the tier is forbidOnly.
+func (r *ruleResolver) addPolicySet(ctx context.Context, policySet *cedar.PolicySet, options store.TierOptions, principalUID cedartypes.EntityUID, principalEntities cedartypes.EntityMap) error {
+	if policySet == nil {
+		return nil
+	}
+	residuals := map[cedar.PolicyID]residualPolicy{}
+	principalPolicies := cedar.NewPolicySet()
+	for id, policy := range policySet.Map() {
+		if options.Combining == v1alpha1.CombiningForbidOnly && policy.Effect() == cedar.Permit {
+			continue
+		}
+		residual := newResidualPolicy(policy)
+		residuals[id] = residual
+		principalPolicies.Add(id, residual.principalPolicy)
+	}
+
+	actions := []cedartypes.Value{}
+	for _, action := range schema.AllAuthorizationActionNames() {
+		actionUID, _ := ActionEntities(action)
+		actions = append(actions, actionUID)
+	}
+
+	err := batch.Authorize(ctx, principalPolicies, principalEntities, batch.Request{
+		Principal: principalUID,
+		Action:    batch.Variable(actionVariable),
+		Resource:  batch.Ignore(),
+		Context:   batch.Ignore(),
+		Variables: batch.Variables{actionVariable: actions},
+	}, func(result batch.Result) error {
+		verb := string(result.Request.Action.ID)
+		if len(result.Diagnostic.Errors) > 0 {
+			// An erroring policy may or may not apply
+			r.incomplete = true
+		}
+		for _, reason := range result.Diagnostic.Reasons {
+			r.addResidualPolicy(residuals[reason.PolicyID], verb)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to evaluate policies: %w", err)
+	}
+	return nil
+}
+
+// addResidualPolicy adds the rules for a policy that applies to the principal and verb
+func (r *ruleResolver) addResidualPolicy(residual residualPolicy, verb string) {
+	if residual.effect == ast.EffectForbid || residual.constraints == nil {
+		r.incomplete = true
+		return
+	}
+	c := residual.constraints
+	for _, values := range c.values {
+		if len(values) == 0 {
+			// The constraints on an attribute don't overlap, so the policy never applies
+			return
+		}
+	}
+
+	if verb == schema.AuthorizationActionImpersonate {
+		// Impersonated resources are principals, not k8s::Resource entities
+		if c.kind != resourceKindAny || len(c.values) > 0 {
+			r.incomplete = true
+			return
+		}
+		r.addResourceRule([]string{verb}, []string{ruleWildcard}, []string{ruleWildcard}, nil)
+		return
+	}
+
+	if c.kind != resourceKindNonResource && !slices.Contains(schema.NonResourceOnlyAuthorizationActionNames(), verb) {
+		namespaces, constrained := c.values["namespace"]
+		if !constrained || slices.Contains(namespaces, r.namespace) {
+			r.addResourceRule(
+				[]string{verb},
+				wildcardIfEmpty(c.values["apiGroup"]),
+				c.resources(),
+				c.values["name"],
+			)
+		}
+	}
+	if c.kind != resourceKindResource && !slices.Contains(schema.ResourceOnlyAuthorizationActionNames(), verb) {
+		r.addNonResourceRule([]string{verb}, wildcardIfEmpty(c.values["path"]))
+	}
+}
+
+type resourceKind int
+
+const (
+	resourceKindAny resourceKind = iota
+	resourceKindResource
+	resourceKindNonResource
+)
+
+var (
+	resourceConstraintAttributes    = []string{"apiGroup", "resource", "subresource", "name", "namespace"}
+	nonResourceConstraintAttributes = []string{"path"}
+)
+
+// resourceConstraints are the allowed values of resource attributes.
+// An attribute that isn't present in values is unconstrained.
+type resourceConstraints struct {
+	kind   resourceKind
+	values map[string][]string
+	has    map[string]bool
+}
+
+// resources returns the rule resources, including any constrained subresources
+func (c *resourceConstraints) resources() []string {
+	resources := wildcardIfEmpty(c.values["resource"])
+	subresources, ok := c.values["subresource"]
+	if !ok {
+		return resources
+	}
+	resp := []string{}
+	for _, resource := range resources {
+		for _, subresource := range subresources {
+			resp = append(resp, resource+"/"+subresource)
+		}
+	}
+	return resp
+}
+
+// setKind narrows the kind of resource, and returns false if the kinds conflict
+func (c *resourceConstraints) setKind(kind resourceKind) bool {
+	if c.kind != resourceKindAny && c.kind != kind {
+		return false
+	}
+	c.kind = kind
+	return true
+}
+
+// constrain restricts an attribute to the given values
+func (c *resourceConstraints) constrain(attribute string, values []string) bool {
+	switch {
+	case slices.Contains(resourceConstraintAttributes, attribute):
+		if !c.setKind(resourceKindResource) {
+			return false
+		}
+	case slices.Contains(nonResourceConstraintAttributes, attribute):
+		if !c.setKind(resourceKindNonResource) {
+			return false
+		}
+	default:
+		return false
+	}
+	if existing, ok := c.values[attribute]; ok {
+		values = slices.DeleteFunc(slices.Clone(values), func(v string) bool {
+			return !slices.Contains(existing, v)
+		})
+	}
+	c.values[attribute] = values
+	return true
+}
+
+// addScope adds the constraints of a policy's resource scope
+func (c *resourceConstraints) addScope(scope ast.IsResourceScopeNode) bool {
+	switch s := scope.(type) {
+	case ast.ScopeTypeAll:
+		return true
+	case ast.ScopeTypeIs:
+		return c.addEntityType(s.Type)
+	case ast.ScopeTypeEq:
+		if s.Entity.Type != schema.NonResourceURLEntityType {
+			return false
+		}
+		return c.constrain("path", []string{string(s.Entity.ID)})
+	case ast.ScopeTypeIn:
+		return c.addNamespace(s.Entity)
+	case ast.ScopeTypeIsIn:
+		return c.addEntityType(s.Type) && c.addNamespace(s.Entity)
+	}
+	return false
+}
+
+// addNamespace constrains the resource to be in a k8s::Namespace entity
+func (c *resourceConstraints) addNamespace(entity cedartypes.EntityUID) bool {
+	if entity.Type != schema.NamespaceEntityType {
+		return false
+	}
+	return c.setKind(resourceKindResource) && c.constrain("namespace", []string{string(entity.ID)})
+}
+
+func (c *resourceConstraints) addEntityType(entityType cedartypes.EntityType) bool {
+	switch entityType {
+	case schema.ResourceEntityType:
+		return c.setKind(resourceKindResource)
+	case schema.NonResourceURLEntityType:
+		return c.setKind(resourceKindNonResource)
+	}
+	return false
+}
+
+// addCondition adds the constraints of a condition that only references the
+// resource, and returns false if the condition can't be represented as a rule
+func (c *resourceConstraints) addCondition(node ast.IsNode) bool {
+	switch n := node.(type) {
+	case ast.NodeTypeAnd:
+		return c.addCondition(n.Left) && c.addCondition(n.Right)
+	case ast.NodeTypeEquals:
+		if attribute, ok := resourceAttribute(n.Left); ok {
+			if value, ok := stringValue(n.Right); ok {
+				return c.constrain(attribute, []string{value})
+			}
+		}
+		if attribute, ok := resourceAttribute(n.Right); ok {
+			if value, ok := stringValue(n.Left); ok {
+				return c.constrain(attribute, []string{value})
+			}
+		}
+	case ast.NodeTypeContains:
+		if attribute, ok := resourceAttribute(n.Right); ok {
+			if values, ok := stringSetValue(n.Left); ok {
+				return c.constrain(attribute, values)
+			}
+		}
+	case ast.NodeTypeHas:
+		if isVariable(n.Arg, "resource") {
+			c.has[string(n.Value)] = true
+			return true
+		}
+	case ast.NodeTypeIs:
+		if isVariable(n.Left, "resource") {
+			return c.addEntityType(n.EntityType)
+		}
+	case ast.NodeTypeLike:
+		if attribute, ok := resourceAttribute(n.Arg); ok && attribute == "path" {
+			if prefix, ok := patternPrefix(n.Value); ok {
+				return c.constrain(attribute, []string{prefix + ruleWildcard})
+			}
+		}
+	}
+	return false
+}
+
+// residualPolicy is a policy split into the part that only depends on the
+// principal and action, and the constraints it places on the resource.
+type residualPolicy struct {
+	effect          ast.Effect
+	principalPolicy *cedar.Policy
+	// constraints is nil if the resource conditions can't be represented as a rule
+	constraints *resourceConstraints
+}
+
+func newResidualPolicy(policy *cedar.Policy) residualPolicy {
+	policyAST := (*ast.Policy)(policy.AST())
+	principalAST := &ast.Policy{
+		Effect:    ast.EffectPermit,
+		Principal: policyAST.Principal,
+		Action:    policyAST.Action,
+		Resource:  ast.ScopeTypeAll{},
+	}
+	constraints := &resourceConstraints{
+		values: map[string][]string{},
+		has:    map[string]bool{},
+	}
+	translatable := constraints.addScope(policyAST.Resource)
+
+	for _, condition := range policyAST.Conditions {
+		conjuncts := []ast.IsNode{condition.Body}
+		if condition.Condition == ast.ConditionWhen {
+			conjuncts = splitConjuncts(condition.Body)
+		}
+		for _, conjunct := range conjuncts {
+			variables := referencedVariables(conjunct)
+			switch {
+			case !variables["resource"] && !variables["context"]:
+				principalAST.Conditions = append(principalAST.Conditions, ast.ConditionType{
+					Condition: condition.Condition,
+					Body:      conjunct,
+				})
+			case condition.Condition == ast.ConditionWhen && len(variables) == 1 && variables["resource"]:
+				translatable = constraints.addCondition(conjunct) && translatable
+			default:
+				translatable = false
+			}
+		}
+	}
+	for attribute := range constraints.has {
+		if _, ok := constraints.values[attribute]; !ok {
+			translatable = false
+		}
+	}
+	if !translatable {
+		constraints = nil
+	}
+	return residualPolicy{
+		effect:          policyAST.Effect,
+		principalPolicy: cedar.NewPolicyFromAST((*cedarast.Policy)(principalAST)),
+		constraints:     constraints,
+	}
+}
+
+// splitConjuncts returns the top-level operands of a chain of && expressions
+func splitConjuncts(node ast.IsNode) []ast.IsNode {
+	if and, ok := node.(ast.NodeTypeAnd); ok {
+		return append(splitConjuncts(and.Left), splitConjuncts(and.Right)...)
+	}
+	return []ast.IsNode{node}
+}
+
+// referencedVariables returns the names of the variables referenced in an expression
+func referencedVariables(node ast.IsNode) map[string]bool {
+	resp := map[string]bool{}
+	walkNodes(node, func(node ast.IsNode) {
+		if variable, ok := node.(ast.NodeTypeVariable); ok {
+			resp[string(variable.Name)] = true
+		}
+	})
+	return resp
+}
+
+// referencesContextAttribute returns true if a condition of any policy in a
+// policy set accesses an attribute of the context. A nil policy set has no
+// policies.
+func referencesContextAttribute(policySet *cedar.PolicySet, attribute string) bool {
+	if policySet == nil {
+		return false
+	}
+	found := false
+	for _, policy := range policySet.Map() {
+		for _, condition := range (*ast.Policy)(policy.AST()).Conditions {
+			walkNodes(condition.Body, func(node ast.IsNode) {
+				access, ok := node.(ast.NodeTypeAccess)
+				if ok && isVariable(access.Arg, "context") && string(access.Value) == attribute {
+					found = true
+				}
+			})
+		}
+	}
+	return found
+}
+
+// walkNodes calls visit for an expression and each of its subexpressions
+func walkNodes(node ast.IsNode, visit func(ast.IsNode)) {
+	walkAll := func(nodes ...ast.IsNode) {
+		for _, n := range nodes {
+			walkNodes(n, visit)
+		}
+	}
+	visit(node)
+	switch n := node.(type) {
+	case ast.NodeTypeIfThenElse:
+		walkAll(n.If, n.Then, n.Else)
+	case ast.NodeTypeOr:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeAnd:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeLessThan:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeLessThanOrEqual:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeGreaterThan:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeGreaterThanOrEqual:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeNotEquals:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeEquals:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeIn:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeHasTag:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeGetTag:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeSub:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeAdd:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeMult:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeContains:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeContainsAll:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeContainsAny:
+		walkAll(n.Left, n.Right)
+	case ast.NodeTypeHas:
+		walkAll(n.Arg)
+	case ast.NodeTypeAccess:
+		walkAll(n.Arg)
+	case ast.NodeTypeLike:
+		walkAll(n.Arg)
+	case ast.NodeTypeIs:
+		walkAll(n.Left)
+	case ast.NodeTypeIsIn:
+		walkAll(n.Left, n.Entity)
+	case ast.NodeTypeNegate:
+		walkAll(n.Arg)
+	case ast.NodeTypeNot:
+		walkAll(n.Arg)
+	case ast.NodeTypeExtensionCall:
+		walkAll(n.Args...)
+	case ast.NodeTypeRecord:
+		for _, element := range n.Elements {
+			walkAll(element.Value)
+		}
+	case ast.NodeTypeSet:
+		walkAll(n.Elements...)
+	}
+}
+
+func isVariable(node ast.IsNode, name string) bool {
+	variable, ok := node.(ast.NodeTypeVariable)
+	return ok && string(variable.Name) == name
+}
+
+// resourceAttribute returns the attribute name of a `resource.<attribute>` expression
+func resourceAttribute(node ast.IsNode) (string, bool) {
+	access, ok := node.(ast.NodeTypeAccess)
+	if !ok || !isVariable(access.Arg, "resource") {
+		return "", false
+	}
+	return string(access.Value), true
+}
+
+func stringValue(node ast.IsNode) (string, bool) {
+	value, ok := node.(ast.NodeValue)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.Value.(cedartypes.String)
+	return string(s), ok
+}
+
+func stringSetValue(node ast.IsNode) ([]string, bool) {
+	resp := []string{}
+	switch n := node.(type) {
+	case ast.NodeTypeSet:
+		for _, element := range n.Elements {
+			s, ok := stringValue(element)
+			if !ok {
+				return nil, false
+			}
+			resp = append(resp, s)
+		}
+	case ast.NodeValue:
+		set, ok := n.Value.(cedartypes.Set)
+		if !ok {
+			return nil, false
+		}
+		for _, value := range set.Slice() {
+			s, ok := value.(cedartypes.String)
+			if !ok {
+				return nil, false
+			}
+			resp = append(resp, string(s))
+		}
+	default:
+		return nil, false
+	}
+	return resp, true
+}
+
+// patternPrefix returns the literal prefix of a pattern that only has a
+// trailing wildcard, such as "/logs/*"
+func patternPrefix(pattern cedartypes.Pattern) (string, bool) {
+	literal := strings.TrimSuffix(strings.TrimPrefix(string(pattern.MarshalCedar()), `"`), `"`)
+	if strings.Contains(literal, `\`) || strings.Count(literal, "*") != 1 || !strings.HasSuffix(literal, "*") {
+		return "", false
+	}
+	return strings.TrimSuffix(literal, "*"), true
+}
+
+func wildcardIfEmpty(values []string) []string {
+	if len(values) == 0 {
+		return []string{ruleWildcard}
+	}
+	return values
+}
+
+func appendUnique(values []string, additions ...string) []string {
+	for _, addition := range additions {
+		if !slices.Contains(values, addition) {
+			values = append(values, addition)
+		}
+	}
+	return values
+}
@@ -0,0 +1,424 @@
+package authorizer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func TestRulesFor(t *testing.T) {
+	testUser := &user.DefaultInfo{Name: "test-user", UID: "test-user-uid", Groups: []string{"viewers", "system:authenticated"}}
+
+	cases := []struct {
+		name                 string
+		policies             []string
+		tierOptions          []store.TierOptions
+		rules                []v1alpha1.PrincipalRule
+		user                 user.Info
+		namespace            string
+		storeComplete        bool
+		wantResourceRules    []authorizer.ResourceRuleInfo
+		wantNonResourceRules []authorizer.NonResourceRuleInfo
+		wantIncomplete       bool
+		wantErr              bool
+	}{
+		{
+			name: "resource attributes",
+			policies: []string{`
+permit (
+    principal in k8s::Group::"viewers",
+    action in [k8s::Action::"get", k8s::Action::"list", k8s::Action::"watch"],
+    resource is k8s::Resource
+) when {
+    resource.apiGroup == "" &&
+    ["pods", "services"].contains(resource.resource)
+};`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get", "list", "watch"},
+					APIGroups: []string{""},
+					Resources: []string{"pods", "services"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "names and subresources",
+			policies: []string{`
+permit (
+    principal == k8s::User::"test-user-uid",
+    action == k8s::Action::"update",
+    resource is k8s::Resource
+) when {
+    resource.apiGroup == "apps" &&
+    resource.resource == "deployments" &&
+    resource has subresource && resource.subresource == "scale" &&
+    resource has name && resource.name == "web"
+};`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:         []string{"update"},
+					APIGroups:     []string{"apps"},
+					Resources:     []string{"deployments/scale"},
+					ResourceNames: []string{"web"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "namespace filtering",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource has namespace && resource.namespace == "default" &&
+    resource.resource == "configmaps"
+};
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource has namespace && resource.namespace == "kube-system" &&
+    resource.resource == "secrets"
+};`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get"},
+					APIGroups: []string{"*"},
+					Resources: []string{"configmaps"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "namespace parents",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"list",
+    resource in k8s::Namespace::"default"
+);
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource in k8s::Namespace::"kube-system"
+);`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"list"},
+					APIGroups: []string{"*"},
+					Resources: []string{"*"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "non-resource urls",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource == k8s::NonResourceURL::"/healthz"
+);
+permit (
+    principal,
+    action in [k8s::Action::"get", k8s::Action::"post"],
+    resource is k8s::NonResourceURL
+) when {
+    resource.path like "/logs/*"
+};`},
+			user:              testUser,
+			namespace:         "default",
+			storeComplete:     true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{
+				&authorizer.DefaultNonResourceRuleInfo{
+					Verbs:           []string{"get"},
+					NonResourceURLs: []string{"/healthz"},
+				},
+				&authorizer.DefaultNonResourceRuleInfo{
+					Verbs:           []string{"get", "post"},
+					NonResourceURLs: []string{"/logs/*"},
+				},
+			},
+		},
+		{
+			name: "unconstrained resource",
+			policies: []string{`
+permit (
+    principal in k8s::Group::"viewers",
+    action == k8s::Action::"get",
+    resource
+);`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get"},
+					APIGroups: []string{"*"},
+					Resources: []string{"*"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{
+				&authorizer.DefaultNonResourceRuleInfo{
+					Verbs:           []string{"get"},
+					NonResourceURLs: []string{"*"},
+				},
+			},
+		},
+		{
+			name: "principal conditions",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"delete",
+    resource is k8s::Resource
+) when {
+    principal.name == "test-user" && resource.resource == "pods"
+};
+permit (
+    principal,
+    action == k8s::Action::"create",
+    resource is k8s::Resource
+) when {
+    principal.name == "other-user" && resource.resource == "pods"
+};`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"delete"},
+					APIGroups: []string{"*"},
+					Resources: []string{"pods"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "untranslatable conditions are incomplete",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"list",
+    resource is k8s::Resource
+) when {
+    resource.resource == "pods" &&
+    resource has labelSelector &&
+    resource.labelSelector.contains({"key": "owner", "operator": "=", "values": ["test-user"]})
+};
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource.resource == "pods"
+} unless {
+    resource has subresource
+};`},
+			user:                 testUser,
+			namespace:            "default",
+			storeComplete:        true,
+			wantResourceRules:    []authorizer.ResourceRuleInfo{},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+			wantIncomplete:       true,
+		},
+		{
+			name: "forbid is incomplete",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource.resource == "pods"
+};
+forbid (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource.resource == "pods" && resource has name && resource.name == "secret-pod"
+};`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get"},
+					APIGroups: []string{"*"},
+					Resources: []string{"pods"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+			wantIncomplete:       true,
+		},
+		{
+			name: "forbid for other principal is ignored",
+			policies: []string{`
+permit (
+    principal,
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource.resource == "pods"
+};`, `
+forbid (
+    principal == k8s::User::"other-user",
+    action,
+    resource
+);`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get"},
+					APIGroups: []string{"*"},
+					Resources: []string{"pods"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "principal rule allow",
+			rules: []v1alpha1.PrincipalRule{
+				{
+					Users:     []string{options.CedarAuthorizerIdentityName},
+					ReadOnly:  true,
+					APIGroups: []string{"cedar.k8s.aws"},
+					Action:    v1alpha1.PrincipalRuleActionAllow,
+				},
+				{
+					UserPrefixes: []string{"system:"},
+					Action:       v1alpha1.PrincipalRuleActionNoOpinion,
+				},
+			},
+			user:          &user.DefaultInfo{Name: options.CedarAuthorizerIdentityName},
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get", "list", "watch"},
+					APIGroups: []string{"cedar.k8s.aws"},
+					Resources: []string{"*"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+			wantIncomplete:       true,
+		},
+		{
+			name: "forbidOnly tier permits are not rules",
+			policies: []string{`
+permit (principal, action == k8s::Action::"get", resource is k8s::Resource) when { resource.resource == "pods" };`, `
+permit (principal, action == k8s::Action::"get", resource is k8s::Resource) when { resource.resource == "services" };`},
+			tierOptions:   []store.TierOptions{{Combining: v1alpha1.CombiningForbidOnly}, {}},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get"},
+					APIGroups: []string{"*"},
+					Resources: []string{"services"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+		},
+		{
+			name: "denyOverrides permit with a later forbid is incomplete",
+			policies: []string{`
+permit (principal, action == k8s::Action::"get", resource is k8s::Resource) when { resource.resource == "pods" };`, `
+forbid (principal in k8s::Group::"viewers", action, resource);`},
+			tierOptions:   []store.TierOptions{{Combining: v1alpha1.CombiningDenyOverrides}, {}},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: true,
+			wantResourceRules: []authorizer.ResourceRuleInfo{
+				&authorizer.DefaultResourceRuleInfo{
+					Verbs:     []string{"get"},
+					APIGroups: []string{"*"},
+					Resources: []string{"pods"},
+				},
+			},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+			wantIncomplete:       true,
+		},
+		{
+			name: "principal rule no opinion",
+			policies: []string{`
+permit (principal, action, resource);`},
+			user:                 &user.DefaultInfo{Name: "system:kube-scheduler"},
+			namespace:            "default",
+			storeComplete:        true,
+			wantResourceRules:    []authorizer.ResourceRuleInfo{},
+			wantNonResourceRules: []authorizer.NonResourceRuleInfo{},
+			wantIncomplete:       true,
+		},
+		{
+			name: "policies not loaded",
+			policies: []string{`
+permit (principal, action, resource);`},
+			user:          testUser,
+			namespace:     "default",
+			storeComplete: false,
+			wantErr:       true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := []store.PolicyStore{}
+			for i, policy := range tc.policies {
+				policyStore, err := store.NewMemoryStore(tc.name, []byte(policy), tc.storeComplete)
+				if err != nil {
+					t.Fatalf("Failed to create policy store: %s", err)
+				}
+				if i < len(tc.tierOptions) {
+					policyStore = store.WithTierOptions(policyStore, tc.tierOptions[i])
+				}
+				stores = append(stores, policyStore)
+			}
+			authorizer := cedarWebhookAuthorizer{stores: stores, rules: principalRulesOrDefault(&v1alpha1.AuthorizerConfig{PrincipalRules: tc.rules})}
+			resourceRules, nonResourceRules, incomplete, err := authorizer.RulesFor(context.Background(), tc.user, tc.namespace)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: got %v, wanted error: %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if incomplete != tc.wantIncomplete {
+				t.Errorf("Didn't get same incomplete: got %v: wanted %v", incomplete, tc.wantIncomplete)
+			}
+			if diff := cmp.Diff(tc.wantResourceRules, resourceRules); diff != "" {
+				t.Errorf("Unexpected resource rules (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantNonResourceRules, nonResourceRules); diff != "" {
+				t.Errorf("Unexpected non-resource rules (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package clientauth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
+)
+
+// Rejection reasons
+const (
+	// ReasonNoCertificate is a request without a client certificate
+	ReasonNoCertificate = "no_certificate"
+	// ReasonInvalidCertificate is a request with a client certificate that isn't signed by the client CA
+	ReasonInvalidCertificate = "invalid_certificate"
+	// ReasonNotAllowed is a request from a verified client that isn't allowed to call the path
+	ReasonNotAllowed = "not_allowed"
+)
+
+// Authenticator verifies webhook client certificates, and limits the paths
+// each client may call. A nil Authenticator allows every request.
+type Authenticator struct {
+	clientCA dynamiccertificates.CAContentProvider
+	allowed  map[string]sets.Set[string]
+}
+
+// New creates an Authenticator from cfg, or returns nil if cfg is nil
+func New(cfg *config.ClientAuthConfig) *Authenticator {
+	if cfg == nil {
+		return nil
+	}
+	resp := &Authenticator{
+		clientCA: cfg.ClientCA,
+		allowed:  map[string]sets.Set[string]{},
+	}
+	for path, identities := range cfg.AllowedClients {
+		resp.allowed[path] = sets.New(identities...)
+	}
+	return resp
+}
+
+// WithClientAuth only passes requests to handler from clients with a verified
+// certificate that are allowed to call path. Other requests are rejected with
+// 401 Unauthorized or 403 Forbidden.
+func (a *Authenticator) WithClientAuth(handler http.Handler, path string) http.Handler {
+	if a == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, reason, err := a.authenticate(r, path)
+		if err != nil {
+			klog.V(2).InfoS("Rejected webhook client", "path", path, "reason", reason, "remoteAddr", r.RemoteAddr, "err", err)
+			metrics.RecordClientAuthRejected(r.Context(), path, reason)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the HTTP status and reason a request is rejected for,
+// or a nil error if its client may call path
+func (a *Authenticator) authenticate(r *http.Request, path string) (int, string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return http.StatusUnauthorized, ReasonNoCertificate, errors.New("a client certificate is required")
+	}
+	opts, ok := a.clientCA.VerifyOptions()
+	if !ok {
+		return http.StatusUnauthorized, ReasonInvalidCertificate, errors.New("client certificate can't be verified: no client CA is loaded")
+	}
+	if len(r.TLS.PeerCertificates) > 1 {
+		opts.Intermediates = x509.NewCertPool()
+		for _, intermediate := range r.TLS.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(intermediate)
+		}
+	}
+	cert := r.TLS.PeerCertificates[0]
+	if _, err := cert.Verify(opts); err != nil {
+		return http.StatusUnauthorized, ReasonInvalidCertificate, fmt.Errorf("client certificate is not valid: %w", err)
+	}
+
+	allowed, ok := a.allowed[path]
+	if !ok {
+		return http.StatusOK, "", nil
+	}
+	identities := Identities(cert)
+	if slices.ContainsFunc(identities, allowed.Has) {
+		return http.StatusOK, "", nil
+	}
+	return http.StatusForbidden, ReasonNotAllowed, fmt.Errorf("client %q is not allowed to call %s", cert.Subject.CommonName, path)
+}
+
+// Identities returns the common name and subject alternative names of a certificate
+func Identities(cert *x509.Certificate) []string {
+	var resp []string
+	if cert.Subject.CommonName != "" {
+		resp = append(resp, cert.Subject.CommonName)
+	}
+	resp = append(resp, cert.DNSNames...)
+	resp = append(resp, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		resp = append(resp, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		resp = append(resp, uri.String())
+	}
+	return resp
+}
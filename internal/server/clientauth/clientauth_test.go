@@ -0,0 +1,143 @@
+package clientauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CA certificate: %v", err)
+	}
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) bundle() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca testCA) clientCert(t *testing.T, commonName string, dnsNames ...string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse client certificate: %v", err)
+	}
+	return cert
+}
+
+func TestWithClientAuth(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	clientCA, err := dynamiccertificates.NewStaticCAContent("client-ca", ca.bundle())
+	if err != nil {
+		t.Fatalf("Failed to load client CA: %v", err)
+	}
+	authenticator := New(&config.ClientAuthConfig{
+		ClientCA: clientCA,
+		AllowedClients: map[string][]string{
+			"/v1/authorize": {"kube-apiserver"},
+			"/v1/admit":     {"admission.cedar.svc"},
+		},
+	})
+
+	apiServer := ca.clientCert(t, "kube-apiserver")
+	admissionController := ca.clientCert(t, "admission-controller", "admission.cedar.svc")
+	untrusted := otherCA.clientCert(t, "kube-apiserver")
+
+	cases := []struct {
+		name       string
+		path       string
+		cert       *x509.Certificate
+		wantStatus int
+	}{
+		{name: "allowed by common name", path: "/v1/authorize", cert: apiServer, wantStatus: http.StatusOK},
+		{name: "allowed by DNS SAN", path: "/v1/admit", cert: admissionController, wantStatus: http.StatusOK},
+		{name: "not allowed on another path", path: "/v1/admit", cert: apiServer, wantStatus: http.StatusForbidden},
+		{name: "other path not allowed", path: "/v1/authorize", cert: admissionController, wantStatus: http.StatusForbidden},
+		{name: "path without allowlist", path: "/v1/rules", cert: admissionController, wantStatus: http.StatusOK},
+		{name: "no certificate", path: "/v1/authorize", wantStatus: http.StatusUnauthorized},
+		{name: "untrusted CA", path: "/v1/authorize", cert: untrusted, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := authenticator.WithClientAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), tc.path)
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			req.TLS = &tls.ConnectionState{}
+			if tc.cert != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{tc.cert}
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// a nil Authenticator allows every request
+	var disabled *Authenticator
+	rec := httptest.NewRecorder()
+	disabled.WithClientAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), "/v1/authorize").ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/authorize", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a nil Authenticator to allow requests, got %d", rec.Code)
+	}
+}
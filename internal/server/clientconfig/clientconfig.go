@@ -0,0 +1,52 @@
+package clientconfig
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// Load returns a client config for the API server.
+//
+// If the KUBECONFIG environment variable is set, Load blocks until the file exists
+// and is populated, and uses the optional kubeconfigContext. Otherwise the
+// in-cluster config is used.
+func Load(kubeconfigContext string) (*rest.Config, error) {
+	kubeconfigPath, ok := os.LookupEnv("KUBECONFIG")
+	if !ok {
+		klog.Infof("No kubeconfig found, using in-cluster config")
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error building in-cluster config: %w", err)
+		}
+		return config, nil
+	}
+
+	for {
+		fi, err := fs.Stat(os.DirFS("/"), strings.TrimLeft(kubeconfigPath, "/"))
+		if err == nil {
+			klog.Infof("kubeconfig found at %s", kubeconfigPath)
+			if fi.Size() == 0 {
+				klog.Infof("kubeconfig is empty, waiting 5s for it to be populated")
+			} else {
+				break
+			}
+		} else {
+			klog.Infof("kubeconfig not yet found at '%s', waiting 5s for it to be created: %v", kubeconfigPath, err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
+		&clientcmd.ConfigOverrides{CurrentContext: kubeconfigContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %w", err)
+	}
+	return config, nil
+}
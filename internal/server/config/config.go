@@ -1,7 +1,13 @@
 package config
 
 import (
+	"time"
+
 	apiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
 )
 
 // AuthorizationWebhookConfig contains the runtime config for the authorizer
@@ -9,13 +15,86 @@ type AuthorizationWebhookConfig struct {
 	ShutdownTimeout int
 
 	StoreConfig string
+	// StoreConfigReload configures reloading StoreConfig when it changes. Reloading is disabled when nil
+	StoreConfigReload *StoreConfigReloadConfig
+
+	DecisionCache *DecisionCacheConfig
+
+	AuthorizationEvaluation *EvaluationConfig
+	AdmissionEvaluation     *EvaluationConfig
+
+	// AdmissionSchema is the schema admission objects are converted into entities with
+	AdmissionSchema schema.CedarSchema
 
 	ErrorInjection *ErrorInjectionConfig
 	SecureServing  *apiserver.SecureServingInfo
+	// ClientAuth configures verification of webhook client certificates. Client certificates aren't verified when nil
+	ClientAuth *ClientAuthConfig
+
+	// Tracing configures the OTLP trace exporter. Tracing is disabled when nil
+	Tracing *tracingapi.TracingConfiguration
+
+	// DecisionLog configures the decision log. The decision log is disabled when nil
+	DecisionLog *DecisionLogConfig
 
 	DebugOptions *DebugOptions
 }
 
+// DecisionCacheConfig configures the authorization decision cache.
+// The cache is disabled if Size or TTL are 0
+type DecisionCacheConfig struct {
+	Size int
+	TTL  time.Duration
+}
+
+const (
+	// FallbackDecisionNoOpinion returns no opinion when evaluation times out. Only valid for authorization
+	FallbackDecisionNoOpinion = "NoOpinion"
+	// FallbackDecisionAllow allows the request when evaluation times out
+	FallbackDecisionAllow = "Allow"
+	// FallbackDecisionDeny denies the request when evaluation times out
+	FallbackDecisionDeny = "Deny"
+)
+
+// EvaluationConfig limits how long a webhook spends evaluating a request.
+// When Timeout passes, FallbackDecision is returned. A Timeout of 0 disables the limit
+type EvaluationConfig struct {
+	Timeout          time.Duration
+	FallbackDecision string
+}
+
+// DecisionLogConfig configures the JSON log of authorization and admission decisions
+type DecisionLogConfig struct {
+	// Path is the file decisions are written to, or "-" for stdout
+	Path string
+	// MaxSize is the size in megabytes of the file before it is rotated
+	MaxSize int
+	// MaxBackups is the number of rotated files to keep. 0 keeps all files
+	MaxBackups int
+	// AllowSampleRate is the fraction of decisions other than Deny that are written, from 0 to 1.
+	// Deny decisions are always written.
+	AllowSampleRate float64
+}
+
+// StoreConfigReloadConfig configures how the store config file is reloaded
+type StoreConfigReloadConfig struct {
+	// Interval is how often the file is checked for changes
+	Interval time.Duration
+	// Timeout is how long to wait for the stores of a changed config to load
+	// before it is rejected
+	Timeout time.Duration
+}
+
+// ClientAuthConfig configures verification of webhook client certificates
+type ClientAuthConfig struct {
+	// ClientCA verifies client certificates
+	ClientCA dynamiccertificates.CAContentProvider
+	// AllowedClients maps a request path to the certificate common names and
+	// subject alternative names that may call it. Any client with a verified
+	// certificate may call paths without an entry.
+	AllowedClients map[string][]string
+}
+
 type ErrorInjectionConfig struct {
 	ArtificialErrorRate float64
 	ArtificialDenyRate  float64
@@ -24,6 +103,8 @@ type ErrorInjectionConfig struct {
 
 type DebugOptions struct {
 	EnableProfiling bool
+	// EnableExplain serves /debug/explain, which returns the Cedar evaluation input and each tier's result for a request
+	EnableExplain bool
 
 	EnableRecording bool
 	RecordingDir    string
@@ -0,0 +1,169 @@
+package decisionlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+const (
+	// WebhookAuthorization is the webhook of an authorization decision
+	WebhookAuthorization = "authorization"
+	// WebhookAdmission is the webhook of an admission decision
+	WebhookAdmission = "admission"
+
+	// DecisionDeny decisions are always logged
+	DecisionDeny = "Deny"
+
+	// SourcePrincipalRule is the source of a decision made by a principal rule
+	SourcePrincipalRule = "principalRule"
+	// SourceExcluded is the source of an admission request excluded from
+	// policy evaluation
+	SourceExcluded = "excluded"
+	// SourceNotLoaded is the source of a decision made before the policy or
+	// entity stores finished loading
+	SourceNotLoaded = "notLoaded"
+)
+
+// Record is a single decision in the decision log, written as one line of JSON.
+//
+// The JSON field names are a stable schema for log consumers. Fields may be
+// added, but existing fields are never renamed or removed.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Webhook string    `json:"webhook"`
+
+	Principal Principal `json:"principal"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Namespace string    `json:"namespace,omitempty"`
+
+	// Decision is Allow, Deny, or NoOpinion
+	Decision string `json:"decision"`
+	// Policies are the policies that determined the decision, if any
+	Policies []Policy `json:"policies"`
+	// Store is the policy store tier that decided the request, if any
+	Store string `json:"store,omitempty"`
+	// TimedOut is true if the request wasn't evaluated in time, and Decision
+	// is the configured fallback decision
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Source is set when the decision wasn't made by evaluating policies, and is
+	// one of principalRule, excluded, or notLoaded
+	Source string `json:"source,omitempty"`
+	// Reason is the principal rule's reason or the exclusion that decided the
+	// request, if any
+	Reason string `json:"reason,omitempty"`
+
+	LatencySeconds float64 `json:"latencySeconds"`
+}
+
+// Principal is the Cedar principal of a request
+type Principal struct {
+	Type   string   `json:"type"`
+	UID    string   `json:"uid"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+// Policy is a policy that determined a decision
+type Policy struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+}
+
+// Policies converts the reasons for a decision to decision log policies
+func Policies(reasons []store.PolicyReason) []Policy {
+	resp := make([]Policy, 0, len(reasons))
+	for _, reason := range reasons {
+		resp = append(resp, Policy{ID: string(reason.PolicyID), Source: reason.Source})
+	}
+	return resp
+}
+
+// Logger writes decision records. A nil Logger discards all records.
+type Logger struct {
+	mu  sync.Mutex
+	out io.Writer
+	enc *json.Encoder
+
+	allowSampleRate float64
+	// random returns a number in [0.0, 1.0), and is overridden in tests
+	random func() float64
+}
+
+// New creates a Logger from cfg, or returns nil if cfg is nil.
+//
+// A Path of "-" writes to stdout. Any other path is a file that is rotated when
+// it reaches MaxSize megabytes.
+func New(cfg *config.DecisionLogConfig) (*Logger, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.AllowSampleRate < 0 || cfg.AllowSampleRate > 1 {
+		return nil, fmt.Errorf("allow sample rate must be between 0 and 1, got %v", cfg.AllowSampleRate)
+	}
+	var out io.Writer = os.Stdout
+	if cfg.Path != "-" {
+		out = &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+		}
+	}
+	return newLogger(out, cfg.AllowSampleRate), nil
+}
+
+func newLogger(out io.Writer, allowSampleRate float64) *Logger {
+	return &Logger{
+		out:             out,
+		enc:             json.NewEncoder(out),
+		allowSampleRate: allowSampleRate,
+		random:          rand.Float64,
+	}
+}
+
+// Log writes a record. Denies are always written, and other decisions are
+// written at the Logger's allow sample rate.
+func (l *Logger) Log(record Record) {
+	if l == nil {
+		return
+	}
+	if record.Decision != DecisionDeny && l.random() >= l.allowSampleRate {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	if record.Policies == nil {
+		record.Policies = []Policy{}
+	}
+	if record.Principal.Groups == nil {
+		record.Principal.Groups = []string{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(record); err != nil {
+		klog.ErrorS(err, "Failed to write decision log record")
+	}
+}
+
+// Close closes the decision log file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if closer, ok := l.out.(io.Closer); ok && l.out != os.Stdout {
+		return closer.Close()
+	}
+	return nil
+}
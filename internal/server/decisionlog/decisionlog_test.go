@@ -0,0 +1,143 @@
+package decisionlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+)
+
+func TestLogSampling(t *testing.T) {
+	cases := []struct {
+		name            string
+		allowSampleRate float64
+		random          float64
+		decision        string
+		wantLogged      bool
+	}{
+		{name: "deny is always logged", allowSampleRate: 0, random: 0.5, decision: "Deny", wantLogged: true},
+		{name: "allow in sample", allowSampleRate: 0.5, random: 0.25, decision: "Allow", wantLogged: true},
+		{name: "allow out of sample", allowSampleRate: 0.5, random: 0.75, decision: "Allow", wantLogged: false},
+		{name: "no opinion out of sample", allowSampleRate: 0.5, random: 0.75, decision: "NoOpinion", wantLogged: false},
+		{name: "all allows", allowSampleRate: 1, random: 0.99, decision: "Allow", wantLogged: true},
+		{name: "no allows", allowSampleRate: 0, random: 0, decision: "Allow", wantLogged: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := newLogger(&buf, tc.allowSampleRate)
+			l.random = func() float64 { return tc.random }
+			l.Log(Record{Decision: tc.decision})
+			if logged := buf.Len() > 0; logged != tc.wantLogged {
+				t.Errorf("Expected logged to be %v, got %v", tc.wantLogged, logged)
+			}
+		})
+	}
+}
+
+func TestLogSchema(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(&buf, 1)
+	l.Log(Record{
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Webhook: WebhookAuthorization,
+		Principal: Principal{
+			Type: "k8s::User",
+			UID:  "1234",
+			Name: "alice",
+		},
+		Action:         `k8s::Action::"get"`,
+		Resource:       `k8s::Resource::"/api/v1/namespaces/default/pods"`,
+		Namespace:      "default",
+		Decision:       "Deny",
+		Policies:       []Policy{{ID: "policy0", Source: "policies.cedar policy 0"}},
+		Store:          "FilePolicyStore",
+		LatencySeconds: 0.5,
+	})
+	l.Log(Record{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Webhook: WebhookAdmission, Decision: "Allow"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []map[string]any{
+		{
+			"time":    "2024-01-02T03:04:05Z",
+			"webhook": "authorization",
+			"principal": map[string]any{
+				"type":   "k8s::User",
+				"uid":    "1234",
+				"name":   "alice",
+				"groups": []any{},
+			},
+			"action":         `k8s::Action::"get"`,
+			"resource":       `k8s::Resource::"/api/v1/namespaces/default/pods"`,
+			"namespace":      "default",
+			"decision":       "Deny",
+			"policies":       []any{map[string]any{"id": "policy0", "source": "policies.cedar policy 0"}},
+			"store":          "FilePolicyStore",
+			"latencySeconds": 0.5,
+		},
+		{
+			"time":    "2024-01-02T03:04:05Z",
+			"webhook": "admission",
+			"principal": map[string]any{
+				"type":   "",
+				"uid":    "",
+				"name":   "",
+				"groups": []any{},
+			},
+			"action":         "",
+			"resource":       "",
+			"decision":       "Allow",
+			"policies":       []any{},
+			"latencySeconds": 0.0,
+		},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %d: %s", len(want), len(lines), buf.String())
+	}
+	for i, line := range lines {
+		var got map[string]any
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("Failed to parse line %d: %v", i, err)
+		}
+		if diff := cmp.Diff(want[i], got); diff != "" {
+			t.Errorf("Unexpected record %d (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	l, err := New(nil)
+	if err != nil || l != nil {
+		t.Fatalf("Expected a nil logger without config, got %v, %v", l, err)
+	}
+	// a nil logger discards records
+	l.Log(Record{Decision: "Deny"})
+
+	if _, err := New(&config.DecisionLogConfig{Path: "-", AllowSampleRate: 2}); err == nil {
+		t.Error("Expected an error for an allow sample rate over 1")
+	}
+
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	l, err = New(&config.DecisionLogConfig{Path: path, MaxSize: 1, MaxBackups: 1, AllowSampleRate: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	l.Log(Record{Decision: "Deny"})
+	if err := l.Close(); err != nil {
+		t.Fatalf("Failed to close decision log: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read decision log: %v", err)
+	}
+	if !strings.Contains(string(data), `"decision":"Deny"`) {
+		t.Errorf("Expected a Deny record, got %s", data)
+	}
+}
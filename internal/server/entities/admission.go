@@ -1,13 +1,18 @@
 package entities
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"slices"
 	"strings"
 
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"go.opentelemetry.io/otel/attribute"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
@@ -99,6 +104,42 @@ func (a *authorizerAttributeWrapper) GetPath() string
 func (a *authorizerAttributeWrapper) GetFieldSelector() (fields.Requirements, error) { return nil, nil }
 func (a *authorizerAttributeWrapper) GetLabelSelector() (labels.Requirements, error) { return nil, nil }
 
+// GroupVersionKindRecord converts a kind into a Cedar record. The group of core
+// resources is empty.
+func GroupVersionKindRecord(gvk metav1.GroupVersionKind) cedartypes.Record {
+	return cedartypes.NewRecord(cedartypes.RecordMap{
+		"group":   cedartypes.String(gvk.Group),
+		"version": cedartypes.String(gvk.Version),
+		"kind":    cedartypes.String(gvk.Kind),
+	})
+}
+
+// AddAdmissionRequestToContext adds if an admission request is a dry run, its
+// subresource, kind, requested kind, and options to the request context.
+// Options aren't added for CONNECT requests, their connect options are the
+// request's resource.
+func AddAdmissionRequestToContext(ctx context.Context, req admission.Request, context cedartypes.RecordMap) error {
+	context[schema.AdmissionDryRunContextKey] = cedartypes.Boolean(req.DryRun != nil && *req.DryRun)
+	context[schema.AdmissionSubResourceContextKey] = cedartypes.String(req.SubResource)
+	context[schema.AdmissionKindContextKey] = GroupVersionKindRecord(req.Kind)
+	if req.RequestKind != nil {
+		context[schema.AdmissionRequestKindContextKey] = GroupVersionKindRecord(*req.RequestKind)
+	}
+	if req.Options.Raw == nil || req.Operation == admissionv1.Connect {
+		return nil
+	}
+	obj, err := UnstructuredFromAdmissionRequestObject(req.Options.Raw)
+	if err != nil {
+		return fmt.Errorf("error getting unstructured options: %w", err)
+	}
+	options, err := UnstructuredToRecord(ctx, obj, obj.GetKind())
+	if err != nil {
+		return fmt.Errorf("error converting options to Cedar record: %w", err)
+	}
+	context[schema.AdmissionOptionsContextKey] = options
+	return nil
+}
+
 func UnstructuredFromAdmissionRequestObject(data []byte) (*unstructured.Unstructured, error) {
 	if data == nil {
 		return nil, errors.New("unstructured data is nil")
@@ -112,38 +153,43 @@ func UnstructuredFromAdmissionRequestObject(data []byte) (*unstructured.Unstruct
 	return obj, nil
 }
 
-func CedarResourceEntityFromAdmissionRequest(req admission.Request) (*cedartypes.Entity, error) {
-	return cedarResourceEntityFromAdmissionRequest(req, req.Object.Raw)
+// CedarResourceEntityFromAdmissionRequest converts the object of an admission
+// request into a Cedar entity. Objects of types in cedarSchema are converted
+// with the schema, see UnstructuredToSchemaRecord.
+func CedarResourceEntityFromAdmissionRequest(ctx context.Context, req admission.Request, cedarSchema schema.CedarSchema) (*cedartypes.Entity, error) {
+	return cedarResourceEntityFromAdmissionRequest(ctx, req, req.Object.Raw, cedarSchema)
 }
 
-func CedarOldResourceEntityFromAdmissionRequest(req admission.Request) (*cedartypes.Entity, error) {
-	return cedarResourceEntityFromAdmissionRequest(req, req.OldObject.Raw)
+// CedarOldResourceEntityFromAdmissionRequest converts the old object of an
+// admission request into a Cedar entity
+func CedarOldResourceEntityFromAdmissionRequest(ctx context.Context, req admission.Request, cedarSchema schema.CedarSchema) (*cedartypes.Entity, error) {
+	return cedarResourceEntityFromAdmissionRequest(ctx, req, req.OldObject.Raw, cedarSchema)
 }
 
-func cedarResourceEntityFromAdmissionRequest(req admission.Request, rawData []byte) (*cedartypes.Entity, error) {
+func cedarResourceEntityFromAdmissionRequest(ctx context.Context, req admission.Request, rawData []byte, cedarSchema schema.CedarSchema) (*cedartypes.Entity, error) {
 	// Convert the request's generator resource to unstructured for expansion
 	obj, err := UnstructuredFromAdmissionRequestObject(rawData)
 	if err != nil {
 		return nil, fmt.Errorf("error getting unstructured resource %s: %w", req.Name, err)
 	}
 
-	// TODO: entity list construction based on the schema
-	// * Generate the schema
-	// * Update the schema on CRD changes
-	// * Walk the schema for this type and build the Cedar entity
-
 	resourceGroup := req.Resource.Group
 	if resourceGroup == "" {
 		resourceGroup = "core"
 	}
+	cedarResourceType := strings.Join([]string{resourceGroup, req.Kind.Version, req.Kind.Kind}, "::")
 
-	attributes, err := UnstructuredToRecord(obj, resourceGroup, req.Kind.Version, req.Kind.Kind)
+	attributes, found, err := UnstructuredToSchemaRecord(ctx, cedarSchema, obj, cedarResourceType)
+	if !found {
+		// types that aren't in the schema, such as CRDs the schema wasn't
+		// generated with, are converted without it
+		klog.V(6).InfoS("Resource type isn't in the schema, converting without it", "type", cedarResourceType)
+		attributes, err = UnstructuredToRecord(ctx, obj, req.Kind.Kind)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error converting unstructured object to Cedar entity: %w", err)
 	}
 
-	cedarResourceType := strings.Join([]string{resourceGroup, req.Kind.Version, req.Kind.Kind}, "::")
-
 	resp := cedartypes.Entity{
 		UID: cedartypes.EntityUID{
 			Type: cedartypes.EntityType(cedarResourceType),
@@ -151,13 +197,20 @@ func cedarResourceEntityFromAdmissionRequest(req admission.Request, rawData []by
 				ResourceRequestToPath(AdmissionRequestToAuthorizerAttribute(req)),
 			),
 		},
+		Parents:    NamespaceParents(req.Namespace),
 		Attributes: attributes,
 	}
 
 	return &resp, nil
 }
 
-func UnstructuredToRecord(obj *unstructured.Unstructured, group, version, kind string) (cedartypes.Record, error) {
+// UnstructuredToRecord converts an object to a Cedar record without a schema.
+// Only labels and annotations are converted into sets of key/value records. It
+// stops and returns the context's error if the context is done before the
+// whole object is converted.
+func UnstructuredToRecord(ctx context.Context, obj *unstructured.Unstructured, kind string) (cedartypes.Record, error) {
+	ctx, span := tracing.Start(ctx, "UnstructuredToRecord", attribute.String("k8s.kind", kind))
+	defer span.End()
 	if obj == nil {
 		return cedartypes.NewRecord(nil), errors.New("unstructured object is nil")
 	}
@@ -168,7 +221,7 @@ func UnstructuredToRecord(obj *unstructured.Unstructured, group, version, kind s
 			continue
 		}
 		// Try not to blow the stack, limit CRDs to 32 fields deep
-		val, err := walkObject(32, group, version, kind, k, v)
+		val, err := walkObject(ctx, 32, k, v)
 		if err != nil {
 			return cedartypes.NewRecord(nil), err
 		}
@@ -181,119 +234,19 @@ func UnstructuredToRecord(obj *unstructured.Unstructured, group, version, kind s
 	return cedartypes.NewRecord(cedartypes.RecordMap(attributes)), nil
 }
 
-func walkObject(i int, group, version, kind, keyName string, obj any) (cedartypes.Value, error) {
+func walkObject(ctx context.Context, i int, keyName string, obj any) (cedartypes.Value, error) {
 	if i == 0 {
 		return nil, errors.New("max depth reached")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if obj == nil {
 		// skip empty values
 		return nil, nil
 	}
 
-	// TODO: This is a hack of referencing attribute names until walking schema for nested entities is supported
-	// g/v/k/attrNames
-	knownKeyValueStringMapAttributes := map[string]map[string]map[string][]string{
-		"core": {
-			"v1": {
-				"ConfigMap":                   {"data", "binaryData"},
-				"CSIPersistentVolumeSource":   {"volumeAttributes"},
-				"CSIVolumeSource":             {"volumeAttributes"},
-				"FlexPersistentVolumeSource":  {"options"},
-				"FlexVolumeSource":            {"options"},
-				"PersistentVolumeClaimStatus": {"allocatedResourceStatuses"},
-				"Pod":                         {"nodeSelector"},
-				"ReplicationController":       {"selector"},
-				"Secret":                      {"data", "stringData"},
-				"Service":                     {"selector"},
-				// The following types only get evaulated if we walk the schema tree
-				// "PodSpec":                     {"nodeSelector"},
-				// "ReplicationControllerSpec":   {"selector"},
-				// "ServiceSpec":                 {"selector"},
-			},
-		},
-		"discovery": {"v1": {"Endpoint": {"deprecatedTopology"}}},
-		"node":      {"v1": {"Scheduling": {"nodeSelectors"}}},
-		"storage": {
-			"v1": {
-				"StorageClass":           {"parameters"},
-				"VolumeAttachmentStatus": {"attachmentMetadata"},
-			},
-		},
-		// TODO: the following only works once we walk the schema tree
-		"meta": {
-			"v1": {
-				"LabelSelector": {"matchLabels"},
-				"ObjectMeta":    {"annotations", "labels"},
-			},
-		},
-	}
-	if apiGroup, ok := knownKeyValueStringMapAttributes[group]; ok {
-		if apiVersion, ok := apiGroup[version]; ok {
-			if attrNames, ok := apiVersion[kind]; ok {
-				if slices.Contains(attrNames, keyName) {
-					set := []cedartypes.Value{}
-					for kk, vv := range obj.(map[string]interface{}) {
-
-						val, ok := vv.(string)
-						if !ok {
-							klog.ErrorS(nil, "Error converting label/annotation value to string", "key", kk, "value", vv)
-							break
-						}
-						set = append(set, cedartypes.NewRecord(cedartypes.RecordMap{
-							cedartypes.String("key"):   cedartypes.String(kk),
-							cedartypes.String("value"): cedartypes.String(val),
-						}))
-					}
-					return cedartypes.NewSet(set...), nil
-				}
-			}
-		}
-	}
-
-	knownKeyValueStringSliceMapAttributes := map[string]map[string]map[string][]string{
-		"authentication": {
-			"v1": {
-				"UserInfo": {"extra"},
-			},
-		},
-		"authorization": {
-			"v1": {
-				"SubjectAccessReview": {"extra"},
-			},
-		},
-		"certificates": {
-			"v1": {
-				"CertificateSigningRequest": {"extra"},
-			},
-		},
-	}
-	if apiGroup, ok := knownKeyValueStringSliceMapAttributes[group]; ok {
-		if apiVersion, ok := apiGroup[version]; ok {
-			if attrNames, ok := apiVersion[kind]; ok {
-				if slices.Contains(attrNames, keyName) {
-					set := []cedartypes.Value{}
-					for kk, vv := range obj.(map[string]interface{}) {
-
-						val, ok := vv.([]string)
-						if !ok {
-							klog.ErrorS(nil, "Error converting label/annotation value to slice of string", "key", kk, "value", vv)
-							break
-						}
-						valSet := []cedartypes.Value{}
-						for _, v := range val {
-							valSet = append(valSet, cedartypes.String(v))
-						}
-						set = append(set, cedartypes.NewRecord(cedartypes.RecordMap{
-							cedartypes.String("key"):   cedartypes.String(kk),
-							cedartypes.String("value"): cedartypes.NewSet(valSet...),
-						}))
-					}
-					return cedartypes.NewSet(set...), nil
-				}
-			}
-		}
-	}
-
+	// Without a schema, only labels and annotations are known to be key/value maps
 	if _, ok := obj.(map[string]interface{}); (keyName == "labels" || keyName == "annotations") && ok {
 		set := []cedartypes.Value{}
 		for kk, vv := range obj.(map[string]interface{}) {
@@ -310,13 +263,12 @@ func walkObject(i int, group, version, kind, keyName string, obj any) (cedartype
 		}
 		return cedartypes.NewSet(set...), nil
 	}
-	// End gross hack for key/value maps
 
 	switch t := obj.(type) {
 	case map[string]interface{}:
 		rec := cedartypes.RecordMap{}
 		for kk, vv := range obj.(map[string]interface{}) {
-			val, err := walkObject(i-1, group, version, kind, kk, vv)
+			val, err := walkObject(ctx, i-1, kk, vv)
 			if err != nil {
 				return nil, err
 			}
@@ -334,7 +286,7 @@ func walkObject(i int, group, version, kind, keyName string, obj any) (cedartype
 	case []interface{}:
 		set := []cedartypes.Value{}
 		for _, item := range obj.([]interface{}) {
-			val, err := walkObject(i-1, group, version, kind, keyName, item)
+			val, err := walkObject(ctx, i-1, keyName, item)
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,279 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
+)
+
+// maxSchemaDepth limits how deeply nested an object converted with a schema may be
+const maxSchemaDepth = 32
+
+// UnstructuredToSchemaRecord converts an object to a Cedar record by walking
+// the shape of entityType in cedarSchema alongside the object. Maps become sets
+// of key/value records, and fields that aren't in the schema or don't match
+// their schema type are dropped, so the record matches the schema. Required
+// records are kept even if they are empty, and an object missing a required
+// attribute, or whose required attribute doesn't match its type, is rejected
+// with an error.
+//
+// It returns false if entityType isn't in the schema.
+func UnstructuredToSchemaRecord(ctx context.Context, cedarSchema schema.CedarSchema, obj *unstructured.Unstructured, entityType string) (cedartypes.Record, bool, error) {
+	shape, ok := cedarSchema.GetEntityShape(entityType)
+	if !ok {
+		return cedartypes.NewRecord(nil), false, nil
+	}
+	ctx, span := tracing.Start(ctx, "UnstructuredToSchemaRecord", attribute.String("cedar.entityType", entityType))
+	defer span.End()
+	if obj == nil {
+		return cedartypes.NewRecord(nil), true, errors.New("unstructured object is nil")
+	}
+	walker := schemaWalker{schema: cedarSchema}
+	namespace, _ := splitTypeName(entityType)
+	rec, err := walker.record(ctx, maxSchemaDepth, namespace, shape.Attributes, obj.Object)
+	if err != nil {
+		return cedartypes.NewRecord(nil), true, err
+	}
+	return cedartypes.NewRecord(rec), true, nil
+}
+
+// schemaWalker converts objects into Cedar values of a schema type
+type schemaWalker struct {
+	schema schema.CedarSchema
+}
+
+// record converts the attributes of an object that are in a record's attributes.
+// Common type names are resolved in namespace.
+func (w schemaWalker) record(ctx context.Context, depth int, namespace string, attributes map[string]schema.EntityAttribute, obj map[string]any) (cedartypes.RecordMap, error) {
+	if depth == 0 {
+		return nil, errors.New("max depth reached")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rec := cedartypes.RecordMap{}
+	for k, v := range obj {
+		attr, ok := attributes[k]
+		if !ok {
+			klog.V(7).InfoS("Dropping attribute that isn't in the schema", "namespace", namespace, "attribute", k)
+			continue
+		}
+		val, err := w.value(ctx, depth-1, namespace, attr, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if val == nil {
+			continue
+		}
+		rec[cedartypes.String(k)] = val
+	}
+	for k, attr := range attributes {
+		if _, ok := rec[cedartypes.String(k)]; attr.Required && !ok {
+			return nil, fmt.Errorf("%s: attribute is required by the schema, but is missing or doesn't match its type", k)
+		}
+	}
+	return rec, nil
+}
+
+// value converts a value of an object into the schema type of attr, or returns
+// nil if the value is empty or doesn't match the type
+func (w schemaWalker) value(ctx context.Context, depth int, namespace string, attr schema.EntityAttribute, obj any) (cedartypes.Value, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	switch strings.TrimPrefix(attr.Type, "__cedar::") {
+	case schema.StringType:
+		// IntOrString and Quantity values may be numbers
+		switch s := obj.(type) {
+		case string:
+			return cedartypes.String(s), nil
+		case int64:
+			return cedartypes.String(strconv.FormatInt(s, 10)), nil
+		case int:
+			return cedartypes.String(strconv.Itoa(s)), nil
+		case float64:
+			if s == math.Trunc(s) {
+				return cedartypes.String(strconv.FormatFloat(s, 'f', -1, 64)), nil
+			}
+		}
+	case schema.LongType:
+		switch n := obj.(type) {
+		case int64:
+			return cedartypes.Long(n), nil
+		case int:
+			return cedartypes.Long(n), nil
+		case float64:
+			if n == math.Trunc(n) {
+				return cedartypes.Long(n), nil
+			}
+		}
+	case schema.BoolType:
+		if b, ok := obj.(bool); ok {
+			return cedartypes.Boolean(b), nil
+		}
+	case schema.SetType:
+		if attr.Element == nil {
+			return nil, nil
+		}
+		element := schema.EntityAttribute{Type: attr.Element.Type, Name: attr.Element.Name}
+		switch t := obj.(type) {
+		case []any:
+			return w.set(ctx, depth, namespace, element, t)
+		case map[string]any:
+			return w.keyValueSet(ctx, depth, namespace, element, t)
+		}
+	case schema.RecordType:
+		if m, ok := obj.(map[string]any); ok {
+			rec, err := w.record(ctx, depth, namespace, attr.Attributes, m)
+			if err != nil || (len(rec) == 0 && !attr.Required) {
+				// skip empty optional records
+				return nil, err
+			}
+			return cedartypes.NewRecord(rec), nil
+		}
+	case schema.ExtensionType:
+		if s, ok := obj.(string); ok {
+			return extensionValue(attr.Name, s), nil
+		}
+	case schema.EntityType:
+		// entity references aren't part of the object
+		return nil, nil
+	case "EntityOrCommon":
+		return w.commonTypeValue(ctx, depth, namespace, attr.Name, attr.Required, obj)
+	default:
+		return w.commonTypeValue(ctx, depth, namespace, attr.Type, attr.Required, obj)
+	}
+	klog.V(7).InfoS("Dropping value that doesn't match its schema type", "namespace", namespace, "type", attr.Type)
+	return nil, nil
+}
+
+// commonTypeValue converts a value into the common type name, which is
+// required if the attribute referencing it is
+func (w schemaWalker) commonTypeValue(ctx context.Context, depth int, namespace, name string, required bool, obj any) (cedartypes.Value, error) {
+	typeNamespace, shape, ok := w.resolve(namespace, name)
+	if !ok {
+		klog.V(6).InfoS("Dropping value of unknown schema type", "namespace", namespace, "type", name)
+		return nil, nil
+	}
+	return w.value(ctx, depth-1, typeNamespace, schema.EntityAttribute{Type: shape.Type, Attributes: shape.Attributes, Required: required}, obj)
+}
+
+// set converts a list into a set of element values. Values that don't match
+// the element type are dropped.
+func (w schemaWalker) set(ctx context.Context, depth int, namespace string, element schema.EntityAttribute, obj []any) (cedartypes.Value, error) {
+	if element.Type == schema.EntityType {
+		// sets of entity references aren't part of the object
+		return nil, nil
+	}
+	values := make([]cedartypes.Value, 0, len(obj))
+	for _, item := range obj {
+		val, err := w.value(ctx, depth, namespace, element, item)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		values = append(values, val)
+	}
+	return cedartypes.NewSet(values...), nil
+}
+
+// keyValueSet converts a map into a set of key/value records, if the set's
+// element type is a record of a key and a value
+func (w schemaWalker) keyValueSet(ctx context.Context, depth int, namespace string, element schema.EntityAttribute, obj map[string]any) (cedartypes.Value, error) {
+	typeNamespace, shape, ok := w.resolve(namespace, element.Type)
+	if !ok || !isKeyValueShape(shape) {
+		klog.V(7).InfoS("Dropping map that doesn't match its schema type", "namespace", namespace, "type", element.Type)
+		return nil, nil
+	}
+	valueAttr := shape.Attributes["value"]
+	values := make([]cedartypes.Value, 0, len(obj))
+	for k, v := range obj {
+		val, err := w.value(ctx, depth-1, typeNamespace, valueAttr, v)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		values = append(values, cedartypes.NewRecord(cedartypes.RecordMap{
+			"key":   cedartypes.String(k),
+			"value": val,
+		}))
+	}
+	return cedartypes.NewSet(values...), nil
+}
+
+// resolve finds a common type by name, and returns the namespace it is in.
+// Unqualified names are looked up in namespace, then the empty namespace.
+func (w schemaWalker) resolve(namespace, name string) (string, *schema.EntityShape, bool) {
+	candidates := []string{name}
+	if !strings.Contains(name, "::") {
+		candidates = []string{namespace + "::" + name, name}
+		if namespace == "" {
+			candidates = []string{name}
+		}
+	}
+	for _, candidate := range candidates {
+		typeNamespace, typeName := splitTypeName(candidate)
+		ns, ok := w.schema[typeNamespace]
+		if !ok {
+			continue
+		}
+		if shape, ok := ns.CommonTypes[typeName]; ok {
+			return typeNamespace, &shape, true
+		}
+	}
+	return "", nil, false
+}
+
+// isKeyValueShape returns true for a record of a string key and a value, which
+// maps are converted into
+func isKeyValueShape(shape *schema.EntityShape) bool {
+	if shape.Type != schema.RecordType || len(shape.Attributes) != 2 {
+		return false
+	}
+	key, ok := shape.Attributes["key"]
+	if !ok || strings.TrimPrefix(key.Type, "__cedar::") != schema.StringType {
+		return false
+	}
+	_, ok = shape.Attributes["value"]
+	return ok
+}
+
+// extensionValue parses a string into a Cedar extension type, or returns nil
+// if the string isn't valid
+func extensionValue(name, s string) cedartypes.Value {
+	switch name {
+	case "ipaddr":
+		if addr, err := cedartypes.ParseIPAddr(s); err == nil {
+			return addr
+		}
+	case "decimal":
+		if d, err := cedartypes.ParseDecimal(s); err == nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// splitTypeName splits a type name into its namespace and name
+func splitTypeName(name string) (string, string) {
+	i := strings.LastIndex(name, "::")
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+2:]
+}
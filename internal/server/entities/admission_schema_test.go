@@ -0,0 +1,541 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+)
+
+func TestUnstructuredToSchemaRecord(t *testing.T) {
+	k8sSchema, err := schema.LoadCedarSchema("")
+	if err != nil {
+		t.Fatalf("Failed to load built-in schema: %v", err)
+	}
+	crdSchema := schema.CedarSchema{
+		"meta::v1": k8sSchema["meta::v1"],
+		"example::v1": {
+			EntityTypes: map[string]schema.Entity{
+				"Widget": {Shape: schema.EntityShape{
+					Type: schema.RecordType,
+					Attributes: map[string]schema.EntityAttribute{
+						"metadata": {Type: "meta::v1::ObjectMeta"},
+						"spec":     {Type: "WidgetSpec"},
+					},
+				}},
+			},
+			CommonTypes: map[string]schema.EntityShape{
+				"WidgetSpec": {
+					Type: schema.RecordType,
+					Attributes: map[string]schema.EntityAttribute{
+						"settings": {Type: schema.SetType, Element: &schema.EntityAttributeElement{Type: "meta::v1::KeyValue"}},
+						"owners":   {Type: schema.SetType, Element: &schema.EntityAttributeElement{Type: "meta::v1::KeyValueStringSlice"}},
+						"size":     {Type: schema.LongType},
+						"address":  {Type: schema.ExtensionType, Name: "ipaddr"},
+					},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name       string
+		schema     schema.CedarSchema
+		entityType string
+		object     map[string]any
+		wantFound  bool
+		want       cedartypes.Record
+	}{
+		{
+			name:       "pod",
+			schema:     k8sSchema,
+			entityType: "core::v1::Pod",
+			object: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata": map[string]any{
+					"name":   "test-pod",
+					"labels": map[string]any{"app": "web"},
+				},
+				"spec": map[string]any{
+					"nodeSelector": map[string]any{"disktype": "ssd"},
+					"hostNetwork":  "yes",
+					"notAField":    "dropped",
+					"containers": []any{
+						map[string]any{
+							"name":      "web",
+							"image":     "nginx",
+							"resources": map[string]any{"limits": map[string]any{"cpu": "500m"}},
+						},
+					},
+					"securityContext": map[string]any{},
+				},
+				"status": map[string]any{
+					"podIP": "10.10.1.4",
+				},
+			},
+			wantFound: true,
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"apiVersion": cedartypes.String("v1"),
+				"kind":       cedartypes.String("Pod"),
+				"metadata": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("test-pod"),
+					"labels": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("app"),
+						"value": cedartypes.String("web"),
+					})),
+				}),
+				"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+					"nodeSelector": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("disktype"),
+						"value": cedartypes.String("ssd"),
+					})),
+					"containers": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						"name":  cedartypes.String("web"),
+						"image": cedartypes.String("nginx"),
+						"resources": cedartypes.NewRecord(cedartypes.RecordMap{
+							"limits": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+								"key":   cedartypes.String("cpu"),
+								"value": cedartypes.String("500m"),
+							})),
+						}),
+					})),
+				}),
+				"status": cedartypes.NewRecord(cedartypes.RecordMap{
+					"podIP": cedartypes.String("10.10.1.4"),
+				}),
+			}),
+		},
+		{
+			name:       "deployment with a numeric IntOrString",
+			schema:     k8sSchema,
+			entityType: "apps::v1::Deployment",
+			object: map[string]any{
+				"metadata": map[string]any{"name": "web"},
+				"spec": map[string]any{
+					"selector": map[string]any{},
+					"template": map[string]any{
+						"spec": map[string]any{
+							"containers": []any{map[string]any{"name": "web"}},
+						},
+					},
+					"strategy": map[string]any{
+						"type": "RollingUpdate",
+						"rollingUpdate": map[string]any{
+							"maxSurge":       int64(1),
+							"maxUnavailable": float64(2),
+						},
+					},
+				},
+			},
+			wantFound: true,
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"metadata": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("web"),
+				}),
+				"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+					// required records are kept even if they are empty
+					"selector": cedartypes.NewRecord(nil),
+					"template": cedartypes.NewRecord(cedartypes.RecordMap{
+						"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+							"containers": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+								"name": cedartypes.String("web"),
+							})),
+						}),
+					}),
+					"strategy": cedartypes.NewRecord(cedartypes.RecordMap{
+						"type": cedartypes.String("RollingUpdate"),
+						"rollingUpdate": cedartypes.NewRecord(cedartypes.RecordMap{
+							"maxSurge":       cedartypes.String("1"),
+							"maxUnavailable": cedartypes.String("2"),
+						}),
+					}),
+				}),
+			}),
+		},
+		{
+			name:       "service with numeric and named target ports",
+			schema:     k8sSchema,
+			entityType: "core::v1::Service",
+			object: map[string]any{
+				"metadata": map[string]any{"name": "web"},
+				"spec": map[string]any{
+					"ports": []any{
+						map[string]any{"name": "http", "port": int64(80), "targetPort": int64(8080)},
+						map[string]any{"name": "https", "port": int64(443), "targetPort": "https"},
+						map[string]any{"name": "metrics", "port": int64(9090), "targetPort": 9090.5},
+					},
+				},
+			},
+			wantFound: true,
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"metadata": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("web"),
+				}),
+				"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+					"ports": cedartypes.NewSet(
+						cedartypes.NewRecord(cedartypes.RecordMap{
+							"name":       cedartypes.String("http"),
+							"port":       cedartypes.Long(80),
+							"targetPort": cedartypes.String("8080"),
+						}),
+						cedartypes.NewRecord(cedartypes.RecordMap{
+							"name":       cedartypes.String("https"),
+							"port":       cedartypes.Long(443),
+							"targetPort": cedartypes.String("https"),
+						}),
+						cedartypes.NewRecord(cedartypes.RecordMap{
+							"name": cedartypes.String("metrics"),
+							"port": cedartypes.Long(9090),
+						}),
+					),
+				}),
+			}),
+		},
+		{
+			name:       "crd maps",
+			schema:     crdSchema,
+			entityType: "example::v1::Widget",
+			object: map[string]any{
+				"metadata": map[string]any{"name": "widget"},
+				"spec": map[string]any{
+					"settings": map[string]any{"color": "blue", "count": int64(3)},
+					"owners":   map[string]any{"team-a": []any{"alice", "bob"}},
+					"size":     int64(3),
+					"address":  "192.168.0.1",
+				},
+			},
+			wantFound: true,
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"metadata": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("widget"),
+				}),
+				"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+					"settings": cedartypes.NewSet(
+						cedartypes.NewRecord(cedartypes.RecordMap{
+							"key":   cedartypes.String("color"),
+							"value": cedartypes.String("blue"),
+						}),
+						cedartypes.NewRecord(cedartypes.RecordMap{
+							"key":   cedartypes.String("count"),
+							"value": cedartypes.String("3"),
+						}),
+					),
+					"owners": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("team-a"),
+						"value": cedartypes.NewSet(cedartypes.String("alice"), cedartypes.String("bob")),
+					})),
+					"size":    cedartypes.Long(3),
+					"address": mustParseIPAddr(t, "192.168.0.1"),
+				}),
+			}),
+		},
+		{
+			name:       "type not in schema",
+			schema:     crdSchema,
+			entityType: "example::v1::Gadget",
+			object:     map[string]any{"metadata": map[string]any{"name": "gadget"}},
+			wantFound:  false,
+			want:       cedartypes.NewRecord(nil),
+		},
+		{
+			name:       "nil schema",
+			schema:     nil,
+			entityType: "core::v1::Pod",
+			object:     map[string]any{"metadata": map[string]any{"name": "test-pod"}},
+			wantFound:  false,
+			want:       cedartypes.NewRecord(nil),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, found, err := UnstructuredToSchemaRecord(context.Background(), tc.schema, &unstructured.Unstructured{Object: tc.object}, tc.entityType)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if found != tc.wantFound {
+				t.Errorf("expected found %v, got %v", tc.wantFound, found)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnstructuredToSchemaRecordRequired(t *testing.T) {
+	k8sSchema, err := schema.LoadCedarSchema("")
+	if err != nil {
+		t.Fatalf("Failed to load built-in schema: %v", err)
+	}
+	cases := []struct {
+		name       string
+		entityType string
+		object     map[string]any
+		wantErr    string
+	}{
+		{
+			name:       "pod without containers",
+			entityType: "core::v1::Pod",
+			object: map[string]any{
+				"metadata": map[string]any{"name": "test-pod"},
+				"spec":     map[string]any{"nodeName": "node-1"},
+			},
+			wantErr: "spec: containers: attribute is required by the schema, but is missing or doesn't match its type",
+		},
+		{
+			name:       "container name that doesn't match its type",
+			entityType: "core::v1::Pod",
+			object: map[string]any{
+				"spec": map[string]any{
+					"containers": []any{map[string]any{"name": true, "image": "nginx"}},
+				},
+			},
+			wantErr: "spec: containers: name: attribute is required by the schema, but is missing or doesn't match its type",
+		},
+		{
+			name:       "deployment without a template",
+			entityType: "apps::v1::Deployment",
+			object: map[string]any{
+				"spec": map[string]any{"selector": map[string]any{}},
+			},
+			wantErr: "spec: template: attribute is required by the schema, but is missing or doesn't match its type",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := UnstructuredToSchemaRecord(context.Background(), k8sSchema, &unstructured.Unstructured{Object: tc.object}, tc.entityType)
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestUnstructuredToSchemaRecordConforms checks that records of complete
+// objects conform to the built-in schema
+func TestUnstructuredToSchemaRecordConforms(t *testing.T) {
+	k8sSchema, err := schema.LoadCedarSchema("")
+	if err != nil {
+		t.Fatalf("Failed to load built-in schema: %v", err)
+	}
+	podSpec := corev1.PodSpec{
+		ServiceAccountName: "web",
+		NodeSelector:       map[string]string{"disktype": "ssd"},
+		SecurityContext:    &corev1.PodSecurityContext{RunAsNonRoot: ptr.To(true), RunAsUser: ptr.To[int64](1000)},
+		Tolerations:        []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "web", Effect: corev1.TaintEffectNoSchedule}},
+		Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a", "b"}}},
+			}}},
+		}},
+		Containers: []corev1.Container{{
+			Name:  "web",
+			Image: "nginx:1.27",
+			Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: corev1.ProtocolTCP}},
+			Env: []corev1.EnvVar{
+				{Name: "MODE", Value: "production"},
+				{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}}},
+			},
+			Resources: corev1.ResourceRequirements{
+				Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("128Mi")},
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			},
+			ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/healthz", Port: intstr.FromString("http")},
+			}},
+			VolumeMounts:    []corev1.VolumeMount{{Name: "config", MountPath: "/etc/web"}},
+			SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(false), Capabilities: &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}},
+		}},
+		Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web"}},
+		}}},
+	}
+	objectMeta := metav1.ObjectMeta{
+		Name:              "web",
+		Namespace:         "default",
+		UID:               "b4f2c6d2-8a3e-4c1b-9f0e-2d7a5c3e1f00",
+		Labels:            map[string]string{"app": "web"},
+		Annotations:       map[string]string{"example.com/owner": "team-a"},
+		CreationTimestamp: metav1.NewTime(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)),
+		OwnerReferences:   []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-abc", UID: "1d2c3b4a"}},
+	}
+	cases := []struct {
+		entityType string
+		object     any
+	}{
+		{
+			entityType: "core::v1::Pod",
+			object: &corev1.Pod{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: objectMeta,
+				Spec:       podSpec,
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodRunning,
+					PodIP:      "10.10.1.4",
+					PodIPs:     []corev1.PodIP{{IP: "10.10.1.4"}},
+					Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				},
+			},
+		},
+		{
+			entityType: "apps::v1::Deployment",
+			object: &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: objectMeta,
+				Spec: appsv1.DeploymentSpec{
+					Replicas: ptr.To[int32](3),
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web"}},
+						Spec:       podSpec,
+					},
+					Strategy: appsv1.DeploymentStrategy{
+						Type: appsv1.RollingUpdateDeploymentStrategyType,
+						RollingUpdate: &appsv1.RollingUpdateDeployment{
+							MaxSurge:       ptr.To(intstr.FromInt32(1)),
+							MaxUnavailable: ptr.To(intstr.FromString("25%")),
+						},
+					},
+				},
+				Status: appsv1.DeploymentStatus{
+					Replicas:      3,
+					ReadyReplicas: 3,
+					Conditions:    []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}},
+				},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.entityType, func(t *testing.T) {
+			obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tc.object)
+			if err != nil {
+				t.Fatalf("failed to convert object to unstructured: %v", err)
+			}
+			got, found, err := UnstructuredToSchemaRecord(context.Background(), k8sSchema, &unstructured.Unstructured{Object: obj}, tc.entityType)
+			if err != nil || !found {
+				t.Fatalf("expected a record, got found %v, error %v", found, err)
+			}
+			shape, _ := k8sSchema.GetEntityShape(tc.entityType)
+			namespace, _ := splitTypeName(tc.entityType)
+			checker := conformanceChecker{t: t, walker: schemaWalker{schema: k8sSchema}}
+			checker.record(tc.entityType, namespace, shape.Attributes, got)
+		})
+	}
+}
+
+// conformanceChecker reports values that don't conform to their schema type
+type conformanceChecker struct {
+	t      *testing.T
+	walker schemaWalker
+}
+
+// record checks that a record only has attributes in the schema, and has every
+// required attribute
+func (c conformanceChecker) record(path, namespace string, attributes map[string]schema.EntityAttribute, rec cedartypes.Record) {
+	c.t.Helper()
+	for k, v := range rec.Map() {
+		attr, ok := attributes[string(k)]
+		if !ok {
+			c.t.Errorf("%s.%s: attribute isn't in the schema", path, k)
+			continue
+		}
+		c.value(path+"."+string(k), namespace, attr, v)
+	}
+	for k, attr := range attributes {
+		if _, ok := rec.Get(cedartypes.String(k)); attr.Required && !ok {
+			c.t.Errorf("%s.%s: required attribute is missing", path, k)
+		}
+	}
+}
+
+// value checks that a value matches the schema type of attr
+func (c conformanceChecker) value(path, namespace string, attr schema.EntityAttribute, v cedartypes.Value) {
+	c.t.Helper()
+	ok := false
+	switch strings.TrimPrefix(attr.Type, "__cedar::") {
+	case schema.StringType:
+		_, ok = v.(cedartypes.String)
+	case schema.LongType:
+		_, ok = v.(cedartypes.Long)
+	case schema.BoolType:
+		_, ok = v.(cedartypes.Boolean)
+	case schema.SetType:
+		var set cedartypes.Set
+		if set, ok = v.(cedartypes.Set); ok {
+			element := schema.EntityAttribute{Type: attr.Element.Type, Name: attr.Element.Name}
+			for _, item := range set.Slice() {
+				c.value(path+"[]", namespace, element, item)
+			}
+		}
+	case schema.RecordType:
+		var rec cedartypes.Record
+		if rec, ok = v.(cedartypes.Record); ok {
+			c.record(path, namespace, attr.Attributes, rec)
+		}
+	case schema.ExtensionType:
+		switch attr.Name {
+		case "ipaddr":
+			_, ok = v.(cedartypes.IPAddr)
+		case "decimal":
+			_, ok = v.(cedartypes.Decimal)
+		}
+	case "EntityOrCommon":
+		c.commonTypeValue(path, namespace, attr.Name, v)
+		return
+	default:
+		c.commonTypeValue(path, namespace, attr.Type, v)
+		return
+	}
+	if !ok {
+		c.t.Errorf("%s: expected %s, got %T", path, attr.Type, v)
+	}
+}
+
+func (c conformanceChecker) commonTypeValue(path, namespace, name string, v cedartypes.Value) {
+	c.t.Helper()
+	typeNamespace, shape, ok := c.walker.resolve(namespace, name)
+	if !ok {
+		c.t.Errorf("%s: unknown type %s", path, name)
+		return
+	}
+	c.value(path, typeNamespace, schema.EntityAttribute{Type: shape.Type, Attributes: shape.Attributes}, v)
+}
+
+func TestUnstructuredToSchemaRecordCanceled(t *testing.T) {
+	k8sSchema, err := schema.LoadCedarSchema("")
+	if err != nil {
+		t.Fatalf("Failed to load built-in schema: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unst := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"name": "test"},
+	}}
+	if _, _, err := UnstructuredToSchemaRecord(ctx, k8sSchema, unst, "core::v1::Pod"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled error, got %v", err)
+	}
+}
+
+func mustParseIPAddr(t *testing.T, s string) cedartypes.IPAddr {
+	t.Helper()
+	addr, err := cedartypes.ParseIPAddr(s)
+	if err != nil {
+		t.Fatalf("Failed to parse IP address %s: %v", s, err)
+	}
+	return addr
+}
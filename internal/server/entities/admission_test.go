@@ -1,15 +1,19 @@
 package entities
 
 import (
+	"context"
+	"errors"
 	"net/netip"
 	"testing"
 
 	cedartypes "github.com/cedar-policy/cedar-go/types"
 	"github.com/google/go-cmp/cmp"
+	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 func TestUnstructuredToEntity(t *testing.T) {
@@ -63,6 +67,46 @@ func TestUnstructuredToEntity(t *testing.T) {
 				}),
 			}),
 		},
+		{
+			name: "objects with only string fields",
+			input: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "cert-manager.io/v1",
+				"kind":       "Certificate",
+				"metadata": map[string]any{
+					"name":   "web",
+					"labels": map[string]any{"app": "web"},
+				},
+				"spec": map[string]any{
+					"issuerRef": map[string]any{"name": "letsencrypt", "kind": "ClusterIssuer"},
+				},
+				"status": map[string]any{
+					"conditions": []any{map[string]any{"type": "Ready", "status": "True"}},
+				},
+			}},
+			expected: cedartypes.NewRecord(cedartypes.RecordMap{
+				cedartypes.String("apiVersion"): cedartypes.String("cert-manager.io/v1"),
+				cedartypes.String("kind"):       cedartypes.String("Certificate"),
+				cedartypes.String("metadata"): cedartypes.NewRecord(cedartypes.RecordMap{
+					cedartypes.String("name"): cedartypes.String("web"),
+					cedartypes.String("labels"): cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						cedartypes.String("key"):   cedartypes.String("app"),
+						cedartypes.String("value"): cedartypes.String("web"),
+					})),
+				}),
+				cedartypes.String("spec"): cedartypes.NewRecord(cedartypes.RecordMap{
+					cedartypes.String("issuerRef"): cedartypes.NewRecord(cedartypes.RecordMap{
+						cedartypes.String("name"): cedartypes.String("letsencrypt"),
+						cedartypes.String("kind"): cedartypes.String("ClusterIssuer"),
+					}),
+				}),
+				cedartypes.String("status"): cedartypes.NewRecord(cedartypes.RecordMap{
+					cedartypes.String("conditions"): cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						cedartypes.String("type"):   cedartypes.String("Ready"),
+						cedartypes.String("status"): cedartypes.String("True"),
+					})),
+				}),
+			}),
+		},
 	}
 
 	for _, tc := range cases {
@@ -72,7 +116,7 @@ func TestUnstructuredToEntity(t *testing.T) {
 				t.Fatalf("failed to convert input to unstructured: %v", err)
 			}
 			unst := &unstructured.Unstructured{Object: unstMap}
-			got, err := UnstructuredToRecord(unst, "core", "v1", "Pod")
+			got, err := UnstructuredToRecord(context.Background(), unst, "Pod")
 			if err != nil {
 				if tc.expectedErr == nil {
 					t.Fatalf("got unexpected error. wanted %v, got %v", tc.expectedErr, err)
@@ -88,3 +132,107 @@ func TestUnstructuredToEntity(t *testing.T) {
 		})
 	}
 }
+
+func TestUnstructuredToRecordCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unst := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"name": "test"},
+	}}
+	if _, err := UnstructuredToRecord(ctx, unst, "Pod"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled error, got %v", err)
+	}
+}
+
+func TestAddAdmissionRequestToContext(t *testing.T) {
+	dryRun := true
+	deploymentKind := metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	scaleKind := metav1.GroupVersionKind{Group: "autoscaling", Version: "v1", Kind: "Scale"}
+	cases := []struct {
+		name     string
+		req      admissionv1.AdmissionRequest
+		expected cedartypes.RecordMap
+	}{
+		{
+			name: "create with options",
+			req: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Kind:      deploymentKind,
+				DryRun:    &dryRun,
+				Options: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"meta.k8s.io/v1","kind":"CreateOptions","dryRun":["All"],"fieldManager":"kubectl"}`),
+				},
+			},
+			expected: cedartypes.RecordMap{
+				"dryRun":      cedartypes.True,
+				"subResource": cedartypes.String(""),
+				"kind": cedartypes.NewRecord(cedartypes.RecordMap{
+					"group":   cedartypes.String("apps"),
+					"version": cedartypes.String("v1"),
+					"kind":    cedartypes.String("Deployment"),
+				}),
+				"options": cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion":   cedartypes.String("meta.k8s.io/v1"),
+					"kind":         cedartypes.String("CreateOptions"),
+					"dryRun":       cedartypes.NewSet(cedartypes.String("All")),
+					"fieldManager": cedartypes.String("kubectl"),
+				}),
+			},
+		},
+		{
+			name: "subresource with request kind",
+			req: admissionv1.AdmissionRequest{
+				Operation:   admissionv1.Update,
+				Kind:        scaleKind,
+				RequestKind: &scaleKind,
+				SubResource: "scale",
+			},
+			expected: cedartypes.RecordMap{
+				"dryRun":      cedartypes.False,
+				"subResource": cedartypes.String("scale"),
+				"kind": cedartypes.NewRecord(cedartypes.RecordMap{
+					"group":   cedartypes.String("autoscaling"),
+					"version": cedartypes.String("v1"),
+					"kind":    cedartypes.String("Scale"),
+				}),
+				"requestKind": cedartypes.NewRecord(cedartypes.RecordMap{
+					"group":   cedartypes.String("autoscaling"),
+					"version": cedartypes.String("v1"),
+					"kind":    cedartypes.String("Scale"),
+				}),
+			},
+		},
+		{
+			name: "connect options are skipped",
+			req: admissionv1.AdmissionRequest{
+				Operation:   admissionv1.Connect,
+				Kind:        metav1.GroupVersionKind{Version: "v1", Kind: "PodExecOptions"},
+				SubResource: "exec",
+				Options: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"v1","kind":"PodExecOptions","command":["sh"]}`),
+				},
+			},
+			expected: cedartypes.RecordMap{
+				"dryRun":      cedartypes.False,
+				"subResource": cedartypes.String("exec"),
+				"kind": cedartypes.NewRecord(cedartypes.RecordMap{
+					"group":   cedartypes.String(""),
+					"version": cedartypes.String("v1"),
+					"kind":    cedartypes.String("PodExecOptions"),
+				}),
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := cedartypes.RecordMap{}
+			err := AddAdmissionRequestToContext(context.Background(), admission.Request{AdmissionRequest: tc.req}, got)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.expected, got); diff != "" {
+				t.Errorf("unexpected context (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
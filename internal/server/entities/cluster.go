@@ -0,0 +1,117 @@
+package entities
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+)
+
+// ClusterMetadata holds static cluster metadata and the Kubernetes version
+// discovered from the API server, and adds them to request contexts.
+//
+// A nil *ClusterMetadata adds nothing to request contexts.
+type ClusterMetadata struct {
+	static cedartypes.RecordMap
+
+	mu     sync.RWMutex
+	record cedartypes.Record
+}
+
+// NewClusterMetadata returns a ClusterMetadata for the config, or nil if cfg is nil
+func NewClusterMetadata(cfg *v1alpha1.ClusterMetadataConfig) *ClusterMetadata {
+	if cfg == nil {
+		return nil
+	}
+	static := cedartypes.RecordMap{}
+	for k, v := range map[string]string{
+		"name":            cfg.Name,
+		"arn":             cfg.ARN,
+		"region":          cfg.Region,
+		"accountId":       cfg.AccountID,
+		"platformVersion": cfg.PlatformVersion,
+	} {
+		if v != "" {
+			static[cedartypes.String(k)] = cedartypes.String(v)
+		}
+	}
+	static["tags"] = keyValueSet(cfg.Tags)
+
+	return &ClusterMetadata{
+		static: static,
+		record: cedartypes.NewRecord(static),
+	}
+}
+
+// SetKubernetesVersion sets the Kubernetes version from an API server version response
+func (m *ClusterMetadata) SetKubernetesVersion(info *version.Info) {
+	if m == nil || info == nil {
+		return
+	}
+	major, err := parseVersionPart(info.Major)
+	if err != nil {
+		klog.ErrorS(err, "Failed to parse Kubernetes major version", "major", info.Major)
+		return
+	}
+	minor, err := parseVersionPart(info.Minor)
+	if err != nil {
+		klog.ErrorS(err, "Failed to parse Kubernetes minor version", "minor", info.Minor)
+		return
+	}
+
+	attrs := cedartypes.RecordMap{}
+	for k, v := range m.static {
+		attrs[k] = v
+	}
+	attrs["kubernetesVersion"] = cedartypes.NewRecord(cedartypes.RecordMap{
+		"major":      cedartypes.Long(major),
+		"minor":      cedartypes.Long(minor),
+		"gitVersion": cedartypes.String(info.GitVersion),
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record = cedartypes.NewRecord(attrs)
+}
+
+// parseVersionPart parses a major or minor version, which some providers suffix with a "+"
+func parseVersionPart(part string) (int64, error) {
+	return strconv.ParseInt(strings.TrimRight(part, "+"), 10, 64)
+}
+
+// AddToContext sets the cluster metadata in a request context
+func (m *ClusterMetadata) AddToContext(requestContext cedartypes.RecordMap) {
+	if m == nil {
+		return
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	requestContext[schema.ClusterMetadataContextKey] = m.record
+}
+
+// DiscoverKubernetesVersion sets the Kubernetes version from the API server every
+// interval until the context is done.
+func (m *ClusterMetadata) DiscoverKubernetesVersion(ctx context.Context, client discovery.ServerVersionInterface, interval time.Duration) {
+	if m == nil {
+		return
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		info, err := client.ServerVersion()
+		if err != nil {
+			klog.ErrorS(err, "Failed to discover Kubernetes version")
+			return
+		}
+		klog.V(4).InfoS("Discovered Kubernetes version", "version", info.GitVersion)
+		m.SetKubernetesVersion(info)
+	}, interval)
+}
@@ -0,0 +1,85 @@
+package entities_test
+
+import (
+	"testing"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/version"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
+)
+
+func TestClusterMetadata(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  *v1alpha1.ClusterMetadataConfig
+		version *version.Info
+		want    cedartypes.RecordMap
+	}{
+		{
+			name:   "nil config",
+			config: nil,
+			want:   cedartypes.RecordMap{},
+		},
+		{
+			name: "static values",
+			config: &v1alpha1.ClusterMetadataConfig{
+				Name:      "prod-cluster-05",
+				Region:    "us-west-2",
+				AccountID: "111122223333",
+				Tags:      map[string]string{"stage": "prod"},
+			},
+			want: cedartypes.RecordMap{
+				"cluster": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name":      cedartypes.String("prod-cluster-05"),
+					"region":    cedartypes.String("us-west-2"),
+					"accountId": cedartypes.String("111122223333"),
+					"tags": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("stage"),
+						"value": cedartypes.String("prod"),
+					})),
+				}),
+			},
+		},
+		{
+			name:    "discovered version",
+			config:  &v1alpha1.ClusterMetadataConfig{Name: "prod-cluster-05"},
+			version: &version.Info{Major: "1", Minor: "30+", GitVersion: "v1.30.4-eks-a737599"},
+			want: cedartypes.RecordMap{
+				"cluster": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("prod-cluster-05"),
+					"tags": cedartypes.NewSet(),
+					"kubernetesVersion": cedartypes.NewRecord(cedartypes.RecordMap{
+						"major":      cedartypes.Long(1),
+						"minor":      cedartypes.Long(30),
+						"gitVersion": cedartypes.String("v1.30.4-eks-a737599"),
+					}),
+				}),
+			},
+		},
+		{
+			name:    "invalid version",
+			config:  &v1alpha1.ClusterMetadataConfig{Name: "prod-cluster-05"},
+			version: &version.Info{Major: "one", Minor: "30"},
+			want: cedartypes.RecordMap{
+				"cluster": cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("prod-cluster-05"),
+					"tags": cedartypes.NewSet(),
+				}),
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := entities.NewClusterMetadata(tc.config)
+			m.SetKubernetesVersion(tc.version)
+			got := cedartypes.RecordMap{}
+			m.AddToContext(got)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Didn't get same context: %s", diff)
+			}
+		})
+	}
+}
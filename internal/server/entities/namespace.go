@@ -0,0 +1,154 @@
+package entities
+
+import (
+	"time"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+)
+
+// Namespaces builds k8s::Namespace entities from a Namespace informer cache,
+// and adds them to requests.
+//
+// A nil *Namespaces adds nothing to requests.
+type Namespaces struct {
+	lister corev1listers.NamespaceLister
+}
+
+// NewNamespaces returns a Namespaces that looks up namespaces in the lister
+func NewNamespaces(lister corev1listers.NamespaceLister) *Namespaces {
+	return &Namespaces{lister: lister}
+}
+
+// NamespaceUID returns the UID of the k8s::Namespace entity for a namespace name
+func NamespaceUID(name string) cedartypes.EntityUID {
+	return cedartypes.EntityUID{
+		Type: schema.NamespaceEntityType,
+		ID:   cedartypes.String(name),
+	}
+}
+
+// NamespaceParents returns the parents of a resource in a namespace, or no parents for cluster-scoped resources
+func NamespaceParents(namespace string) cedartypes.EntityUIDSet {
+	if namespace == "" {
+		return cedartypes.NewEntityUIDSet()
+	}
+	return cedartypes.NewEntityUIDSet(NamespaceUID(namespace))
+}
+
+// NamespaceToCedarEntity converts a namespace into a Cedar entity.
+// A nil namespace is converted into an entity without labels or annotations.
+func NamespaceToCedarEntity(name string, namespace *corev1.Namespace) cedartypes.Entity {
+	var labels, annotations map[string]string
+	if namespace != nil {
+		labels = namespace.Labels
+		annotations = namespace.Annotations
+	}
+	return cedartypes.Entity{
+		UID:     NamespaceUID(name),
+		Parents: cedartypes.NewEntityUIDSet(),
+		Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+			"name":        cedartypes.String(name),
+			"labels":      keyValueSet(labels),
+			"annotations": keyValueSet(annotations),
+		}),
+	}
+}
+
+// AddToRequest adds the entity for a namespace to the request entities, and
+// references it as the namespace in the request context. Nothing is added for
+// cluster-scoped requests.
+func (n *Namespaces) AddToRequest(name string, entities cedartypes.EntityMap, context cedartypes.RecordMap) {
+	if n == nil || name == "" {
+		return
+	}
+	namespace, err := n.lister.Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to get namespace from cache", "namespace", name)
+		}
+		namespace = nil
+	}
+	entity := NamespaceToCedarEntity(name, namespace)
+	entities[entity.UID] = entity
+	context[schema.NamespaceContextKey] = entity.UID
+}
+
+// ResourceVersion returns the resource version of a cached namespace. An
+// empty string is returned for cluster-scoped requests, and namespaces that
+// aren't cached.
+func (n *Namespaces) ResourceVersion(name string) string {
+	if n == nil || name == "" {
+		return ""
+	}
+	namespace, err := n.lister.Get(name)
+	if err != nil {
+		return ""
+	}
+	return namespace.ResourceVersion
+}
+
+// NamespaceObjectRecord converts a namespace into a Cedar record of its
+// Namespace object
+func NamespaceObjectRecord(namespace *corev1.Namespace) cedartypes.Record {
+	metadata := cedartypes.RecordMap{
+		"name":              cedartypes.String(namespace.Name),
+		"uid":               cedartypes.String(namespace.UID),
+		"resourceVersion":   cedartypes.String(namespace.ResourceVersion),
+		"creationTimestamp": cedartypes.String(namespace.CreationTimestamp.UTC().Format(time.RFC3339)),
+		"labels":            keyValueSet(namespace.Labels),
+		"annotations":       keyValueSet(namespace.Annotations),
+	}
+	if namespace.DeletionTimestamp != nil {
+		metadata["deletionTimestamp"] = cedartypes.String(namespace.DeletionTimestamp.UTC().Format(time.RFC3339))
+	}
+	finalizers := []cedartypes.Value{}
+	for _, finalizer := range namespace.Spec.Finalizers {
+		finalizers = append(finalizers, cedartypes.String(finalizer))
+	}
+	return cedartypes.NewRecord(cedartypes.RecordMap{
+		"apiVersion": cedartypes.String("v1"),
+		"kind":       cedartypes.String("Namespace"),
+		"metadata":   cedartypes.NewRecord(metadata),
+		"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+			"finalizers": cedartypes.NewSet(finalizers...),
+		}),
+		"status": cedartypes.NewRecord(cedartypes.RecordMap{
+			"phase": cedartypes.String(namespace.Status.Phase),
+		}),
+	})
+}
+
+// AddObjectToContext adds the Namespace object of a namespace to the request
+// context. Nothing is added for cluster-scoped requests, or namespaces that
+// aren't cached.
+func (n *Namespaces) AddObjectToContext(name string, context cedartypes.RecordMap) {
+	if n == nil || name == "" {
+		return
+	}
+	namespace, err := n.lister.Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to get namespace from cache", "namespace", name)
+		}
+		return
+	}
+	context[schema.NamespaceObjectContextKey] = NamespaceObjectRecord(namespace)
+}
+
+// keyValueSet converts a string map into a set of key/value records
+func keyValueSet(m map[string]string) cedartypes.Set {
+	values := []cedartypes.Value{}
+	for k, v := range m {
+		values = append(values, cedartypes.NewRecord(cedartypes.RecordMap{
+			"key":   cedartypes.String(k),
+			"value": cedartypes.String(v),
+		}))
+	}
+	return cedartypes.NewSet(values...)
+}
@@ -0,0 +1,189 @@
+package entities_test
+
+import (
+	"testing"
+	"time"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
+)
+
+func TestNamespacesAddToRequest(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team-a",
+		Labels:      map[string]string{"team": "a"},
+		Annotations: map[string]string{"owner": "alice"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to add namespace: %v", err)
+	}
+
+	cases := []struct {
+		name         string
+		namespaces   *entities.Namespaces
+		namespace    string
+		wantEntities cedartypes.EntityMap
+		wantContext  cedartypes.RecordMap
+	}{
+		{
+			name:         "nil namespaces",
+			namespaces:   nil,
+			namespace:    "team-a",
+			wantEntities: cedartypes.EntityMap{},
+			wantContext:  cedartypes.RecordMap{},
+		},
+		{
+			name:         "cluster scoped",
+			namespaces:   entities.NewNamespaces(corev1listers.NewNamespaceLister(indexer)),
+			namespace:    "",
+			wantEntities: cedartypes.EntityMap{},
+			wantContext:  cedartypes.RecordMap{},
+		},
+		{
+			name:       "cached namespace",
+			namespaces: entities.NewNamespaces(corev1listers.NewNamespaceLister(indexer)),
+			namespace:  "team-a",
+			wantEntities: cedartypes.EntityMap{
+				entities.NamespaceUID("team-a"): {
+					UID:     cedartypes.EntityUID{Type: schema.NamespaceEntityType, ID: "team-a"},
+					Parents: cedartypes.NewEntityUIDSet(),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name": cedartypes.String("team-a"),
+						"labels": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+							"key":   cedartypes.String("team"),
+							"value": cedartypes.String("a"),
+						})),
+						"annotations": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+							"key":   cedartypes.String("owner"),
+							"value": cedartypes.String("alice"),
+						})),
+					}),
+				},
+			},
+			wantContext: cedartypes.RecordMap{
+				"namespace": cedartypes.EntityUID{Type: schema.NamespaceEntityType, ID: "team-a"},
+			},
+		},
+		{
+			name:       "uncached namespace",
+			namespaces: entities.NewNamespaces(corev1listers.NewNamespaceLister(indexer)),
+			namespace:  "team-b",
+			wantEntities: cedartypes.EntityMap{
+				entities.NamespaceUID("team-b"): {
+					UID:     cedartypes.EntityUID{Type: schema.NamespaceEntityType, ID: "team-b"},
+					Parents: cedartypes.NewEntityUIDSet(),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name":        cedartypes.String("team-b"),
+						"labels":      cedartypes.NewSet(),
+						"annotations": cedartypes.NewSet(),
+					}),
+				},
+			},
+			wantContext: cedartypes.RecordMap{
+				"namespace": cedartypes.EntityUID{Type: schema.NamespaceEntityType, ID: "team-b"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotEntities := cedartypes.EntityMap{}
+			gotContext := cedartypes.RecordMap{}
+			tc.namespaces.AddToRequest(tc.namespace, gotEntities, gotContext)
+			if diff := cmp.Diff(tc.wantEntities, gotEntities); diff != "" {
+				t.Errorf("Didn't get same entities: %s", diff)
+			}
+			if diff := cmp.Diff(tc.wantContext, gotContext); diff != "" {
+				t.Errorf("Didn't get same context: %s", diff)
+			}
+		})
+	}
+}
+
+func TestNamespacesAddObjectToContext(t *testing.T) {
+	created := metav1.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := indexer.Add(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "team-a",
+			UID:               "1234",
+			ResourceVersion:   "42",
+			CreationTimestamp: created,
+			Labels:            map[string]string{"team": "a"},
+		},
+		Spec:   corev1.NamespaceSpec{Finalizers: []corev1.FinalizerName{corev1.FinalizerKubernetes}},
+		Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add namespace: %v", err)
+	}
+	namespaces := entities.NewNamespaces(corev1listers.NewNamespaceLister(indexer))
+
+	cases := []struct {
+		name        string
+		namespaces  *entities.Namespaces
+		namespace   string
+		wantContext cedartypes.RecordMap
+	}{
+		{
+			name:        "nil namespaces",
+			namespace:   "team-a",
+			wantContext: cedartypes.RecordMap{},
+		},
+		{
+			name:        "cluster scoped",
+			namespaces:  namespaces,
+			wantContext: cedartypes.RecordMap{},
+		},
+		{
+			name:        "uncached namespace",
+			namespaces:  namespaces,
+			namespace:   "team-b",
+			wantContext: cedartypes.RecordMap{},
+		},
+		{
+			name:       "cached namespace",
+			namespaces: namespaces,
+			namespace:  "team-a",
+			wantContext: cedartypes.RecordMap{
+				"namespaceObject": cedartypes.NewRecord(cedartypes.RecordMap{
+					"apiVersion": cedartypes.String("v1"),
+					"kind":       cedartypes.String("Namespace"),
+					"metadata": cedartypes.NewRecord(cedartypes.RecordMap{
+						"name":              cedartypes.String("team-a"),
+						"uid":               cedartypes.String("1234"),
+						"resourceVersion":   cedartypes.String("42"),
+						"creationTimestamp": cedartypes.String("2024-01-02T03:04:05Z"),
+						"labels": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+							"key":   cedartypes.String("team"),
+							"value": cedartypes.String("a"),
+						})),
+						"annotations": cedartypes.NewSet(),
+					}),
+					"spec": cedartypes.NewRecord(cedartypes.RecordMap{
+						"finalizers": cedartypes.NewSet(cedartypes.String("kubernetes")),
+					}),
+					"status": cedartypes.NewRecord(cedartypes.RecordMap{
+						"phase": cedartypes.String("Active"),
+					}),
+				}),
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotContext := cedartypes.RecordMap{}
+			tc.namespaces.AddObjectToContext(tc.namespace, gotContext)
+			if diff := cmp.Diff(tc.wantContext, gotContext); diff != "" {
+				t.Errorf("Didn't get same context: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package entities
+
+import (
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+)
+
+// Well-known node labels added to k8s::Node principals as typed attributes
+const (
+	NodeZoneLabel         = "topology.kubernetes.io/zone"
+	NodeRegionLabel       = "topology.kubernetes.io/region"
+	NodeInstanceTypeLabel = "node.kubernetes.io/instance-type"
+)
+
+// NodePoolLabels are the labels checked in order for a node's pool
+var NodePoolLabels = []string{
+	"eks.amazonaws.com/nodegroup",
+	"karpenter.sh/nodepool",
+	"cloud.google.com/gke-nodepool",
+	"kubernetes.azure.com/agentpool",
+}
+
+// Principals adds attributes from ServiceAccount and Node informer caches to
+// k8s::ServiceAccount and k8s::Node principals.
+//
+// A nil *Principals adds nothing to principals.
+type Principals struct {
+	serviceAccounts corev1listers.ServiceAccountLister
+	nodes           corev1listers.NodeLister
+}
+
+// NewPrincipals returns a Principals that looks up service accounts and nodes in the listers
+func NewPrincipals(serviceAccounts corev1listers.ServiceAccountLister, nodes corev1listers.NodeLister) *Principals {
+	return &Principals{
+		serviceAccounts: serviceAccounts,
+		nodes:           nodes,
+	}
+}
+
+// AddAttributes adds the labels and annotations of the ServiceAccount or Node
+// object for a principal to its entity. Other principals, and principals whose
+// object isn't found, are left unchanged.
+func (p *Principals) AddAttributes(principalUID cedartypes.EntityUID, entities cedartypes.EntityMap) {
+	obj, ok := p.object(principalUID, entities)
+	if !ok {
+		return
+	}
+	entity := entities[principalUID]
+	attributes := entity.Attributes.Map()
+	labels := obj.GetLabels()
+	attributes["labels"] = keyValueSet(labels)
+	switch principalUID.Type {
+	case schema.ServiceAccountEntityType:
+		attributes["annotations"] = keyValueSet(obj.GetAnnotations())
+	case schema.NodeEntityType:
+		addLabelAttribute(attributes, "zone", labels, NodeZoneLabel)
+		addLabelAttribute(attributes, "region", labels, NodeRegionLabel)
+		addLabelAttribute(attributes, "instanceType", labels, NodeInstanceTypeLabel)
+		addLabelAttribute(attributes, "nodePool", labels, NodePoolLabels...)
+	}
+	entity.Attributes = cedartypes.NewRecord(attributes)
+	entities[principalUID] = entity
+}
+
+// ResourceVersion returns the resource version of the ServiceAccount or Node
+// object for a principal. An empty string is returned for other principals,
+// and principals whose object isn't found.
+func (p *Principals) ResourceVersion(principalUID cedartypes.EntityUID, entities cedartypes.EntityMap) string {
+	obj, ok := p.object(principalUID, entities)
+	if !ok {
+		return ""
+	}
+	return obj.GetResourceVersion()
+}
+
+// object returns the cached ServiceAccount or Node object for a principal,
+// and false for other principals and principals whose object isn't found
+func (p *Principals) object(principalUID cedartypes.EntityUID, entities cedartypes.EntityMap) (metav1.Object, bool) {
+	if p == nil {
+		return nil, false
+	}
+	entity, ok := entities[principalUID]
+	if !ok {
+		return nil, false
+	}
+	attributes := entity.Attributes.Map()
+	name, _ := attributes["name"].(cedartypes.String)
+
+	switch principalUID.Type {
+	case schema.ServiceAccountEntityType:
+		namespace, _ := attributes["namespace"].(cedartypes.String)
+		sa, err := p.serviceAccounts.ServiceAccounts(string(namespace)).Get(string(name))
+		if err != nil {
+			logLookupError(err, "service account", string(namespace)+"/"+string(name))
+			return nil, false
+		}
+		return sa, true
+	case schema.NodeEntityType:
+		node, err := p.nodes.Get(string(name))
+		if err != nil {
+			logLookupError(err, "node", string(name))
+			return nil, false
+		}
+		return node, true
+	}
+	return nil, false
+}
+
+// addLabelAttribute sets an attribute to the value of the first present label
+func addLabelAttribute(attributes cedartypes.RecordMap, attribute cedartypes.String, labels map[string]string, keys ...string) {
+	for _, key := range keys {
+		if value, ok := labels[key]; ok {
+			attributes[attribute] = cedartypes.String(value)
+			return
+		}
+	}
+}
+
+func logLookupError(err error, kind, name string) {
+	if errors.IsNotFound(err) {
+		klog.V(4).InfoS("Principal object not found in cache", "kind", kind, "name", name)
+		return
+	}
+	klog.ErrorS(err, "Failed to get principal object from cache", "kind", kind, "name", name)
+}
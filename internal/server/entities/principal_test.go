@@ -0,0 +1,129 @@
+package entities_test
+
+import (
+	"testing"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/entities"
+)
+
+func TestPrincipalsAddAttributes(t *testing.T) {
+	serviceAccounts := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := serviceAccounts.Add(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:        "controller",
+		Namespace:   "platform",
+		Labels:      map[string]string{"tier": "platform"},
+		Annotations: map[string]string{"owner": "infra"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to add service account: %v", err)
+	}
+	err = nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name: "ip-10-0-0-1",
+		Labels: map[string]string{
+			"topology.kubernetes.io/zone":      "us-west-2a",
+			"node.kubernetes.io/instance-type": "m5.large",
+			"karpenter.sh/nodepool":            "default",
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	principals := entities.NewPrincipals(
+		corev1listers.NewServiceAccountLister(serviceAccounts),
+		corev1listers.NewNodeLister(nodes),
+	)
+
+	cases := []struct {
+		name       string
+		principals *entities.Principals
+		user       user.Info
+		want       cedartypes.Record
+	}{
+		{
+			name:       "nil principals",
+			principals: nil,
+			user:       &user.DefaultInfo{Name: "system:serviceaccount:platform:controller", UID: "sa-uid"},
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"name":      cedartypes.String("controller"),
+				"namespace": cedartypes.String("platform"),
+			}),
+		},
+		{
+			name:       "service account",
+			principals: principals,
+			user:       &user.DefaultInfo{Name: "system:serviceaccount:platform:controller", UID: "sa-uid"},
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"name":      cedartypes.String("controller"),
+				"namespace": cedartypes.String("platform"),
+				"labels": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+					"key":   cedartypes.String("tier"),
+					"value": cedartypes.String("platform"),
+				})),
+				"annotations": cedartypes.NewSet(cedartypes.NewRecord(cedartypes.RecordMap{
+					"key":   cedartypes.String("owner"),
+					"value": cedartypes.String("infra"),
+				})),
+			}),
+		},
+		{
+			name:       "uncached service account",
+			principals: principals,
+			user:       &user.DefaultInfo{Name: "system:serviceaccount:default:default", UID: "sa-uid"},
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"name":      cedartypes.String("default"),
+				"namespace": cedartypes.String("default"),
+			}),
+		},
+		{
+			name:       "node",
+			principals: principals,
+			user:       &user.DefaultInfo{Name: "system:node:ip-10-0-0-1", UID: "node-uid"},
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"name": cedartypes.String("ip-10-0-0-1"),
+				"labels": cedartypes.NewSet(
+					cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("topology.kubernetes.io/zone"),
+						"value": cedartypes.String("us-west-2a"),
+					}),
+					cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("node.kubernetes.io/instance-type"),
+						"value": cedartypes.String("m5.large"),
+					}),
+					cedartypes.NewRecord(cedartypes.RecordMap{
+						"key":   cedartypes.String("karpenter.sh/nodepool"),
+						"value": cedartypes.String("default"),
+					}),
+				),
+				"zone":         cedartypes.String("us-west-2a"),
+				"instanceType": cedartypes.String("m5.large"),
+				"nodePool":     cedartypes.String("default"),
+			}),
+		},
+		{
+			name:       "user",
+			principals: principals,
+			user:       &user.DefaultInfo{Name: "test-user", UID: "user-uid"},
+			want: cedartypes.NewRecord(cedartypes.RecordMap{
+				"name": cedartypes.String("test-user"),
+			}),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			principalUID, principalEntities := entities.UserToCedarEntity(tc.user)
+			tc.principals.AddAttributes(principalUID, principalEntities)
+			if diff := cmp.Diff(tc.want, principalEntities[principalUID].Attributes); diff != "" {
+				t.Errorf("Didn't get same attributes: %s", diff)
+			}
+		})
+	}
+}
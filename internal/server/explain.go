@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cedar-policy/cedar-go"
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	admissionv1 "k8s.io/api/admission/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	cedaradmission "github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	cedarauthorizer "github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+// Explanation is the response of /debug/explain. It describes how a
+// SubjectAccessReview or AdmissionReview would be decided.
+type Explanation struct {
+	// Kind is the kind of the explained request
+	Kind     string `json:"kind"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+	// PrincipalRule is the principal rule that decided an authorization
+	// request. Policies aren't evaluated when a principal rule decides a request.
+	PrincipalRule *v1alpha1.PrincipalRule `json:"principalRule,omitempty"`
+	// Exclusion is why an admission request was allowed without evaluating policies
+	Exclusion string `json:"exclusion,omitempty"`
+	// Warnings are the warn policies that apply to an admission request
+	Warnings []ExplainedPolicy `json:"warnings,omitempty"`
+	// Store is the policy store tier that decided the request, if any
+	Store string `json:"store,omitempty"`
+
+	Request  *ExplainedRequest    `json:"request,omitempty"`
+	Entities cedartypes.EntityMap `json:"entities,omitempty"`
+	Tiers    []ExplainedTier      `json:"tiers"`
+}
+
+// ExplainedRequest is the Cedar request a webhook request is evaluated as
+type ExplainedRequest struct {
+	Principal string            `json:"principal"`
+	Action    string            `json:"action"`
+	Resource  string            `json:"resource"`
+	Context   cedartypes.Record `json:"context"`
+}
+
+// ExplainedTier is the result of evaluating the enforced policies of a policy store tier
+type ExplainedTier struct {
+	Store     string `json:"store"`
+	Combining string `json:"combining"`
+	OnError   string `json:"onError"`
+	// Reached is false for tiers after the tier that decided the request,
+	// whose results didn't affect the decision
+	Reached bool `json:"reached"`
+	// Decision is Allow or Deny, or NotApplicable when no policy in the tier applied
+	Decision string            `json:"decision"`
+	Policies []ExplainedPolicy `json:"policies"`
+	Errors   []ExplainedError  `json:"errors"`
+}
+
+// ExplainedPolicy is a policy that determined a tier's decision
+type ExplainedPolicy struct {
+	ID      string `json:"id"`
+	Source  string `json:"source"`
+	Message string `json:"message,omitempty"`
+	// Text is the policy in Cedar syntax
+	Text string `json:"text,omitempty"`
+}
+
+// ExplainedError is a policy evaluation error
+type ExplainedError struct {
+	PolicyID string `json:"policyId"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// explainHandlerFunc returns a handler that explains the decision for a
+// SubjectAccessReview or AdmissionReview, without recording metrics, audit
+// decisions, or decision log records
+func explainHandlerFunc(authorizer cedarauthorizer.Authorizer, admissionHandler cedaradmission.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed reading request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		typeMeta := metav1.TypeMeta{}
+		if err := json.Unmarshal(body, &typeMeta); err != nil {
+			http.Error(w, fmt.Sprintf("failed parsing request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var explanation Explanation
+		switch typeMeta.Kind {
+		case "SubjectAccessReview":
+			sar := authzv1.SubjectAccessReview{}
+			if err := json.Unmarshal(body, &sar); err != nil {
+				http.Error(w, fmt.Sprintf("failed parsing SubjectAccessReview: %v", err), http.StatusBadRequest)
+				return
+			}
+			evaluation, err := authorizer.Evaluate(r.Context(), GetAuthorizerAttributes(sar))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed evaluating SubjectAccessReview: %v", err), http.StatusInternalServerError)
+				return
+			}
+			explanation = Explanation{
+				Decision:      authorizationDecisionString(evaluation.Decision),
+				Reason:        evaluation.Reason,
+				PrincipalRule: evaluation.PrincipalRule,
+				Store:         evaluation.Store,
+				Tiers:         explainTiers(evaluation.Tiers),
+			}
+			if evaluation.PrincipalRule == nil {
+				explanation.Request = explainRequest(evaluation.Request)
+				explanation.Entities = evaluation.Entities
+			}
+		case "AdmissionReview":
+			review := admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(body, &review); err != nil {
+				http.Error(w, fmt.Sprintf("failed parsing AdmissionReview: %v", err), http.StatusBadRequest)
+				return
+			}
+			if review.Request == nil {
+				http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+				return
+			}
+			evaluation, err := admissionHandler.Evaluate(r.Context(), admission.Request{AdmissionRequest: *review.Request})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed evaluating AdmissionReview: %v", err), http.StatusInternalServerError)
+				return
+			}
+			explanation = Explanation{
+				Decision:  "Deny",
+				Exclusion: evaluation.Exclusion,
+				Store:     evaluation.Store,
+				Tiers:     explainTiers(evaluation.Tiers),
+			}
+			if evaluation.Allowed {
+				explanation.Decision = "Allow"
+			}
+			if evaluation.Exclusion == "" {
+				explanation.Request = explainRequest(evaluation.Request)
+				explanation.Entities = evaluation.Entities
+			}
+			for _, warning := range evaluation.Warnings {
+				explanation.Warnings = append(explanation.Warnings, ExplainedPolicy{
+					ID:      string(warning.PolicyID),
+					Source:  warning.Source,
+					Message: warning.Message,
+				})
+			}
+		default:
+			http.Error(w, fmt.Sprintf("unsupported kind %q, must be SubjectAccessReview or AdmissionReview", typeMeta.Kind), http.StatusBadRequest)
+			return
+		}
+		explanation.Kind = typeMeta.Kind
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(explanation); err != nil {
+			klog.ErrorS(err, "Failed to write explanation")
+		}
+	}
+}
+
+func explainRequest(req cedar.Request) *ExplainedRequest {
+	return &ExplainedRequest{
+		Principal: req.Principal.String(),
+		Action:    req.Action.String(),
+		Resource:  req.Resource.String(),
+		Context:   req.Context,
+	}
+}
+
+func explainTiers(tiers []store.TierEvaluation) []ExplainedTier {
+	resp := make([]ExplainedTier, 0, len(tiers))
+	for _, tier := range tiers {
+		explained := ExplainedTier{
+			Store:     tier.Store.Name(),
+			Combining: tier.Options.Combining,
+			OnError:   tier.Options.OnError,
+			Reached:   tier.Reached,
+			Decision:  "NotApplicable",
+			Policies:  []ExplainedPolicy{},
+			Errors:    []ExplainedError{},
+		}
+		if len(tier.Diagnostic.Reasons) > 0 {
+			explained.Decision = "Deny"
+			if tier.Decision == cedar.Allow {
+				explained.Decision = "Allow"
+			}
+		}
+		for _, reason := range tier.Diagnostic.Reasons {
+			policyReason, _ := tier.Store.PolicyReason(reason.PolicyID)
+			explained.Policies = append(explained.Policies, ExplainedPolicy{
+				ID:      string(reason.PolicyID),
+				Source:  policyReason.Source,
+				Message: policyReason.Message,
+				Text:    policyText(tier.Store, reason.PolicyID),
+			})
+		}
+		for _, diagnosticError := range tier.Diagnostic.Errors {
+			policyReason, _ := tier.Store.PolicyReason(diagnosticError.PolicyID)
+			explained.Errors = append(explained.Errors, ExplainedError{
+				PolicyID: string(diagnosticError.PolicyID),
+				Source:   policyReason.Source,
+				Message:  diagnosticError.Message,
+			})
+		}
+		resp = append(resp, explained)
+	}
+	return resp
+}
+
+// policyText returns an enforced policy of a store in Cedar syntax
+func policyText(policyStore store.PolicyStore, id cedar.PolicyID) string {
+	policySet := policyStore.PolicySet()
+	if policySet == nil {
+		return ""
+	}
+	policy := policySet.Get(id)
+	if policy == nil {
+		return ""
+	}
+	return string(policy.MarshalCedar())
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	admissionv1 "k8s.io/api/admission/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	cedaradmission "github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	cedarauthorizer "github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/decisionlog"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+const explainPolicies = `permit (
+    principal == k8s::User::"alice",
+    action == k8s::Action::"get",
+    resource is k8s::Resource
+) when {
+    resource.resource == "pods"
+};
+
+forbid (
+    principal,
+    action == k8s::admission::Action::"create",
+    resource is core::v1::Pod
+) when {
+    resource.metadata.namespace == "prod"
+};`
+
+// explainSAR returns a SubjectAccessReview body for alice to get pods
+func explainSAR(t *testing.T) []byte {
+	t.Helper()
+	body, err := json.Marshal(authzv1.SubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "authorization.k8s.io/v1", Kind: "SubjectAccessReview"},
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   "alice",
+			UID:    "alice",
+			Groups: []string{"developers"},
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace: "default",
+				Verb:      "get",
+				Version:   "v1",
+				Resource:  "pods",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SubjectAccessReview: %v", err)
+	}
+	return body
+}
+
+// explainAdmissionReview returns an AdmissionReview body for alice to create a pod in namespace
+func explainAdmissionReview(t *testing.T, namespace string) []byte {
+	t.Helper()
+	pod, err := json.Marshal(corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal pod: %v", err)
+	}
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "705ab4f5-6393-11e8-b7cc-42010a800002",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Name:      "web",
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authnv1.UserInfo{Username: "alice", Groups: []string{"developers"}},
+			Object:    runtime.RawExtension{Raw: pod},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal AdmissionReview: %v", err)
+	}
+	return body
+}
+
+// gatherMetrics returns the webhook's metrics in text format
+func gatherMetrics(t *testing.T) string {
+	t.Helper()
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	var sb strings.Builder
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "cedar_authorizer_") {
+			continue
+		}
+		sb.WriteString(family.String())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// decisionCacheMisses returns the number of authorization decision cache misses
+func decisionCacheMisses(t *testing.T) float64 {
+	t.Helper()
+	families, err := legacyregistry.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "cedar_authorizer_decision_cache_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "result" && label.GetValue() == "miss" {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestExplainHandler(t *testing.T) {
+	policyStore, err := store.NewMemoryStore("policies.cedar", []byte(explainPolicies), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", cedaradmission.AllowAllAdmissionPolicy())
+	allowAll := store.StaticStore(*pset)
+
+	path := filepath.Join(t.TempDir(), "decisions.log")
+	decisionLog, err := decisionlog.New(&config.DecisionLogConfig{Path: path, MaxSize: 1, AllowSampleRate: 1})
+	if err != nil {
+		t.Fatalf("Failed to create decision log: %v", err)
+	}
+	authorizer := cedarauthorizer.NewAuthorizer(nil, cedarauthorizer.Options{
+		DecisionCache: &config.DecisionCacheConfig{Size: 10, TTL: time.Minute},
+		DecisionLog:   decisionLog,
+	}, policyStore)
+	handler := cedaradmission.NewHandler([]store.PolicyStore{policyStore, allowAll}, cedaradmission.Options{DecisionLog: decisionLog})
+	explain := explainHandlerFunc(authorizer, handler)
+
+	cases := []struct {
+		name       string
+		body       []byte
+		wantStatus int
+		wantError  string
+		want       Explanation
+	}{
+		{
+			name:       "SubjectAccessReview allowed by a policy",
+			body:       explainSAR(t),
+			wantStatus: http.StatusOK,
+			want: Explanation{
+				Kind:     "SubjectAccessReview",
+				Decision: "Allow",
+				Reason:   "policies.cedar, policy0",
+				Store:    "policies.cedar",
+				Request: &ExplainedRequest{
+					Principal: `k8s::User::"alice"`,
+					Action:    `k8s::Action::"get"`,
+				},
+				Tiers: []ExplainedTier{{
+					Store:     "policies.cedar",
+					Combining: "firstApplicable",
+					OnError:   "noOpinion",
+					Reached:   true,
+					Decision:  "Allow",
+					Policies:  []ExplainedPolicy{{ID: "policy0", Source: "policies.cedar, policy0"}},
+					Errors:    []ExplainedError{},
+				}},
+			},
+		},
+		{
+			name:       "AdmissionReview denied by a policy",
+			body:       explainAdmissionReview(t, "prod"),
+			wantStatus: http.StatusOK,
+			want: Explanation{
+				Kind:     "AdmissionReview",
+				Decision: "Deny",
+				Store:    "policies.cedar",
+				Request: &ExplainedRequest{
+					Principal: `k8s::User::"alice"`,
+					Action:    `k8s::admission::Action::"create"`,
+				},
+				Tiers: []ExplainedTier{
+					{
+						Store:     "policies.cedar",
+						Combining: "firstApplicable",
+						OnError:   "noOpinion",
+						Reached:   true,
+						Decision:  "Deny",
+						Policies:  []ExplainedPolicy{{ID: "policy1", Source: "policies.cedar, policy1"}},
+						Errors:    []ExplainedError{},
+					},
+					{
+						Store:     "StaticStore",
+						Combining: "firstApplicable",
+						OnError:   "noOpinion",
+						Reached:   false,
+						Decision:  "Allow",
+						Policies:  []ExplainedPolicy{{ID: "allow-all-admission", Source: "StaticStore, allow-all-admission"}},
+						Errors:    []ExplainedError{},
+					},
+				},
+			},
+		},
+		{
+			name:       "AdmissionReview allowed by the allow-all policy",
+			body:       explainAdmissionReview(t, "default"),
+			wantStatus: http.StatusOK,
+			want: Explanation{
+				Kind:     "AdmissionReview",
+				Decision: "Allow",
+				Store:    "StaticStore",
+				Request: &ExplainedRequest{
+					Principal: `k8s::User::"alice"`,
+					Action:    `k8s::admission::Action::"create"`,
+				},
+				Tiers: []ExplainedTier{
+					{
+						Store:     "policies.cedar",
+						Combining: "firstApplicable",
+						OnError:   "noOpinion",
+						Reached:   true,
+						Decision:  "NotApplicable",
+						Policies:  []ExplainedPolicy{},
+						Errors:    []ExplainedError{},
+					},
+					{
+						Store:     "StaticStore",
+						Combining: "firstApplicable",
+						OnError:   "noOpinion",
+						Reached:   true,
+						Decision:  "Allow",
+						Policies:  []ExplainedPolicy{{ID: "allow-all-admission", Source: "StaticStore, allow-all-admission"}},
+						Errors:    []ExplainedError{},
+					},
+				},
+			},
+		},
+		{
+			name:       "malformed body",
+			body:       []byte(`{"kind": "SubjectAccessReview"`),
+			wantStatus: http.StatusBadRequest,
+			wantError:  "failed parsing request body",
+		},
+		{
+			name:       "unsupported kind",
+			body:       []byte(`{"apiVersion": "v1", "kind": "Pod"}`),
+			wantStatus: http.StatusBadRequest,
+			wantError:  `unsupported kind "Pod"`,
+		},
+		{
+			name:       "AdmissionReview without a request",
+			body:       []byte(`{"apiVersion": "admission.k8s.io/v1", "kind": "AdmissionReview"}`),
+			wantStatus: http.StatusBadRequest,
+			wantError:  "AdmissionReview has no request",
+		},
+	}
+
+	metricsBefore := gatherMetrics(t)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			explain(rec, httptest.NewRequest(http.MethodPost, "/debug/explain", strings.NewReader(string(tc.body))))
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantError != "" {
+				if !strings.Contains(rec.Body.String(), tc.wantError) {
+					t.Errorf("Expected error containing %q, got %q", tc.wantError, rec.Body.String())
+				}
+				return
+			}
+			var got Explanation
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to parse explanation %s: %v", rec.Body.String(), err)
+			}
+			if diff := cmp.Diff(tc.want, got,
+				cmpopts.IgnoreFields(Explanation{}, "Entities"),
+				cmpopts.IgnoreFields(ExplainedRequest{}, "Resource", "Context"),
+				cmpopts.IgnoreFields(ExplainedPolicy{}, "Text"),
+			); diff != "" {
+				t.Errorf("Unexpected explanation (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if diff := cmp.Diff(metricsBefore, gatherMetrics(t)); diff != "" {
+		t.Errorf("Expected explain to not record metrics (-before +after):\n%s", diff)
+	}
+	if err := decisionLog.Close(); err != nil {
+		t.Fatalf("Failed to close decision log: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read decision log: %v", err)
+	} else if len(data) > 0 {
+		t.Errorf("Expected explain to not write the decision log, got %s", data)
+	}
+
+	// the explained SubjectAccessReview isn't cached, so authorizing it is a cache miss
+	misses := decisionCacheMisses(t)
+	sar := authzv1.SubjectAccessReview{}
+	if err := json.Unmarshal(explainSAR(t), &sar); err != nil {
+		t.Fatalf("Failed to parse SubjectAccessReview: %v", err)
+	}
+	if _, _, err := authorizer.Authorize(context.Background(), GetAuthorizerAttributes(sar)); err != nil {
+		t.Fatalf("Failed to authorize: %v", err)
+	}
+	if got := decisionCacheMisses(t); got != misses+1 {
+		t.Errorf("Expected a decision cache miss after explain, got %v misses, previously %v", got, misses)
+	}
+}
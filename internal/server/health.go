@@ -1,35 +1,132 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
 
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/options"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
 )
 
-func newHealthHandlers() *http.ServeMux {
+// StoresFunc returns the policy and entity stores currently in use, which
+// change when the store config is reloaded
+type StoresFunc func() (store.TieredPolicyStores, store.TieredEntityStores)
+
+// SyncedFunc returns true once the webhook's informer caches have synced
+type SyncedFunc func() bool
+
+func newHealthHandlers(stores StoresFunc, informersSynced SyncedFunc) *http.ServeMux {
 	mux := http.NewServeMux()
-	// TODO: actually check health status
-	mux.HandleFunc("/healthz", healthzHandlerFunc())
-	mux.HandleFunc("/readyz", healthzHandlerFunc())
+	mux.HandleFunc("/healthz", healthzHandlerFunc(stores))
+	mux.HandleFunc("/readyz", readyzHandlerFunc(stores, informersSynced))
+	mux.HandleFunc("/statusz", statuszHandlerFunc(stores))
 	mux.Handle("/metrics", legacyregistry.Handler())
 	return mux
 }
 
-func healthzHandlerFunc() http.HandlerFunc {
+// healthzHandlerFunc reports stores whose last load had an error as degraded.
+// It always succeeds, as restarting the webhook won't fix a bad policy.
+func healthzHandlerFunc(storesFunc StoresFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		stores, _ := storesFunc()
+		var b strings.Builder
+		degraded := 0
+		for _, s := range stores {
+			if err := s.Status().LastError; err != nil {
+				degraded++
+				fmt.Fprintf(&b, "[-]store %s degraded: %v\n", s.Name(), err)
+				continue
+			}
+			fmt.Fprintf(&b, "[+]store %s ok\n", s.Name())
+		}
+		if degraded > 0 {
+			fmt.Fprintf(&b, "healthz check passed with %d degraded stores\n", degraded)
+		} else {
+			b.WriteString("healthz check passed\n")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(b.String()))
+	}
+}
+
+// readyzHandlerFunc fails until every policy and entity store has completed
+// its initial load, and the informer caches have synced. A nil informersSynced
+// is always synced.
+func readyzHandlerFunc(storesFunc StoresFunc, informersSynced SyncedFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stores, entityStores := storesFunc()
+		var b strings.Builder
+		ready := true
+		if informersSynced != nil {
+			if !informersSynced() {
+				ready = false
+				b.WriteString("[-]informers not synced\n")
+			} else {
+				b.WriteString("[+]informers ok\n")
+			}
+		}
+		for _, s := range stores {
+			if !s.InitalPolicyLoadComplete() {
+				ready = false
+				fmt.Fprintf(&b, "[-]store %s not ready\n", s.Name())
+				continue
+			}
+			fmt.Fprintf(&b, "[+]store %s ok\n", s.Name())
+		}
+		for _, s := range entityStores {
+			if !s.InitalEntityLoadComplete() {
+				ready = false
+				fmt.Fprintf(&b, "[-]entity store %s not ready\n", s.Name())
+				continue
+			}
+			fmt.Fprintf(&b, "[+]entity store %s ok\n", s.Name())
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			b.WriteString("readyz check failed\n")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			b.WriteString("readyz check passed\n")
+			w.WriteHeader(http.StatusOK)
+		}
+		_, _ = w.Write([]byte(b.String()))
+	}
+}
+
+// serverStatus is the response of /statusz
+type serverStatus struct {
+	PolicyStores []store.TierStatus        `json:"policyStores"`
+	EntityStores []store.EntityStoreStatus `json:"entityStores"`
+}
+
+// statuszHandlerFunc lists each store in tier order with its generation and
+// policy set hash, to compare the policies enforced by each replica
+func statuszHandlerFunc(storesFunc StoresFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stores, entityStores := storesFunc()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(serverStatus{
+			PolicyStores: stores.Statuses(),
+			EntityStores: entityStores.Statuses(),
+		}); err != nil {
+			klog.ErrorS(err, "Failed to write status")
+		}
 	}
 }
 
-// NewMetrics returns a new metrics server.
-func NewMetricsServer() *http.Server {
+// NewMetrics returns a new metrics server, with health and status endpoints
+// for the stores returned by stores. The server isn't ready until informersSynced.
+func NewMetricsServer(stores StoresFunc, informersSynced SyncedFunc) *http.Server {
 	return &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", options.CedarAuthorizerDefaultAddress, options.CedarAuthorizerMetricsPort),
-		Handler:      newHealthHandlers(),
+		Handler:      newHealthHandlers(stores, informersSynced),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 	}
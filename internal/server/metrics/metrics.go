@@ -2,8 +2,8 @@ package metrics
 
 import (
 	"context"
+	"sync"
 
-	apiv1alpha1 "github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/legacyregistry"
@@ -13,6 +13,12 @@ import (
 const (
 	// subSystemName is the name of this subsystem name used for prometheus metrics.
 	subSystemName = "cedar_authorizer"
+
+	// maxPolicySeries bounds the number of policies with their own policy_determining_total
+	// series. Hits for policies beyond this are counted with the policy label "other".
+	maxPolicySeries = 1000
+	// otherPolicy is the policy label for policies beyond maxPolicySeries
+	otherPolicy = "other"
 )
 
 type registerables []metrics.Registerable
@@ -46,21 +52,183 @@ var (
 		[]string{"decision"},
 	)
 
+	admissionRequestTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "admission_request_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of admission requests partitioned by admission decision.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"decision"},
+	)
+
+	admissionRequestLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "admission_request_duration_seconds",
+			Subsystem:      subSystemName,
+			Help:           "Admission request latency in seconds partitioned by admission decision.",
+			Buckets:        []float64{0.25, 0.5, 0.7, 1, 1.5, 3, 5, 10},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"decision"},
+	)
+
+	storeEvaluationLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "store_evaluation_duration_seconds",
+			Subsystem:      subSystemName,
+			Help:           "Latency in seconds of evaluating a request against a policy store's policies, partitioned by store.",
+			Buckets:        prometheus.ExponentialBuckets(0.0001, 4, 8),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+
+	tierDecisionTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "tier_decision_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of evaluated requests partitioned by the policy store that decided the request, or none, and the decision.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store", "decision"},
+	)
+
+	policyDeterminingTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "policy_determining_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of evaluated requests a policy determined the decision of, partitioned by store and policy ID.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store", "policy"},
+	)
+
+	storePolicies = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "store_policies",
+			Subsystem:      subSystemName,
+			Help:           "Number of enforced and audit policies loaded in a policy store.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+
+	storeReloadLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "store_reload_duration_seconds",
+			Subsystem:      subSystemName,
+			Help:           "Latency in seconds of loading a policy store's policies, partitioned by store.",
+			Buckets:        prometheus.ExponentialBuckets(0.001, 4, 10),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+
+	storeReloadFailureTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "store_reload_failures_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of policy store loads with an error, partitioned by store.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+
+	entityConstructionLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "entity_construction_duration_seconds",
+			Subsystem:      subSystemName,
+			Help:           "Latency in seconds of building the Cedar entities and request for a webhook request, partitioned by webhook.",
+			Buckets:        prometheus.ExponentialBuckets(0.0001, 4, 8),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"webhook"},
+	)
+
 	e2eLatency = metrics.NewHistogramVec(
 		&metrics.HistogramOpts{
 			Name:           "e2e_latency_seconds",
 			Subsystem:      subSystemName,
-			Help:           "End to end latency in seconds partitioned by filename.",
-			Buckets:        prometheus.ExponentialBuckets(2, 2, 8),
+			Help:           "End to end latency in seconds from a policy's creation or update to when it is loaded, partitioned by store.",
+			Buckets:        prometheus.ExponentialBuckets(0.5, 2, 10),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+
+	auditDecisionTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "audit_decision_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of requests where audit policies applied, partitioned by webhook, enforced decision, and the decision audit policies would have made.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"webhook", "decision", "audit_decision"},
+	)
+
+	decisionCacheTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "decision_cache_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of authorization decision cache lookups partitioned by result (hit or miss).",
 			StabilityLevel: metrics.ALPHA,
 		},
-		[]string{"filename"},
+		[]string{"result"},
 	)
 
+	evaluationTimeoutTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "evaluation_timeout_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of requests where evaluation timed out, partitioned by webhook and the fallback decision returned.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"webhook", "decision"},
+	)
+
+	configReloadTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "config_reload_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of store config reloads partitioned by result (success or failure).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"result"},
+	)
+
+	clientAuthRejectedTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "client_auth_rejected_total",
+			Subsystem:      subSystemName,
+			Help:           "Number of webhook requests rejected by client certificate verification, partitioned by path and reason.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"path", "reason"},
+	)
+
+	// policySeries is the set of store and policy label pairs with their own policy_determining_total series
+	policySeries   = map[[2]string]struct{}{}
+	policySeriesMu sync.Mutex
+
 	toRegister = registerables{
 		requestTotal,
 		requestLatency,
+		admissionRequestTotal,
+		admissionRequestLatency,
+		storeEvaluationLatency,
+		tierDecisionTotal,
+		policyDeterminingTotal,
+		storePolicies,
+		storeReloadLatency,
+		storeReloadFailureTotal,
+		entityConstructionLatency,
 		e2eLatency,
+		auditDecisionTotal,
+		decisionCacheTotal,
+		evaluationTimeoutTotal,
+		configReloadTotal,
+		clientAuthRejectedTotal,
 	}
 )
 
@@ -74,13 +242,112 @@ func RecordRequestLatency(ctx context.Context, decision string, latency float64)
 	requestLatency.WithContext(ctx).With(map[string]string{"decision": decision}).Observe(latency)
 }
 
-// RecordE2ELatency measures the e2e latency in seconds from ddb update time to load time.
-func RecordE2ELatency(ctx context.Context, filename string, latency float64, clusterId, version string) {
-	e2eLatency.WithContext(ctx).With(map[string]string{"filename": filename}).Observe(latency)
-	klog.V(3).Infof("%#v", apiv1alpha1.E2ELatencyLog{
-		ClusterID: clusterId,
-		Version:   version,
-		Type:      filename,
-		Latency:   latency,
-	})
+// RecordAdmissionRequestTotal increments the total number of requests for the admission webhook.
+func RecordAdmissionRequestTotal(ctx context.Context, decision string) {
+	admissionRequestTotal.WithContext(ctx).With(map[string]string{"decision": decision}).Add(1)
+}
+
+// RecordAdmissionRequestLatency measures admission request latency in seconds. Broken down by decision.
+func RecordAdmissionRequestLatency(ctx context.Context, decision string, latency float64) {
+	admissionRequestLatency.WithContext(ctx).With(map[string]string{"decision": decision}).Observe(latency)
+}
+
+// RecordStoreEvaluationLatency measures the latency in seconds of evaluating a request in a policy store.
+func RecordStoreEvaluationLatency(ctx context.Context, store string, latency float64) {
+	storeEvaluationLatency.WithContext(ctx).With(map[string]string{"store": store}).Observe(latency)
+}
+
+// RecordTierDecision increments the number of requests decided by a policy store.
+func RecordTierDecision(ctx context.Context, store, decision string) {
+	tierDecisionTotal.WithContext(ctx).With(map[string]string{"store": store, "decision": decision}).Add(1)
+}
+
+// RecordPolicyDetermining increments the number of requests a policy determined.
+// Only the first maxPolicySeries policies get their own series.
+func RecordPolicyDetermining(ctx context.Context, store, policy string) {
+	policyDeterminingTotal.WithContext(ctx).With(map[string]string{"store": store, "policy": boundedPolicy(store, policy)}).Add(1)
+}
+
+// boundedPolicy returns the policy label for a policy, or otherPolicy once maxPolicySeries have been recorded
+func boundedPolicy(store, policy string) string {
+	policySeriesMu.Lock()
+	defer policySeriesMu.Unlock()
+	key := [2]string{store, policy}
+	if _, ok := policySeries[key]; ok {
+		return policy
+	}
+	if len(policySeries) >= maxPolicySeries {
+		return otherPolicy
+	}
+	policySeries[key] = struct{}{}
+	return policy
+}
+
+// RecordStorePolicies sets the number of policies loaded in a policy store.
+func RecordStorePolicies(store string, count int) {
+	storePolicies.With(map[string]string{"store": store}).Set(float64(count))
+}
+
+// RecordStoreReload measures the latency in seconds of loading a policy
+// store's policies, and counts loads with an error as failures.
+func RecordStoreReload(store string, latency float64, failed bool) {
+	storeReloadLatency.With(map[string]string{"store": store}).Observe(latency)
+	if failed {
+		storeReloadFailureTotal.With(map[string]string{"store": store}).Add(1)
+	}
+}
+
+// RecordEntityConstructionLatency measures the latency in seconds of building the entities for a request.
+func RecordEntityConstructionLatency(ctx context.Context, webhook string, latency float64) {
+	entityConstructionLatency.WithContext(ctx).With(map[string]string{"webhook": webhook}).Observe(latency)
+}
+
+// RecordAuditDecision increments the number of requests where audit policies applied.
+func RecordAuditDecision(ctx context.Context, webhook, decision, auditDecision string) {
+	auditDecisionTotal.WithContext(ctx).With(map[string]string{
+		"webhook":        webhook,
+		"decision":       decision,
+		"audit_decision": auditDecision,
+	}).Add(1)
+}
+
+// RecordDecisionCacheHit increments the number of authorization decision cache hits.
+func RecordDecisionCacheHit(ctx context.Context) {
+	decisionCacheTotal.WithContext(ctx).With(map[string]string{"result": "hit"}).Add(1)
+}
+
+// RecordDecisionCacheMiss increments the number of authorization decision cache misses.
+func RecordDecisionCacheMiss(ctx context.Context) {
+	decisionCacheTotal.WithContext(ctx).With(map[string]string{"result": "miss"}).Add(1)
+}
+
+// RecordEvaluationTimeout increments the number of requests where evaluation timed out.
+func RecordEvaluationTimeout(ctx context.Context, webhook, decision string) {
+	evaluationTimeoutTotal.WithContext(ctx).With(map[string]string{
+		"webhook":  webhook,
+		"decision": decision,
+	}).Add(1)
+}
+
+// RecordConfigReload increments the number of store config reloads.
+func RecordConfigReload(failed bool) {
+	result := "success"
+	if failed {
+		result = "failure"
+	}
+	configReloadTotal.With(map[string]string{"result": result}).Add(1)
+}
+
+// RecordClientAuthRejected increments the number of requests rejected by client certificate verification.
+func RecordClientAuthRejected(ctx context.Context, path, reason string) {
+	clientAuthRejectedTotal.WithContext(ctx).With(map[string]string{
+		"path":   path,
+		"reason": reason,
+	}).Add(1)
+}
+
+// RecordE2ELatency measures the e2e latency in seconds from a policy's creation or update time to load time.
+func RecordE2ELatency(ctx context.Context, store string, latency float64) {
+	e2eLatency.WithContext(ctx).With(map[string]string{"store": store}).Observe(latency)
+	klog.V(3).InfoS("Policy propagation latency", "store", store, "latency", latency)
 }
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBoundedPolicy(t *testing.T) {
+	policySeriesMu.Lock()
+	policySeries = map[[2]string]struct{}{}
+	policySeriesMu.Unlock()
+
+	for i := range maxPolicySeries {
+		policy := fmt.Sprintf("policy%d", i)
+		if got := boundedPolicy("store", policy); got != policy {
+			t.Fatalf("Expected policy %d to have its own series, got %q", i, got)
+		}
+	}
+	if got := boundedPolicy("store", "policy0"); got != "policy0" {
+		t.Errorf("Expected a recorded policy to keep its series, got %q", got)
+	}
+	if got := boundedPolicy("store", "new-policy"); got != otherPolicy {
+		t.Errorf("Expected a policy beyond the limit to be %q, got %q", otherPolicy, got)
+	}
+	if got := boundedPolicy("other-store", "policy0"); got != otherPolicy {
+		t.Errorf("Expected the same policy ID in another store beyond the limit to be %q, got %q", otherPolicy, got)
+	}
+}
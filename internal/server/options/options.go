@@ -1,12 +1,20 @@
 package options
 
 import (
+	"fmt"
 	"net"
+	"slices"
+	"strings"
+	"time"
 
+	apiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
 	apiserveroptions "k8s.io/apiserver/pkg/server/options"
 	cliflag "k8s.io/component-base/cli/flag"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
 	netutils "k8s.io/utils/net"
 
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
 )
 
@@ -32,25 +40,106 @@ const (
 	CedarAuthorizerDefaultArtificialDenyRate = 5.0
 	// CedarAuthorizerShutdownTimeout is how long until the server shuts down
 	CedarAuthorizerShutdownTimeout = 10
+	// CedarAuthorizerDefaultDecisionCacheSize is the default maximum number of cached authorization decisions
+	CedarAuthorizerDefaultDecisionCacheSize = 4096
+	// CedarAuthorizerDefaultDecisionCacheTTL is the default length of time an authorization decision is cached
+	CedarAuthorizerDefaultDecisionCacheTTL = 10 * time.Second
+	// CedarAuthorizerDefaultAuthorizationTimeout is the default length of time to evaluate an authorization request.
+	// It should be less than the timeout in the API server's authorization webhook configuration.
+	CedarAuthorizerDefaultAuthorizationTimeout = 2 * time.Second
+	// CedarAuthorizerDefaultAdmissionTimeout is the default length of time to evaluate an admission request.
+	// It is less than the default admission webhook timeoutSeconds of 10 seconds.
+	CedarAuthorizerDefaultAdmissionTimeout = 8 * time.Second
+	// CedarAuthorizerDefaultDecisionLogMaxSize is the default size in megabytes of the decision log file before it is rotated
+	CedarAuthorizerDefaultDecisionLogMaxSize = 100
+	// CedarAuthorizerDefaultDecisionLogMaxBackups is the default number of rotated decision log files to keep
+	CedarAuthorizerDefaultDecisionLogMaxBackups = 5
+	// CedarAuthorizerDefaultStoreConfigReloadInterval is the default interval the store config file is checked for changes
+	CedarAuthorizerDefaultStoreConfigReloadInterval = 10 * time.Second
+	// CedarAuthorizerDefaultStoreConfigReloadTimeout is the default length of time to wait for a changed store config's stores to load
+	CedarAuthorizerDefaultStoreConfigReloadTimeout = 30 * time.Second
+	// CedarAuthorizerDefaultDecisionLogAllowSampleRate is the default fraction of decisions other than Deny written to the decision log
+	CedarAuthorizerDefaultDecisionLogAllowSampleRate = 1.0
 )
 
 // AuthorizerOptions follows the k8s convention of separating options/flags from config
 type AuthorizerOptions struct {
 	ShutdownTimeout int
 
-	StoreConfig string
+	StoreConfig       string
+	StoreConfigReload *StoreConfigReloadOptions
+
+	DecisionCache *DecisionCacheOptions
+
+	AuthorizationEvaluation *EvaluationOptions
+	AdmissionEvaluation     *EvaluationOptions
+	// AdmissionSchema is a Cedar JSON schema file admission objects are
+	// converted with. The built-in schema is used when empty.
+	AdmissionSchema string
 
 	SecureServing  *apiserveroptions.SecureServingOptions
+	ClientAuth     *ClientAuthOptions
 	ErrorInjection *ErrorInjectionOptions
+	Tracing        *TracingOptions
+	DecisionLog    *DecisionLogOptions
 	DebugOptions   *DebugOptions
 }
 
 type DebugOptions struct {
 	EnableProfiling bool
+	EnableExplain   bool
 	EnableRecording bool
 	RecordingDir    string
 }
 
+type ClientAuthOptions struct {
+	// ClientCAFile is a PEM bundle of the CAs that sign webhook client certificates.
+	// Client certificates aren't verified when empty.
+	ClientCAFile string
+	// AllowedClients are PATH=IDENTITY pairs limiting the certificate common
+	// names and subject alternative names that may call a path
+	AllowedClients []string
+}
+
+type DecisionCacheOptions struct {
+	// Size is the maximum number of cached authorization decisions. 0 disables the cache.
+	Size int
+	// TTL is how long an authorization decision is cached. 0 disables the cache.
+	TTL time.Duration
+}
+
+type StoreConfigReloadOptions struct {
+	// Interval is how often the store config file is checked for changes. 0 disables reloading.
+	Interval time.Duration
+	// Timeout is how long to wait for the stores of a changed config to load
+	Timeout time.Duration
+}
+
+type EvaluationOptions struct {
+	// Timeout is how long a webhook evaluates a request before returning FallbackDecision. 0 disables the timeout.
+	Timeout time.Duration
+	// FallbackDecision is the decision returned when Timeout passes
+	FallbackDecision string
+}
+
+type TracingOptions struct {
+	// Endpoint is the OTLP gRPC collector endpoint traces are exported to. Tracing is disabled when empty.
+	Endpoint string
+	// SamplingRatePerMillion is the number of requests to sample per million, when the API server didn't sample the request
+	SamplingRatePerMillion int32
+}
+
+type DecisionLogOptions struct {
+	// Path is the file decisions are written to, or "-" for stdout. The decision log is disabled when empty.
+	Path string
+	// MaxSize is the size in megabytes of the decision log file before it is rotated
+	MaxSize int
+	// MaxBackups is the number of rotated decision log files to keep
+	MaxBackups int
+	// AllowSampleRate is the fraction of decisions other than Deny that are logged
+	AllowSampleRate float64
+}
+
 type ErrorInjectionOptions struct {
 	// ArtificialErrorRate is the maximum number of fake errors returned per second by the error injector
 	ArtificialErrorRate float64
@@ -64,9 +153,25 @@ func NewCedarAuthorizerOptions() *AuthorizerOptions {
 	return &AuthorizerOptions{
 		ShutdownTimeout: CedarAuthorizerShutdownTimeout,
 		SecureServing:   NewAuthorizerSecureServingOptions(),
+		ClientAuth:      &ClientAuthOptions{},
 		ErrorInjection:  NewErrorInjectionOptions(),
 		StoreConfig:     "",
-		DebugOptions:    NewDebugOptions(),
+		StoreConfigReload: &StoreConfigReloadOptions{
+			Interval: CedarAuthorizerDefaultStoreConfigReloadInterval,
+			Timeout:  CedarAuthorizerDefaultStoreConfigReloadTimeout,
+		},
+		DecisionCache: NewDecisionCacheOptions(),
+		AuthorizationEvaluation: &EvaluationOptions{
+			Timeout:          CedarAuthorizerDefaultAuthorizationTimeout,
+			FallbackDecision: config.FallbackDecisionNoOpinion,
+		},
+		AdmissionEvaluation: &EvaluationOptions{
+			Timeout:          CedarAuthorizerDefaultAdmissionTimeout,
+			FallbackDecision: config.FallbackDecisionAllow,
+		},
+		Tracing:      &TracingOptions{},
+		DecisionLog:  NewDecisionLogOptions(),
+		DebugOptions: NewDebugOptions(),
 	}
 }
 
@@ -91,9 +196,27 @@ func NewErrorInjectionOptions() *ErrorInjectionOptions {
 	}
 }
 
+// NewDecisionCacheOptions creates a DecisionCacheOptions with some defaults
+func NewDecisionCacheOptions() *DecisionCacheOptions {
+	return &DecisionCacheOptions{
+		Size: CedarAuthorizerDefaultDecisionCacheSize,
+		TTL:  CedarAuthorizerDefaultDecisionCacheTTL,
+	}
+}
+
+// NewDecisionLogOptions creates a DecisionLogOptions with some defaults
+func NewDecisionLogOptions() *DecisionLogOptions {
+	return &DecisionLogOptions{
+		MaxSize:         CedarAuthorizerDefaultDecisionLogMaxSize,
+		MaxBackups:      CedarAuthorizerDefaultDecisionLogMaxBackups,
+		AllowSampleRate: CedarAuthorizerDefaultDecisionLogAllowSampleRate,
+	}
+}
+
 func NewDebugOptions() *DebugOptions {
 	return &DebugOptions{
 		EnableProfiling: false,
+		EnableExplain:   false,
 		EnableRecording: false,
 		RecordingDir:    "",
 	}
@@ -126,15 +249,43 @@ func (o *AuthorizerOptions) ApplyTo(cfg *config.AuthorizationWebhookConfig) erro
 	}
 
 	cfg.StoreConfig = o.StoreConfig
+	if err := o.StoreConfigReload.ApplyTo(&cfg.StoreConfigReload); err != nil {
+		return fmt.Errorf("invalid store config reload options: %w", err)
+	}
 
 	cfg.ShutdownTimeout = o.ShutdownTimeout
 
+	o.DecisionCache.ApplyTo(&cfg.DecisionCache)
+
+	if err := o.AuthorizationEvaluation.ApplyTo(&cfg.AuthorizationEvaluation, config.FallbackDecisionNoOpinion, config.FallbackDecisionAllow, config.FallbackDecisionDeny); err != nil {
+		return fmt.Errorf("invalid authorization evaluation options: %w", err)
+	}
+	if err := o.AdmissionEvaluation.ApplyTo(&cfg.AdmissionEvaluation, config.FallbackDecisionAllow, config.FallbackDecisionDeny); err != nil {
+		return fmt.Errorf("invalid admission evaluation options: %w", err)
+	}
+	admissionSchema, err := schema.LoadCedarSchema(o.AdmissionSchema)
+	if err != nil {
+		return fmt.Errorf("invalid admission schema: %w", err)
+	}
+	cfg.AdmissionSchema = admissionSchema
+
 	if err := o.SecureServing.ApplyTo(&cfg.SecureServing); err != nil {
 		return err
 	}
+	if err := o.ClientAuth.ApplyTo(&cfg.ClientAuth, cfg.SecureServing); err != nil {
+		return fmt.Errorf("invalid client auth options: %w", err)
+	}
 
 	o.ErrorInjection.ApplyTo(&cfg.ErrorInjection)
 
+	if err := o.Tracing.ApplyTo(&cfg.Tracing); err != nil {
+		return fmt.Errorf("invalid tracing options: %w", err)
+	}
+
+	if err := o.DecisionLog.ApplyTo(&cfg.DecisionLog); err != nil {
+		return fmt.Errorf("invalid decision log options: %w", err)
+	}
+
 	if o.DebugOptions != nil {
 		o.DebugOptions.ApplyTo(cfg.DebugOptions)
 	}
@@ -162,11 +313,131 @@ func (o *ErrorInjectionOptions) ApplyTo(cfg **config.ErrorInjectionConfig) {
 	}
 }
 
+// ApplyTo converts command line options into runtime config for the Authorizer.
+// The client CA is added to servingInfo, so TLS connections request a client certificate.
+func (o *ClientAuthOptions) ApplyTo(cfg **config.ClientAuthConfig, servingInfo *apiserver.SecureServingInfo) error {
+	if o == nil {
+		return nil
+	}
+	if o.ClientCAFile == "" {
+		if len(o.AllowedClients) > 0 {
+			return fmt.Errorf("allowed clients require a client CA file")
+		}
+		return nil
+	}
+	allowedClients := map[string][]string{}
+	for _, allowedClient := range o.AllowedClients {
+		path, identity, ok := strings.Cut(allowedClient, "=")
+		if !ok || !strings.HasPrefix(path, "/") || identity == "" {
+			return fmt.Errorf("allowed client %q must be in the form PATH=IDENTITY", allowedClient)
+		}
+		allowedClients[path] = append(allowedClients[path], identity)
+	}
+	clientCA, err := dynamiccertificates.NewDynamicCAContentFromFile("client-ca-bundle", o.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client CA file: %w", err)
+	}
+	if servingInfo != nil {
+		servingInfo.ClientCA = clientCA
+	}
+	*cfg = &config.ClientAuthConfig{
+		ClientCA:       clientCA,
+		AllowedClients: allowedClients,
+	}
+	return nil
+}
+
+// ApplyTo converts command line options into runtime config for the Authorizer
+func (o *DecisionCacheOptions) ApplyTo(cfg **config.DecisionCacheConfig) {
+	if o == nil {
+		return
+	}
+	*cfg = &config.DecisionCacheConfig{
+		Size: o.Size,
+		TTL:  o.TTL,
+	}
+}
+
+// ApplyTo converts command line options into runtime config for the Authorizer
+func (o *StoreConfigReloadOptions) ApplyTo(cfg **config.StoreConfigReloadConfig) error {
+	if o == nil || o.Interval == 0 {
+		return nil
+	}
+	if o.Interval < 0 {
+		return fmt.Errorf("interval must not be negative, got %s", o.Interval)
+	}
+	if o.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %s", o.Timeout)
+	}
+	*cfg = &config.StoreConfigReloadConfig{
+		Interval: o.Interval,
+		Timeout:  o.Timeout,
+	}
+	return nil
+}
+
+// ApplyTo converts command line options into runtime config for a webhook.
+// The fallback decision must be one of fallbackDecisions.
+func (o *EvaluationOptions) ApplyTo(cfg **config.EvaluationConfig, fallbackDecisions ...string) error {
+	if o == nil {
+		return nil
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", o.Timeout)
+	}
+	if !slices.Contains(fallbackDecisions, o.FallbackDecision) {
+		return fmt.Errorf("fallback decision %q must be one of %v", o.FallbackDecision, fallbackDecisions)
+	}
+	*cfg = &config.EvaluationConfig{
+		Timeout:          o.Timeout,
+		FallbackDecision: o.FallbackDecision,
+	}
+	return nil
+}
+
+// ApplyTo converts command line options into runtime config for the Authorizer
+func (o *TracingOptions) ApplyTo(cfg **tracingapi.TracingConfiguration) error {
+	if o == nil || o.Endpoint == "" {
+		return nil
+	}
+	endpoint, samplingRate := o.Endpoint, o.SamplingRatePerMillion
+	tracingConfig := &tracingapi.TracingConfiguration{
+		Endpoint:               &endpoint,
+		SamplingRatePerMillion: &samplingRate,
+	}
+	if errs := tracingapi.ValidateTracingConfiguration(tracingConfig, nil, nil); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	*cfg = tracingConfig
+	return nil
+}
+
+// ApplyTo converts command line options into runtime config for the Authorizer
+func (o *DecisionLogOptions) ApplyTo(cfg **config.DecisionLogConfig) error {
+	if o == nil || o.Path == "" {
+		return nil
+	}
+	if o.AllowSampleRate < 0 || o.AllowSampleRate > 1 {
+		return fmt.Errorf("allow sample rate must be between 0 and 1, got %v", o.AllowSampleRate)
+	}
+	if o.MaxSize < 0 || o.MaxBackups < 0 {
+		return fmt.Errorf("max size and max backups must not be negative")
+	}
+	*cfg = &config.DecisionLogConfig{
+		Path:            o.Path,
+		MaxSize:         o.MaxSize,
+		MaxBackups:      o.MaxBackups,
+		AllowSampleRate: o.AllowSampleRate,
+	}
+	return nil
+}
+
 func (o *DebugOptions) ApplyTo(cfg *config.DebugOptions) {
 	if o == nil {
 		return
 	}
 	cfg.EnableProfiling = o.EnableProfiling
+	cfg.EnableExplain = o.EnableExplain
 	cfg.EnableRecording = o.EnableRecording
 	cfg.RecordingDir = o.RecordingDir
 }
@@ -177,6 +448,15 @@ func (o *AuthorizerOptions) Flags() *cliflag.NamedFlagSets {
 
 	fs := fss.FlagSet("cedar")
 	fs.StringVar(&o.StoreConfig, "config", o.StoreConfig, "The config for the Cedar policy stores")
+	fs.DurationVar(&o.StoreConfigReload.Interval, "config-reload-interval", o.StoreConfigReload.Interval, "How often to check --config for changes. A changed config replaces the policy and entity stores without a restart. Set to 0 to disable reloading.")
+	fs.DurationVar(&o.StoreConfigReload.Timeout, "config-reload-timeout", o.StoreConfigReload.Timeout, "How long to wait for the stores of a changed --config to load before keeping the previous config.")
+	fs.IntVar(&o.DecisionCache.Size, "decision-cache-size", o.DecisionCache.Size, "The maximum number of authorization decisions to cache. Set to 0 to disable the decision cache.")
+	fs.DurationVar(&o.AuthorizationEvaluation.Timeout, "authorization-evaluation-timeout", o.AuthorizationEvaluation.Timeout, "How long to evaluate an authorization request before returning --authorization-fallback-decision. Set to 0 to disable the timeout.")
+	fs.StringVar(&o.AuthorizationEvaluation.FallbackDecision, "authorization-fallback-decision", o.AuthorizationEvaluation.FallbackDecision, "The decision returned when an authorization request times out. One of NoOpinion, Allow, or Deny.")
+	fs.DurationVar(&o.AdmissionEvaluation.Timeout, "admission-evaluation-timeout", o.AdmissionEvaluation.Timeout, "How long to evaluate an admission request before returning --admission-fallback-decision. Set to 0 to disable the timeout.")
+	fs.StringVar(&o.AdmissionEvaluation.FallbackDecision, "admission-fallback-decision", o.AdmissionEvaluation.FallbackDecision, "The decision returned when an admission request times out. One of Allow or Deny.")
+	fs.StringVar(&o.AdmissionSchema, "admission-schema", o.AdmissionSchema, "A Cedar schema in JSON format, such as one generated by schema-generator, that admission objects are converted into entities with. Generate a schema from your cluster to include CRDs. Defaults to the built-in schema of Kubernetes types.")
+	fs.DurationVar(&o.DecisionCache.TTL, "decision-cache-ttl", o.DecisionCache.TTL, "How long to cache an authorization decision. Cached decisions are always dropped when policies change. Set to 0 to disable the decision cache.")
 
 	fs = fss.FlagSet("runtime")
 	fs.IntVar(&o.ShutdownTimeout, "shutdown-timeout", o.ShutdownTimeout, "The length of time to wait between stopCh being closed and server shutdown being triggered.")
@@ -186,12 +466,26 @@ func (o *AuthorizerOptions) Flags() *cliflag.NamedFlagSets {
 	fs.Float64Var(&o.ErrorInjection.ArtificialErrorRate, "artificial-error-rate", o.ErrorInjection.ArtificialErrorRate, "Cause the authorizer to occasionally return errors at the specified rate.  Useful to validate metrics are working as expected.")
 	fs.Float64Var(&o.ErrorInjection.ArtificialDenyRate, "artificial-deny-rate", o.ErrorInjection.ArtificialDenyRate, "Cause the authorizer to occasionally return denies at the specified rate.  Useful to validate metrics are working as expected.")
 
+	fs = fss.FlagSet("tracing")
+	fs.StringVar(&o.Tracing.Endpoint, "tracing-endpoint", o.Tracing.Endpoint, "The OTLP gRPC endpoint to export traces to, such as localhost:4317. Tracing is disabled when empty.")
+	fs.Int32Var(&o.Tracing.SamplingRatePerMillion, "tracing-sampling-rate-per-million", o.Tracing.SamplingRatePerMillion, "The number of requests to trace per million. Requests sampled by the API server's trace headers are always traced.")
+
+	fs = fss.FlagSet("decision log")
+	fs.StringVar(&o.DecisionLog.Path, "decision-log-path", o.DecisionLog.Path, "If set, each authorization and admission decision is written as a line of JSON to this file. '-' writes to stdout.")
+	fs.IntVar(&o.DecisionLog.MaxSize, "decision-log-maxsize", o.DecisionLog.MaxSize, "The maximum size in megabytes of the decision log file before it is rotated.")
+	fs.IntVar(&o.DecisionLog.MaxBackups, "decision-log-maxbackup", o.DecisionLog.MaxBackups, "The maximum number of rotated decision log files to keep. Set to 0 to keep all files.")
+	fs.Float64Var(&o.DecisionLog.AllowSampleRate, "decision-log-allow-sample-rate", o.DecisionLog.AllowSampleRate, "The fraction of Allow and NoOpinion decisions to log, from 0 to 1. Deny decisions are always logged.")
+
 	fs = fss.FlagSet("debug")
 	fs.BoolVar(&o.DebugOptions.EnableProfiling, "profiling", o.DebugOptions.EnableProfiling, "Enable profiling via web interface host:port/debug/pprof/")
+	fs.BoolVar(&o.DebugOptions.EnableExplain, "enable-explain", o.DebugOptions.EnableExplain, "Enable explaining decisions via host:port/debug/explain. The response includes request entities and policy text.")
 	fs.BoolVar(&o.DebugOptions.EnableRecording, "enable-request-recording", o.DebugOptions.EnableRecording, "Enable recording of requests")
 	fs.StringVar(&o.DebugOptions.RecordingDir, "request-recording-dir", o.DebugOptions.RecordingDir, "The directory to record requests to")
 
 	o.SecureServing.AddFlags(fss.FlagSet("secure serving"))
+	fs = fss.FlagSet("secure serving")
+	fs.StringVar(&o.ClientAuth.ClientCAFile, "client-ca-file", o.ClientAuth.ClientCAFile, "If set, webhook clients must present a certificate signed by a CA in this PEM bundle. The file is reloaded when it changes.")
+	fs.StringArrayVar(&o.ClientAuth.AllowedClients, "allowed-client", o.ClientAuth.AllowedClients, "A PATH=IDENTITY pair allowing clients whose certificate has IDENTITY as its common name or a subject alternative name to call PATH, such as /v1/authorize=kube-apiserver. May be repeated. Any client with a verified certificate may call paths without an allowed client. Requires --client-ca-file.")
 
 	return &fss
 }
@@ -0,0 +1,309 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	k8sauthorizer "k8s.io/apiserver/pkg/authorization/authorizer"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server"
+	cedaradmission "github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+const (
+	// WebhookAuthorization is the webhook of a recorded SubjectAccessReview
+	WebhookAuthorization = "authorization"
+	// WebhookAdmission is the webhook of a recorded AdmissionReview
+	WebhookAdmission = "admission"
+)
+
+// recordingPattern matches the file names written by server.RecordRequest
+var recordingPattern = regexp.MustCompile(`^req-(.+)-(\d+)\.json$`)
+
+// recordingWebhooks maps the request path of a recording to its webhook
+var recordingWebhooks = map[string]string{
+	"authorize": WebhookAuthorization,
+	"admit":     WebhookAdmission,
+}
+
+// Recording is a webhook request recorded with --enable-request-recording
+type Recording struct {
+	File    string
+	Webhook string
+
+	SubjectAccessReview *authzv1.SubjectAccessReview
+	AdmissionRequest    *admission.Request
+}
+
+// LoadRecordings reads the recorded authorization and admission requests in
+// dir, in the order they were recorded. Files that aren't recordings of either
+// webhook are ignored.
+func LoadRecordings(dir string) ([]Recording, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording dir: %w", err)
+	}
+	type recordingFile struct {
+		name    string
+		webhook string
+		time    int64
+	}
+	var recordingFiles []recordingFile
+	for _, file := range files {
+		matches := recordingPattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || matches == nil {
+			continue
+		}
+		webhook, ok := recordingWebhooks[matches[1]]
+		if !ok {
+			continue
+		}
+		recorded, err := strconv.ParseInt(matches[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		recordingFiles = append(recordingFiles, recordingFile{name: file.Name(), webhook: webhook, time: recorded})
+	}
+	sort.SliceStable(recordingFiles, func(i, j int) bool {
+		return recordingFiles[i].time < recordingFiles[j].time
+	})
+
+	resp := make([]Recording, 0, len(recordingFiles))
+	for _, file := range recordingFiles {
+		data, err := os.ReadFile(filepath.Join(dir, file.name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording %s: %w", file.name, err)
+		}
+		recording := Recording{File: file.name, Webhook: file.webhook}
+		switch file.webhook {
+		case WebhookAuthorization:
+			recording.SubjectAccessReview = &authzv1.SubjectAccessReview{}
+			if err := json.Unmarshal(data, recording.SubjectAccessReview); err != nil {
+				return nil, fmt.Errorf("failed to parse SubjectAccessReview %s: %w", file.name, err)
+			}
+		case WebhookAdmission:
+			review := admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(data, &review); err != nil {
+				return nil, fmt.Errorf("failed to parse AdmissionReview %s: %w", file.name, err)
+			}
+			if review.Request == nil {
+				return nil, fmt.Errorf("AdmissionReview %s has no request", file.name)
+			}
+			recording.AdmissionRequest = &admission.Request{AdmissionRequest: *review.Request}
+		}
+		resp = append(resp, recording)
+	}
+	return resp, nil
+}
+
+// Description returns a short, human-readable description of the request
+func (r Recording) Description() string {
+	if r.SubjectAccessReview != nil {
+		spec := r.SubjectAccessReview.Spec
+		if spec.NonResourceAttributes != nil {
+			return fmt.Sprintf("%s %s %s", spec.User, spec.NonResourceAttributes.Verb, spec.NonResourceAttributes.Path)
+		}
+		if attrs := spec.ResourceAttributes; attrs != nil {
+			resource := attrs.Resource
+			if attrs.Subresource != "" {
+				resource += "/" + attrs.Subresource
+			}
+			if attrs.Group != "" {
+				resource += "." + attrs.Group
+			}
+			return strings.TrimSpace(fmt.Sprintf("%s %s %s %s", spec.User, attrs.Verb, resource, objectName(attrs.Namespace, attrs.Name)))
+		}
+		return spec.User
+	}
+	if r.AdmissionRequest != nil {
+		req := r.AdmissionRequest
+		resource := req.Resource.Resource
+		if req.SubResource != "" {
+			resource += "/" + req.SubResource
+		}
+		if req.Resource.Group != "" {
+			resource += "." + req.Resource.Group
+		}
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s %s", req.UserInfo.Username, strings.ToLower(string(req.Operation)), resource, objectName(req.Namespace, req.Name)))
+	}
+	return ""
+}
+
+func objectName(namespace, name string) string {
+	if namespace == "" || name == "" {
+		return namespace + name
+	}
+	return namespace + "/" + name
+}
+
+// Evaluator evaluates recorded requests with one policy configuration
+type Evaluator struct {
+	Authorizer authorizer.Authorizer
+	Admission  cedaradmission.Handler
+}
+
+// Result is the decision for a recorded request with one policy configuration
+type Result struct {
+	Decision string `json:"decision"`
+	// Policies are the IDs of the policies that determined the decision, sorted
+	Policies []string `json:"policies"`
+	// PrincipalRule is true if a principal rule decided the request instead of policies
+	PrincipalRule bool   `json:"principalRule,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// equal returns true if both results have the same decision and determining policies
+func (r Result) equal(other Result) bool {
+	return r.Decision == other.Decision &&
+		r.PrincipalRule == other.PrincipalRule &&
+		r.Error == other.Error &&
+		slices.Equal(r.Policies, other.Policies)
+}
+
+// Evaluate returns the decision for a recorded request
+func (e Evaluator) Evaluate(ctx context.Context, recording Recording) Result {
+	switch {
+	case recording.SubjectAccessReview != nil:
+		evaluation, err := e.Authorizer.Evaluate(ctx, server.GetAuthorizerAttributes(*recording.SubjectAccessReview))
+		if err != nil {
+			return Result{Error: err.Error(), Policies: []string{}}
+		}
+		return Result{
+			Decision:      authorizationDecisionString(evaluation),
+			PrincipalRule: evaluation.PrincipalRule != nil,
+			Policies:      policyIDs(evaluation.Policies),
+		}
+	case recording.AdmissionRequest != nil:
+		evaluation, err := e.Admission.Evaluate(ctx, *recording.AdmissionRequest)
+		if err != nil {
+			return Result{Error: err.Error(), Policies: []string{}}
+		}
+		result := Result{Decision: "Deny", Policies: policyIDs(evaluation.Policies)}
+		if evaluation.Allowed {
+			result.Decision = "Allow"
+		}
+		return result
+	}
+	return Result{Error: "recording has no request", Policies: []string{}}
+}
+
+// policyIDs returns the sorted IDs of policies
+func policyIDs(policies []store.PolicyReason) []string {
+	resp := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		resp = append(resp, string(policy.PolicyID))
+	}
+	slices.Sort(resp)
+	return resp
+}
+
+func authorizationDecisionString(evaluation authorizer.Evaluation) string {
+	switch evaluation.Decision {
+	case k8sauthorizer.DecisionDeny:
+		return "Deny"
+	case k8sauthorizer.DecisionAllow:
+		return "Allow"
+	}
+	return "NoOpinion"
+}
+
+// Change is a recorded request whose decision or determining policies changed
+type Change struct {
+	File     string `json:"file"`
+	Webhook  string `json:"webhook"`
+	Request  string `json:"request"`
+	Base     Result `json:"base"`
+	Proposed Result `json:"proposed"`
+}
+
+// Report is the result of replaying recorded requests with two policy configurations
+type Report struct {
+	Total     int `json:"total"`
+	Unchanged int `json:"unchanged"`
+	// DecisionChanged counts requests whose decision changed
+	DecisionChanged int `json:"decisionChanged"`
+	// PoliciesChanged counts requests with the same decision, but different determining policies
+	PoliciesChanged int      `json:"policiesChanged"`
+	Changes         []Change `json:"changes"`
+}
+
+// Diff evaluates each recording with the base and proposed configurations,
+// and reports every request whose decision or determining policies changed.
+func Diff(ctx context.Context, recordings []Recording, base, proposed Evaluator) Report {
+	report := Report{Total: len(recordings), Changes: []Change{}}
+	for _, recording := range recordings {
+		baseResult := base.Evaluate(ctx, recording)
+		proposedResult := proposed.Evaluate(ctx, recording)
+		if baseResult.equal(proposedResult) {
+			report.Unchanged++
+			continue
+		}
+		if baseResult.Decision != proposedResult.Decision {
+			report.DecisionChanged++
+		} else {
+			report.PoliciesChanged++
+		}
+		report.Changes = append(report.Changes, Change{
+			File:     recording.File,
+			Webhook:  recording.Webhook,
+			Request:  recording.Description(),
+			Base:     baseResult,
+			Proposed: proposedResult,
+		})
+	}
+	return report
+}
+
+// WriteSummary writes a table of changed requests followed by totals
+func (r Report) WriteSummary(out io.Writer) error {
+	if len(r.Changes) > 0 {
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "File\tWebhook\tRequest\tBase\tProposed")
+		for _, change := range r.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.File, change.Webhook, change.Request, change.Base, change.Proposed)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+	}
+	_, err := fmt.Fprintf(out, "%d requests replayed: %d unchanged, %d decisions changed, %d determining policies changed\n",
+		r.Total, r.Unchanged, r.DecisionChanged, r.PoliciesChanged)
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r Report) WriteJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// String describes a result for the summary table
+func (r Result) String() string {
+	if r.Error != "" {
+		return "error: " + r.Error
+	}
+	if r.PrincipalRule {
+		return r.Decision + " (principal rule)"
+	}
+	if len(r.Policies) == 0 {
+		return r.Decision
+	}
+	return fmt.Sprintf("%s [%s]", r.Decision, strings.Join(r.Policies, ", "))
+}
@@ -0,0 +1,192 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+const (
+	getPodSAR = `{
+	"apiVersion": "authorization.k8s.io/v1",
+	"kind": "SubjectAccessReview",
+	"spec": {
+		"user": "alice",
+		"groups": ["developers"],
+		"resourceAttributes": {"verb": "get", "version": "v1", "resource": "pods", "namespace": "default", "name": "web"}
+	}
+}`
+	listNodesSAR = `{
+	"apiVersion": "authorization.k8s.io/v1",
+	"kind": "SubjectAccessReview",
+	"spec": {
+		"user": "bob",
+		"resourceAttributes": {"verb": "list", "version": "v1", "resource": "nodes"}
+	}
+}`
+	createConfigMapReview = `{
+	"apiVersion": "admission.k8s.io/v1",
+	"kind": "AdmissionReview",
+	"request": {
+		"uid": "705ab4f5-6393-11e8-b7cc-42010a800002",
+		"kind": {"group": "", "version": "v1", "kind": "ConfigMap"},
+		"resource": {"group": "", "version": "v1", "resource": "configmaps"},
+		"name": "cm1",
+		"namespace": "default",
+		"operation": "CREATE",
+		"userInfo": {"username": "alice", "groups": ["developers"]},
+		"object": {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "cm1", "namespace": "default"}, "data": {"key": "value"}}
+	}
+}`
+)
+
+func writeRecordings(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write recording: %v", err)
+		}
+	}
+	return dir
+}
+
+func newEvaluator(t *testing.T, name, policies string) Evaluator {
+	t.Helper()
+	return newEvaluatorWithExclusions(t, name, policies, nil)
+}
+
+func newEvaluatorWithExclusions(t *testing.T, name, policies string, exclusions *admission.Exclusions) Evaluator {
+	t.Helper()
+	policyStore, err := store.NewMemoryStore(name, []byte(policies), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", admission.AllowAllAdmissionPolicy())
+	return Evaluator{
+		Authorizer: authorizer.NewAuthorizer(nil, authorizer.Options{}, policyStore),
+		Admission:  admission.NewHandler([]store.PolicyStore{policyStore, store.StaticStore(*pset)}, admission.Options{Exclusions: exclusions}),
+	}
+}
+
+func TestLoadRecordings(t *testing.T) {
+	dir := writeRecordings(t, map[string]string{
+		"req-authorize-300.json": listNodesSAR,
+		"req-authorize-100.json": getPodSAR,
+		"req-admit-200.json":     createConfigMapReview,
+		"req-rules-400.json":     `{}`,
+		"notes.txt":              "not a recording",
+	})
+	recordings, err := LoadRecordings(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, recording := range recordings {
+		got = append(got, recording.Webhook+" "+recording.Description())
+	}
+	want := []string{
+		"authorization alice get pods default/web",
+		"admission alice create configmaps default/cm1",
+		"authorization bob list nodes",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected recordings (-want +got):\n%s", diff)
+	}
+
+	if _, err := LoadRecordings(writeRecordings(t, map[string]string{"req-admit-1.json": `{"kind": "AdmissionReview"}`})); err == nil {
+		t.Error("Expected an error for an AdmissionReview without a request")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := writeRecordings(t, map[string]string{
+		"req-authorize-100.json": getPodSAR,
+		"req-admit-200.json":     createConfigMapReview,
+		"req-authorize-300.json": listNodesSAR,
+	})
+	recordings, err := LoadRecordings(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	base := newEvaluator(t, "base", `
+permit (principal in k8s::Group::"developers", action == k8s::Action::"get", resource);
+permit (principal, action == k8s::Action::"list", resource);
+`)
+	proposed := newEvaluator(t, "proposed", `
+permit (principal, action == k8s::Action::"list", resource);
+permit (principal in k8s::Group::"developers", action == k8s::Action::"get", resource);
+forbid (principal, action == k8s::admission::Action::"create", resource is core::v1::ConfigMap);
+`)
+
+	report := Diff(context.Background(), recordings, base, proposed)
+	want := Report{
+		Total:           3,
+		Unchanged:       0,
+		DecisionChanged: 1,
+		PoliciesChanged: 2,
+		Changes: []Change{
+			{
+				File:     "req-authorize-100.json",
+				Webhook:  WebhookAuthorization,
+				Request:  "alice get pods default/web",
+				Base:     Result{Decision: "Allow", Policies: []string{"policy0"}},
+				Proposed: Result{Decision: "Allow", Policies: []string{"policy1"}},
+			},
+			{
+				File:     "req-admit-200.json",
+				Webhook:  WebhookAdmission,
+				Request:  "alice create configmaps default/cm1",
+				Base:     Result{Decision: "Allow", Policies: []string{"allow-all-admission"}},
+				Proposed: Result{Decision: "Deny", Policies: []string{"policy2"}},
+			},
+			{
+				File:     "req-authorize-300.json",
+				Webhook:  WebhookAuthorization,
+				Request:  "bob list nodes",
+				Base:     Result{Decision: "Allow", Policies: []string{"policy1"}},
+				Proposed: Result{Decision: "Allow", Policies: []string{"policy0"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, report); diff != "" {
+		t.Errorf("Unexpected report (-want +got):\n%s", diff)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteSummary(&out); err != nil {
+		t.Fatalf("Failed to write summary: %v", err)
+	}
+	if !strings.Contains(out.String(), "3 requests replayed: 0 unchanged, 1 decisions changed, 2 determining policies changed") {
+		t.Errorf("Unexpected summary:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "Deny [policy2]") {
+		t.Errorf("Expected summary to list the proposed deny:\n%s", out.String())
+	}
+
+	if report := Diff(context.Background(), recordings, base, base); report.Unchanged != 3 || len(report.Changes) != 0 {
+		t.Errorf("Expected no changes with the same configuration, got %+v", report)
+	}
+
+	// excluded admission requests are allowed without evaluating policies
+	excluded := newEvaluatorWithExclusions(t, "excluded", `
+forbid (principal, action == k8s::admission::Action::"create", resource is core::v1::ConfigMap);
+`, admission.NewExclusions(&v1alpha1.AdmissionConfig{ExcludedNamespaces: []string{"default"}}, nil))
+	result := excluded.Evaluate(context.Background(), recordings[1])
+	if diff := cmp.Diff(Result{Decision: "Allow", Policies: []string{}}, result); diff != "" {
+		t.Errorf("Unexpected result for an excluded request (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/klog/v2"
+
+	cedarauthorizer "github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+)
+
+// SubjectRulesReview is the body of a /v1/rules request and response. It
+// mirrors the SubjectRulesReview used internally by the API server, which
+// isn't part of the authorization.k8s.io/v1 API.
+type SubjectRulesReview struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Spec   SubjectRulesReviewSpec           `json:"spec"`
+	Status authzv1.SubjectRulesReviewStatus `json:"status,omitempty"`
+}
+
+// SubjectRulesReviewSpec is the user and namespace to resolve rules for
+type SubjectRulesReviewSpec struct {
+	User      string                        `json:"user,omitempty"`
+	Groups    []string                      `json:"groups,omitempty"`
+	Extra     map[string]authzv1.ExtraValue `json:"extra,omitempty"`
+	UID       string                        `json:"uid,omitempty"`
+	Namespace string                        `json:"namespace,omitempty"`
+}
+
+// rulesHandlerFunc returns a handler that resolves the rules in a SubjectRulesReview
+func (as *AuthorizerServer) rulesHandlerFunc(authorizer cedarauthorizer.Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestId := uuid.New().String()
+
+		review := SubjectRulesReview{}
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			klog.ErrorS(err, "Failed to decode SubjectRulesReview", "requestId", requestId)
+			http.Error(w, fmt.Sprintf("failed parsing request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		u := &user.DefaultInfo{
+			Name:   review.Spec.User,
+			Groups: review.Spec.Groups,
+			Extra:  convertExtraForAuthorizerAttributes(review.Spec.Extra),
+			UID:    review.Spec.UID,
+		}
+		resp := SubjectRulesReview{
+			TypeMeta: metav1.TypeMeta{
+				Kind: "SubjectRulesReview",
+			},
+			Spec:   review.Spec,
+			Status: GetSubjectRulesReviewStatus(r.Context(), authorizer, u, review.Spec.Namespace),
+		}
+		klog.InfoS("Rules response", "requestId", requestId, "user", u.Name, "namespace", review.Spec.Namespace, "incomplete", resp.Status.Incomplete)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			klog.ErrorS(err, "Failed to encode SubjectRulesReview", "requestId", requestId)
+		}
+	}
+}
+
+// GetSubjectRulesReviewStatus resolves the rules the authorizer grants a user in a namespace
+func GetSubjectRulesReviewStatus(ctx context.Context, authorizer cedarauthorizer.Authorizer, u user.Info, namespace string) authzv1.SubjectRulesReviewStatus {
+	resourceRules, nonResourceRules, incomplete, err := authorizer.RulesFor(ctx, u, namespace)
+
+	status := authzv1.SubjectRulesReviewStatus{
+		ResourceRules:    []authzv1.ResourceRule{},
+		NonResourceRules: []authzv1.NonResourceRule{},
+		Incomplete:       incomplete,
+	}
+	for _, rule := range resourceRules {
+		status.ResourceRules = append(status.ResourceRules, authzv1.ResourceRule{
+			Verbs:         rule.GetVerbs(),
+			APIGroups:     rule.GetAPIGroups(),
+			Resources:     rule.GetResources(),
+			ResourceNames: rule.GetResourceNames(),
+		})
+	}
+	for _, rule := range nonResourceRules {
+		status.NonResourceRules = append(status.NonResourceRules, authzv1.NonResourceRule{
+			Verbs:           rule.GetVerbs(),
+			NonResourceURLs: rule.GetNonResourceURLs(),
+		})
+	}
+	if err != nil {
+		status.EvaluationError = err.Error()
+	}
+	return status
+}
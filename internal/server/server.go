@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
@@ -19,10 +21,14 @@ import (
 	"k8s.io/apiserver/pkg/authentication/user"
 	k8sauthorizer "k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	cedaradmission "github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
 	cedarauthorizer "github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/clientauth"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 )
 
 // AuthorizerServer is contains the authorization handler
@@ -34,8 +40,9 @@ type AuthorizerServer struct {
 }
 
 // NewServer is a constructor for the AuthorizerServer.  It defines the
-// /v1/authorize and /v1/admit handlers.
-func NewServer(authorizer cedarauthorizer.Authorizer, admissionHandler http.Handler, cfg *config.AuthorizationWebhookConfig) *AuthorizerServer {
+// /v1/authorize, /v1/admit, and /v1/rules handlers, and the debug handlers
+// enabled in cfg.
+func NewServer(authorizer cedarauthorizer.Authorizer, admissionEvaluator cedaradmission.Handler, cfg *config.AuthorizationWebhookConfig) *AuthorizerServer {
 	mux := http.NewServeMux()
 	as := &AuthorizerServer{
 		handler:    mux,
@@ -45,21 +52,35 @@ func NewServer(authorizer cedarauthorizer.Authorizer, admissionHandler http.Hand
 	errorInjector := NewErrorInjector(cfg.ErrorInjection)
 
 	var authzHandler http.Handler = as.authorizeHandlerFunc(authorizer, errorInjector)
+	var admissionHandler http.Handler = &admission.Webhook{Handler: admissionEvaluator}
 
 	if cfg.DebugOptions.EnableRecording {
 		authzHandler = RecordRequest(cfg.DebugOptions.RecordingDir)(authzHandler)
 		admissionHandler = RecordRequest(cfg.DebugOptions.RecordingDir)(admissionHandler)
 	}
+	// continue traces from the API server's trace headers
+	authzHandler = tracing.WithTracing(authzHandler, "authorize")
+	admissionHandler = tracing.WithTracing(admissionHandler, "admit")
+
+	// verify client certificates before requests are recorded or traced
+	clientAuth := clientauth.New(cfg.ClientAuth)
+	handle := func(path string, handler http.Handler) {
+		mux.Handle(path, clientAuth.WithClientAuth(handler, path))
+	}
 
-	mux.Handle("/v1/authorize", authzHandler)
-	mux.Handle("/v1/admit", admissionHandler)
+	handle("/v1/authorize", authzHandler)
+	handle("/v1/admit", admissionHandler)
+	handle("/v1/rules", as.rulesHandlerFunc(authorizer))
 
 	if cfg.DebugOptions.EnableProfiling {
-		mux.HandleFunc("/debug/pprof/", pprof.Index)
-		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+		handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+		handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+		handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+		handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	}
+	if cfg.DebugOptions.EnableExplain {
+		handle("/debug/explain", explainHandlerFunc(authorizer, admissionEvaluator))
 	}
 	return as
 }
@@ -70,6 +91,7 @@ func (as *AuthorizerServer) authorizeHandlerFunc(authorizer cedarauthorizer.Auth
 			err                   error
 			reason                string
 			authorizationDecision k8sauthorizer.Decision
+			evaluated             bool
 		)
 		ctx := r.Context()
 		start := time.Now()
@@ -78,7 +100,14 @@ func (as *AuthorizerServer) authorizeHandlerFunc(authorizer cedarauthorizer.Auth
 		defer func() {
 			latency := time.Since(start)
 
-			if authorizationDecision != 0 {
+			if errors.Is(err, context.DeadlineExceeded) {
+				metrics.RecordRequestTotal(ctx, "timeout")
+				metrics.RecordRequestLatency(ctx, "timeout", latency.Seconds())
+				return
+			}
+
+			// DecisionDeny is the zero value, so only record decisions from evaluated requests
+			if evaluated {
 				metrics.RecordRequestTotal(ctx, authorizationDecisionString(authorizationDecision))
 				metrics.RecordRequestLatency(ctx, authorizationDecisionString(authorizationDecision), latency.Seconds())
 				return
@@ -101,7 +130,9 @@ func (as *AuthorizerServer) authorizeHandlerFunc(authorizer cedarauthorizer.Auth
 			}
 		}
 
+		_, decodeSpan := tracing.Start(ctx, "DecodeSubjectAccessReview")
 		err = json.NewDecoder(r.Body).Decode(&sar)
+		decodeSpan.End()
 		if err != nil {
 			writeResponse(w, requestId, fmt.Errorf("failed parsing request body: %w", err), k8sauthorizer.DecisionNoOpinion, "Encountered decoding error")
 			return
@@ -112,6 +143,7 @@ func (as *AuthorizerServer) authorizeHandlerFunc(authorizer cedarauthorizer.Auth
 
 		attributes := GetAuthorizerAttributes(sar)
 		authorizationDecision, reason, err = errorInjector.InjectIfEnabled(authorizer.Authorize(r.Context(), attributes))
+		evaluated = true
 		writeResponse(w, requestId, err, authorizationDecision, reason)
 	}
 }
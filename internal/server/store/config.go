@@ -24,18 +24,20 @@ func CedarConfigStores(c *v1alpha1.CedarConfig) (TieredPolicyStores, error) {
 	}
 	var stores []PolicyStore
 	for _, storeDef := range c.Spec.Stores {
+		var ps PolicyStore
 		switch storeDef.Type {
 		case v1alpha1.StoreTypeDirectory:
-			stores = append(stores, NewDirectoryPolicyStore(
+			ps = NewDirectoryPolicyStore(
 				storeDef.DirectoryStore.Path,
 				time.Duration(*storeDef.DirectoryStore.RefreshInterval),
-			))
+			)
 		case v1alpha1.StoreTypeCRD:
-			ps, err := NewCRDPolicyStore(storeDef.CRDStore.KubeconfigContext)
+			var err error
+			ps, err = NewCRDPolicyStore(storeDef.CRDStore.KubeconfigContext)
 			if err != nil {
+				TieredPolicyStores(stores).Stop()
 				return nil, err
 			}
-			stores = append(stores, ps)
 		case v1alpha1.StoreTypeVerifiedPermissions:
 			loadFuncs := []func(*config.LoadOptions) error{}
 			if storeDef.VerifiedPermissionsStore.AWSRegion != "" {
@@ -46,18 +48,51 @@ func CedarConfigStores(c *v1alpha1.CedarConfig) (TieredPolicyStores, error) {
 			}
 			cfg, err := config.LoadDefaultConfig(context.Background(), loadFuncs...)
 			if err != nil {
+				TieredPolicyStores(stores).Stop()
 				return nil, err
 			}
 
-			ps, err := NewVerifiedPermissionStore(
+			ps, err = NewVerifiedPermissionStore(
 				cfg,
 				storeDef.VerifiedPermissionsStore.PolicyStoreID,
 				time.Duration(*storeDef.VerifiedPermissionsStore.RefreshInterval),
 			)
 			if err != nil {
+				TieredPolicyStores(stores).Stop()
+				return nil, err
+			}
+		default:
+			// entity stores are loaded by CedarConfigEntityStores
+			continue
+		}
+		stores = append(stores, WithTierOptions(ps, TierOptions{
+			Combining: storeDef.Combining,
+			OnError:   storeDef.OnError,
+		}))
+	}
+	return stores, nil
+}
+
+// CedarConfigEntityStores returns the entity stores in the config, in tier order
+func CedarConfigEntityStores(c *v1alpha1.CedarConfig) (TieredEntityStores, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var stores []EntityStore
+	for _, storeDef := range c.Spec.Stores {
+		switch storeDef.Type {
+		case v1alpha1.StoreTypeEntityDirectory:
+			stores = append(stores, NewDirectoryEntityStore(
+				storeDef.DirectoryStore.Path,
+				time.Duration(*storeDef.DirectoryStore.RefreshInterval),
+			))
+		case v1alpha1.StoreTypeEntityCRD:
+			es, err := NewCRDEntityStore(storeDef.CRDStore.KubeconfigContext)
+			if err != nil {
+				TieredEntityStores(stores).Stop()
 				return nil, err
 			}
-			stores = append(stores, ps)
+			stores = append(stores, es)
 		}
 	}
 	return stores, nil
@@ -64,7 +64,8 @@ func TestConfigParse(t *testing.T) {
 						{
 							Type: v1alpha1.StoreTypeDirectory,
 							DirectoryStore: v1alpha1.DirectoryStoreConfig{
-								Path: "/cedar/provider-policies",
+								Path:            "/cedar/provider-policies",
+								RefreshInterval: DurationPtr(time.Minute),
 							},
 						},
 						{
@@ -88,12 +89,183 @@ func TestConfigParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:     "authorizer principal rules",
+			filename: "authorizer.yaml",
+			want: &v1alpha1.CedarConfig{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "StoreConfig",
+					APIVersion: "cedar.k8s.aws/v1alpha1",
+				},
+				Spec: v1alpha1.ConfigSpec{
+					Stores: []v1alpha1.StoreConfig{
+						{
+							Type: v1alpha1.StoreTypeCRD,
+						},
+					},
+					Authorizer: &v1alpha1.AuthorizerConfig{
+						PrincipalRules: []v1alpha1.PrincipalRule{
+							{
+								Users:  []string{"system:anonymous"},
+								Action: v1alpha1.PrincipalRuleActionEvaluate,
+							},
+							{
+								UserPrefixes: []string{"system:kube-scheduler"},
+								Action:       v1alpha1.PrincipalRuleActionEvaluate,
+							},
+							{
+								Groups: []string{"system:masters"},
+								Action: v1alpha1.PrincipalRuleActionAllow,
+								Reason: "cluster admins are always allowed",
+							},
+							{
+								UserPrefixes: []string{"system:"},
+								Action:       v1alpha1.PrincipalRuleActionNoOpinion,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "cluster metadata",
+			filename: "cluster_metadata.yaml",
+			want: &v1alpha1.CedarConfig{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "StoreConfig",
+					APIVersion: "cedar.k8s.aws/v1alpha1",
+				},
+				Spec: v1alpha1.ConfigSpec{
+					Stores: []v1alpha1.StoreConfig{
+						{
+							Type: v1alpha1.StoreTypeCRD,
+						},
+					},
+					ClusterMetadata: &v1alpha1.ClusterMetadataConfig{
+						Name:                   "prod-cluster-05",
+						Region:                 "us-west-2",
+						AccountID:              "111122223333",
+						Tags:                   map[string]string{"stage": "prod"},
+						VersionRefreshInterval: DurationPtr(time.Minute * 10),
+					},
+				},
+			},
+		},
+		{
+			name:     "entity stores",
+			filename: "entity_stores.yaml",
+			want: &v1alpha1.CedarConfig{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "StoreConfig",
+					APIVersion: "cedar.k8s.aws/v1alpha1",
+				},
+				Spec: v1alpha1.ConfigSpec{
+					Stores: []v1alpha1.StoreConfig{
+						{
+							Type: v1alpha1.StoreTypeEntityDirectory,
+							DirectoryStore: v1alpha1.DirectoryStoreConfig{
+								Path:            "/cedar/entities",
+								RefreshInterval: DurationPtr(time.Minute),
+							},
+						},
+						{
+							Type: v1alpha1.StoreTypeEntityCRD,
+						},
+						{
+							Type: v1alpha1.StoreTypeCRD,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "tier options",
+			filename: "tier_options.yaml",
+			want: &v1alpha1.CedarConfig{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "StoreConfig",
+					APIVersion: "cedar.k8s.aws/v1alpha1",
+				},
+				Spec: v1alpha1.ConfigSpec{
+					Stores: []v1alpha1.StoreConfig{
+						{
+							Type: v1alpha1.StoreTypeDirectory,
+							DirectoryStore: v1alpha1.DirectoryStoreConfig{
+								Path:            "/cedar/guardrails",
+								RefreshInterval: DurationPtr(time.Minute),
+							},
+							Combining: v1alpha1.CombiningForbidOnly,
+							OnError:   v1alpha1.OnErrorDeny,
+						},
+						{
+							Type: v1alpha1.StoreTypeDirectory,
+							DirectoryStore: v1alpha1.DirectoryStoreConfig{
+								Path:            "/cedar/policies",
+								RefreshInterval: DurationPtr(time.Minute),
+							},
+							Combining: v1alpha1.CombiningDenyOverrides,
+							OnError:   v1alpha1.OnErrorSkip,
+						},
+						{
+							Type: v1alpha1.StoreTypeCRD,
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "admission exclusions",
+			filename: "admission.yaml",
+			want: &v1alpha1.CedarConfig{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "StoreConfig",
+					APIVersion: "cedar.k8s.aws/v1alpha1",
+				},
+				Spec: v1alpha1.ConfigSpec{
+					Stores: []v1alpha1.StoreConfig{
+						{
+							Type: v1alpha1.StoreTypeCRD,
+						},
+					},
+					Admission: &v1alpha1.AdmissionConfig{
+						ExcludedNamespaces: []string{"cedar-k8s-authz-system", "monitoring"},
+						ExcludedNamespaceSelectors: []metav1.LabelSelector{
+							{MatchLabels: map[string]string{"platform.example.com/system": "true"}},
+						},
+						ExcludedResources: []v1alpha1.AdmissionResourceExclusion{
+							{Group: "coordination.k8s.io", Kind: "Lease"},
+							{Group: "", Version: "v1", Kind: "Event"},
+						},
+						ExcludedUsers:  []string{"system:kube-scheduler"},
+						ExcludedGroups: []string{"system:nodes"},
+					},
+				},
+			},
+		},
+		{
+			name:     "invalid admission exclusion",
+			filename: "invalid_admission.yaml",
+			want:     nil,
+			wantErr:  errors.New(".spec.admission: excludedResources[0]: kind is required"),
+		},
+		{
+			name:     "invalid principal rule",
+			filename: "invalid_principal_rule.yaml",
+			want:     nil,
+			wantErr:  errors.New(".spec.authorizer.principalRules[1]: principal rule must specify at least one of users, groups, or userPrefixes"),
+		},
 		{
 			name:     "invalid store",
 			filename: "invalid_type.yaml",
 			want:     nil,
 			wantErr:  errors.New(".spec.stores[3]: invalid store type"),
 		},
+		{
+			name:     "invalid combining",
+			filename: "invalid_combining.yaml",
+			want:     nil,
+			wantErr:  errors.New(`.spec.stores[0]: invalid store combining "permitOverrides"`),
+		},
 	}
 
 	for _, tc := range cases {
@@ -2,20 +2,21 @@ package store
 
 import (
 	"context"
-	"io/fs"
-	"os"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/clientconfig"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
 	"github.com/cedar-policy/cedar-go"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	uitlruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 )
@@ -37,12 +38,71 @@ type crdPolicyStore struct {
 	cache             cache.Cache
 
 	// a map of resource name to policyID names
-	policyNames map[string][]cedar.PolicyID
-	policies    *cedar.PolicySet
-	policiesMu  sync.RWMutex
+	policyNames   map[string][]cedar.PolicyID
+	policies      *cedar.PolicySet
+	auditPolicies *cedar.PolicySet
+	warnPolicies  *cedar.PolicySet
+	reasons       policyReasons
+	generation    uint64
+	policiesMu    sync.RWMutex
+
+	// a map of resource name to the error parsing its policies
+	loadErrors map[string]error
+	status     loadStatus
+	background
+}
+
+// policySetFor returns the policy set a policy from the given object belongs in.
+// All policies in an audit or warn Policy object are audit-only or warn,
+// otherwise the policy's own annotations are used.
+func (s *crdPolicyStore) policySetFor(obj *v1alpha1.Policy, policy *cedar.Policy) *cedar.PolicySet {
+	switch {
+	case obj.Spec.Enforcement == v1alpha1.EnforcementModeAudit || IsAuditPolicy(policy):
+		return s.auditPolicies
+	case obj.Spec.Enforcement == v1alpha1.EnforcementModeWarn || IsWarnPolicy(policy):
+		return s.warnPolicies
+	}
+	return s.policies
+}
+
+// crdPolicySource returns the source of the i-th policy in a Policy object
+func crdPolicySource(name string, i int) string {
+	return fmt.Sprintf("Policy %s, policy %d", name, i)
+}
+
+// setLoadError records or clears the parse error of a Policy object, and
+// updates the store's status. Must be called with policiesMu held.
+func (s *crdPolicyStore) setLoadError(start time.Time, name string, err error) {
+	if err != nil {
+		s.loadErrors[name] = fmt.Errorf("Policy %s: %w", name, err)
+	} else {
+		delete(s.loadErrors, name)
+	}
+	errs := make([]error, 0, len(s.loadErrors))
+	for _, name := range slices.Sorted(maps.Keys(s.loadErrors)) {
+		errs = append(errs, s.loadErrors[name])
+	}
+	if err != nil {
+		s.status.failed(start, errors.Join(errs...))
+		return
+	}
+	s.status.loaded(start, policyCount(s.policies, s.auditPolicies, s.warnPolicies), policyCount(s.auditPolicies), errors.Join(errs...))
+}
+
+// recordPropagation records the latency from a Policy's creation or last
+// update to when its policies were loaded
+func (s *crdPolicyStore) recordPropagation(obj *v1alpha1.Policy) {
+	changed := obj.CreationTimestamp.Time
+	for _, entry := range obj.ManagedFields {
+		if entry.Time != nil && entry.Time.After(changed) {
+			changed = entry.Time.Time
+		}
+	}
+	metrics.RecordE2ELatency(context.Background(), s.Name(), time.Since(changed).Seconds())
 }
 
 func (s *crdPolicyStore) OnAdd(rawObj interface{}, isInInitialList bool) {
+	start := time.Now()
 	obj := rawObj.(*v1alpha1.Policy)
 
 	s.policiesMu.Lock()
@@ -51,6 +111,7 @@ func (s *crdPolicyStore) OnAdd(rawObj interface{}, isInInitialList bool) {
 	pList, err := cedar.NewPolicyListFromBytes(obj.Name, []byte(obj.Spec.Content))
 	if err != nil {
 		klog.ErrorS(err, "Error parsing policy", "policy", obj.Name)
+		s.setLoadError(start, obj.Name, err)
 		return
 	}
 
@@ -59,12 +120,20 @@ func (s *crdPolicyStore) OnAdd(rawObj interface{}, isInInitialList bool) {
 		// Use UID for uniqeness to avoid naming collisions (ex: the 0th policy from "mypolicy1" could conflict with the 11th policy from "mypolicy")
 		pname := cedar.PolicyID(obj.Name + strconv.Itoa(i) + "-" + string(obj.UID))
 		policyNames = append(policyNames, pname)
-		s.policies.Add(pname, policy)
+		s.policySetFor(obj, policy).Add(pname, policy)
+		s.reasons.add(pname, crdPolicySource(obj.Name, i), policy)
 	}
 	s.policyNames[obj.Name] = policyNames
+	s.generation++
+	s.setLoadError(start, obj.Name, nil)
+	// policies in the initial list were created before the store started
+	if !isInInitialList {
+		s.recordPropagation(obj)
+	}
 }
 
 func (s *crdPolicyStore) OnUpdate(rawOldObj, rawNewObj interface{}) {
+	start := time.Now()
 	oldObj, ok := rawOldObj.(*v1alpha1.Policy)
 	if !ok {
 		klog.Error("Error updating old policy obj to Policy")
@@ -75,6 +144,11 @@ func (s *crdPolicyStore) OnUpdate(rawOldObj, rawNewObj interface{}) {
 		klog.Error("Error updating new policy obj to Policy")
 		return
 	}
+	// resyncs update with an unchanged object, which must not change the
+	// generation and invalidate cached decisions
+	if oldObj.ResourceVersion == newObj.ResourceVersion {
+		return
+	}
 
 	s.policiesMu.Lock()
 	defer s.policiesMu.Unlock()
@@ -83,6 +157,9 @@ func (s *crdPolicyStore) OnUpdate(rawOldObj, rawNewObj interface{}) {
 	if policyNames, ok := s.policyNames[oldObj.Name]; ok {
 		for _, name := range policyNames {
 			s.policies.Remove(name)
+			s.auditPolicies.Remove(name)
+			s.warnPolicies.Remove(name)
+			delete(s.reasons, name)
 		}
 		delete(s.policyNames, oldObj.Name)
 	}
@@ -91,6 +168,7 @@ func (s *crdPolicyStore) OnUpdate(rawOldObj, rawNewObj interface{}) {
 	pList, err := cedar.NewPolicyListFromBytes(newObj.Name, []byte(newObj.Spec.Content))
 	if err != nil {
 		klog.ErrorS(err, "Error parsing updated policy", "policy", newObj.Name)
+		s.setLoadError(start, newObj.Name, err)
 		return
 	}
 	policyNames := []cedar.PolicyID{}
@@ -99,12 +177,17 @@ func (s *crdPolicyStore) OnUpdate(rawOldObj, rawNewObj interface{}) {
 		// ex: the 0th policy from "mypolicy1" could conflict with the 11th policy from "mypolicy")
 		pname := cedar.PolicyID(newObj.Name + strconv.Itoa(i) + "-" + string(newObj.UID))
 		policyNames = append(policyNames, pname)
-		s.policies.Add(pname, policy)
+		s.policySetFor(newObj, policy).Add(pname, policy)
+		s.reasons.add(pname, crdPolicySource(newObj.Name, i), policy)
 	}
 	s.policyNames[newObj.Name] = policyNames
+	s.generation++
+	s.setLoadError(start, newObj.Name, nil)
+	s.recordPropagation(newObj)
 }
 
 func (s *crdPolicyStore) OnDelete(rawObj interface{}) {
+	start := time.Now()
 	obj := rawObj.(*v1alpha1.Policy)
 	s.policiesMu.Lock()
 	defer s.policiesMu.Unlock()
@@ -112,9 +195,14 @@ func (s *crdPolicyStore) OnDelete(rawObj interface{}) {
 	if policyNames, ok := s.policyNames[obj.Name]; ok {
 		for _, name := range policyNames {
 			s.policies.Remove(name)
+			s.auditPolicies.Remove(name)
+			s.warnPolicies.Remove(name)
+			delete(s.reasons, name)
 		}
 		delete(s.policyNames, obj.Name)
 	}
+	s.generation++
+	s.setLoadError(start, obj.Name, nil)
 }
 
 func (s *crdPolicyStore) InitalPolicyLoadComplete() bool {
@@ -123,68 +211,68 @@ func (s *crdPolicyStore) InitalPolicyLoadComplete() bool {
 	return s.initalPolicyLoadComplete
 }
 
+// populatePolicies starts the Policy informer cache, and completes the initial
+// load once it has synced. If the cache can't be started, the error is
+// recorded in the store's status and the initial load never completes.
 func (s *crdPolicyStore) populatePolicies() {
-	var config *rest.Config
-	var err error
-
-	if kubeconfigPath, ok := os.LookupEnv("KUBECONFIG"); ok {
-		for {
-			fi, err := fs.Stat(os.DirFS("/"), strings.TrimLeft(kubeconfigPath, "/"))
-			if err == nil {
-				klog.Infof("kubeconfig found at %s", kubeconfigPath)
-				if fi.Size() == 0 {
-					klog.Infof("kubeconfig is empty, waiting 5s for it to be populated")
-				} else {
-					break
-				}
-			} else {
-				klog.Infof("kubeconfig not yet found at '%s', waiting 5s for it to be created: %v", kubeconfigPath, err)
-			}
-			time.Sleep(5 * time.Second)
-		}
-		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath},
-			&clientcmd.ConfigOverrides{CurrentContext: s.kubeconfigContext}).ClientConfig()
-		if err != nil {
-			klog.Fatalf("Error building kubeconfig: %v", err)
-			return
-		}
-	} else {
-		klog.Infof("No kubeconfig found, using in-cluster config")
-		config, err = rest.InClusterConfig()
-		if err != nil {
-			klog.Fatalf("Error building in-cluster config: %v", err)
+	start := time.Now()
+	c, err := s.startCache()
+	if err != nil {
+		if s.stopped() {
+			klog.Infof("Policy store stopped before its cache synced")
 			return
 		}
+		klog.ErrorS(err, "Failed to start policy store cache")
+		s.status.failed(start, err)
+		return
+	}
+	s.initalPolicyLoadCompleteMu.Lock()
+	s.cache = c
+	s.initalPolicyLoadComplete = true
+	s.initalPolicyLoadCompleteMu.Unlock()
+	klog.Infof("Cache started")
+}
+
+// startCache starts a cache with an informer for Policy objects, and waits
+// for it to sync
+func (s *crdPolicyStore) startCache() (cache.Cache, error) {
+	config, err := clientconfig.Load(s.kubeconfigContext)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client config: %w", err)
 	}
 	c, err := cache.New(config, cache.Options{Scheme: scheme})
 	if err != nil {
-		klog.Fatalf("Error creating cache: %v", err)
-		return
+		return nil, fmt.Errorf("error creating cache: %w", err)
 	}
 
 	policy := v1alpha1.Policy{TypeMeta: metav1.TypeMeta{Kind: "Policy", APIVersion: v1alpha1.GroupVersion.String()}}
-	policyInformer, err := c.GetInformer(context.Background(), &policy)
+	policyInformer, err := c.GetInformer(s.ctx, &policy)
 	if err != nil {
-		klog.Fatalf("Error getting cedar policy informer")
+		return nil, fmt.Errorf("error getting cedar policy informer: %w", err)
 	}
-	_, err = policyInformer.AddEventHandler(s)
-	if err != nil {
-		klog.Fatalf("Error adding policy store event handler")
+	if _, err := policyInformer.AddEventHandler(s); err != nil {
+		return nil, fmt.Errorf("error adding policy store event handler: %w", err)
+	}
+	if err := startAndSync(s.ctx, c); err != nil {
+		return nil, fmt.Errorf("error syncing policy cache: %w", err)
 	}
+	return c, nil
+}
 
+// startAndSync starts a cache and waits for it to sync. It returns an error if
+// the cache fails to start, or ctx is done before it syncs.
+func startAndSync(ctx context.Context, c cache.Cache) error {
+	syncCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 	go func() {
-		err := c.Start(context.Background())
-		if err != nil {
-			klog.Fatalf("Error starting cache: %v", err)
-			return
+		if err := c.Start(ctx); err != nil {
+			cancel(fmt.Errorf("error starting cache: %w", err))
 		}
 	}()
-	s.initalPolicyLoadCompleteMu.Lock()
-	s.cache = c
-	s.initalPolicyLoadComplete = true
-	s.initalPolicyLoadCompleteMu.Unlock()
-	klog.Infof("Cache started")
+	if !c.WaitForCacheSync(syncCtx) {
+		return context.Cause(syncCtx)
+	}
+	return nil
 }
 
 func (s *crdPolicyStore) PolicySet() *cedar.PolicySet {
@@ -193,6 +281,35 @@ func (s *crdPolicyStore) PolicySet() *cedar.PolicySet {
 	return s.policies
 }
 
+func (s *crdPolicyStore) AuditPolicySet() *cedar.PolicySet {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.auditPolicies
+}
+
+func (s *crdPolicyStore) WarnPolicySet() *cedar.PolicySet {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.warnPolicies
+}
+
+func (s *crdPolicyStore) PolicyReason(id cedar.PolicyID) (PolicyReason, bool) {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	reason, ok := s.reasons[id]
+	return reason, ok
+}
+
+func (s *crdPolicyStore) Status() StoreStatus {
+	return s.status.get()
+}
+
+func (s *crdPolicyStore) Generation() uint64 {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.generation
+}
+
 func (s *crdPolicyStore) Name() string {
 	return "CRDPolicyStore"
 }
@@ -203,7 +320,13 @@ func NewCRDPolicyStore(kubeconfigContext string) (PolicyStore, error) {
 		initalPolicyLoadComplete: false,
 		policyNames:              map[string][]cedar.PolicyID{},
 		policies:                 cedar.NewPolicySet(),
+		auditPolicies:            cedar.NewPolicySet(),
+		warnPolicies:             cedar.NewPolicySet(),
+		reasons:                  policyReasons{},
+		loadErrors:               map[string]error{},
+		background:               newBackground(),
 	}
+	resp.status.store = resp.Name()
 	go resp.populatePolicies()
 	return resp, nil
 }
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/cedar-policy/cedar-go"
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCRDPolicyStoreResync(t *testing.T) {
+	s := &crdPolicyStore{
+		policyNames:   map[string][]cedar.PolicyID{},
+		policies:      cedar.NewPolicySet(),
+		auditPolicies: cedar.NewPolicySet(),
+		warnPolicies:  cedar.NewPolicySet(),
+		reasons:       policyReasons{},
+		loadErrors:    map[string]error{},
+	}
+	policy := &v1alpha1.Policy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy", UID: "1234", ResourceVersion: "1"},
+		Spec:       v1alpha1.PolicySpec{Content: `permit (principal, action, resource);`},
+	}
+	s.OnAdd(policy, true)
+	if got := s.Generation(); got != 1 {
+		t.Fatalf("Expected generation 1 after adding a policy, got %d", got)
+	}
+
+	// a resync updates with the unchanged object
+	s.OnUpdate(policy, policy.DeepCopy())
+	if got := s.Generation(); got != 1 {
+		t.Errorf("Expected a resync to keep generation 1, got %d", got)
+	}
+	if got := len(s.PolicySet().Map()); got != 1 {
+		t.Errorf("Expected a resync to keep the policy, got %d policies", got)
+	}
+
+	updated := policy.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Spec.Content = `forbid (principal, action, resource);`
+	s.OnUpdate(policy, updated)
+	if got := s.Generation(); got != 2 {
+		t.Errorf("Expected an update to increment the generation to 2, got %d", got)
+	}
+	if got := s.PolicySet().Map()["policy0-1234"]; got == nil || got.Effect() != cedar.Forbid {
+		t.Errorf("Expected the updated forbid policy, got %v", got)
+	}
+}
+
+func TestCRDEntityStoreResync(t *testing.T) {
+	s := &crdEntityStore{
+		entitySets: map[string]cedartypes.EntityMap{},
+		entities:   cedartypes.EntityMap{},
+	}
+	entitySet := &v1alpha1.EntitySet{
+		ObjectMeta: metav1.ObjectMeta{Name: "groups", ResourceVersion: "1"},
+		Spec:       v1alpha1.EntitySetSpec{Content: `[{"uid": {"type": "k8s::Group", "id": "admins"}, "attrs": {}, "parents": []}]`},
+	}
+	s.OnAdd(entitySet, true)
+	if got := s.Generation(); got != 1 {
+		t.Fatalf("Expected generation 1 after adding an entity set, got %d", got)
+	}
+
+	// a resync updates with the unchanged object
+	s.OnUpdate(entitySet, entitySet.DeepCopy())
+	if got := s.Generation(); got != 1 {
+		t.Errorf("Expected a resync to keep generation 1, got %d", got)
+	}
+
+	updated := entitySet.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Spec.Content = `[{"uid": {"type": "k8s::Group", "id": "developers"}, "attrs": {}, "parents": []}]`
+	s.OnUpdate(entitySet, updated)
+	if got := s.Generation(); got != 2 {
+		t.Errorf("Expected an update to increment the generation to 2, got %d", got)
+	}
+}
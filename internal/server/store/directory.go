@@ -1,6 +1,7 @@
 package store
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,7 +17,13 @@ type directoryPolicyStore struct {
 	directory       string
 	refreshInterval time.Duration
 	policies        *cedar.PolicySet
+	auditPolicies   *cedar.PolicySet
+	warnPolicies    *cedar.PolicySet
+	reasons         policyReasons
+	generation      uint64
 	policiesMu      sync.RWMutex
+	status          loadStatus
+	background
 }
 
 // NewDirectoryPolicyStore creates a PolicyStore
@@ -25,7 +32,9 @@ func NewDirectoryPolicyStore(directory string, refreshInterval time.Duration) Po
 	store := &directoryPolicyStore{
 		directory:       directory,
 		refreshInterval: refreshInterval,
+		background:      newBackground(),
 	}
+	store.status.store = store.Name()
 	store.loadPolicies()
 	go store.reloadAsync()
 	return store
@@ -33,22 +42,31 @@ func NewDirectoryPolicyStore(directory string, refreshInterval time.Duration) Po
 
 func (s *directoryPolicyStore) reloadAsync() {
 	ticker := time.NewTicker(s.refreshInterval)
-	for range ticker.C {
-		s.loadPolicies()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.loadPolicies()
+		}
 	}
 }
 
 func (s *directoryPolicyStore) loadPolicies() {
-
+	start := time.Now()
 	files, err := os.ReadDir(s.directory)
 	if err != nil {
 		klog.Errorf("Error reading policy directory: %v", err)
+		s.status.failed(start, err)
 		return
 	}
 
 	s.policiesMu.Lock()
 	defer s.policiesMu.Unlock()
 	policySet := cedar.NewPolicySet()
+	reasons := policyReasons{}
+	var loadErrors []error
 	for _, file := range files {
 		if file.IsDir() || !file.Type().IsRegular() {
 			klog.V(6).InfoS("Skipping non-regular or directory file", "file", file.Name())
@@ -63,22 +81,30 @@ func (s *directoryPolicyStore) loadPolicies() {
 		data, err := os.ReadFile(policySetFile)
 		if err != nil {
 			klog.Errorf("Error reading policy file: %v", err)
+			loadErrors = append(loadErrors, err)
 			continue
 		}
 
 		policySlice, err := cedar.NewPolicyListFromBytes(file.Name(), data)
 		if err != nil {
 			klog.Errorf("Error loading policy file: %v", err)
+			loadErrors = append(loadErrors, fmt.Errorf("error loading policy file %s: %w", policySetFile, err))
 			continue
 		}
 
 		for i, p := range policySlice {
 			policyID := cedar.PolicyID(fmt.Sprintf("%s.policy%d", file.Name(), i))
 			policySet.Add(policyID, p)
+			reasons.add(policyID, fmt.Sprintf("file %s, policy %d", policySetFile, i), p)
 		}
 	}
 
-	s.policies = policySet
+	enforced, audit, warn := SplitPolicySet(policySet)
+	if !policySetsEqual(s.policies, enforced) || !policySetsEqual(s.auditPolicies, audit) || !policySetsEqual(s.warnPolicies, warn) {
+		s.generation++
+	}
+	s.policies, s.auditPolicies, s.warnPolicies, s.reasons = enforced, audit, warn, reasons
+	s.status.loaded(start, policyCount(enforced, audit, warn), policyCount(audit), errors.Join(loadErrors...))
 }
 
 func (s *directoryPolicyStore) PolicySet() *cedar.PolicySet {
@@ -87,6 +113,35 @@ func (s *directoryPolicyStore) PolicySet() *cedar.PolicySet {
 	return s.policies
 }
 
+func (s *directoryPolicyStore) AuditPolicySet() *cedar.PolicySet {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.auditPolicies
+}
+
+func (s *directoryPolicyStore) WarnPolicySet() *cedar.PolicySet {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.warnPolicies
+}
+
+func (s *directoryPolicyStore) Generation() uint64 {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.generation
+}
+
+func (s *directoryPolicyStore) PolicyReason(id cedar.PolicyID) (PolicyReason, bool) {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	reason, ok := s.reasons[id]
+	return reason, ok
+}
+
+func (s *directoryPolicyStore) Status() StoreStatus {
+	return s.status.get()
+}
+
 func (s *directoryPolicyStore) InitalPolicyLoadComplete() bool {
 	return true
 }
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"github.com/cedar-policy/cedar-go"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+)
+
+const (
+	// EnforcementAnnotation is the policy annotation that sets a policy's
+	// enforcement mode, as one of the v1alpha1.EnforcementMode values
+	EnforcementAnnotation = "enforcement"
+
+	// EffectAnnotation is an alias for EnforcementAnnotation that only accepts
+	// the warn mode, as `@effect("warn")`
+	EffectAnnotation = "effect"
+)
+
+// IsAuditPolicy returns true if the policy is annotated with `@enforcement("audit")`
+func IsAuditPolicy(p *cedar.Policy) bool {
+	return p.Annotations()[EnforcementAnnotation] == v1alpha1.EnforcementModeAudit
+}
+
+// IsWarnPolicy returns true if the policy is annotated with `@effect("warn")`
+// or `@enforcement("warn")`
+func IsWarnPolicy(p *cedar.Policy) bool {
+	annotations := p.Annotations()
+	return annotations[EffectAnnotation] == v1alpha1.EnforcementModeWarn || annotations[EnforcementAnnotation] == v1alpha1.EnforcementModeWarn
+}
+
+// SplitPolicySet partitions a policy set into enforced, audit-only, and warn
+// policy sets. Audit takes precedence if a policy is annotated as both audit and warn.
+func SplitPolicySet(ps *cedar.PolicySet) (enforced, audit, warn *cedar.PolicySet) {
+	enforced, audit, warn = cedar.NewPolicySet(), cedar.NewPolicySet(), cedar.NewPolicySet()
+	if ps == nil {
+		return enforced, audit, warn
+	}
+	for id, p := range ps.Map() {
+		switch {
+		case IsAuditPolicy(p):
+			audit.Add(id, p)
+		case IsWarnPolicy(p):
+			warn.Add(id, p)
+		default:
+			enforced.Add(id, p)
+		}
+	}
+	return enforced, audit, warn
+}
+
+// DiagnosticPolicyIDs returns the policy IDs of all reasons in a diagnostic
+func DiagnosticPolicyIDs(diagnostic cedar.Diagnostic) []string {
+	resp := make([]string, 0, len(diagnostic.Reasons))
+	for _, reason := range diagnostic.Reasons {
+		resp = append(resp, string(reason.PolicyID))
+	}
+	return resp
+}
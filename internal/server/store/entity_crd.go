@@ -0,0 +1,200 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/clientconfig"
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+type crdEntityStore struct {
+	initalEntityLoadComplete   bool
+	initalEntityLoadCompleteMu sync.RWMutex
+
+	// kube context to use, if specified
+	kubeconfigContext string
+	cache             cache.Cache
+
+	// a map of EntitySet name to its entities
+	entitySets map[string]cedartypes.EntityMap
+	entities   cedartypes.EntityMap
+	generation uint64
+	entitiesMu sync.RWMutex
+	background
+}
+
+// setEntities replaces the entities of an EntitySet and rebuilds the merged entities.
+// Must be called with entitiesMu held.
+func (s *crdEntityStore) setEntities(name string, entities cedartypes.EntityMap) {
+	if entities == nil {
+		delete(s.entitySets, name)
+	} else {
+		s.entitySets[name] = entities
+	}
+	merged := cedartypes.EntityMap{}
+	for _, set := range s.entitySets {
+		for uid, entity := range set {
+			if existing, ok := merged[uid]; ok {
+				entity = MergeEntity(existing, entity)
+			}
+			merged[uid] = entity
+		}
+	}
+	s.entities = merged
+	s.generation++
+}
+
+func parseEntitySet(obj *v1alpha1.EntitySet) (cedartypes.EntityMap, error) {
+	entities := cedartypes.EntityMap{}
+	if err := entities.UnmarshalJSON([]byte(obj.Spec.Content)); err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+func (s *crdEntityStore) OnAdd(rawObj interface{}, isInInitialList bool) {
+	obj := rawObj.(*v1alpha1.EntitySet)
+
+	entities, err := parseEntitySet(obj)
+	if err != nil {
+		klog.ErrorS(err, "Error parsing entity set", "entitySet", obj.Name)
+		return
+	}
+
+	s.entitiesMu.Lock()
+	defer s.entitiesMu.Unlock()
+	s.setEntities(obj.Name, entities)
+}
+
+func (s *crdEntityStore) OnUpdate(rawOldObj, rawNewObj interface{}) {
+	oldObj, ok := rawOldObj.(*v1alpha1.EntitySet)
+	if !ok {
+		klog.Error("Error updating old entity set obj to EntitySet")
+		return
+	}
+	newObj, ok := rawNewObj.(*v1alpha1.EntitySet)
+	if !ok {
+		klog.Error("Error updating new entity set obj to EntitySet")
+		return
+	}
+	// resyncs update with an unchanged object, which must not change the
+	// generation and invalidate cached decisions
+	if oldObj.ResourceVersion == newObj.ResourceVersion {
+		return
+	}
+
+	s.entitiesMu.Lock()
+	defer s.entitiesMu.Unlock()
+
+	// clear out old entities, the updated entities are only added if they parse
+	delete(s.entitySets, oldObj.Name)
+	entities, err := parseEntitySet(newObj)
+	if err != nil {
+		klog.ErrorS(err, "Error parsing updated entity set", "entitySet", newObj.Name)
+	}
+	s.setEntities(newObj.Name, entities)
+}
+
+func (s *crdEntityStore) OnDelete(rawObj interface{}) {
+	obj, ok := rawObj.(*v1alpha1.EntitySet)
+	if !ok {
+		tombstone, ok := rawObj.(toolscache.DeletedFinalStateUnknown)
+		if !ok {
+			klog.Error("Error converting deleted obj to EntitySet")
+			return
+		}
+		if obj, ok = tombstone.Obj.(*v1alpha1.EntitySet); !ok {
+			klog.Error("Error converting deleted obj to EntitySet")
+			return
+		}
+	}
+	s.entitiesMu.Lock()
+	defer s.entitiesMu.Unlock()
+	s.setEntities(obj.Name, nil)
+}
+
+func (s *crdEntityStore) InitalEntityLoadComplete() bool {
+	s.initalEntityLoadCompleteMu.RLock()
+	defer s.initalEntityLoadCompleteMu.RUnlock()
+	return s.initalEntityLoadComplete
+}
+
+// populateEntities starts the EntitySet informer cache, and completes the
+// initial load once it has synced. If the cache can't be started, the error is
+// logged and the initial load never completes.
+func (s *crdEntityStore) populateEntities() {
+	c, err := s.startCache()
+	if err != nil {
+		if s.stopped() {
+			klog.Infof("Entity store stopped before its cache synced")
+			return
+		}
+		klog.ErrorS(err, "Failed to start entity store cache")
+		return
+	}
+	s.initalEntityLoadCompleteMu.Lock()
+	s.cache = c
+	s.initalEntityLoadComplete = true
+	s.initalEntityLoadCompleteMu.Unlock()
+	klog.Infof("Entity cache started")
+}
+
+// startCache starts a cache with an informer for EntitySet objects, and waits
+// for it to sync
+func (s *crdEntityStore) startCache() (cache.Cache, error) {
+	config, err := clientconfig.Load(s.kubeconfigContext)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client config: %w", err)
+	}
+	c, err := cache.New(config, cache.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache: %w", err)
+	}
+
+	entitySet := v1alpha1.EntitySet{TypeMeta: metav1.TypeMeta{Kind: "EntitySet", APIVersion: v1alpha1.GroupVersion.String()}}
+	entitySetInformer, err := c.GetInformer(s.ctx, &entitySet)
+	if err != nil {
+		return nil, fmt.Errorf("error getting cedar entity set informer: %w", err)
+	}
+	if _, err := entitySetInformer.AddEventHandler(s); err != nil {
+		return nil, fmt.Errorf("error adding entity store event handler: %w", err)
+	}
+	if err := startAndSync(s.ctx, c); err != nil {
+		return nil, fmt.Errorf("error syncing entity set cache: %w", err)
+	}
+	return c, nil
+}
+
+func (s *crdEntityStore) Entities() cedartypes.EntityMap {
+	s.entitiesMu.RLock()
+	defer s.entitiesMu.RUnlock()
+	return s.entities
+}
+
+func (s *crdEntityStore) Generation() uint64 {
+	s.entitiesMu.RLock()
+	defer s.entitiesMu.RUnlock()
+	return s.generation
+}
+
+func (s *crdEntityStore) Name() string {
+	return "CRDEntityStore"
+}
+
+// NewCRDEntityStore creates an EntityStore from EntitySet objects
+func NewCRDEntityStore(kubeconfigContext string) (EntityStore, error) {
+	resp := &crdEntityStore{
+		kubeconfigContext: kubeconfigContext,
+		entitySets:        map[string]cedartypes.EntityMap{},
+		entities:          cedartypes.EntityMap{},
+		background:        newBackground(),
+	}
+	go resp.populateEntities()
+	return resp, nil
+}
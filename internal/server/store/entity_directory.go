@@ -0,0 +1,111 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"k8s.io/klog/v2"
+)
+
+// directoryEntityStore loads Cedar entities JSON files from a directory
+type directoryEntityStore struct {
+	directory       string
+	refreshInterval time.Duration
+	entities        cedartypes.EntityMap
+	generation      uint64
+	entitiesMu      sync.RWMutex
+	background
+}
+
+// NewDirectoryEntityStore creates an EntityStore from the *.json Cedar entities files in a directory
+func NewDirectoryEntityStore(directory string, refreshInterval time.Duration) EntityStore {
+	store := &directoryEntityStore{
+		directory:       directory,
+		refreshInterval: refreshInterval,
+		entities:        cedartypes.EntityMap{},
+		background:      newBackground(),
+	}
+	store.loadEntities()
+	go store.reloadAsync()
+	return store
+}
+
+func (s *directoryEntityStore) reloadAsync() {
+	ticker := time.NewTicker(s.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.loadEntities()
+		}
+	}
+}
+
+func (s *directoryEntityStore) loadEntities() {
+	files, err := os.ReadDir(s.directory)
+	if err != nil {
+		klog.Errorf("Error reading entity directory: %v", err)
+		return
+	}
+
+	entities := cedartypes.EntityMap{}
+	for _, file := range files {
+		if file.IsDir() || !file.Type().IsRegular() {
+			klog.V(6).InfoS("Skipping non-regular or directory file", "file", file.Name())
+			continue
+		}
+		if filepath.Ext(file.Name()) != ".json" {
+			klog.V(6).InfoS("Skipping non-json file", "file", file.Name())
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.directory, file.Name()))
+		if err != nil {
+			klog.Errorf("Error reading entity file: %v", err)
+			continue
+		}
+		fileEntities := cedartypes.EntityMap{}
+		if err := fileEntities.UnmarshalJSON(data); err != nil {
+			klog.Errorf("Error loading entity file %s: %v", file.Name(), err)
+			continue
+		}
+		for uid, entity := range fileEntities {
+			if existing, ok := entities[uid]; ok {
+				entity = MergeEntity(existing, entity)
+			}
+			entities[uid] = entity
+		}
+	}
+
+	s.entitiesMu.Lock()
+	defer s.entitiesMu.Unlock()
+	if !entityMapsEqual(s.entities, entities) {
+		s.generation++
+	}
+	s.entities = entities
+}
+
+func (s *directoryEntityStore) Entities() cedartypes.EntityMap {
+	s.entitiesMu.RLock()
+	defer s.entitiesMu.RUnlock()
+	return s.entities
+}
+
+func (s *directoryEntityStore) Generation() uint64 {
+	s.entitiesMu.RLock()
+	defer s.entitiesMu.RUnlock()
+	return s.generation
+}
+
+func (s *directoryEntityStore) InitalEntityLoadComplete() bool {
+	return true
+}
+
+func (s *directoryEntityStore) Name() string {
+	return "FileEntityStore"
+}
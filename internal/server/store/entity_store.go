@@ -0,0 +1,199 @@
+package store
+
+import (
+	"bytes"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/schema"
+)
+
+// EntityStore is an interface for types that return Cedar entities, such as
+// nested groups or user attributes, that aren't derived from a request
+type EntityStore interface {
+	// InitalEntityLoadComplete signals if the store's entities are ready to be added to requests
+	InitalEntityLoadComplete() bool
+	// Entities returns the entities in the store
+	Entities() cedartypes.EntityMap
+	// Generation is incremented every time the store's entities change
+	Generation() uint64
+	Name() string
+}
+
+// entityMapsEqual returns true if both entity maps contain identical entities
+func entityMapsEqual(a, b cedartypes.EntityMap) bool {
+	aData, err := a.MarshalJSON()
+	if err != nil {
+		return false
+	}
+	bData, err := b.MarshalJSON()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
+
+// TieredEntityStores is a type for adding the entities of a set of entity
+// stores to requests. When multiple stores contain an entity, earlier stores
+// take precedence.
+type TieredEntityStores []EntityStore
+
+// Entity returns an entity merged from every store that contains it
+func (s TieredEntityStores) Entity(uid cedartypes.EntityUID) (cedartypes.Entity, bool) {
+	var (
+		resp  cedartypes.Entity
+		found bool
+	)
+	for _, store := range s {
+		entity, ok := store.Entities()[uid]
+		if !ok {
+			continue
+		}
+		if !found {
+			resp, found = entity, true
+			continue
+		}
+		resp = MergeEntity(resp, entity)
+	}
+	return resp, found
+}
+
+// Generations returns the generation of each store, in tier order
+func (s TieredEntityStores) Generations() []uint64 {
+	resp := make([]uint64, len(s))
+	for i, store := range s {
+		resp[i] = store.Generation()
+	}
+	return resp
+}
+
+// InitalEntityLoadComplete returns true once every store has completed its initial load
+func (s TieredEntityStores) InitalEntityLoadComplete() bool {
+	for _, store := range s {
+		if !store.InitalEntityLoadComplete() {
+			return false
+		}
+	}
+	return true
+}
+
+// AddToRequest merges stored entities into the entities of a request.
+//
+// Stored entities with the same UID as a request entity are merged into it,
+// and stored entities referenced by request entities, as a parent or in an
+// attribute, are added. Parents are merged transitively, so a group in a group
+// in a stored entity applies to the principal.
+//
+// Attributes and tags derived from the request take precedence over stored
+// attributes and tags with the same name, and parents are combined. A
+// k8s::User principal is merged with the stored user that has its UID, or if
+// there is none, with the stored user that has its username.
+func (s TieredEntityStores) AddToRequest(principalUID cedartypes.EntityUID, entities cedartypes.EntityMap) {
+	if len(s) == 0 {
+		return
+	}
+	queue := make([]cedartypes.EntityUID, 0, len(entities))
+	for uid := range entities {
+		queue = append(queue, uid)
+	}
+	visited := map[cedartypes.EntityUID]struct{}{}
+	for len(queue) > 0 {
+		uid := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[uid]; ok {
+			continue
+		}
+		visited[uid] = struct{}{}
+
+		stored, ok := s.Entity(uid)
+		if !ok && uid == principalUID {
+			stored, ok = s.userByName(entities[uid])
+		}
+		entity, inRequest := entities[uid]
+		switch {
+		case ok && inRequest:
+			entity = MergeEntity(entity, stored)
+		case ok:
+			entity = stored
+			entity.UID = uid
+		case !inRequest:
+			continue
+		}
+		entities[uid] = entity
+		queue = append(queue, referencedEntities(entity)...)
+	}
+}
+
+// userByName returns the stored k8s::User whose ID is the principal's username
+func (s TieredEntityStores) userByName(principal cedartypes.Entity) (cedartypes.Entity, bool) {
+	if principal.UID.Type != schema.UserEntityType {
+		return cedartypes.Entity{}, false
+	}
+	name, ok := principal.Attributes.Get("name")
+	if !ok {
+		return cedartypes.Entity{}, false
+	}
+	username, ok := name.(cedartypes.String)
+	if !ok || username == principal.UID.ID {
+		return cedartypes.Entity{}, false
+	}
+	return s.Entity(cedartypes.EntityUID{Type: schema.UserEntityType, ID: username})
+}
+
+// MergeEntity merges two entities with the same UID. Attributes and tags of
+// the first entity take precedence, and parents are combined.
+func MergeEntity(first, second cedartypes.Entity) cedartypes.Entity {
+	parents := []cedartypes.EntityUID{}
+	first.Parents.Iterate(func(uid cedartypes.EntityUID) bool {
+		parents = append(parents, uid)
+		return true
+	})
+	second.Parents.Iterate(func(uid cedartypes.EntityUID) bool {
+		parents = append(parents, uid)
+		return true
+	})
+	return cedartypes.Entity{
+		UID:        first.UID,
+		Parents:    cedartypes.NewEntityUIDSet(parents...),
+		Attributes: mergeRecords(first.Attributes, second.Attributes),
+		Tags:       mergeRecords(first.Tags, second.Tags),
+	}
+}
+
+// mergeRecords returns the keys of both records, preferring values in the first
+func mergeRecords(first, second cedartypes.Record) cedartypes.Record {
+	if second.Len() == 0 {
+		return first
+	}
+	resp := second.Map()
+	for k, v := range first.Map() {
+		resp[k] = v
+	}
+	return cedartypes.NewRecord(resp)
+}
+
+// referencedEntities returns the parents of an entity, and any entities in its attributes
+func referencedEntities(entity cedartypes.Entity) []cedartypes.EntityUID {
+	resp := []cedartypes.EntityUID{}
+	entity.Parents.Iterate(func(uid cedartypes.EntityUID) bool {
+		resp = append(resp, uid)
+		return true
+	})
+	return appendValueEntities(resp, entity.Attributes)
+}
+
+func appendValueEntities(uids []cedartypes.EntityUID, value cedartypes.Value) []cedartypes.EntityUID {
+	switch v := value.(type) {
+	case cedartypes.EntityUID:
+		uids = append(uids, v)
+	case cedartypes.Record:
+		for _, element := range v.Map() {
+			uids = appendValueEntities(uids, element)
+		}
+	case cedartypes.Set:
+		for _, element := range v.Slice() {
+			uids = appendValueEntities(uids, element)
+		}
+	}
+	return uids
+}
@@ -0,0 +1,162 @@
+package store_test
+
+import (
+	"testing"
+
+	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func NewEntityStore(document string) store.EntityStore {
+	es, err := store.NewMemoryEntityStore("in-memory-test-entities", []byte(document))
+	if err != nil {
+		panic(err)
+	}
+	return es
+}
+
+func TestTieredEntityStoresAddToRequest(t *testing.T) {
+	user := cedartypes.NewEntityUID("k8s::User", "uid-1234")
+	group := func(name string) cedartypes.EntityUID {
+		return cedartypes.NewEntityUID("k8s::Group", cedartypes.String(name))
+	}
+	requestEntities := func() cedartypes.EntityMap {
+		return cedartypes.EntityMap{
+			user: {
+				UID:     user,
+				Parents: cedartypes.NewEntityUIDSet(group("oncall")),
+				Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("alice"),
+				}),
+			},
+			group("oncall"): {
+				UID: group("oncall"),
+				Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+					"name": cedartypes.String("oncall"),
+				}),
+			},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		stores store.TieredEntityStores
+		want   cedartypes.EntityMap
+	}{
+		{
+			name:   "no stores",
+			stores: nil,
+			want:   requestEntities(),
+		},
+		{
+			name: "nested groups",
+			stores: store.TieredEntityStores{NewEntityStore(`[
+				{"uid": {"type": "k8s::Group", "id": "oncall"}, "parents": [{"type": "k8s::Group", "id": "sre"}], "attrs": {"name": "stored-oncall"}},
+				{"uid": {"type": "k8s::Group", "id": "sre"}, "parents": [{"type": "k8s::Group", "id": "engineering"}], "attrs": {"name": "sre"}},
+				{"uid": {"type": "k8s::Group", "id": "engineering"}, "parents": [], "attrs": {"name": "engineering"}},
+				{"uid": {"type": "k8s::Group", "id": "unrelated"}, "parents": [], "attrs": {"name": "unrelated"}}
+			]`)},
+			want: cedartypes.EntityMap{
+				user: requestEntities()[user],
+				group("oncall"): {
+					UID:     group("oncall"),
+					Parents: cedartypes.NewEntityUIDSet(group("sre")),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name": cedartypes.String("oncall"),
+					}),
+				},
+				group("sre"): {
+					UID:     group("sre"),
+					Parents: cedartypes.NewEntityUIDSet(group("engineering")),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name": cedartypes.String("sre"),
+					}),
+				},
+				group("engineering"): {
+					UID:     group("engineering"),
+					Parents: cedartypes.NewEntityUIDSet(),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name": cedartypes.String("engineering"),
+					}),
+				},
+			},
+		},
+		{
+			name: "user by username",
+			stores: store.TieredEntityStores{NewEntityStore(`[
+				{"uid": {"type": "k8s::User", "id": "alice"}, "parents": [{"type": "k8s::Group", "id": "admins"}], "attrs": {"name": "bob", "department": "sre"}}
+			]`)},
+			want: cedartypes.EntityMap{
+				user: {
+					UID:     user,
+					Parents: cedartypes.NewEntityUIDSet(group("oncall"), group("admins")),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name":       cedartypes.String("alice"),
+						"department": cedartypes.String("sre"),
+					}),
+				},
+				group("oncall"): requestEntities()[group("oncall")],
+			},
+		},
+		{
+			name: "user by uid before username",
+			stores: store.TieredEntityStores{NewEntityStore(`[
+				{"uid": {"type": "k8s::User", "id": "alice"}, "parents": [], "attrs": {"department": "sre"}},
+				{"uid": {"type": "k8s::User", "id": "uid-1234"}, "parents": [], "attrs": {"department": "security"}}
+			]`)},
+			want: cedartypes.EntityMap{
+				user: {
+					UID:     user,
+					Parents: cedartypes.NewEntityUIDSet(group("oncall")),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name":       cedartypes.String("alice"),
+						"department": cedartypes.String("security"),
+					}),
+				},
+				group("oncall"): requestEntities()[group("oncall")],
+			},
+		},
+		{
+			name: "earlier stores take precedence",
+			stores: store.TieredEntityStores{
+				NewEntityStore(`[
+					{"uid": {"type": "k8s::Group", "id": "oncall"}, "parents": [{"type": "k8s::Group", "id": "sre"}], "attrs": {"tier": "first"}}
+				]`),
+				NewEntityStore(`[
+					{"uid": {"type": "k8s::Group", "id": "oncall"}, "parents": [{"type": "k8s::Group", "id": "security"}], "attrs": {"tier": "second", "pager": "true"}}
+				]`),
+			},
+			want: cedartypes.EntityMap{
+				user: requestEntities()[user],
+				group("oncall"): {
+					UID:     group("oncall"),
+					Parents: cedartypes.NewEntityUIDSet(group("sre"), group("security")),
+					Attributes: cedartypes.NewRecord(cedartypes.RecordMap{
+						"name":  cedartypes.String("oncall"),
+						"tier":  cedartypes.String("first"),
+						"pager": cedartypes.String("true"),
+					}),
+				},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := requestEntities()
+			tc.stores.AddToRequest(user, got)
+			wantData, err := tc.want.MarshalJSON()
+			if err != nil {
+				t.Fatalf("Failed to marshal entities: %v", err)
+			}
+			gotData, err := got.MarshalJSON()
+			if err != nil {
+				t.Fatalf("Failed to marshal entities: %v", err)
+			}
+			if diff := cmp.Diff(string(wantData), string(gotData)); diff != "" {
+				t.Errorf("Didn't get same entities: %s", diff)
+			}
+		})
+	}
+}
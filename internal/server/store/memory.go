@@ -1,13 +1,21 @@
 package store
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/cedar-policy/cedar-go"
+	cedartypes "github.com/cedar-policy/cedar-go/types"
 )
 
 type memoryStore struct {
-	policies     *cedar.PolicySet
-	loadComplete bool
-	name         string
+	policies      *cedar.PolicySet
+	auditPolicies *cedar.PolicySet
+	warnPolicies  *cedar.PolicySet
+	reasons       policyReasons
+	loadComplete  bool
+	name          string
+	status        StoreStatus
 }
 
 // NewMemoryStore returns an in-memory PolicyStore that is immutable and always ready.
@@ -19,10 +27,23 @@ func NewMemoryStore(filename string, document []byte, loadComplete bool) (Policy
 	if err != nil {
 		return nil, err
 	}
+	reasons := policyReasons{}
+	for id, p := range policies.Map() {
+		reasons.add(id, fmt.Sprintf("%s, %s", filename, id), p)
+	}
+	enforced, audit, warn := SplitPolicySet(policies)
 	return &memoryStore{
-		policies:     policies,
-		loadComplete: loadComplete,
-		name:         filename,
+		policies:      enforced,
+		auditPolicies: audit,
+		warnPolicies:  warn,
+		reasons:       reasons,
+		loadComplete:  loadComplete,
+		name:          filename,
+		status: StoreStatus{
+			LastLoadTime:     time.Now(),
+			PolicyCount:      policyCount(enforced, audit, warn),
+			AuditPolicyCount: policyCount(audit),
+		},
 	}, nil
 }
 
@@ -30,6 +51,29 @@ func (s *memoryStore) PolicySet() *cedar.PolicySet {
 	return s.policies
 }
 
+func (s *memoryStore) AuditPolicySet() *cedar.PolicySet {
+	return s.auditPolicies
+}
+
+func (s *memoryStore) WarnPolicySet() *cedar.PolicySet {
+	return s.warnPolicies
+}
+
+func (s *memoryStore) PolicyReason(id cedar.PolicyID) (PolicyReason, bool) {
+	reason, ok := s.reasons[id]
+	return reason, ok
+}
+
+// Status returns the time the store was created, and its policy counts
+func (s *memoryStore) Status() StoreStatus {
+	return s.status
+}
+
+// Generation always returns 0, memory stores are immutable
+func (s *memoryStore) Generation() uint64 {
+	return 0
+}
+
 func (s *memoryStore) InitalPolicyLoadComplete() bool {
 	return s.loadComplete
 }
@@ -47,8 +91,65 @@ func (s StaticStore) PolicySet() *cedar.PolicySet {
 	return &ps
 }
 
+// AuditPolicySet returns an empty policy set, StaticStore policies are always enforced
+func (s StaticStore) AuditPolicySet() *cedar.PolicySet { return cedar.NewPolicySet() }
+
+// WarnPolicySet returns an empty policy set, StaticStore policies are always enforced
+func (s StaticStore) WarnPolicySet() *cedar.PolicySet { return cedar.NewPolicySet() }
+
+// Generation returns 0, StaticStore is immutable
+func (s StaticStore) Generation() uint64 { return 0 }
+
+// PolicyReason returns the policy ID as the source of a policy in the StaticStore
+func (s StaticStore) PolicyReason(id cedar.PolicyID) (PolicyReason, bool) {
+	ps := cedar.PolicySet(s)
+	p, ok := ps.Map()[id]
+	if !ok {
+		return PolicyReason{}, false
+	}
+	return PolicyReason{PolicyID: id, Source: fmt.Sprintf("StaticStore, %s", id), Message: PolicyMessage(p)}, true
+}
+
+// Status returns the policy count of the StaticStore, which is never loaded
+func (s StaticStore) Status() StoreStatus {
+	ps := cedar.PolicySet(s)
+	return StoreStatus{PolicyCount: policyCount(&ps)}
+}
+
 // Name returns the name "StaticStore"
 func (s StaticStore) Name() string { return "StaticStore" }
 
 // InitialPolicyLoadComplete returns true
 func (s StaticStore) InitalPolicyLoadComplete() bool { return true }
+
+type memoryEntityStore struct {
+	entities cedartypes.EntityMap
+	name     string
+}
+
+// NewMemoryEntityStore returns an in-memory EntityStore that is immutable and
+// always ready, from a Cedar entities JSON array
+func NewMemoryEntityStore(name string, document []byte) (EntityStore, error) {
+	entities := cedartypes.EntityMap{}
+	if err := entities.UnmarshalJSON(document); err != nil {
+		return nil, err
+	}
+	return &memoryEntityStore{entities: entities, name: name}, nil
+}
+
+func (s *memoryEntityStore) Entities() cedartypes.EntityMap {
+	return s.entities
+}
+
+// Generation always returns 0, memory stores are immutable
+func (s *memoryEntityStore) Generation() uint64 {
+	return 0
+}
+
+func (s *memoryEntityStore) InitalEntityLoadComplete() bool {
+	return true
+}
+
+func (s *memoryEntityStore) Name() string {
+	return s.name
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cedar-policy/cedar-go"
+)
+
+const (
+	// ReasonAnnotation is the policy annotation for a human-readable reason returned when the policy determines a decision
+	ReasonAnnotation = "reason"
+	// MessageAnnotation is an alias for ReasonAnnotation. ReasonAnnotation takes precedence if both are set.
+	MessageAnnotation = "message"
+)
+
+// PolicyReason describes a policy that determined a decision
+type PolicyReason struct {
+	PolicyID cedar.PolicyID
+	// Source is where the policy was loaded from, such as a file path and index
+	Source string
+	// Message is the policy's reason annotation, if any
+	Message string
+}
+
+// String returns the reason message followed by the policy source, or just the
+// policy source if the policy has no reason annotation
+func (r PolicyReason) String() string {
+	if r.Message == "" {
+		return r.Source
+	}
+	return fmt.Sprintf("%s (%s)", r.Message, r.Source)
+}
+
+// PolicyMessage returns the reason annotation of a policy
+func PolicyMessage(p *cedar.Policy) string {
+	annotations := p.Annotations()
+	if reason, ok := annotations[ReasonAnnotation]; ok {
+		return string(reason)
+	}
+	return string(annotations[MessageAnnotation])
+}
+
+// policyReasons is a map of policy IDs to the reason for each policy, used
+// by stores to look up policies without copying their policy sets
+type policyReasons map[cedar.PolicyID]PolicyReason
+
+// add records the source and message of a policy
+func (r policyReasons) add(id cedar.PolicyID, source string, p *cedar.Policy) {
+	r[id] = PolicyReason{PolicyID: id, Source: source, Message: PolicyMessage(p)}
+}
+
+// TieredDiagnostic is the diagnostic of a decision of TieredPolicyStores, with
+// the tiers its policies are in. Policy IDs are only unique within a store, so
+// reasons and errors are resolved in the store they came from.
+type TieredDiagnostic struct {
+	cedar.Diagnostic
+	// Tier is the index of the store whose policies determined the decision,
+	// or -1 if no store did
+	Tier int
+	// ErrorTiers is the index of the store of each error in Errors
+	ErrorTiers []int
+}
+
+// DecidingTier returns the index of the store containing the policies that
+// determined the decision, or -1 if no policy did
+func (d TieredDiagnostic) DecidingTier() int {
+	if len(d.Reasons) == 0 {
+		return -1
+	}
+	return d.Tier
+}
+
+// policyReason looks up a policy in the store at index tier, and returns its
+// source and message
+func (s TieredPolicyStores) policyReason(tier int, id cedar.PolicyID) PolicyReason {
+	if store := s.tier(tier); store != nil {
+		if reason, ok := store.PolicyReason(id); ok {
+			return reason
+		}
+	}
+	return PolicyReason{PolicyID: id, Source: fmt.Sprintf("policy %s", id)}
+}
+
+// Reasons resolves the policies that determined a decision to their sources and messages
+func (s TieredPolicyStores) Reasons(diagnostic TieredDiagnostic) []PolicyReason {
+	resp := make([]PolicyReason, 0, len(diagnostic.Reasons))
+	for _, reason := range diagnostic.Reasons {
+		resp = append(resp, s.policyReason(diagnostic.Tier, reason.PolicyID))
+	}
+	return resp
+}
+
+// DecidingStore returns the name of the store containing the policies that
+// determined a decision, or an empty string if none did
+func (s TieredPolicyStores) DecidingStore(diagnostic TieredDiagnostic) string {
+	if store := s.tier(diagnostic.DecidingTier()); store != nil {
+		return store.Name()
+	}
+	return ""
+}
+
+// ReasonString returns a human-readable description of the policies that
+// determined a decision, or an empty string if none did
+func (s TieredPolicyStores) ReasonString(diagnostic TieredDiagnostic) string {
+	reasons := s.Reasons(diagnostic)
+	messages := make([]string, len(reasons))
+	for i, reason := range reasons {
+		messages[i] = reason.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ErrorString returns a description of each policy evaluation error and the
+// source of the policy, or an empty string if there were no errors
+func (s TieredPolicyStores) ErrorString(diagnostic TieredDiagnostic) string {
+	messages := make([]string, len(diagnostic.Errors))
+	for i, diagnosticError := range diagnostic.Errors {
+		tier := -1
+		if i < len(diagnostic.ErrorTiers) {
+			tier = diagnostic.ErrorTiers[i]
+		}
+		messages[i] = fmt.Sprintf("%s: %s", s.policyReason(tier, diagnosticError.PolicyID).Source, diagnosticError.Message)
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,125 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func TestReasons(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "forbid.cedar"), []byte(`
+forbid (principal, action, resource) when { resource.name == "cm1" };
+
+@reason("configmaps can't be deleted")
+forbid (principal, action, resource) when { resource.resource == "configmaps" };
+`), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	directoryStore := store.NewDirectoryPolicyStore(dir, time.Hour)
+
+	// a later tier loading a file of the same name has the same policy IDs
+	otherDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(otherDir, "forbid.cedar"), []byte(`
+forbid (principal, action, resource) when { resource.name == "cm2" };
+
+@reason("secrets can't be deleted")
+forbid (principal, action, resource) when { resource.resource == "secrets" };
+`), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	otherDirectoryStore := store.NewDirectoryPolicyStore(otherDir, time.Hour)
+
+	allowAll := cedar.NewPolicySet()
+	policy := &cedar.Policy{}
+	if err := policy.UnmarshalCedar([]byte(`@message("always allowed") permit (principal, action, resource);`)); err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+	allowAll.Add("allow-all", policy)
+
+	stores := store.TieredPolicyStores{directoryStore, otherDirectoryStore, store.StaticStore(*allowAll)}
+	cases := []struct {
+		name       string
+		diagnostic store.TieredDiagnostic
+		wantReason string
+		wantError  string
+		wantStore  string
+		wantTier   int
+	}{
+		{
+			name:       "no reasons",
+			diagnostic: store.TieredDiagnostic{Tier: -1},
+			wantTier:   -1,
+		},
+		{
+			name: "file policies",
+			diagnostic: store.TieredDiagnostic{Diagnostic: cedar.Diagnostic{Reasons: []cedar.DiagnosticReason{
+				{PolicyID: "forbid.cedar.policy0"},
+				{PolicyID: "forbid.cedar.policy1"},
+			}}, Tier: 0},
+			wantReason: "file " + filepath.Join(dir, "forbid.cedar") + ", policy 0; configmaps can't be deleted (file " + filepath.Join(dir, "forbid.cedar") + ", policy 1)",
+			wantStore:  "FilePolicyStore",
+			wantTier:   0,
+		},
+		{
+			name: "same policy ID in a later tier",
+			diagnostic: store.TieredDiagnostic{Diagnostic: cedar.Diagnostic{Reasons: []cedar.DiagnosticReason{
+				{PolicyID: "forbid.cedar.policy1"},
+			}}, Tier: 1},
+			wantReason: "secrets can't be deleted (file " + filepath.Join(otherDir, "forbid.cedar") + ", policy 1)",
+			wantStore:  "FilePolicyStore",
+			wantTier:   1,
+		},
+		{
+			name: "later tier",
+			diagnostic: store.TieredDiagnostic{Diagnostic: cedar.Diagnostic{Reasons: []cedar.DiagnosticReason{
+				{PolicyID: "allow-all"},
+			}}, Tier: 2},
+			wantReason: "always allowed (StaticStore, allow-all)",
+			wantStore:  "StaticStore",
+			wantTier:   2,
+		},
+		{
+			name: "unknown policy",
+			diagnostic: store.TieredDiagnostic{Diagnostic: cedar.Diagnostic{Reasons: []cedar.DiagnosticReason{
+				{PolicyID: "unknown"},
+			}}, Tier: 0},
+			wantReason: "policy unknown",
+			wantStore:  "FilePolicyStore",
+			wantTier:   0,
+		},
+		{
+			name: "errors",
+			diagnostic: store.TieredDiagnostic{Diagnostic: cedar.Diagnostic{Errors: []cedar.DiagnosticError{
+				{PolicyID: "forbid.cedar.policy0", Message: "attribute not found"},
+				{PolicyID: "forbid.cedar.policy0", Message: "type error"},
+			}}, Tier: -1, ErrorTiers: []int{0, 1}},
+			wantError: "file " + filepath.Join(dir, "forbid.cedar") + ", policy 0: attribute not found; file " + filepath.Join(otherDir, "forbid.cedar") + ", policy 0: type error",
+			wantTier:  -1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.wantReason, stores.ReasonString(tc.diagnostic)); diff != "" {
+				t.Errorf("Didn't get same reason: %s", diff)
+			}
+			if diff := cmp.Diff(tc.wantError, stores.ErrorString(tc.diagnostic)); diff != "" {
+				t.Errorf("Didn't get same error: %s", diff)
+			}
+			if got := tc.diagnostic.DecidingTier(); got != tc.wantTier {
+				t.Errorf("DecidingTier() = %d, want %d", got, tc.wantTier)
+			}
+			if got := stores.DecidingStore(tc.diagnostic); got != tc.wantStore {
+				t.Errorf("DecidingStore() = %q, want %q", got, tc.wantStore)
+			}
+		})
+	}
+}
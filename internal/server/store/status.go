@@ -0,0 +1,146 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/cedar-policy/cedar-go"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
+)
+
+// StoreStatus describes the most recent policy load of a store
+type StoreStatus struct {
+	// LastLoadTime is when policies were last loaded. It is zero until the
+	// first load, and for stores that never load policies.
+	LastLoadTime time.Time
+	// LastError is the error of the most recent load, if any. A store can
+	// have an error and still have loaded some policies.
+	LastError error
+	// PolicyCount is the number of enforced and audit policies in the store
+	PolicyCount int
+	// AuditPolicyCount is the number of audit policies in the store, which
+	// are also counted in PolicyCount
+	AuditPolicyCount int
+}
+
+// loadStatus records the result of each policy load in a store, and is safe
+// for concurrent use
+type loadStatus struct {
+	// store is the name of the store in metrics
+	store  string
+	mu     sync.RWMutex
+	status StoreStatus
+}
+
+// loaded records a load of policyCount policies, auditPolicyCount of which are
+// audit policies, that started at start. err is any error for policies that
+// couldn't be loaded, or nil.
+func (s *loadStatus) loaded(start time.Time, policyCount, auditPolicyCount int, err error) {
+	metrics.RecordStoreReload(s.store, time.Since(start).Seconds(), err != nil)
+	metrics.RecordStorePolicies(s.store, policyCount)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = StoreStatus{LastLoadTime: time.Now(), LastError: err, PolicyCount: policyCount, AuditPolicyCount: auditPolicyCount}
+}
+
+// failed records a load that started at start and failed without changing the
+// store's policies
+func (s *loadStatus) failed(start time.Time, err error) {
+	metrics.RecordStoreReload(s.store, time.Since(start).Seconds(), true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastError = err
+}
+
+func (s *loadStatus) get() StoreStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// policyCount returns the number of policies in each policy set
+func policyCount(policySets ...*cedar.PolicySet) int {
+	resp := 0
+	for _, ps := range policySets {
+		if ps != nil {
+			resp += len(ps.Map())
+		}
+	}
+	return resp
+}
+
+// TierStatus is the status of a policy store tier
+type TierStatus struct {
+	Name       string `json:"name"`
+	Ready      bool   `json:"ready"`
+	Generation uint64 `json:"generation"`
+	// PolicySetHash is a SHA-256 hash of the store's enforced and audit
+	// policies. Replicas with the same hash for a tier enforce the same policies.
+	PolicySetHash string     `json:"policySetHash"`
+	PolicyCount   int        `json:"policyCount"`
+	LastLoadTime  *time.Time `json:"lastLoadTime,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+// Statuses returns the status of each store, in tier order
+func (s TieredPolicyStores) Statuses() []TierStatus {
+	resp := make([]TierStatus, len(s))
+	for i, store := range s {
+		status := store.Status()
+		resp[i] = TierStatus{
+			Name:          store.Name(),
+			Ready:         store.InitalPolicyLoadComplete(),
+			Generation:    store.Generation(),
+			PolicySetHash: PolicySetHash(store),
+			PolicyCount:   status.PolicyCount,
+		}
+		if !status.LastLoadTime.IsZero() {
+			resp[i].LastLoadTime = &status.LastLoadTime
+		}
+		if status.LastError != nil {
+			resp[i].LastError = status.LastError.Error()
+		}
+	}
+	return resp
+}
+
+// PolicySetHash returns a hex encoded SHA-256 hash of a store's enforced,
+// audit, and warn policies, including their policy IDs
+func PolicySetHash(store PolicyStore) string {
+	hash := sha256.New()
+	for _, ps := range []*cedar.PolicySet{store.PolicySet(), store.AuditPolicySet(), store.WarnPolicySet()} {
+		if ps == nil {
+			ps = cedar.NewPolicySet()
+		}
+		// policy sets marshal with sorted policy IDs, so equal sets have equal hashes
+		data, err := ps.MarshalJSON()
+		if err != nil {
+			return ""
+		}
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// EntityStoreStatus is the status of an entity store
+type EntityStoreStatus struct {
+	Name       string `json:"name"`
+	Ready      bool   `json:"ready"`
+	Generation uint64 `json:"generation"`
+}
+
+// Statuses returns the status of each entity store, in order
+func (s TieredEntityStores) Statuses() []EntityStoreStatus {
+	resp := make([]EntityStoreStatus, len(s))
+	for i, store := range s {
+		resp[i] = EntityStoreStatus{
+			Name:       store.Name(),
+			Ready:      store.InitalEntityLoadComplete(),
+			Generation: store.Generation(),
+		}
+	}
+	return resp
+}
@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func TestStatuses(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "valid.cedar"), []byte(`
+permit (principal, action, resource);
+
+@enforcement("audit")
+forbid (principal, action, resource);
+`), 0o600); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "invalid.cedar"), []byte(`permit (principal, action, resource`), 0o600); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	directoryStore := store.NewDirectoryPolicyStore(dir, time.Hour)
+	memoryStore := NewStoreFromPolicy(`permit (principal, action, resource);`)
+
+	statuses := store.TieredPolicyStores{directoryStore, memoryStore}.Statuses()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 statuses, got %d", len(statuses))
+	}
+
+	directoryStatus := statuses[0]
+	if directoryStatus.Name != "FilePolicyStore" || !directoryStatus.Ready {
+		t.Errorf("Unexpected directory store status: %+v", directoryStatus)
+	}
+	if directoryStatus.PolicyCount != 2 {
+		t.Errorf("Expected 2 directory store policies, got %d", directoryStatus.PolicyCount)
+	}
+	if got := directoryStore.Status().AuditPolicyCount; got != 1 {
+		t.Errorf("Expected 1 directory store audit policy, got %d", got)
+	}
+	if directoryStatus.LastLoadTime == nil {
+		t.Error("Expected directory store to have a load time")
+	}
+	if !strings.Contains(directoryStatus.LastError, "invalid.cedar") {
+		t.Errorf("Expected directory store error for invalid.cedar, got %q", directoryStatus.LastError)
+	}
+
+	memoryStatus := statuses[1]
+	if memoryStatus.PolicyCount != 1 || memoryStatus.LastError != "" {
+		t.Errorf("Unexpected memory store status: %+v", memoryStatus)
+	}
+	if got := memoryStore.Status().AuditPolicyCount; got != 0 {
+		t.Errorf("Expected no memory store audit policies, got %d", got)
+	}
+	if memoryStatus.PolicySetHash == directoryStatus.PolicySetHash {
+		t.Error("Expected stores with different policies to have different hashes")
+	}
+	if got := store.PolicySetHash(NewStoreFromPolicy(`permit (principal, action, resource);`)); got != memoryStatus.PolicySetHash {
+		t.Errorf("Expected stores with the same policies to have the same hash, got %s and %s", got, memoryStatus.PolicySetHash)
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+)
+
+// Stopper is implemented by stores that load policies or entities in the background
+type Stopper interface {
+	// Stop ends the store's background loading. The store keeps serving the
+	// policies or entities it last loaded.
+	Stop()
+}
+
+// background is embedded in stores to stop their background goroutines
+type background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newBackground() background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return background{ctx: ctx, cancel: cancel}
+}
+
+// Stop cancels the store's context, ending its background goroutines
+func (b *background) Stop() {
+	b.cancel()
+}
+
+// stopped returns true once Stop has been called
+func (b *background) stopped() bool {
+	return b.ctx.Err() != nil
+}
+
+// stop stops a store if it loads in the background
+func stop(store any) {
+	if s, ok := store.(Stopper); ok {
+		s.Stop()
+	}
+}
+
+// Stop ends the background loading of a tier's store
+func (t *tierStore) Stop() {
+	stop(t.PolicyStore)
+}
+
+// Stop ends the background loading of every store
+func (s TieredPolicyStores) Stop() {
+	for _, store := range s {
+		stop(store)
+	}
+}
+
+// Stop ends the background loading of every store
+func (s TieredEntityStores) Stop() {
+	for _, store := range s {
+		stop(store)
+	}
+}
@@ -0,0 +1,41 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func TestStop(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy := func(policy string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "policy.cedar"), []byte(policy), 0o600); err != nil {
+			t.Fatalf("Failed to write policy file: %v", err)
+		}
+	}
+	writePolicy(`permit (principal, action, resource);`)
+	directoryStore := store.NewDirectoryPolicyStore(dir, 10*time.Millisecond)
+	stores := store.TieredPolicyStores{
+		store.WithTierOptions(directoryStore, store.TierOptions{Combining: "denyOverrides"}),
+		NewStoreFromPolicy(`permit (principal, action, resource);`),
+	}
+
+	// stopping a tier stops its store, and stores without background loading are skipped
+	stores.Stop()
+	// wait for any reload in progress when the store was stopped
+	time.Sleep(50 * time.Millisecond)
+	generation := directoryStore.Generation()
+
+	writePolicy(`forbid (principal, action, resource);`)
+	time.Sleep(100 * time.Millisecond)
+	if got := directoryStore.Generation(); got != generation {
+		t.Errorf("Expected a stopped store to keep generation %d, got %d", generation, got)
+	}
+	if got := len(directoryStore.PolicySet().Map()); got != 1 {
+		t.Errorf("Expected a stopped store to keep its policies, got %d policies", got)
+	}
+}
@@ -1,8 +1,19 @@
 package store
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
 	"github.com/cedar-policy/cedar-go"
 	cedartypes "github.com/cedar-policy/cedar-go/types"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/metrics"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 )
 
 // PolicyStore is an interface for types that return a cedar.PolicySet
@@ -10,33 +21,344 @@ type PolicyStore interface {
 	// InitalPolicyLoadComplete signals if authorizer is ready to authorize requests
 	// While this is false, the authorizer will emit an authorizer.NoOpinion until its ready
 	InitalPolicyLoadComplete() bool
+	// PolicySet returns the enforced policies in the store
 	PolicySet() *cedar.PolicySet
+	// AuditPolicySet returns the audit-only policies in the store. These never
+	// change a decision.
+	AuditPolicySet() *cedar.PolicySet
+	// WarnPolicySet returns the warn policies in the store. These never change
+	// a decision, and are only evaluated for admission warnings.
+	WarnPolicySet() *cedar.PolicySet
+	// Generation is incremented every time the store's policies change
+	Generation() uint64
+	// PolicyReason returns the source and reason annotation of an enforced,
+	// audit, or warn policy, and false if the policy isn't in the store
+	PolicyReason(cedar.PolicyID) (PolicyReason, bool)
+	// Status returns the result of the store's most recent policy load
+	Status() StoreStatus
 	Name() string
 }
 
+// policySetsEqual returns true if both policy sets contain identical policies and policy IDs
+func policySetsEqual(a, b *cedar.PolicySet) bool {
+	if a == nil {
+		a = cedar.NewPolicySet()
+	}
+	if b == nil {
+		b = cedar.NewPolicySet()
+	}
+	aData, err := a.MarshalJSON()
+	if err != nil {
+		return false
+	}
+	bData, err := b.MarshalJSON()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aData, bData)
+}
+
 // TieredPolicyStores is a type for checking if a cedar request is authorized
 // in a given set of policy stores, returning any explicit decision in a policy store
 // before a default deny in the final PolicyStore
 type TieredPolicyStores []PolicyStore
 
-// IsAuthorized returns looks for an explicit decision in each policy store, first to last.
-// If there is no explicit decision, it checks the subsequent policy store. If no explicit
-// policies are identified in the last store, that store's decision (forbid) is returned.
-func (s TieredPolicyStores) IsAuthorized(entities cedartypes.EntityMap, req cedar.Request) (cedar.Decision, cedar.Diagnostic) {
+// IsAuthorized looks for an explicit decision in each policy store, first to last.
+//
+// A forbid policy in any tier denies the request. A permit policy allows the
+// request, unless the tier's combining algorithm is denyOverrides, where later
+// tiers are still evaluated for forbid policies, or forbidOnly, where permit
+// policies are ignored. If no policy applies in any tier, Deny is returned
+// with no reasons.
+//
+// When policies in a tier have errors, the tier's onError mode sets if the
+// errors are skipped, deny the request with the policies with errors as
+// reasons, or stop evaluation at that tier. Errors from every evaluated tier
+// are returned in the diagnostic.
+//
+// The diagnostic includes the index of the tier that decided the request,
+// which is used to resolve its policies with Reasons.
+//
+// The context is checked before each tier is evaluated, and its error is
+// returned if it is done before a decision is made.
+func (s TieredPolicyStores) IsAuthorized(ctx context.Context, entities cedartypes.EntityMap, req cedar.Request) (cedar.Decision, TieredDiagnostic, error) {
+	ctx, span := tracing.Start(ctx, "IsAuthorized")
+	defer span.End()
+	decision, diagnostic, err := s.combineTiers(ctx, func(_ int, store PolicyStore, options TierOptions) (cedar.Decision, cedar.Diagnostic) {
+		return evaluateTier(ctx, store, options, entities, req)
+	})
+	if err != nil {
+		return decision, diagnostic, err
+	}
+	recordDecision(ctx, s.tier(diagnostic.Tier), decision, diagnostic.Reasons)
+	return decision, diagnostic, nil
+}
+
+// combineTiers combines the decision evaluate returns for each store, first
+// to last, as described by IsAuthorized. It returns the decision, and a
+// diagnostic with the index of the store that made it, or -1 if no store did.
+func (s TieredPolicyStores) combineTiers(ctx context.Context, evaluate func(int, PolicyStore, TierOptions) (cedar.Decision, cedar.Diagnostic)) (cedar.Decision, TieredDiagnostic, error) {
 	var (
-		decision   cedar.Decision = cedar.Deny
-		diagnostic cedar.Diagnostic
+		errors     []cedar.DiagnosticError
+		errorTiers []int
+		// reasons of a permit in a denyOverrides tier, which a later forbid can override
+		allowReasons []cedar.DiagnosticReason
+		allowTier    = -1
 	)
+	result := func(tier int, decision cedar.Decision, reasons []cedar.DiagnosticReason) (cedar.Decision, TieredDiagnostic, error) {
+		return decision, TieredDiagnostic{
+			Diagnostic: cedar.Diagnostic{Reasons: reasons, Errors: errors},
+			Tier:       tier,
+			ErrorTiers: errorTiers,
+		}, nil
+	}
 	for i, store := range s {
-		decision, diagnostic = store.PolicySet().IsAuthorized(entities, req)
-		if len(s)-1 == i {
-			break
+		if err := ctx.Err(); err != nil {
+			return cedar.Deny, TieredDiagnostic{Diagnostic: cedar.Diagnostic{Errors: errors}, Tier: -1, ErrorTiers: errorTiers}, fmt.Errorf("evaluation stopped before policy store %s: %w", store.Name(), err)
+		}
+		options := TierOptionsOf(store)
+		decision, diagnostic := evaluate(i, store, options)
+		errors = append(errors, diagnostic.Errors...)
+		for range diagnostic.Errors {
+			errorTiers = append(errorTiers, i)
 		}
 
-		if decision == cedar.Deny && len(diagnostic.Reasons) == 0 && len(diagnostic.Errors) == 0 {
+		if len(diagnostic.Errors) > 0 {
+			switch options.OnError {
+			case v1alpha1.OnErrorDeny:
+				return result(i, cedar.Deny, errorReasons(diagnostic.Errors))
+			case v1alpha1.OnErrorNoOpinion:
+				return result(i, decision, diagnostic.Reasons)
+			}
+		}
+		if len(diagnostic.Reasons) == 0 {
 			continue
 		}
-		break
+		if decision == cedar.Allow && options.Combining == v1alpha1.CombiningDenyOverrides {
+			if allowReasons == nil {
+				allowReasons, allowTier = diagnostic.Reasons, i
+			}
+			continue
+		}
+		return result(i, decision, diagnostic.Reasons)
+	}
+	if allowReasons != nil {
+		return result(allowTier, cedar.Allow, allowReasons)
+	}
+	return result(-1, cedar.Deny, nil)
+}
+
+// tier returns the store at index i, or nil if i isn't a store's index
+func (s TieredPolicyStores) tier(i int) PolicyStore {
+	if i < 0 || i >= len(s) {
+		return nil
+	}
+	return s[i]
+}
+
+// TierEvaluation is the result of evaluating the enforced policies of a single store
+type TierEvaluation struct {
+	Store   PolicyStore
+	Options TierOptions
+	// Reached is false for stores after the store that decided the request,
+	// whose decisions didn't affect the result
+	Reached    bool
+	Decision   cedar.Decision
+	Diagnostic cedar.Diagnostic
+}
+
+// Evaluation is a decision, with the result of evaluating each store
+type Evaluation struct {
+	Decision   cedar.Decision
+	Diagnostic TieredDiagnostic
+	Tiers      []TierEvaluation
+}
+
+// Evaluate makes the same decision as IsAuthorized, without metrics or
+// tracing, and also evaluates the stores after the store that decided the
+// request.
+func (s TieredPolicyStores) Evaluate(ctx context.Context, entities cedartypes.EntityMap, req cedar.Request) (Evaluation, error) {
+	tiers := make([]TierEvaluation, len(s))
+	for i, store := range s {
+		if err := ctx.Err(); err != nil {
+			return Evaluation{}, fmt.Errorf("evaluation stopped before policy store %s: %w", store.Name(), err)
+		}
+		options := TierOptionsOf(store)
+		decision, diagnostic := tierIsAuthorized(store, options, entities, req)
+		tiers[i] = TierEvaluation{Store: store, Options: options, Decision: decision, Diagnostic: diagnostic}
+	}
+	decision, diagnostic, err := s.combineTiers(ctx, func(i int, _ PolicyStore, _ TierOptions) (cedar.Decision, cedar.Diagnostic) {
+		tiers[i].Reached = true
+		return tiers[i].Decision, tiers[i].Diagnostic
+	})
+	if err != nil {
+		return Evaluation{}, err
+	}
+	return Evaluation{Decision: decision, Diagnostic: diagnostic, Tiers: tiers}, nil
+}
+
+// evaluateTier evaluates the enforced policies of a single store in its own span
+func evaluateTier(ctx context.Context, store PolicyStore, options TierOptions, entities cedartypes.EntityMap, req cedar.Request) (cedar.Decision, cedar.Diagnostic) {
+	ctx, span := tracing.Start(ctx, "EvaluatePolicyStore", tracing.StoreKey.String(store.Name()))
+	defer span.End()
+	start := time.Now()
+	decision, diagnostic := tierIsAuthorized(store, options, entities, req)
+	metrics.RecordStoreEvaluationLatency(ctx, store.Name(), time.Since(start).Seconds())
+	span.SetAttributes(tracing.Decision(decision), tracing.Policies(diagnostic.Reasons))
+	if len(diagnostic.Errors) > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d policy evaluation errors", len(diagnostic.Errors)))
 	}
 	return decision, diagnostic
 }
+
+// tierIsAuthorized evaluates the enforced policies of a single store.
+// Permit policies are ignored in a forbidOnly store.
+func tierIsAuthorized(store PolicyStore, options TierOptions, entities cedartypes.EntityMap, req cedar.Request) (cedar.Decision, cedar.Diagnostic) {
+	decision, diagnostic := store.PolicySet().IsAuthorized(entities, req)
+	if decision == cedar.Allow && options.Combining == v1alpha1.CombiningForbidOnly {
+		decision, diagnostic.Reasons = cedar.Deny, nil
+	}
+	return decision, diagnostic
+}
+
+// recordDecision counts the store that decided a request, or none if store is
+// nil, and the policies that determined the decision. They are also added to
+// the span in ctx.
+func recordDecision(ctx context.Context, store PolicyStore, decision cedar.Decision, reasons []cedar.DiagnosticReason) {
+	name := "none"
+	if store != nil {
+		name = store.Name()
+	}
+	trace.SpanFromContext(ctx).SetAttributes(tracing.StoreKey.String(name), tracing.Decision(decision), tracing.Policies(reasons))
+	decisionLabel := "Deny"
+	if decision == cedar.Allow {
+		decisionLabel = "Allow"
+	}
+	metrics.RecordTierDecision(ctx, name, decisionLabel)
+	for _, reason := range reasons {
+		metrics.RecordPolicyDetermining(ctx, name, string(reason.PolicyID))
+	}
+}
+
+// Generations returns the generation of each store, in tier order
+func (s TieredPolicyStores) Generations() []uint64 {
+	resp := make([]uint64, len(s))
+	for i, store := range s {
+		resp[i] = store.Generation()
+	}
+	return resp
+}
+
+// HasAuditPolicies returns true if any store contains audit-only policies.
+// It checks the audit policy count each store recorded when its policies were
+// loaded, so it's cheap enough to call for every request.
+func (s TieredPolicyStores) HasAuditPolicies() bool {
+	for _, store := range s {
+		if store.Status().AuditPolicyCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditIsAuthorized evaluates the request as if every store's audit policies were enforced.
+//
+// The enforced and audit policies of each store are evaluated together, and
+// combined across stores with the same combining algorithms and onError modes
+// as IsAuthorized. It returns the resulting decision and a diagnostic containing
+// only the audit policies that determined that decision, along with any errors
+// from audit policies. When the returned diagnostic is empty, audit policies
+// had no effect on the request.
+func (s TieredPolicyStores) AuditIsAuthorized(entities cedartypes.EntityMap, req cedar.Request) (cedar.Decision, TieredDiagnostic) {
+	resp := TieredDiagnostic{Tier: -1}
+	decision, diagnostic, _ := s.combineTiers(context.Background(), func(i int, store PolicyStore, options TierOptions) (cedar.Decision, cedar.Diagnostic) {
+		decision, diagnostic, tierAuditErrors := auditTierIsAuthorized(store, options, entities, req)
+		resp.Errors = append(resp.Errors, tierAuditErrors...)
+		for range tierAuditErrors {
+			resp.ErrorTiers = append(resp.ErrorTiers, i)
+		}
+		return decision, diagnostic
+	})
+	decidingStore := s.tier(diagnostic.Tier)
+	if decidingStore == nil {
+		return decision, resp
+	}
+	auditPolicies := decidingStore.AuditPolicySet()
+	for _, reason := range diagnostic.Reasons {
+		if auditPolicies != nil && auditPolicies.Get(reason.PolicyID) != nil {
+			resp.Reasons = append(resp.Reasons, reason)
+		}
+	}
+	if len(resp.Reasons) > 0 {
+		resp.Tier = diagnostic.Tier
+	}
+	return decision, resp
+}
+
+// Warnings evaluates the warn policies of every store, and returns the warn
+// forbid policies that apply to the request, and any errors from warn policies.
+// Unlike enforced policies, warn policies in every tier are evaluated, and they
+// never change a decision.
+func (s TieredPolicyStores) Warnings(entities cedartypes.EntityMap, req cedar.Request) ([]PolicyReason, []cedar.DiagnosticError) {
+	var (
+		resp   []PolicyReason
+		errors []cedar.DiagnosticError
+	)
+	for _, store := range s {
+		warnPolicies := store.WarnPolicySet()
+		if warnPolicies == nil || len(warnPolicies.Map()) == 0 {
+			continue
+		}
+		decision, diagnostic := warnPolicies.IsAuthorized(entities, req)
+		errors = append(errors, diagnostic.Errors...)
+		if decision == cedar.Allow {
+			// only permit policies applied
+			continue
+		}
+		for _, reason := range diagnostic.Reasons {
+			policyReason, ok := store.PolicyReason(reason.PolicyID)
+			if !ok {
+				policyReason = PolicyReason{PolicyID: reason.PolicyID, Source: fmt.Sprintf("policy %s", reason.PolicyID)}
+			}
+			resp = append(resp, policyReason)
+		}
+	}
+	return resp, errors
+}
+
+// auditTierIsAuthorized evaluates the enforced and audit policies of a single
+// store together, as if the audit policies were enforced. Permit policies are
+// ignored in a forbidOnly store. The errors from audit policies are also
+// returned on their own.
+func auditTierIsAuthorized(store PolicyStore, options TierOptions, entities cedartypes.EntityMap, req cedar.Request) (cedar.Decision, cedar.Diagnostic, []cedar.DiagnosticError) {
+	decision, diagnostic := store.PolicySet().IsAuthorized(entities, req)
+	auditPolicies := store.AuditPolicySet()
+	if auditPolicies == nil {
+		auditPolicies = cedar.NewPolicySet()
+	}
+	auditDecision, auditDiagnostic := auditPolicies.IsAuthorized(entities, req)
+
+	resp := cedar.Diagnostic{Errors: append(diagnostic.Errors, auditDiagnostic.Errors...)}
+	enforcedForbid := decision == cedar.Deny && len(diagnostic.Reasons) > 0
+	auditForbid := auditDecision == cedar.Deny && len(auditDiagnostic.Reasons) > 0
+	switch {
+	case enforcedForbid || auditForbid:
+		// a forbid in either policy set overrides every permit
+		decision = cedar.Deny
+		if enforcedForbid {
+			resp.Reasons = append(resp.Reasons, diagnostic.Reasons...)
+		}
+		if auditForbid {
+			resp.Reasons = append(resp.Reasons, auditDiagnostic.Reasons...)
+		}
+	case decision == cedar.Allow || auditDecision == cedar.Allow:
+		decision = cedar.Allow
+		resp.Reasons = append(diagnostic.Reasons, auditDiagnostic.Reasons...)
+	default:
+		decision = cedar.Deny
+	}
+	if decision == cedar.Allow && options.Combining == v1alpha1.CombiningForbidOnly {
+		decision, resp.Reasons = cedar.Deny, nil
+	}
+	return decision, resp, auditDiagnostic.Errors
+}
@@ -1,13 +1,22 @@
 package store_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
 	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/tracing"
 	"github.com/cedar-policy/cedar-go"
 	cedartypes "github.com/cedar-policy/cedar-go/types"
 	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func NewStoreFromPolicy(policy string) store.PolicyStore {
@@ -164,13 +173,16 @@ func TestTieredIsAuthorized(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 
-			decision, diagnostic := tc.stores.IsAuthorized(entities, tc.req)
+			decision, diagnostic, err := tc.stores.IsAuthorized(context.Background(), entities, tc.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 
 			if decision != tc.want {
 				t.Fatalf("got %v, want %v", decision, tc.want)
 			}
 
-			gotDiag, err := json.MarshalIndent(diagnostic, "", "  ")
+			gotDiag, err := json.MarshalIndent(diagnostic.Diagnostic, "", "  ")
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -186,3 +198,663 @@ func TestTieredIsAuthorized(t *testing.T) {
 	}
 
 }
+
+// testEntities are the entities of the tiered store tests
+var testEntities = cedartypes.EntityMap{
+	cedartypes.EntityUID{
+		Type: "k8s::User",
+		ID:   "alice",
+	}: cedar.Entity{
+		UID: cedartypes.EntityUID{
+			Type: "k8s::User",
+			ID:   "alice",
+		},
+		Attributes: cedartypes.NewRecord(map[cedartypes.String]cedartypes.Value{
+			"name": cedartypes.String("alice"),
+		}),
+		Parents: cedartypes.NewEntityUIDSet(
+			cedartypes.EntityUID{
+				Type: "k8s::Group",
+				ID:   "admin",
+			},
+		),
+	},
+	cedartypes.EntityUID{
+		Type: "k8s::Group",
+		ID:   "admin",
+	}: cedar.Entity{
+		UID: cedartypes.EntityUID{
+			Type: "k8s::Group",
+			ID:   "admin",
+		},
+		Attributes: cedartypes.NewRecord(map[cedartypes.String]cedartypes.Value{
+			"name": cedartypes.String("admin"),
+		}),
+	},
+	cedartypes.EntityUID{
+		Type: "k8s::Resource",
+		ID:   "/api/v1/namespaces/default/configmaps/cm1",
+	}: cedar.Entity{
+		UID: cedartypes.EntityUID{
+			Type: "k8s::Resource",
+			ID:   "/api/v1/namespaces/default/configmaps/cm1",
+		},
+		Attributes: cedartypes.NewRecord(map[cedartypes.String]cedartypes.Value{
+			"name":      cedartypes.String("cm1"),
+			"namespace": cedartypes.String("default"),
+			"apiGroup":  cedartypes.String(""),
+			"resource":  cedartypes.String("configmaps"),
+		}),
+	},
+}
+
+func TestTieredCombining(t *testing.T) {
+	tier := func(name, policy, combining, onError string) store.PolicyStore {
+		mStore, err := store.NewMemoryStore(name, []byte(policy), true)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		return store.WithTierOptions(mStore, store.TierOptions{Combining: combining, OnError: onError})
+	}
+	const (
+		permitAll    = `permit(principal, action, resource);`
+		forbidAdmins = `forbid(principal in k8s::Group::"admin", action, resource);`
+		noMatch      = `forbid(principal, action == k8s::Action::"list", resource);`
+		// alice has no department attribute, so this policy always has an error
+		permitError = `permit(principal, action, resource) when { principal.department == "sre" };`
+	)
+	req := cedartypes.Request{
+		Principal: cedartypes.NewEntityUID("k8s::User", "alice"),
+		Action:    cedartypes.NewEntityUID("k8s::Action", "get"),
+		Resource:  cedartypes.NewEntityUID("k8s::Resource", "/api/v1/namespaces/default/configmaps/cm1"),
+	}
+
+	cases := []struct {
+		name        string
+		stores      store.TieredPolicyStores
+		want        cedar.Decision
+		wantReasons []string
+		wantErrors  int
+	}{
+		{
+			name: "firstApplicable permit masks a later forbid",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningFirstApplicable, ""),
+				tier("second", forbidAdmins, "", ""),
+			},
+			want:        cedar.Allow,
+			wantReasons: []string{"first"},
+		},
+		{
+			name: "denyOverrides permit is overridden by a later forbid",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningDenyOverrides, ""),
+				tier("second", noMatch, "", ""),
+				tier("third", forbidAdmins, "", ""),
+			},
+			want:        cedar.Deny,
+			wantReasons: []string{"third"},
+		},
+		{
+			name: "denyOverrides permit allows when no later policy applies",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningDenyOverrides, ""),
+				tier("second", noMatch, "", ""),
+			},
+			want:        cedar.Allow,
+			wantReasons: []string{"first"},
+		},
+		{
+			name: "denyOverrides permit stops at a later firstApplicable permit",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningDenyOverrides, ""),
+				tier("second", permitAll, "", ""),
+				tier("third", forbidAdmins, "", ""),
+			},
+			want:        cedar.Allow,
+			wantReasons: []string{"second"},
+		},
+		{
+			name: "forbidOnly tier ignores permits",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningForbidOnly, ""),
+				tier("second", noMatch, "", ""),
+			},
+			want: cedar.Deny,
+		},
+		{
+			name: "forbidOnly tier denies",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll+forbidAdmins, v1alpha1.CombiningForbidOnly, ""),
+				tier("second", permitAll, "", ""),
+			},
+			want:        cedar.Deny,
+			wantReasons: []string{"first"},
+		},
+		{
+			name: "forbidOnly tier continues to later tiers",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningForbidOnly, ""),
+				tier("second", permitAll, "", ""),
+			},
+			want:        cedar.Allow,
+			wantReasons: []string{"second"},
+		},
+		{
+			name: "onError noOpinion stops evaluation",
+			stores: store.TieredPolicyStores{
+				tier("first", permitError, "", v1alpha1.OnErrorNoOpinion),
+				tier("second", permitAll, "", ""),
+			},
+			want:       cedar.Deny,
+			wantErrors: 1,
+		},
+		{
+			name: "onError noOpinion returns forbids in the same tier",
+			stores: store.TieredPolicyStores{
+				tier("first", permitError+forbidAdmins, "", ""),
+				tier("second", permitAll, "", ""),
+			},
+			want:        cedar.Deny,
+			wantReasons: []string{"first"},
+			wantErrors:  1,
+		},
+		{
+			name: "onError skip continues to later tiers",
+			stores: store.TieredPolicyStores{
+				tier("first", permitError, "", v1alpha1.OnErrorSkip),
+				tier("second", permitAll, "", ""),
+			},
+			want:        cedar.Allow,
+			wantReasons: []string{"second"},
+			wantErrors:  1,
+		},
+		{
+			name: "onError deny denies with the policies with errors",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll+permitError, "", v1alpha1.OnErrorDeny),
+				tier("second", permitAll, "", ""),
+			},
+			want:        cedar.Deny,
+			wantReasons: []string{"first"},
+			wantErrors:  1,
+		},
+		{
+			name: "onError deny overrides a pending denyOverrides permit",
+			stores: store.TieredPolicyStores{
+				tier("first", permitAll, v1alpha1.CombiningDenyOverrides, ""),
+				tier("second", permitError, "", v1alpha1.OnErrorDeny),
+			},
+			want:        cedar.Deny,
+			wantReasons: []string{"second"},
+			wantErrors:  1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, diagnostic, err := tc.stores.IsAuthorized(context.Background(), testEntities, req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if decision != tc.want {
+				t.Errorf("got %v, want %v", decision, tc.want)
+			}
+			var gotReasons []string
+			for _, reason := range diagnostic.Reasons {
+				gotReasons = append(gotReasons, reason.Position.Filename)
+			}
+			if diff := cmp.Diff(tc.wantReasons, gotReasons); diff != "" {
+				t.Errorf("reasons mismatch (-want +got):\n%s", diff)
+			}
+			if len(diagnostic.Errors) != tc.wantErrors {
+				t.Errorf("got %d errors, want %d: %v", len(diagnostic.Errors), tc.wantErrors, diagnostic.Errors)
+			}
+
+			evaluation, err := tc.stores.Evaluate(context.Background(), testEntities, req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if evaluation.Decision != decision {
+				t.Errorf("Evaluate got %v, IsAuthorized got %v", evaluation.Decision, decision)
+			}
+			if diff := cmp.Diff(diagnostic, evaluation.Diagnostic); diff != "" {
+				t.Errorf("Evaluate diagnostic mismatch (-IsAuthorized +Evaluate):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTieredEvaluate(t *testing.T) {
+	tier := func(name, policy, combining string) store.PolicyStore {
+		mStore, err := store.NewMemoryStore(name, []byte(policy), true)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		return store.WithTierOptions(mStore, store.TierOptions{Combining: combining})
+	}
+	req := cedartypes.Request{
+		Principal: cedartypes.NewEntityUID("k8s::User", "alice"),
+		Action:    cedartypes.NewEntityUID("k8s::Action", "get"),
+		Resource:  cedartypes.NewEntityUID("k8s::Resource", "/api/v1/namespaces/default/configmaps/cm1"),
+	}
+	stores := store.TieredPolicyStores{
+		tier("first", `forbid(principal, action == k8s::Action::"list", resource);`, ""),
+		tier("second", `permit(principal, action, resource);`, v1alpha1.CombiningForbidOnly),
+		tier("third", `permit(principal, action, resource);`, ""),
+		tier("fourth", `forbid(principal in k8s::Group::"admin", action, resource);`, ""),
+	}
+
+	evaluation, err := stores.Evaluate(context.Background(), testEntities, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evaluation.Decision != cedar.Allow || len(evaluation.Diagnostic.Reasons) != 1 {
+		t.Errorf("Expected Allow with one reason, got %v %v", evaluation.Decision, evaluation.Diagnostic.Reasons)
+	}
+	type tierResult struct {
+		Store     string
+		Combining string
+		Reached   bool
+		Decision  cedar.Decision
+		Reasons   int
+	}
+	var got []tierResult
+	for _, tier := range evaluation.Tiers {
+		got = append(got, tierResult{
+			Store:     tier.Store.Name(),
+			Combining: tier.Options.Combining,
+			Reached:   tier.Reached,
+			Decision:  tier.Decision,
+			Reasons:   len(tier.Diagnostic.Reasons),
+		})
+	}
+	want := []tierResult{
+		{Store: "first", Combining: v1alpha1.CombiningFirstApplicable, Reached: true, Decision: cedar.Deny},
+		// forbidOnly ignores the permit
+		{Store: "second", Combining: v1alpha1.CombiningForbidOnly, Reached: true, Decision: cedar.Deny},
+		{Store: "third", Combining: v1alpha1.CombiningFirstApplicable, Reached: true, Decision: cedar.Allow, Reasons: 1},
+		// evaluated, but after the request was decided
+		{Store: "fourth", Combining: v1alpha1.CombiningFirstApplicable, Reached: false, Decision: cedar.Deny, Reasons: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("tiers mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTieredIsAuthorizedCanceled(t *testing.T) {
+	req := cedartypes.Request{
+		Principal: cedartypes.NewEntityUID("k8s::User", "alice"),
+		Action:    cedartypes.NewEntityUID("k8s::Action", "get"),
+		Resource:  cedartypes.NewEntityUID("k8s::Resource", "/api/v1/namespaces/default/configmaps/cm1"),
+	}
+	stores := store.TieredPolicyStores{NewStoreFromPolicy(`permit(principal, action, resource);`)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	decision, diagnostic, err := stores.IsAuthorized(ctx, testEntities, req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded error, got %v", err)
+	}
+	if decision != cedar.Deny || len(diagnostic.Reasons) > 0 {
+		t.Errorf("expected Deny with no reasons, got %v %v", decision, diagnostic.Reasons)
+	}
+}
+
+func TestTieredIsAuthorizedPolicyIDCollision(t *testing.T) {
+	req := cedartypes.Request{
+		Principal: cedartypes.NewEntityUID("k8s::User", "alice"),
+		Action:    cedartypes.NewEntityUID("k8s::Action", "get"),
+		Resource:  cedartypes.NewEntityUID("k8s::Resource", "/api/v1/namespaces/default/configmaps/cm1"),
+	}
+	// both stores name their first policy policy0
+	first, err := store.NewMemoryStore("first", []byte(`@reason("bob is blocked") forbid(principal == k8s::User::"bob", action, resource);`), true)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	second, err := store.NewMemoryStore("second", []byte(`@reason("everyone is allowed") permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	stores := store.TieredPolicyStores{first, second}
+
+	decision, diagnostic, err := stores.IsAuthorized(context.Background(), testEntities, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision != cedar.Allow || diagnostic.DecidingTier() != 1 {
+		t.Fatalf("expected Allow by tier 1, got %v by tier %d", decision, diagnostic.DecidingTier())
+	}
+	if got := stores.DecidingStore(diagnostic); got != "second" {
+		t.Errorf("expected deciding store second, got %q", got)
+	}
+	reasons := stores.Reasons(diagnostic)
+	if len(reasons) != 1 || reasons[0].Message != "everyone is allowed" {
+		t.Errorf("expected the reason of the second store's policy, got %v", reasons)
+	}
+}
+
+func TestTieredIsAuthorizedTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	req := cedartypes.Request{
+		Principal: cedartypes.NewEntityUID("k8s::User", "alice"),
+		Action:    cedartypes.NewEntityUID("k8s::Action", "get"),
+		Resource:  cedartypes.NewEntityUID("k8s::Resource", "/api/v1/namespaces/default/configmaps/cm1"),
+	}
+	first, err := store.NewMemoryStore("first", []byte(`forbid(principal == k8s::User::"bob", action, resource);`), true)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	second, err := store.NewMemoryStore("second", []byte(`permit(principal, action, resource);`), true)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	_, diagnostic, err := store.TieredPolicyStores{first, second}.IsAuthorized(context.Background(), testEntities, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policies := store.DiagnosticPolicyIDs(diagnostic.Diagnostic)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	got := map[string]map[attribute.Key]attribute.Value{}
+	for _, span := range spans {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, attr := range span.Attributes {
+			attrs[attr.Key] = attr.Value
+		}
+		name := span.Name
+		if store, ok := attrs[tracing.StoreKey]; ok && span.Name == "EvaluatePolicyStore" {
+			name += "/" + store.AsString()
+		}
+		got[name] = attrs
+	}
+	want := map[string]map[attribute.Key]attribute.Value{
+		"EvaluatePolicyStore/first": {
+			tracing.StoreKey:    attribute.StringValue("first"),
+			tracing.DecisionKey: attribute.StringValue("Deny"),
+			tracing.PoliciesKey: attribute.StringSliceValue([]string{}),
+		},
+		"EvaluatePolicyStore/second": {
+			tracing.StoreKey:    attribute.StringValue("second"),
+			tracing.DecisionKey: attribute.StringValue("Allow"),
+			tracing.PoliciesKey: attribute.StringSliceValue(policies),
+		},
+		"IsAuthorized": {
+			tracing.StoreKey:    attribute.StringValue("second"),
+			tracing.DecisionKey: attribute.StringValue("Allow"),
+			tracing.PoliciesKey: attribute.StringSliceValue(policies),
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b attribute.Value) bool { return a.Emit() == b.Emit() })); diff != "" {
+		t.Errorf("unexpected span attributes (-want +got):\n%s", diff)
+	}
+	for _, span := range spans {
+		if span.Name != "IsAuthorized" && span.Parent.SpanID() != spans[len(spans)-1].SpanContext.SpanID() {
+			t.Errorf("expected span %s to be a child of IsAuthorized", span.Name)
+		}
+	}
+}
+
+func TestAuditIsAuthorized(t *testing.T) {
+	req := cedartypes.Request{
+		Principal: cedartypes.EntityUID{Type: "k8s::User", ID: "alice"},
+		Action:    cedartypes.EntityUID{Type: "k8s::Action", ID: "get"},
+		Resource:  cedartypes.EntityUID{Type: "k8s::Resource", ID: "/api/v1/namespaces/default/configmaps/cm1"},
+	}
+
+	cases := []struct {
+		name          string
+		stores        store.TieredPolicyStores
+		want          cedar.Decision
+		wantAudit     cedar.Decision
+		wantAuditIDs  []string
+		wantHasAudits bool
+	}{
+		{
+			name: "no audit policies",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`permit(principal in k8s::Group::"admin", action, resource);`),
+			},
+			want:         cedar.Allow,
+			wantAudit:    cedar.Allow,
+			wantAuditIDs: []string{},
+		},
+		{
+			name: "audit forbid would deny",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`
+				permit(principal in k8s::Group::"admin", action, resource);
+				@enforcement("audit")
+				forbid(principal, action, resource is k8s::Resource) when { resource.resource == "configmaps" };`),
+			},
+			want:          cedar.Allow,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{"policy1"},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit permit would allow",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`@enforcement("audit") permit(principal, action, resource);`),
+			},
+			want:          cedar.Deny,
+			wantAudit:     cedar.Allow,
+			wantAuditIDs:  []string{"policy0"},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit permit in later tier is masked by an earlier explicit decision",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`forbid(principal in k8s::Group::"admin", action, resource);`),
+				NewStoreFromPolicy(`@enforcement("audit") permit(principal, action, resource);`),
+			},
+			want:          cedar.Deny,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit forbid in earlier tier would override later permit",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`@enforcement("audit") forbid(principal, action, resource);`),
+				NewStoreFromPolicy(`permit(principal, action, resource);`),
+			},
+			want:          cedar.Allow,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{"policy0"},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit forbid in a later tier overrides a denyOverrides permit",
+			stores: store.TieredPolicyStores{
+				store.WithTierOptions(NewStoreFromPolicy(`permit(principal, action, resource);`), store.TierOptions{Combining: v1alpha1.CombiningDenyOverrides}),
+				NewStoreFromPolicy(`@enforcement("audit") forbid(principal in k8s::Group::"admin", action, resource);`),
+			},
+			want:          cedar.Allow,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{"policy0"},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit denyOverrides permit is overridden by a later forbid",
+			stores: store.TieredPolicyStores{
+				store.WithTierOptions(NewStoreFromPolicy(`@enforcement("audit") permit(principal, action, resource);`), store.TierOptions{Combining: v1alpha1.CombiningDenyOverrides}),
+				NewStoreFromPolicy(`forbid(principal in k8s::Group::"admin", action, resource);`),
+			},
+			want:          cedar.Deny,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit permit in a forbidOnly tier is ignored",
+			stores: store.TieredPolicyStores{
+				store.WithTierOptions(NewStoreFromPolicy(`@enforcement("audit") permit(principal, action, resource);`), store.TierOptions{Combining: v1alpha1.CombiningForbidOnly}),
+				NewStoreFromPolicy(`forbid(principal, action == k8s::Action::"list", resource);`),
+			},
+			want:          cedar.Deny,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{},
+			wantHasAudits: true,
+		},
+		{
+			name: "audit policy error in an onError deny tier would deny",
+			stores: store.TieredPolicyStores{
+				store.WithTierOptions(NewStoreFromPolicy(`
+				permit(principal, action, resource);
+				@enforcement("audit")
+				permit(principal, action, resource) when { principal.department == "sre" };`), store.TierOptions{OnError: v1alpha1.OnErrorDeny}),
+			},
+			want:          cedar.Allow,
+			wantAudit:     cedar.Deny,
+			wantAuditIDs:  []string{"policy1"},
+			wantHasAudits: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.stores.HasAuditPolicies(); got != tc.wantHasAudits {
+				t.Errorf("HasAuditPolicies() = %v, want %v", got, tc.wantHasAudits)
+			}
+
+			decision, _, _ := tc.stores.IsAuthorized(context.Background(), testEntities, req)
+			if decision != tc.want {
+				t.Errorf("IsAuthorized() = %v, want %v", decision, tc.want)
+			}
+
+			auditDecision, auditDiagnostic := tc.stores.AuditIsAuthorized(testEntities, req)
+			if auditDecision != tc.wantAudit {
+				t.Errorf("AuditIsAuthorized() = %v, want %v", auditDecision, tc.wantAudit)
+			}
+			if diff := cmp.Diff(tc.wantAuditIDs, store.DiagnosticPolicyIDs(auditDiagnostic.Diagnostic)); diff != "" {
+				t.Errorf("audit policy IDs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	req := cedartypes.Request{
+		Principal: cedartypes.EntityUID{Type: "k8s::User", ID: "alice"},
+		Action:    cedartypes.EntityUID{Type: "k8s::Action", ID: "get"},
+		Resource:  cedartypes.EntityUID{Type: "k8s::Resource", ID: "/api/v1/namespaces/default/configmaps/cm1"},
+	}
+
+	cases := []struct {
+		name         string
+		stores       store.TieredPolicyStores
+		want         cedar.Decision
+		wantWarnings []store.PolicyReason
+		wantErrors   int
+	}{
+		{
+			name: "no warn policies",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`permit(principal in k8s::Group::"admin", action, resource);`),
+			},
+			want: cedar.Allow,
+		},
+		{
+			name: "warn forbid applies",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`
+				permit(principal in k8s::Group::"admin", action, resource);
+				@effect("warn")
+				@reason("configmaps are deprecated")
+				forbid(principal, action, resource is k8s::Resource) when { resource.resource == "configmaps" };`),
+			},
+			want: cedar.Allow,
+			wantWarnings: []store.PolicyReason{
+				{PolicyID: "policy1", Source: "in-memory-test-store.cedar, policy1", Message: "configmaps are deprecated"},
+			},
+		},
+		{
+			name: "warn enforcement annotation",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`
+				permit(principal, action, resource);
+				@enforcement("warn")
+				forbid(principal, action, resource);`),
+			},
+			want: cedar.Allow,
+			wantWarnings: []store.PolicyReason{
+				{PolicyID: "policy1", Source: "in-memory-test-store.cedar, policy1"},
+			},
+		},
+		{
+			name: "warn forbid doesn't apply",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`
+				permit(principal, action, resource);
+				@effect("warn")
+				forbid(principal, action, resource is k8s::Resource) when { resource.resource == "secrets" };`),
+			},
+			want: cedar.Allow,
+		},
+		{
+			name: "warn permit is ignored",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`@effect("warn") permit(principal, action, resource);`),
+			},
+			want: cedar.Deny,
+		},
+		{
+			name: "warn forbid in a later tier",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`permit(principal, action, resource);`),
+				NewStoreFromPolicy(`@effect("warn") forbid(principal, action, resource);`),
+			},
+			want: cedar.Allow,
+			wantWarnings: []store.PolicyReason{
+				{PolicyID: "policy0", Source: "in-memory-test-store.cedar, policy0"},
+			},
+		},
+		{
+			name: "audit takes precedence over warn",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`
+				permit(principal, action, resource);
+				@enforcement("audit")
+				@effect("warn")
+				forbid(principal, action, resource);`),
+			},
+			want: cedar.Allow,
+		},
+		{
+			name: "warn policy error",
+			stores: store.TieredPolicyStores{
+				NewStoreFromPolicy(`
+				permit(principal, action, resource);
+				@effect("warn")
+				forbid(principal, action, resource) when { resource.missing == "value" };`),
+			},
+			want:       cedar.Allow,
+			wantErrors: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, _, _ := tc.stores.IsAuthorized(context.Background(), testEntities, req)
+			if decision != tc.want {
+				t.Errorf("IsAuthorized() = %v, want %v", decision, tc.want)
+			}
+
+			warnings, warnErrors := tc.stores.Warnings(testEntities, req)
+			if diff := cmp.Diff(tc.wantWarnings, warnings); diff != "" {
+				t.Errorf("Warnings() mismatch (-want +got):\n%s", diff)
+			}
+			if len(warnErrors) != tc.wantErrors {
+				t.Errorf("Expected %d warn policy errors, got %v", tc.wantErrors, warnErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"github.com/awslabs/cedar-access-control-for-k8s/api/v1alpha1"
+	"github.com/cedar-policy/cedar-go"
+)
+
+// TierOptions configures how a policy store's decision is combined with the
+// decisions of other tiers
+type TierOptions struct {
+	// Combining is one of the v1alpha1.Combining* algorithms. Defaults to firstApplicable.
+	Combining string
+	// OnError is one of the v1alpha1.OnError* modes. Defaults to noOpinion.
+	OnError string
+}
+
+type tierStore struct {
+	PolicyStore
+	options TierOptions
+}
+
+// WithTierOptions returns a PolicyStore that is combined with other tiers using the options
+func WithTierOptions(store PolicyStore, options TierOptions) PolicyStore {
+	if options == (TierOptions{}) {
+		return store
+	}
+	return &tierStore{PolicyStore: store, options: options}
+}
+
+// TierOptionsOf returns the options of a store, with defaults for unset options
+func TierOptionsOf(store PolicyStore) TierOptions {
+	var options TierOptions
+	if t, ok := store.(*tierStore); ok {
+		options = t.options
+	}
+	if options.Combining == "" {
+		options.Combining = v1alpha1.CombiningFirstApplicable
+	}
+	if options.OnError == "" {
+		options.OnError = v1alpha1.OnErrorNoOpinion
+	}
+	return options
+}
+
+// errorReasons returns the policies with errors as reasons, for tiers that deny on error
+func errorReasons(errors []cedar.DiagnosticError) []cedar.DiagnosticReason {
+	resp := make([]cedar.DiagnosticReason, len(errors))
+	for i, diagnosticError := range errors {
+		resp[i] = cedar.DiagnosticReason{PolicyID: diagnosticError.PolicyID, Position: diagnosticError.Position}
+	}
+	return resp
+}
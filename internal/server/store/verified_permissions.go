@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -19,8 +20,14 @@ type VerifiedPermissionStore struct {
 	policyStoreID   string
 	refreshInterval time.Duration
 
-	policies   *cedar.PolicySet
-	policiesMu sync.RWMutex
+	policies      *cedar.PolicySet
+	auditPolicies *cedar.PolicySet
+	warnPolicies  *cedar.PolicySet
+	reasons       policyReasons
+	generation    uint64
+	policiesMu    sync.RWMutex
+	status        loadStatus
+	background
 }
 
 func NewVerifiedPermissionStore(cfg aws.Config, policyStoreID string, refreshInterval time.Duration) (PolicyStore, error) {
@@ -28,7 +35,9 @@ func NewVerifiedPermissionStore(cfg aws.Config, policyStoreID string, refreshInt
 		client:          avp.NewFromConfig(cfg),
 		policyStoreID:   policyStoreID,
 		refreshInterval: refreshInterval,
+		background:      newBackground(),
 	}
+	resp.status.store = resp.Name()
 	resp.loadPolicies()
 	go resp.reloadAsync()
 	return resp, nil
@@ -42,20 +51,56 @@ func (s *VerifiedPermissionStore) Name() string {
 	return fmt.Sprintf("VerifiedPermissionStore-%s", s.policyStoreID)
 }
 
+func (s *VerifiedPermissionStore) PolicyReason(id cedar.PolicyID) (PolicyReason, bool) {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	reason, ok := s.reasons[id]
+	return reason, ok
+}
+
+func (s *VerifiedPermissionStore) Status() StoreStatus {
+	return s.status.get()
+}
+
 func (s *VerifiedPermissionStore) PolicySet() *cedar.PolicySet {
 	s.policiesMu.RLock()
 	defer s.policiesMu.RUnlock()
 	return s.policies
 }
 
+func (s *VerifiedPermissionStore) AuditPolicySet() *cedar.PolicySet {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.auditPolicies
+}
+
+func (s *VerifiedPermissionStore) WarnPolicySet() *cedar.PolicySet {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.warnPolicies
+}
+
+func (s *VerifiedPermissionStore) Generation() uint64 {
+	s.policiesMu.RLock()
+	defer s.policiesMu.RUnlock()
+	return s.generation
+}
+
 func (s *VerifiedPermissionStore) reloadAsync() {
 	ticker := time.NewTicker(s.refreshInterval)
-	for range ticker.C {
-		s.loadPolicies()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.loadPolicies()
+		}
 	}
 }
 
 func (s *VerifiedPermissionStore) loadPolicies() {
+	start := time.Now()
 	paginator := avp.NewListPoliciesPaginator(s.client, &avp.ListPoliciesInput{
 		PolicyStoreId: aws.String(s.policyStoreID),
 		Filter: &avptypes.PolicyFilter{
@@ -68,10 +113,13 @@ func (s *VerifiedPermissionStore) loadPolicies() {
 	ctx := context.Background()
 
 	pSet := cedar.NewPolicySet()
+	reasons := policyReasons{}
+	var loadErrors []error
 	for paginator.HasMorePages() {
 		policies, err := paginator.NextPage(ctx)
 		if err != nil {
 			klog.ErrorS(err, "failed to load AVP policies", "policyStoreId", s.policyStoreID)
+			s.status.failed(start, fmt.Errorf("failed to list policies: %w", err))
 			return
 		}
 		for _, p := range policies.Policies {
@@ -81,6 +129,7 @@ func (s *VerifiedPermissionStore) loadPolicies() {
 			})
 			if err != nil {
 				klog.ErrorS(err, "failed to fetch AVP policy", "policyId", *p.PolicyId, "policyStoreId", s.policyStoreID)
+				loadErrors = append(loadErrors, fmt.Errorf("failed to fetch policy %s: %w", *p.PolicyId, err))
 				continue
 			}
 			staticPolicy := policy.Definition.(*avptypes.PolicyDefinitionDetailMemberStatic)
@@ -89,12 +138,20 @@ func (s *VerifiedPermissionStore) loadPolicies() {
 			pList, err := cedar.NewPolicyListFromBytes(*p.PolicyId, []byte(*statement))
 			if err != nil {
 				klog.ErrorS(err, "failed to parse Cedar policy", "policyId", *p.PolicyId, "policyStoreId", s.policyStoreID)
+				loadErrors = append(loadErrors, fmt.Errorf("failed to parse policy %s: %w", *p.PolicyId, err))
 				continue
 			}
 			for i, policyStatement := range pList {
-				pSet.Add(cedar.PolicyID(fmt.Sprintf("%s.%d", *p.PolicyId, i)), policyStatement)
+				policyID := cedar.PolicyID(fmt.Sprintf("%s.%d", *p.PolicyId, i))
+				pSet.Add(policyID, policyStatement)
+				reasons.add(policyID, fmt.Sprintf("Verified Permissions policy %s, policy %d", *p.PolicyId, i), policyStatement)
 			}
 		}
 	}
-	s.policies = pSet
+	enforced, audit, warn := SplitPolicySet(pSet)
+	if !policySetsEqual(s.policies, enforced) || !policySetsEqual(s.auditPolicies, audit) || !policySetsEqual(s.warnPolicies, warn) {
+		s.generation++
+	}
+	s.policies, s.auditPolicies, s.warnPolicies, s.reasons = enforced, audit, warn, reasons
+	s.status.loaded(start, policyCount(enforced, audit, warn), policyCount(audit), errors.Join(loadErrors...))
 }
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cedar-policy/cedar-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	componenttracing "k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+)
+
+const (
+	tracerName  = "github.com/awslabs/cedar-access-control-for-k8s"
+	serviceName = "cedar-webhook"
+)
+
+// Span attribute keys
+const (
+	// DecisionKey is the decision of a request or policy store
+	DecisionKey = attribute.Key("cedar.decision")
+	// PoliciesKey is the IDs of the policies that determined a decision
+	PoliciesKey = attribute.Key("cedar.determining_policies")
+	// StoreKey is the name of a policy store
+	StoreKey = attribute.Key("cedar.store")
+)
+
+// NewProvider creates an OTLP TracerProvider and sets it as the global
+// provider used by Start. Spans are only exported when a request's parent span
+// from the API server is sampled, or at the configured sampling rate.
+// A nil tracingConfig returns a no-op provider and leaves the global provider unset.
+func NewProvider(ctx context.Context, tracingConfig *tracingapi.TracingConfiguration) (componenttracing.TracerProvider, error) {
+	if tracingConfig == nil {
+		return componenttracing.NewNoopTracerProvider(), nil
+	}
+	tp, err := componenttracing.NewProvider(ctx, tracingConfig, nil, []resource.Option{
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tp)
+	return tp, nil
+}
+
+// WithTracing starts a span for each request to handler, continuing any trace
+// from the request's trace headers
+func WithTracing(handler http.Handler, spanName string) http.Handler {
+	return componenttracing.WithTracing(handler, otel.GetTracerProvider(), spanName)
+}
+
+// Start creates a span and a context containing it with the global TracerProvider
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.GetTracerProvider().Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Decision returns the attribute for a Cedar decision
+func Decision(decision cedar.Decision) attribute.KeyValue {
+	if decision == cedar.Allow {
+		return DecisionKey.String("Allow")
+	}
+	return DecisionKey.String("Deny")
+}
+
+// Policies returns the attribute for the policies that determined a decision
+func Policies(reasons []cedar.DiagnosticReason) attribute.KeyValue {
+	ids := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		ids = append(ids, string(reason.PolicyID))
+	}
+	return PoliciesKey.StringSlice(ids)
+}
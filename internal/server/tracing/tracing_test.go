@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestWithTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	handler := WithTracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "Authorize")
+		span.End()
+	}), "authorize")
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	resp.Body.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	// spans are exported as they end, so the handler's span is first
+	span, serverSpan := spans[0], spans[1]
+	if span.Name != "Authorize" || serverSpan.Name != "authorize" {
+		t.Fatalf("Expected Authorize and authorize spans, got %s and %s", span.Name, serverSpan.Name)
+	}
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	parentID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	if serverSpan.Parent.TraceID() != traceID || serverSpan.Parent.SpanID() != parentID {
+		t.Errorf("Expected the server span's parent to be the traceparent span, got %+v", serverSpan.Parent)
+	}
+	if span.Parent.SpanID() != serverSpan.SpanContext.SpanID() || span.SpanContext.TraceID() != traceID {
+		t.Errorf("Expected the Authorize span to be a child of the server span in trace %s, got %+v", traceID, span.Parent)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cedar-policy/cedar-go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	cedaradmission "github.com/awslabs/cedar-access-control-for-k8s/internal/server/admission"
+	cedarauthorizer "github.com/awslabs/cedar-access-control-for-k8s/internal/server/authorizer"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/config"
+	"github.com/awslabs/cedar-access-control-for-k8s/internal/server/store"
+)
+
+func TestWebhookTracePropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	policyStore, err := store.NewMemoryStore("policies.cedar", []byte(explainPolicies), true)
+	if err != nil {
+		t.Fatalf("Failed to create policy store: %v", err)
+	}
+	pset := cedar.NewPolicySet()
+	pset.Add("allow-all-admission", cedaradmission.AllowAllAdmissionPolicy())
+	authorizer := cedarauthorizer.NewAuthorizer(nil, cedarauthorizer.Options{}, policyStore)
+	handler := cedaradmission.NewHandler([]store.PolicyStore{policyStore, store.StaticStore(*pset)}, cedaradmission.Options{})
+	// the trace handlers use the global TracerProvider when the server is created
+	as := NewServer(authorizer, handler, &config.AuthorizationWebhookConfig{
+		ErrorInjection: &config.ErrorInjectionConfig{},
+		DebugOptions:   &config.DebugOptions{},
+	})
+	server := httptest.NewServer(as.GetHandler())
+	defer server.Close()
+
+	// the API server's span, sent in the traceparent header
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	parentID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	cases := []struct {
+		name       string
+		path       string
+		body       []byte
+		serverSpan string
+		span       string
+	}{
+		{
+			name:       "authorization",
+			path:       "/v1/authorize",
+			body:       explainSAR(t),
+			serverSpan: "authorize",
+			span:       "Authorize",
+		},
+		{
+			name:       "admission",
+			path:       "/v1/admit",
+			body:       explainAdmissionReview(t, "default"),
+			serverSpan: "admit",
+			span:       "Admit",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter.Reset()
+			req, err := http.NewRequest(http.MethodPost, server.URL+tc.path, bytes.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("traceparent", traceparent)
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+
+			spans := map[string]tracetest.SpanStub{}
+			names := []string{}
+			for _, span := range exporter.GetSpans() {
+				spans[span.Name] = span
+				names = append(names, span.Name)
+			}
+			serverSpan, ok := spans[tc.serverSpan]
+			if !ok {
+				t.Fatalf("Expected a %s span, got spans %v", tc.serverSpan, names)
+			}
+			if serverSpan.Parent.TraceID() != traceID || serverSpan.Parent.SpanID() != parentID || !serverSpan.Parent.IsRemote() {
+				t.Errorf("Expected the %s span's parent to be the traceparent span, got %+v", tc.serverSpan, serverSpan.Parent)
+			}
+			span, ok := spans[tc.span]
+			if !ok {
+				t.Fatalf("Expected a %s span, got spans %v", tc.span, names)
+			}
+			if span.SpanContext.TraceID() != traceID {
+				t.Errorf("Expected the %s span to continue trace %s, got %s", tc.span, traceID, span.SpanContext.TraceID())
+			}
+			if span.Parent.SpanID() != serverSpan.SpanContext.SpanID() {
+				t.Errorf("Expected the %s span's parent to be the %s span", tc.span, tc.serverSpan)
+			}
+		})
+	}
+}